@@ -0,0 +1,268 @@
+package main
+
+import (
+	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/envelope"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// 结果接收方工具
+//
+//	Consumer keygen   -dir consumer                 按会话参数生成接收方密钥对
+//	Consumer register -dir consumer -name model     向协调器登记接收方公钥
+//	Consumer decrypt  -dir consumer -result <ID>    获取并解密公钥切换后的结果
+//
+// 私钥只保存在本地，协调器和参与方只接触接收方公钥下的密文。
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = runKeygen(os.Args[2:])
+	case "register":
+		err = runRegister(os.Args[2:])
+	case "decrypt":
+		err = runDecrypt(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// 接收方目录中的文件
+const (
+	secretKeyFile  = "secret_key.bin"
+	publicKeyFile  = "public_key.b64"
+	consumerIDFile = "consumer_id"
+)
+
+// usage 打印用法
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  Consumer keygen   [-coordinator http://localhost:8060] [-session <协调器ID>] [-dir consumer] [-force]")
+	fmt.Fprintln(os.Stderr, "  Consumer register [-coordinator http://localhost:8060] [-session <协调器ID>] [-dir consumer] -name model")
+	fmt.Fprintln(os.Stderr, "  Consumer decrypt  [-coordinator http://localhost:8060] [-session <协调器ID>] [-dir consumer] -result <结果ID> [-slots 8]")
+}
+
+// runKeygen 按会话参数生成接收方密钥对
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	coordinatorURL := fs.String("coordinator", "http://localhost:8060", "协调器控制面地址")
+	session := fs.String("session", "", "会话的协调器ID（协调器只运行一个会话时可省略）")
+	dir := fs.String("dir", "consumer", "接收方密钥目录")
+	force := fs.Bool("force", false, "覆盖已存在的密钥")
+	fs.Parse(args)
+
+	skPath := filepath.Join(*dir, secretKeyFile)
+	if _, err := os.Stat(skPath); err == nil && !*force {
+		return fmt.Errorf("%s 中已存在接收方密钥，使用 -force 覆盖（之前的结果将无法解密）", *dir)
+	}
+
+	params, err := fetchParams(apiURL(*coordinatorURL, *session))
+	if err != nil {
+		return err
+	}
+	sk, pk := rlwe.NewKeyGenerator(params).GenKeyPairNew()
+
+	skBytes, err := sk.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("序列化私钥失败: %v", err)
+	}
+	// 公钥以信封形式保存和登记，绑定会话参数
+	pkB64, err := utils.EncodePublicKey(params, pk)
+	if err != nil {
+		return fmt.Errorf("序列化公钥失败: %v", err)
+	}
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(skPath, skBytes, 0600); err != nil {
+		return fmt.Errorf("保存私钥失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, publicKeyFile), []byte(pkB64), 0644); err != nil {
+		return fmt.Errorf("保存公钥失败: %v", err)
+	}
+	fmt.Printf("已生成接收方密钥对（LogN=%d），私钥: %s\n", params.LogN(), skPath)
+	fmt.Printf("公钥指纹: %s（参与方审批公钥切换任务时据此核对接收方公钥）\n", envelope.KeyFingerprint(pk).Hex())
+	return nil
+}
+
+// runRegister 向协调器登记接收方公钥
+func runRegister(args []string) error {
+	fs := flag.NewFlagSet("register", flag.ExitOnError)
+	coordinatorURL := fs.String("coordinator", "http://localhost:8060", "协调器控制面地址")
+	session := fs.String("session", "", "会话的协调器ID（协调器只运行一个会话时可省略）")
+	dir := fs.String("dir", "consumer", "接收方密钥目录")
+	name := fs.String("name", "", "接收方名称")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("需要通过 -name 指定接收方名称")
+	}
+	pkB64, err := os.ReadFile(filepath.Join(*dir, publicKeyFile))
+	if err != nil {
+		return fmt.Errorf("读取公钥失败（先运行 keygen）: %v", err)
+	}
+
+	reqBody, _ := json.Marshal(map[string]string{
+		"name":       *name,
+		"public_key": strings.TrimSpace(string(pkB64)),
+	})
+	resp, err := http.Post(apiURL(*coordinatorURL, *session)+"/consumers", "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var consumer struct {
+		ID string `json:"consumer_id"`
+	}
+	if err := decodeResponse(resp, &consumer); err != nil {
+		return fmt.Errorf("登记接收方失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, consumerIDFile), []byte(consumer.ID), 0644); err != nil {
+		return fmt.Errorf("保存接收方ID失败: %v", err)
+	}
+	fmt.Printf("已登记接收方 %s，接收方ID: %s\n", *name, consumer.ID)
+	return nil
+}
+
+// runDecrypt 获取并解密公钥切换后的结果
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	coordinatorURL := fs.String("coordinator", "http://localhost:8060", "协调器控制面地址")
+	session := fs.String("session", "", "会话的协调器ID（协调器只运行一个会话时可省略）")
+	dir := fs.String("dir", "consumer", "接收方密钥目录")
+	resultID := fs.String("result", "", "结果ID")
+	slots := fs.Int("slots", 8, "输出的槽位数")
+	fs.Parse(args)
+
+	if *resultID == "" {
+		return fmt.Errorf("需要通过 -result 指定结果ID")
+	}
+	params, err := fetchParams(apiURL(*coordinatorURL, *session))
+	if err != nil {
+		return err
+	}
+	skBytes, err := os.ReadFile(filepath.Join(*dir, secretKeyFile))
+	if err != nil {
+		return fmt.Errorf("读取私钥失败: %v", err)
+	}
+	sk := new(rlwe.SecretKey)
+	if err := sk.UnmarshalBinary(skBytes); err != nil {
+		return fmt.Errorf("反序列化私钥失败: %v", err)
+	}
+
+	resp, err := http.Get(apiURL(*coordinatorURL, *session) + "/results/" + *resultID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		ConsumerID string `json:"consumer_id"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := decodeResponse(resp, &result); err != nil {
+		return fmt.Errorf("获取结果失败: %v", err)
+	}
+	if id, err := os.ReadFile(filepath.Join(*dir, consumerIDFile)); err == nil && string(id) != result.ConsumerID {
+		return fmt.Errorf("结果属于接收方 %s，本地接收方为 %s", result.ConsumerID, id)
+	}
+
+	// 结果密文的信封须绑定本方公钥
+	pkB64, err := os.ReadFile(filepath.Join(*dir, publicKeyFile))
+	if err != nil {
+		return fmt.Errorf("读取公钥失败: %v", err)
+	}
+	pk, err := utils.DecodePublicKey(params, strings.TrimSpace(string(pkB64)))
+	if err != nil {
+		return fmt.Errorf("公钥校验失败: %v", err)
+	}
+	ct, err := utils.DecodeCiphertext(params, envelope.KeyFingerprint(pk), result.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("结果密文校验失败: %v", err)
+	}
+
+	pt := rlwe.NewDecryptor(params, sk).DecryptNew(ct)
+	values := make([]complex128, params.MaxSlots())
+	if err := ckks.NewEncoder(params).Decode(pt, values); err != nil {
+		return fmt.Errorf("解码失败: %v", err)
+	}
+	if *slots > len(values) {
+		*slots = len(values)
+	}
+	fmt.Printf("解密结果: ")
+	for i := 0; i < *slots; i++ {
+		fmt.Printf("%.4f ", real(values[i]))
+	}
+	fmt.Println()
+	return nil
+}
+
+// apiURL 会话控制面接口的基础地址，未指定会话时使用协调器唯一的会话
+func apiURL(coordinatorURL, session string) string {
+	if session == "" {
+		return coordinatorURL + "/api/coordinator"
+	}
+	return coordinatorURL + "/api/coordinator/sessions/" + session
+}
+
+// fetchParams 从会话控制面获取会话CKKS参数
+func fetchParams(baseURL string) (ckks.Parameters, error) {
+	resp, err := http.Get(baseURL + "/params")
+	if err != nil {
+		return ckks.Parameters{}, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		ParamsLiteral string `json:"params_literal"`
+	}
+	if err := decodeResponse(resp, &raw); err != nil {
+		return ckks.Parameters{}, fmt.Errorf("获取会话参数失败: %v", err)
+	}
+	paramsBytes, err := utils.DecodeFromBase64(raw.ParamsLiteral)
+	if err != nil {
+		return ckks.Parameters{}, fmt.Errorf("参数base64解码失败: %v", err)
+	}
+	var literal ckks.ParametersLiteral
+	if err := json.Unmarshal(paramsBytes, &literal); err != nil {
+		return ckks.Parameters{}, fmt.Errorf("参数JSON反序列化失败: %v", err)
+	}
+	return ckks.NewParametersFromLiteral(literal)
+}
+
+// decodeResponse 解析JSON响应，状态码非200时返回协调器给出的错误
+func decodeResponse(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &errResp)
+		return fmt.Errorf("状态码 %d %s", resp.StatusCode, errResp.Error)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -2,25 +2,133 @@ package main
 
 import (
 	"MPHEDev/pkg/core/coordinator/services"
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/wire"
+	"context"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// registerSessionRoutes 注册作用于单个会话的控制面接口
+func registerSessionRoutes(group *gin.RouterGroup) {
+	// 注册状态查询接口
+	group.GET("/status", services.GetCoordinatorStatusHandler)
+	// 注册密钥进度查询接口
+	group.GET("/key-progress", services.GetKeyProgressHandler)
+	// 注册追加旋转密钥接口
+	group.POST("/rotation-keys", services.AddRotationKeysHandler)
+	// 注册集体密钥轮换接口
+	group.POST("/key-rotation", services.StartKeyRotationHandler)
+	group.GET("/key-rotation", services.GetKeyRotationHandler)
+	// 成员变更：把候选成员加入集体密钥
+	group.POST("/members", services.AddMembersHandler)
+	group.GET("/members", services.GetMembersHandler)
+	// 注册结果接收方和公钥切换接口
+	group.GET("/params", services.GetCKKSParamsHandler)
+	group.POST("/consumers", services.RegisterConsumerHandler)
+	group.GET("/consumers", services.ListConsumersHandler)
+	group.POST("/reencrypt", services.ReencryptHandler)
+	group.GET("/results/:id", services.GetResultHandler)
+	// 注册解密任务授权接口
+	group.GET("/tasks", services.ListTasksHandler)
+	group.GET("/policy", services.GetPolicyHandler)
+	group.PUT("/policy", services.SetPolicyHandler)
+	group.POST("/computations/outputs", services.RegisterOutputsHandler)
+}
+
 func main() {
+	profilesPath := flag.String("param-profiles", "configs/ckks_profiles.json", "CKKS参数配置文件路径")
+	tlsCA := flag.String("tls-ca", "", "会话CA证书（启用mTLS时必填）")
+	tlsCert := flag.String("tls-cert", "", "协调器证书")
+	tlsKey := flag.String("tls-key", "", "协调器私钥")
+	stateDir := flag.String("state-dir", "state", "关闭时保存会话状态的目录（为空时不保存）")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "等待处理中请求完成的最长时间")
+	recoverSession := flag.Bool("recover", true, "启动时从状态目录恢复上一次运行的会话")
+	compression := flag.String("compression", "", "向参与方发送密钥和密文时的压缩编码（gzip/zstd，默认不压缩）")
+	flag.Parse()
+	services.SetParamProfilesPath(*profilesPath)
+	encoding, err := wire.ParseEncoding(*compression)
+	if err != nil {
+		panic(err)
+	}
+	services.SetWireEncoding(encoding)
+	services.SetStateDir(*stateDir)
+	if *stateDir != "" {
+		stateStore, err := store.NewFileStore(filepath.Join(*stateDir, "store"))
+		if err != nil {
+			panic(err)
+		}
+		defer stateStore.Close()
+		services.SetStateStore(stateStore)
+	}
+
+	tlsConfig, err := pki.Load(*tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		panic(err)
+	}
+	services.SetTLSConfig(tlsConfig)
+
+	// 协调器崩溃或重启后继续上一次运行的各个会话的密钥生成
+	if *recoverSession {
+		recovered, err := services.RecoverCoordinator()
+		if err != nil {
+			fmt.Printf("[警告] 恢复会话失败: %v\n", err)
+		}
+		if recovered > 0 {
+			fmt.Printf("已恢复 %d 个会话，参与方可继续上传密钥份额\n", recovered)
+		}
+	}
+
 	router := gin.Default()
 
-	// 注册初始化协调器的接口
+	// 注册初始化协调器的接口，每次初始化创建一个新会话
 	router.POST("/api/coordinator/init", services.InitHandler)
-	// 注册状态查询接口
-	router.GET("/api/coordinator/status", services.RequireCoordinator(), services.GetCoordinatorStatusHandler)
-	// 注册密钥进度查询接口
-	router.GET("/api/coordinator/key-progress", services.RequireCoordinator(), services.GetKeyProgressHandler)
+	// 注册参数配置档查询接口
+	router.GET("/api/coordinator/param-profiles", services.ListParamProfilesHandler)
+	// 会话管理：创建、列出、查看和关闭会话
+	router.POST("/api/coordinator/sessions", services.InitHandler)
+	router.GET("/api/coordinator/sessions", services.ListSessionsHandler)
+	router.GET("/api/coordinator/sessions/:session", services.RequireCoordinator(), services.GetSessionHandler)
+	router.DELETE("/api/coordinator/sessions/:session", services.CloseSessionHandler)
+
+	// 会话接口注册在 /api/coordinator/sessions/{协调器ID} 下，只有一个会话时也可省略前缀
+	registerSessionRoutes(router.Group("/api/coordinator/sessions/:session", services.RequireCoordinator()))
+	registerSessionRoutes(router.Group("/api/coordinator", services.RequireCoordinator()))
+
+	// SIGINT/SIGTERM 触发优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	port := "8060"
-	fmt.Printf("Coordinator HTTP server running on port %s\n", port)
-	if err := router.Run(":" + port); err != nil {
-		panic(err)
+	srv := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		fmt.Printf("Coordinator HTTP server running on port %s\n", port)
+		//启动在coordinator_handlers.go中的http服务init后
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	fmt.Println("\n检测到退出信号，正在关闭...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("关闭控制接口失败: %v\n", err)
+	}
+	if err := services.ShutdownCoordinator(shutdownCtx); err != nil {
+		fmt.Printf("关闭协调器失败: %v\n", err)
+		os.Exit(1)
 	}
-	//启动在coordinator_handlers.go中的http服务init后
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"MPHEDev/pkg/core/pki"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 会话迷你CA
+//
+//	MiniCA init  -dir certs                                   生成会话CA
+//	MiniCA issue -dir certs -name coordinator,participant_000 为协调器和参与方签发证书
+//
+// 证书默认包含 localhost、127.0.0.1 和本机IP，可通过 -hosts 指定。
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "init":
+		err = runInit(os.Args[2:])
+	case "issue":
+		err = runIssue(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage 打印用法
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  MiniCA init  [-dir certs] [-validity 168h] [-force]")
+	fmt.Fprintln(os.Stderr, "  MiniCA issue [-dir certs] -name coordinator,participant_000 [-hosts 127.0.0.1,localhost] [-validity 24h]")
+}
+
+// runInit 生成会话CA
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "证书目录")
+	validity := fs.Duration("validity", pki.DefaultCAValidity, "CA证书有效期")
+	force := fs.Bool("force", false, "覆盖已存在的CA")
+	fs.Parse(args)
+
+	if _, err := os.Stat(filepath.Join(*dir, pki.CAKeyFileName)); err == nil && !*force {
+		return fmt.Errorf("%s 中已存在CA，使用 -force 覆盖（之前签发的证书将全部失效）", *dir)
+	}
+	ca, err := pki.NewCA("MPHE Session CA", *validity)
+	if err != nil {
+		return err
+	}
+	if err := ca.Save(*dir); err != nil {
+		return err
+	}
+	fmt.Printf("已生成会话CA: %s（有效期至 %s）\n", filepath.Join(*dir, pki.CAFileName), ca.Cert.NotAfter.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// runIssue 为协调器和参与方签发会话证书
+func runIssue(args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "证书目录（须包含CA）")
+	names := fs.String("name", "", "证书名称，多个用逗号分隔，如 coordinator,participant_000")
+	hosts := fs.String("hosts", "", "证书的IP地址或域名，多个用逗号分隔（默认 localhost,127.0.0.1 和本机IP）")
+	validity := fs.Duration("validity", pki.DefaultCertValidity, "证书有效期")
+	fs.Parse(args)
+
+	if *names == "" {
+		return fmt.Errorf("需要通过 -name 指定证书名称")
+	}
+	ca, err := pki.LoadCA(*dir)
+	if err != nil {
+		return fmt.Errorf("载入CA失败（先执行 MiniCA init）: %v", err)
+	}
+
+	hostList := splitList(*hosts)
+	if len(hostList) == 0 {
+		hostList = defaultHosts()
+	}
+	for _, name := range splitList(*names) {
+		if err := ca.Issue(*dir, name, hostList, *validity); err != nil {
+			return err
+		}
+		fmt.Printf("已签发证书: %s（%s）\n", filepath.Join(*dir, name+".crt"), strings.Join(hostList, ", "))
+	}
+	return nil
+}
+
+// defaultHosts 本机测试使用的默认地址
+func defaultHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			hosts = append(hosts, ipNet.IP.String())
+		}
+	}
+	return hosts
+}
+
+// splitList 按逗号拆分并去除空白
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
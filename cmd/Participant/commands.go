@@ -0,0 +1,402 @@
+package main
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/services"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 非交互子命令
+//
+//	Participant join    [选项]   注册、生成或恢复密钥、分发数据集，然后持续服务直到收到退出信号或 leave
+//	Participant keygen  [选项]   注册并生成密钥，密钥验证通过后保存到密钥库并退出（不注销）
+//	Participant serve   [选项]   用 keygen 保存的密钥库重新加入会话并持续服务
+//	Participant status  [选项]   查询本机运行中的参与方的状态和密钥生成进度
+//	Participant decrypt [选项]   通过本机运行中的参与方协同解密密文
+//	Participant refresh [选项]   通过本机运行中的参与方协同刷新密文
+//	Participant leave   [选项]   请求本机运行中的参与方注销并退出
+//
+// 标准输出只输出JSON：join/keygen/serve 每行一个事件，其余子命令输出一个对象，失败时输出 {"error": ...}
+// 并以状态码1退出。日志输出到标准错误。
+
+// output 子命令的JSON输出
+var output *json.Encoder
+
+// commandEvent join/keygen/serve 输出的事件
+type commandEvent struct {
+	Event     string `json:"event"` // registered、ready、keys_saved、stopped
+	ID        int    `json:"id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ShardID   string `json:"shard_id,omitempty"`
+	Keystore  string `json:"keystore,omitempty"`
+	Rejoined  bool   `json:"rejoined,omitempty"`
+	Candidate bool   `json:"candidate,omitempty"`
+	APIPort   int    `json:"api_port,omitempty"`
+}
+
+// runCommand 执行子命令，返回进程退出码
+func runCommand(name string, args []string) int {
+	// 标准输出只保留JSON结果，日志改写到标准错误
+	output = json.NewEncoder(os.Stdout)
+	logs.Writer = os.Stderr
+	gin.DefaultWriter = os.Stderr
+	gin.DefaultErrorWriter = os.Stderr
+
+	var err error
+	switch name {
+	case "join":
+		err = runJoin(args)
+	case "keygen":
+		err = runKeygen(args)
+	case "serve":
+		err = runServe(args)
+	case "status":
+		err = runStatus(args)
+	case "decrypt":
+		err = runDecrypt(args)
+	case "refresh":
+		err = runRefresh(args)
+	case "leave":
+		err = runLeave(args)
+	case "help":
+		usage()
+		return 0
+	default:
+		usage()
+		return 2
+	}
+	if err != nil {
+		output.Encode(gin.H{"error": err.Error()})
+		return 1
+	}
+	return 0
+}
+
+// usage 打印用法
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  Participant [选项]                           交互模式")
+	fmt.Fprintln(os.Stderr, "  Participant join    -coordinator <地址> -session <协调器ID> [选项]")
+	fmt.Fprintln(os.Stderr, "  Participant keygen  -coordinator <地址> -session <协调器ID> [选项]   需要密钥库口令")
+	fmt.Fprintln(os.Stderr, "  Participant serve   -coordinator <地址> -session <协调器ID> [选项]   需要密钥库口令")
+	fmt.Fprintln(os.Stderr, "  Participant status  [-api-port 8061]")
+	fmt.Fprintln(os.Stderr, "  Participant decrypt [-api-port 8061] -in <密文文件|-> [-purpose 用途] [-task ID,...] [-slots 8] [-complex] [-timeout 2m]")
+	fmt.Fprintln(os.Stderr, "  Participant refresh [-api-port 8061] -in <密文文件|-> [-timeout 2m]")
+	fmt.Fprintln(os.Stderr, "  Participant leave   [-api-port 8061]")
+	fmt.Fprintln(os.Stderr, "选项可来自命令行参数、环境变量（如 -api-port 对应 MPHE_API_PORT）或 -config 指定的JSON配置文件，")
+	fmt.Fprintln(os.Stderr, "优先级依次降低。运行 Participant <子命令> -h 查看全部选项。")
+}
+
+// runJoin 加入会话并持续服务，直到收到退出信号或 leave
+func runJoin(args []string) error {
+	fs, opts := newFlagSet("join")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	participant, leave, rejoined, err := startSession(opts, false, false)
+	if err != nil {
+		return err
+	}
+	if opts.Dataset {
+		if err := catchPanic(func() { distributeDataset(participant, rejoined) }); err != nil {
+			shutdownParticipant(participant, opts.ShutdownTimeout)
+			return err
+		}
+	}
+	return serveUntilExit(participant, opts, leave, rejoined)
+}
+
+// runKeygen 加入会话并生成密钥，密钥验证通过后保存到密钥库并退出，保留注册以便之后用 serve 重新加入
+func runKeygen(args []string) error {
+	fs, opts := newFlagSet("keygen")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	participant, _, rejoined, err := startSession(opts, false, true)
+	if err != nil {
+		return err
+	}
+
+	// 密钥验证需要参与方在线参与协同解密，验证通过后再退出
+	if _, err := participant.CoordinatorClient.WaitForPhase(context.Background(), types.PhaseReady); err != nil {
+		shutdownParticipant(participant, opts.ShutdownTimeout)
+		return err
+	}
+	participant.KeepRegistration = true
+	if err := shutdownParticipant(participant, opts.ShutdownTimeout); err != nil {
+		return err
+	}
+	output.Encode(commandEvent{
+		Event:     "keys_saved",
+		ID:        participant.ID,
+		SessionID: participant.SessionID,
+		ShardID:   participant.ShardID,
+		Keystore:  participant.KeystoreFile(),
+		Rejoined:  rejoined,
+		Candidate: participant.Candidate,
+	})
+	return nil
+}
+
+// runServe 用密钥库重新加入会话并持续服务，直到收到退出信号或 leave
+func runServe(args []string) error {
+	fs, opts := newFlagSet("serve")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	participant, leave, rejoined, err := startSession(opts, true, true)
+	if err != nil {
+		return err
+	}
+	return serveUntilExit(participant, opts, leave, rejoined)
+}
+
+// startSession 启动本机接口，注册到协调器并准备密钥。requireKeystore 时只允许从密钥库重新加入；
+// keygen 和 serve 必须提供密钥库口令（needPassphrase），否则无法保存或读取密钥
+func startSession(opts *options, requireKeystore, needPassphrase bool) (*services.Participant, chan struct{}, bool, error) {
+	participant, tlsConfig, err := newParticipant(opts)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	passphrase, err := opts.passphrase()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if passphrase == "" && needPassphrase {
+		return nil, nil, false, fmt.Errorf("需要通过环境变量 %s 或 -passphrase-file 提供密钥库口令", services.KeystorePassphraseEnv)
+	}
+	participant.KeystorePassphrase = []byte(passphrase)
+	coordinatorURL, err := opts.sessionURL(tlsConfig.Scheme())
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	localIP, err := utils.GetLocalIP()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("获取本机IP失败: %v", err)
+	}
+	leave := make(chan struct{}, 1)
+	startIPPushServer(localIP, opts.Port, opts.APIPort, participant, leave)
+
+	if err := registerParticipant(participant, coordinatorURL, localIP); err != nil {
+		return nil, nil, false, err
+	}
+	output.Encode(commandEvent{
+		Event:     "registered",
+		ID:        participant.ID,
+		SessionID: participant.SessionID,
+		ShardID:   participant.ShardID,
+		Candidate: participant.Candidate,
+		APIPort:   opts.APIPort,
+	})
+
+	var rejoined bool
+	if err := catchPanic(func() { rejoined = setupSession(participant, requireKeystore) }); err != nil {
+		shutdownParticipant(participant, opts.ShutdownTimeout)
+		return nil, nil, false, err
+	}
+	return participant, leave, rejoined, nil
+}
+
+// serveUntilExit 输出 ready 事件后持续服务，收到退出信号或 leave 时注销并退出
+func serveUntilExit(participant *services.Participant, opts *options, leave <-chan struct{}, rejoined bool) error {
+	if opts.AutoApprove {
+		participant.StartAutoApprove(opts.approvePurposes())
+	}
+	ready := commandEvent{
+		Event:     "ready",
+		ID:        participant.ID,
+		SessionID: participant.SessionID,
+		ShardID:   participant.ShardID,
+		Rejoined:  rejoined,
+		APIPort:   opts.APIPort,
+	}
+	// 未设置口令时不保存密钥库
+	if len(participant.KeystorePassphrase) > 0 {
+		ready.Keystore = participant.KeystoreFile()
+	}
+	output.Encode(ready)
+
+	waitForExit(leave)
+	if err := shutdownParticipant(participant, opts.ShutdownTimeout); err != nil {
+		return err
+	}
+	output.Encode(commandEvent{Event: "stopped", ID: participant.ID})
+	return nil
+}
+
+// catchPanic 把密钥生成等流程中的 panic 转为错误
+func catchPanic(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	f()
+	return nil
+}
+
+// runStatus 查询本机运行中的参与方的状态和密钥生成进度
+func runStatus(args []string) error {
+	fs, opts := newFlagSet("status")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	var status, progress json.RawMessage
+	if err := localAPI(opts, http.MethodGet, "/status", nil, &status); err != nil {
+		return err
+	}
+	if err := localAPI(opts, http.MethodGet, "/step", nil, &progress); err != nil {
+		return err
+	}
+	return output.Encode(gin.H{"status": status, "progress": progress})
+}
+
+// runDecrypt 通过本机运行中的参与方协同解密密文，结果与 /api/participant/decrypt 的响应相同
+func runDecrypt(args []string) error {
+	fs, opts := newFlagSet("decrypt")
+	in := fs.String("in", "-", "密文文件，每行一个Base64编码的密文信封，- 表示标准输入")
+	purpose := fs.String("purpose", "", "提议任务时声明的用途")
+	tasks := fs.String("task", "", "已批准的任务ID（逗号分隔，与密文一一对应），为空时为每个密文提议任务")
+	slots := fs.Int("slots", 0, "返回前多少个槽，0表示全部")
+	complexValues := fs.Bool("complex", false, "同时返回虚部")
+	timeout := fs.Duration("timeout", 0, "整批的超时（包括等待任务批准），0表示默认")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+
+	ciphertexts, err := readCiphertexts(*in)
+	if err != nil {
+		return err
+	}
+	req := types.DecryptAPIRequest{
+		Ciphertexts:    ciphertexts,
+		Purpose:        *purpose,
+		Slots:          *slots,
+		Complex:        *complexValues,
+		TimeoutSeconds: int(timeout.Seconds()),
+	}
+	if *tasks != "" {
+		req.TaskIDs = strings.Split(*tasks, ",")
+	}
+	var resp json.RawMessage
+	if err := localAPI(opts, http.MethodPost, "/decrypt", req, &resp); err != nil {
+		return err
+	}
+	return output.Encode(resp)
+}
+
+// runRefresh 通过本机运行中的参与方协同刷新密文，结果与 /api/participant/refresh 的响应相同
+func runRefresh(args []string) error {
+	fs, opts := newFlagSet("refresh")
+	in := fs.String("in", "-", "密文文件，每行一个Base64编码的密文信封，- 表示标准输入")
+	timeout := fs.Duration("timeout", 0, "整批的超时，0表示默认")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+
+	ciphertexts, err := readCiphertexts(*in)
+	if err != nil {
+		return err
+	}
+	req := types.RefreshAPIRequest{
+		Ciphertexts:    ciphertexts,
+		TimeoutSeconds: int(timeout.Seconds()),
+	}
+	var resp json.RawMessage
+	if err := localAPI(opts, http.MethodPost, "/refresh", req, &resp); err != nil {
+		return err
+	}
+	return output.Encode(resp)
+}
+
+// runLeave 请求本机运行中的参与方注销并退出
+func runLeave(args []string) error {
+	fs, opts := newFlagSet("leave")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	var resp json.RawMessage
+	if err := localAPI(opts, http.MethodPost, "/leave", nil, &resp); err != nil {
+		return err
+	}
+	return output.Encode(resp)
+}
+
+// readCiphertexts 读取密文文件，每行一个Base64编码的密文信封，忽略空行
+func readCiphertexts(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取密文文件失败: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var ciphertexts []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			ciphertexts = append(ciphertexts, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取密文失败: %v", err)
+	}
+	if len(ciphertexts) == 0 {
+		return nil, fmt.Errorf("没有读到密文")
+	}
+	return ciphertexts, nil
+}
+
+// localAPI 调用本机运行中的参与方的 /api/participant 接口，响应不是2xx时返回其中的错误
+func localAPI(opts *options, method, path string, body interface{}, out *json.RawMessage) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/api/participant%s", opts.APIPort, path)
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接本机参与方失败（端口 %d）: %v", opts.APIPort, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s", apiErr.Error)
+		}
+		return fmt.Errorf("本机参与方返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	*out = data
+	return nil
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/services"
+	"MPHEDev/pkg/core/participant/types"
 	"MPHEDev/pkg/core/participant/utils"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/relay"
+	"MPHEDev/pkg/core/wire"
 	"bufio"
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -13,14 +21,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/multiparty"
 	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 )
 
 // getUserInput 获取用户输入
 func getUserInput(prompt string) string {
-	fmt.Print(prompt)
+	logs.Print(prompt)
 	reader := bufio.NewReader(os.Stdin)
 	input, _ := reader.ReadString('\n')
 	return strings.TrimSpace(input)
@@ -74,12 +81,14 @@ func getKeyGenProgress() KeyGenProgressPush {
 //	    Participants map[int]string   `json:"participants"`
 //	}
 type ParticipantSelfStatusResponse struct {
-	ID           int            `json:"id"`
-	IP           string         `json:"ip"`
-	Port         int            `json:"port"`
-	Status       string         `json:"status"`
-	DataSplit    string         `json:"data_split"`
-	Participants map[int]string `json:"participants"`
+	ID           int                    `json:"id"`
+	IP           string                 `json:"ip"`
+	Port         int                    `json:"port"`
+	Status       string                 `json:"status"`
+	DataSplit    string                 `json:"data_split"`
+	Participants map[int]string         `json:"participants"`
+	Candidate    bool                   `json:"candidate"` // 尚未加入集体密钥的候选成员
+	Keys         types.CiphertextStatus `json:"keys"`      // 密钥纪元、成员纪元和每批密文所在的纪元
 }
 
 // OnlineStatusParticipant 和 ParticipantOnlineStatusResponse 结构体
@@ -118,7 +127,8 @@ type ParticipantOnlineStatusResponse struct {
 	Participants      []OnlineStatusParticipant `json:"participants"`
 }
 
-func startIPPushServer(ip string, port int, participant *services.Participant) {
+// startIPPushServer 启动本机接口服务（apiPort 端口），leave 接收退出请求
+func startIPPushServer(ip string, port, apiPort int, participant *services.Participant, leave chan<- struct{}) {
 	r := gin.Default()
 	r.GET("/api/participant/ws", func(c *gin.Context) {
 		msg := struct {
@@ -157,6 +167,8 @@ func startIPPushServer(ip string, port int, participant *services.Participant) {
 			Status:       "online",
 			DataSplit:    participant.DataSplit,
 			Participants: participant.GetOnlineParticipants(),
+			Candidate:    participant.Candidate && !participant.KeyManager.IsReady(),
+			Keys:         participant.CiphertextStatus(),
 		}
 		c.JSON(200, resp)
 	})
@@ -192,7 +204,18 @@ func startIPPushServer(ip string, port int, participant *services.Participant) {
 		resp.Participants = participants
 		c.JSON(200, resp)
 	})
-	addr := ":8061"
+	// 调用方密文的协同解密和刷新，只接受本机请求
+	r.POST("/api/participant/decrypt", loopbackOnly, gin.WrapF(participant.HandleDecryptAPI))
+	r.POST("/api/participant/refresh", loopbackOnly, gin.WrapF(participant.HandleRefreshAPI))
+	// 请求优雅关闭（注销并等待处理中的请求完成），只接受本机请求
+	r.POST("/api/participant/leave", loopbackOnly, func(c *gin.Context) {
+		select {
+		case leave <- struct{}{}:
+		default:
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "leaving", "id": participant.ID})
+	})
+	addr := fmt.Sprintf(":%d", apiPort)
 	go func() {
 		if err := r.Run(addr); err != nil {
 			panic(err)
@@ -200,52 +223,173 @@ func startIPPushServer(ip string, port int, participant *services.Participant) {
 	}()
 }
 
+// loopbackOnly 拒绝非本机来源的请求
+func loopbackOnly(c *gin.Context) {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "该接口只接受本机请求"})
+		return
+	}
+	c.Next()
+}
+
+// 参与方
+//
+//	Participant [选项]                  交互模式：提示输入协调器地址、会话和口令，密钥生成后进入菜单
+//	Participant <子命令> [选项]          非交互模式，供脚本和测试使用，结果以JSON输出到标准输出
+//
+// 子命令见 usage。选项可来自命令行参数、MPHE_ 开头的环境变量或 -config 指定的配置文件。
 func main() {
-	fmt.Println("参与方启动中...")
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+	runInteractive(os.Args[1:])
+}
+
+// runInteractive 交互模式：未配置的协调器地址、会话和口令在启动后输入，密钥生成后运行菜单
+func runInteractive(args []string) {
+	fs, opts := newFlagSet("Participant")
+	if err := opts.parse(fs, args); err != nil {
+		panic(err)
+	}
+
+	logs.Println("参与方启动中...")
 
 	// 创建参与方实例
-	participant := services.NewParticipant()
+	participant, tlsConfig, err := newParticipant(opts)
+	if err != nil {
+		panic(err)
+	}
 
 	// 获取本机IP并显示
 	localIP, err := utils.GetLocalIP()
 	if err != nil {
-		fmt.Printf("获取本机IP失败: %v\n", err)
+		logs.Printf("获取本机IP失败: %v\n", err)
 		panic(err)
 	}
-	fmt.Printf("本机IP: %s\n", localIP)
+	logs.Printf("本机IP: %s\n", localIP)
 
-	// 启动 WebSocket 服务（8061端口）
-	startIPPushServer(localIP, 8061, participant)
+	// 启动本机接口服务
+	leave := make(chan struct{}, 1)
+	startIPPushServer(localIP, opts.Port, opts.APIPort, participant, leave)
 
 	// 获取协调器IP
-	coordinatorIP := getUserInput("请输入协调器IP地址: ")
-	if coordinatorIP == "" {
-		fmt.Println("协调器IP地址不能为空")
+	if opts.Coordinator == "" {
+		opts.Coordinator = getUserInput("请输入协调器IP地址: ")
+	}
+	if opts.Coordinator == "" {
+		logs.Println("协调器IP地址不能为空")
 		panic("协调器IP地址不能为空")
 	}
 
+	// 协调器可同时运行多个会话，按协调器ID选择要加入的会话
+	if opts.Session == "" && !strings.Contains(opts.Coordinator, "/sessions/") {
+		opts.Session = getUserInput("请输入会话的协调器ID: ")
+		if opts.Session == "" {
+			logs.Println("协调器ID不能为空")
+			panic("协调器ID不能为空")
+		}
+	}
+
+	// 密钥库口令，优先从环境变量或口令文件读取
+	passphrase, err := opts.passphrase()
+	if err != nil {
+		panic(err)
+	}
+	if passphrase == "" {
+		passphrase = getUserInput("请输入密钥库口令（留空则不保存密钥，重启后无法重新加入会话）: ")
+	}
+	participant.KeystorePassphrase = []byte(passphrase)
+
 	// 设置协调器URL
-	coordinatorURL := fmt.Sprintf("http://%s:8080", coordinatorIP)
+	coordinatorURL, err := opts.sessionURL(tlsConfig.Scheme())
+	if err != nil {
+		panic(err)
+	}
 
 	// 1. 注册并获取参数
+	if err := registerParticipant(participant, coordinatorURL, localIP); err != nil {
+		panic(err)
+	}
+
+	// 捕获Ctrl+C/SIGTERM信号和本机接口的退出请求，优雅关闭（注销并等待处理中的请求完成）
+	go func() {
+		waitForExit(leave)
+		code := 0
+		if err := shutdownParticipant(participant, opts.ShutdownTimeout); err != nil {
+			code = 1
+		}
+		os.Exit(code)
+	}()
+
+	// 2-13. 加入会话并准备密钥
+	rejoined := setupSession(participant, false)
+
+	// 14-16. 载入、加密并分发数据集
+	if opts.Dataset {
+		distributeDataset(participant, rejoined)
+	}
+	if opts.AutoApprove {
+		participant.StartAutoApprove(opts.approvePurposes())
+	}
+
+	// 17. 运行主循环
+	participant.RunMainLoop()
+
+	// 18. 菜单选择退出后优雅关闭
+	if err := shutdownParticipant(participant, opts.ShutdownTimeout); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newParticipant 按启动配置创建参与方
+func newParticipant(opts *options) (*services.Participant, *pki.Config, error) {
+	encoding, err := wire.ParseEncoding(opts.Compression)
+	if err != nil {
+		return nil, nil, err
+	}
+	relayMode, err := relay.ParseMode(opts.Relay)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	participant := services.NewParticipant()
+	participant.IdentityPath = opts.Identity
+	participant.KeystorePath = opts.Keystore
+	participant.Port = opts.Port
+	participant.Host = opts.Host
+	participant.DataDir = opts.DataDir
+	participant.ShardID = opts.Shard
+	participant.Client.Encoding = encoding
+	participant.Relay = relayMode
+
+	tlsConfig, err := pki.Load(opts.TLSCA, opts.TLSCert, opts.TLSKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	participant.SetTLS(tlsConfig)
+	return participant, tlsConfig, nil
+}
+
+// registerParticipant 注册到协调器，协调器后端尚未启动时重试
+func registerParticipant(participant *services.Participant, coordinatorURL, localIP string) error {
 	setKeyGenProgress("register", "started", "注册参与方")
 
-	// 重试机制：等待协调器后端服务器启动
 	maxRetries := 10
-	fmt.Printf("尝试连接到协调器: %s\n", coordinatorURL)
-	fmt.Printf("参与方IP: %s\n", localIP)
+	logs.Printf("尝试连接到协调器: %s\n", coordinatorURL)
+	logs.Printf("参与方IP: %s\n", localIP)
 
 	for i := 0; i < maxRetries; i++ {
 		if err := participant.Register(coordinatorURL); err != nil {
-			fmt.Printf("注册失败 (尝试 %d/%d): %v\n", i+1, maxRetries, err)
-			fmt.Printf("网络诊断: 参与方(%s) -> 协调器(%s)\n", localIP, coordinatorIP)
+			logs.Printf("注册失败 (尝试 %d/%d): %v\n", i+1, maxRetries, err)
+			logs.Printf("网络诊断: 参与方(%s) -> 协调器(%s)\n", localIP, coordinatorURL)
 			if i < maxRetries-1 {
-				fmt.Println("等待3秒后重试...")
+				logs.Println("等待3秒后重试...")
 				time.Sleep(3 * time.Second)
 				continue
 			}
 			setKeyGenProgress("register", "failed", err.Error())
-			panic(err)
+			return err
 		}
 		break
 	}
@@ -253,27 +397,58 @@ func main() {
 
 	// 设置参与方ID到客户端
 	participant.CoordinatorClient.SetParticipantID(participant.ID)
+	return nil
+}
 
-	// 捕获Ctrl+C信号，自动注销
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		fmt.Println("\n检测到退出信号，正在注销...")
-		if err := participant.Unregister(); err != nil {
-			fmt.Printf("注销失败: %v\n", err)
-		} else {
-			fmt.Println("注销成功")
+// waitForExit 等待Ctrl+C/SIGTERM信号或本机接口的退出请求
+func waitForExit(leave <-chan struct{}) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case <-sigCtx.Done():
+		logs.Println("\n检测到退出信号，正在关闭...")
+	case <-leave:
+		logs.Println("\n收到退出请求，正在关闭...")
+	}
+}
+
+// setupSession 注册后加入会话：密钥库属于当前会话时重新加入，候选成员等待加入集体密钥，否则参与密钥生成；
+// 然后同步成员并检查在线状态。requireKeystore 时只允许重新加入。返回是否重新加入
+func setupSession(participant *services.Participant, requireKeystore bool) bool {
+	// 2. 密钥库属于当前会话时重新加入，跳过CRS种子协商和密钥生成
+	rejoined, err := participant.LoadKeystore()
+	if err != nil {
+		setKeyGenProgress("keystore", "failed", err.Error())
+		panic(err)
+	}
+	if requireKeystore && !rejoined {
+		err := fmt.Errorf("密钥库 %s 不属于当前会话或口令为空，请先运行 keygen", participant.KeystoreFile())
+		setKeyGenProgress("keystore", "failed", err.Error())
+		panic(err)
+	}
+
+	// 参与会话CRS种子协商（协调器开启时），候选成员注册时协商已经结束
+	if participant.CRSContribution && !rejoined && !participant.Candidate {
+		setKeyGenProgress("crs_contribution", "started", "协商会话CRS种子")
+		if err := participant.ContributeCRS(); err != nil {
+			setKeyGenProgress("crs_contribution", "failed", err.Error())
+			panic(err)
 		}
-		os.Exit(0)
-	}()
+		setKeyGenProgress("crs_contribution", "success", "CRS种子协商完成")
+	}
 
-	// 2. 获取CKKS参数、CRP和伽罗瓦密钥相关参数
+	// 获取CKKS参数、CRP和伽罗瓦密钥相关参数
 	params, err := participant.CoordinatorClient.GetParams()
 	if err != nil {
 		panic(err)
 	}
 
+	// 拒绝不属于注册会话或种子无法验证的参数
+	if err := participant.VerifySessionParams(params); err != nil {
+		setKeyGenProgress("verify_params", "failed", err.Error())
+		panic(fmt.Sprintf("拒绝协调器参数: %v", err))
+	}
+
 	// 将 ParamsResponse 转换为 ckks.Parameters
 	ckksParams, err := ckks.NewParametersFromLiteral(params.Params)
 	if err != nil {
@@ -282,6 +457,9 @@ func main() {
 
 	participant.KeyManager.SetParams(ckksParams)
 	participant.KeyManager.TotalGaloisKeys = len(params.GalEls)
+	participant.KeyManager.SetThresholdConfig(participant.ID, params.Threshold, params.ExpectedParticipants)
+	participant.KeyManager.SetSmudgingConfig(params.Smudging)
+	logs.Printf("门限配置: t=%d, N=%d\n", participant.KeyManager.RequiredParticipants(), params.ExpectedParticipants)
 
 	// 设置刷新服务的参数和CRS
 	participant.RefreshService.UpdateParams(ckksParams)
@@ -293,6 +471,86 @@ func main() {
 	}
 	participant.RefreshService.SetCommonCRSSeed(commonCRSSeedBytes)
 
+	// 本方同意的授权策略：重新加入时沿用密钥库中的记录，否则采用协调器的当前策略
+	if err := participant.SyncTaskPolicy(); err != nil {
+		panic(fmt.Sprintf("读取解密授权策略失败: %v", err))
+	}
+	// 重启前有效期内已使用的刷新任务ID仍不能用于其他密文
+	if err := participant.RestoreRefreshTasks(); err != nil {
+		panic(err)
+	}
+
+	if rejoined {
+		// 重新加入会话：从密钥库恢复私钥份额和集体密钥，不重新生成
+		setKeyGenProgress("keystore", "started", "从密钥库恢复密钥")
+		if err := participant.ApplyKeystore(); err != nil {
+			setKeyGenProgress("keystore", "failed", err.Error())
+			panic(err)
+		}
+		setKeyGenProgress("keystore", "success", "已重新加入会话")
+		// 加入集体密钥的轮换尚未提交时继续等待
+		if !participant.KeyManager.IsReady() {
+			if err := participant.WaitForMembership(); err != nil {
+				panic(err)
+			}
+		}
+	} else if participant.Candidate {
+		// 初始密钥已生成：作为候选成员等待控制面把本方加入集体密钥，不重新生成会话密钥
+		setKeyGenProgress("membership", "started", "等待加入集体密钥")
+		if err := participant.JoinAsCandidate(params); err != nil {
+			setKeyGenProgress("membership", "failed", err.Error())
+			panic(err)
+		}
+		setKeyGenProgress("membership", "success", "已加入集体密钥")
+	} else {
+		generateKeys(participant, params, ckksParams)
+		if err := participant.SaveKeystore(); err != nil {
+			logs.Printf("[警告] 保存密钥库失败，重启后将无法重新加入本会话: %v\n", err)
+		}
+	}
+
+	// 同步成员，候选成员不参与协同解密和刷新
+	if err := participant.SyncMembership(); err != nil {
+		logs.Printf("[警告] 同步成员失败: %v\n", err)
+	}
+
+	// 13. 获取在线成员列表
+	logs.Printf("参与方 %d 收集密钥并解码设置，启动成功，开始检查在线状态...\n", participant.ID)
+	if err := participant.CheckOnlineStatusBeforeOperation(); err != nil {
+		logs.Printf("在线状态检查失败: %v\n", err)
+		panic(err)
+	}
+
+	if err := participant.UpdateOnlineParticipants(); err != nil {
+		panic(err)
+	}
+	return rejoined
+}
+
+// distributeDataset 载入本地数据集，加密后分发给其他参与方并等待分发完成
+func distributeDataset(participant *services.Participant, rejoined bool) {
+	if rejoined || participant.Candidate {
+		// 其他参与方已完成数据分发，重新加入或作为新成员加入时不再分发
+		logs.Println("已重新加入会话，跳过数据集分发")
+		return
+	}
+
+	// 14. 载入数据集
+	if err := participant.LoadDataset(); err != nil {
+		panic(err)
+	}
+
+	// 15. 加密并分发数据集
+	if err := participant.EncryptAndDistributeDataset(); err != nil {
+		panic(err)
+	}
+
+	// 16. 等待数据分发完成
+	<-participant.ReadyCh
+}
+
+// generateKeys 参与多方密钥生成：生成私钥和各类密钥份额并上传，等待协调器聚合后设置集体密钥
+func generateKeys(participant *services.Participant, params *types.ParamsResponse, ckksParams ckks.Parameters) {
 	// 3. 生成本地私钥和公钥份额
 
 	// 根据统一CRS种子生成所有CRP
@@ -341,72 +599,55 @@ func main() {
 	}
 	participant.KeyManager.SetSecretKey(sk)
 
-	// 4. 编码并上传私钥  该方法仅用于测试环境
-	skB64, err := keyGen.EncodeSecretKey(sk)
-	if err != nil {
-		panic(err)
-	}
-	setKeyGenProgress("upload_secret_key", "started", "上传私钥")
-	if err := participant.CoordinatorClient.UploadSecretKey(skB64); err != nil {
-		setKeyGenProgress("upload_secret_key", "failed", err.Error())
-		panic(err)
+	// 协调器按阶段接受份额：全部参与方注册完成（以及CRS种子协商完成）后进入公钥阶段
+	waitForPhase(participant, types.PhasePublicKey)
+
+	// 4. 编码并上传私钥  仅在协调器开启insecure_debug的测试环境中执行
+	if params.InsecureDebug {
+		logs.Println("[WARNING] 协调器处于 insecure_debug 模式，私钥将上传到协调器，仅可用于测试！")
+		skData, err := keyGen.EncodeSecretKey(sk)
+		if err != nil {
+			panic(err)
+		}
+		setKeyGenProgress("upload_secret_key", "started", "上传私钥")
+		if err := participant.CoordinatorClient.UploadSecretKey(skData); err != nil {
+			setKeyGenProgress("upload_secret_key", "failed", err.Error())
+			panic(err)
+		}
+		setKeyGenProgress("upload_secret_key", "success", "上传私钥成功")
+	} else {
+		setKeyGenProgress("upload_secret_key", "skipped", "生产模式不上传私钥")
 	}
-	setKeyGenProgress("upload_secret_key", "success", "上传私钥成功")
 
 	// 5. 编码并上传公钥份额
-	shareB64, err := keyGen.EncodePublicKeyShare(share)
+	shareData, err := keyGen.EncodePublicKeyShare(share)
 	if err != nil {
 		panic(err)
 	}
 	setKeyGenProgress("upload_public_key_share", "started", "上传公钥份额")
-	if err := participant.CoordinatorClient.UploadPublicKeyShare(shareB64); err != nil {
+	if err := participant.CoordinatorClient.UploadPublicKeyShare(shareData); err != nil {
 		setKeyGenProgress("upload_public_key_share", "failed", err.Error())
 		panic(err)
 	}
 	setKeyGenProgress("upload_public_key_share", "success", "上传公钥份额成功")
 
-	// 6. 生成并上传伽罗瓦密钥份额
-	galoisShares, err := keyGen.GenerateGaloisKeyShares()
-	if err != nil {
-		panic(err)
-	}
-
-	for galEl, share := range galoisShares {
-		shareB64, err := keyGen.EncodeGaloisKeyShare(share)
-		if err != nil {
-			panic(err)
-		}
-		if err := participant.CoordinatorClient.UploadGaloisKeyShare(galEl, shareB64); err != nil {
-			panic(err)
-		}
-	}
-
-	// 7. 生成并上传重线性化密钥第一轮份额
+	// 6. 公钥聚合后生成并上传重线性化密钥第一轮份额
+	waitForPhase(participant, types.PhaseRelinRound1)
 	if err := keyGen.GenerateRelinearizationKeyRound1(); err != nil {
 		panic(err)
 	}
-	rlkShare1B64, err := keyGen.EncodeRelinearizationKeyShare(1)
+	rlkShare1, err := keyGen.EncodeRelinearizationKeyShare(1)
 	if err != nil {
 		panic(err)
 	}
-	if err := participant.CoordinatorClient.UploadRelinearizationKeyShare(1, rlkShare1B64); err != nil {
+	if err := participant.CoordinatorClient.UploadRelinearizationKeyShare(1, rlkShare1); err != nil {
 		panic(err)
 	}
 
-	// 8. 等待第一轮聚合完成，然后获取聚合结果
-	for {
-		status, err := participant.CoordinatorClient.PollStatus()
-		if err != nil {
-			time.Sleep(2 * time.Second)
-			continue
-		}
-		if status.RlkRound1Ready {
-			break
-		}
-		time.Sleep(2 * time.Second)
-	}
+	// 7. 等待第一轮聚合完成
+	waitForPhase(participant, types.PhaseRelinRound2)
 
-	// 9. 获取聚合后的第一轮份额，生成第二轮份额
+	// 8. 获取聚合后的第一轮份额，生成并上传第二轮份额
 	aggregatedShare1, err := participant.CoordinatorClient.GetRelinearizationKeyRound1Aggregated()
 	if err != nil {
 		panic(err)
@@ -414,109 +655,82 @@ func main() {
 	if err := keyGen.GenerateRelinearizationKeyRound2(aggregatedShare1); err != nil {
 		panic(err)
 	}
-	rlkShare2B64, err := keyGen.EncodeRelinearizationKeyShare(2)
+	rlkShare2, err := keyGen.EncodeRelinearizationKeyShare(2)
 	if err != nil {
 		panic(err)
 	}
-	if err := participant.CoordinatorClient.UploadRelinearizationKeyShare(2, rlkShare2B64); err != nil {
+	if err := participant.CoordinatorClient.UploadRelinearizationKeyShare(2, rlkShare2); err != nil {
 		panic(err)
 	}
 
-	// 10. 等待所有密钥生成完成
-	fmt.Println("开始等待所有密钥生成完成...")
-	for {
-		status, err := participant.CoordinatorClient.PollStatus()
-		if err != nil {
-			time.Sleep(2 * time.Second)
-			continue
-		}
-
-		if status.GlobalPKReady && status.SkAggReady && status.RlkReady &&
-			status.CompletedGaloisKeys == status.TotalGaloisKeys {
-			fmt.Println("所有密钥生成完成！")
-			break
+	// 9. 门限模式下与其他参与方交换Shamir份额，密钥验证的协同解密需要门限份额
+	if participant.KeyManager.IsThresholdMode() {
+		setKeyGenProgress("threshold_shares", "started", "交换门限份额")
+		if err := participant.SetupThresholdKey(); err != nil {
+			setKeyGenProgress("threshold_shares", "failed", err.Error())
+			panic(err)
 		}
-		time.Sleep(2 * time.Second)
-	}
-
-	// 11. 获取聚合后的密钥
-	fmt.Println("开始获取聚合后的密钥...")
-	keys, err := participant.CoordinatorClient.GetAggregatedKeys()
-	if err != nil {
-		fmt.Printf("获取聚合密钥失败: %v\n", err)
-		panic(err)
-	}
-	fmt.Println("成功获取聚合密钥")
-
-	// 解码并设置公钥
-	fmt.Println("开始解码并设置公钥...")
-	pubKeyBytes, err := utils.DecodeFromBase64(keys.PubKey)
-	if err != nil {
-		panic(err)
-	}
-	var pubKey rlwe.PublicKey
-	if err := utils.DecodeShare(pubKeyBytes, &pubKey); err != nil {
-		panic(err)
+		setKeyGenProgress("threshold_shares", "success", "门限份额准备就绪")
 	}
-	participant.KeyManager.SetPublicKey(&pubKey)
-	fmt.Println("公钥设置完成")
 
-	// 解码并设置重线性化密钥
-	fmt.Println("开始解码并设置重线性化密钥...")
-	rlkBytes, err := utils.DecodeFromBase64(keys.RelineKey)
+	// 10. 重线性化密钥聚合后生成并上传伽罗瓦密钥份额
+	waitForPhase(participant, types.PhaseGalois)
+	galoisShares, err := keyGen.GenerateGaloisKeyShares()
 	if err != nil {
 		panic(err)
 	}
-	var rlk rlwe.RelinearizationKey
-	if err := utils.DecodeShare(rlkBytes, &rlk); err != nil {
-		panic(err)
-	}
-	participant.KeyManager.SetRelinearizationKey(&rlk)
-	fmt.Println("重线性化密钥设置完成")
 
-	// 解码并设置伽罗瓦密钥
-	fmt.Printf("开始解码并设置伽罗瓦密钥 (共 %d 个)...\n", len(keys.GaloisKeys))
-	galoisKeys := make([]*rlwe.GaloisKey, 0)
-	for _, keyStr := range keys.GaloisKeys {
-		keyBytes, err := utils.DecodeFromBase64(keyStr)
+	for galEl, share := range galoisShares {
+		shareData, err := keyGen.EncodeGaloisKeyShare(share)
 		if err != nil {
 			panic(err)
 		}
-		var galoisKey rlwe.GaloisKey
-		if err := utils.DecodeShare(keyBytes, &galoisKey); err != nil {
+		if err := participant.CoordinatorClient.UploadGaloisKeyShare(galEl, shareData); err != nil {
 			panic(err)
 		}
-		galoisKeys = append(galoisKeys, &galoisKey)
 	}
-	participant.KeyManager.SetGaloisKeys(galoisKeys)
-	fmt.Println("所有伽罗瓦密钥设置完成")
 
-	// 12. 获取在线成员列表
-	fmt.Printf("参与方 %d 收集密钥并解码设置，启动成功，开始检查在线状态...\n", participant.ID)
-	if err := participant.CheckOnlineStatusBeforeOperation(); err != nil {
-		fmt.Printf("在线状态检查失败: %v\n", err)
-		panic(err)
-	}
+	// 11. 等待所有密钥聚合完成，协调器随后开始验证密钥
+	logs.Println("开始等待所有密钥生成完成...")
+	waitForPhase(participant, types.PhaseVerification)
+	logs.Println("所有密钥生成完成！")
 
-	if err := participant.UpdateOnlineParticipants(); err != nil {
+	// 12. 获取聚合后的密钥
+	logs.Println("开始获取聚合后的密钥...")
+	keys, err := participant.CoordinatorClient.GetAggregatedKeys()
+	if err != nil {
+		logs.Printf("获取聚合密钥失败: %v\n", err)
 		panic(err)
 	}
+	logs.Println("成功获取聚合密钥")
 
-	// 13. 载入数据集
-	if err := participant.LoadDataset(); err != nil {
-		panic(err)
-	}
+	// 设置公钥、重线性化密钥和伽罗瓦密钥
+	participant.KeyManager.SetPublicKey(keys.PubKey)
+	logs.Println("公钥设置完成")
+	participant.KeyManager.SetRelinearizationKey(keys.RelineKey)
+	logs.Println("重线性化密钥设置完成")
+	logs.Printf("设置伽罗瓦密钥 (共 %d 个)...\n", len(keys.GaloisKeys))
+	participant.KeyManager.SetGaloisKeys(keys.GaloisKeys)
+	logs.Println("所有伽罗瓦密钥设置完成")
+}
 
-	// 14. 加密并分发数据集
-	if err := participant.EncryptAndDistributeDataset(); err != nil {
+// waitForPhase 等待会话推进到 phase，会话失败或关闭时退出
+func waitForPhase(participant *services.Participant, phase string) {
+	if _, err := participant.CoordinatorClient.WaitForPhase(context.Background(), phase); err != nil {
+		setKeyGenProgress("session_phase", "failed", err.Error())
 		panic(err)
 	}
+}
 
-	// 15. 等待数据分发完成
-	<-participant.ReadyCh
-
-	// 16. 运行主循环
-	participant.RunMainLoop()
+// shutdownParticipant 在超时时间内优雅关闭参与方
+func shutdownParticipant(participant *services.Participant, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := participant.Shutdown(ctx); err != nil {
+		logs.Printf("关闭参与方失败: %v\n", err)
+		return err
+	}
+	return nil
 }
 
 // 辅助类型转换函数
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"MPHEDev/pkg/core/participant/services"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix 选项对应的环境变量前缀，例如 -tls-ca 对应 MPHE_TLS_CA
+const envPrefix = "MPHE_"
+
+// options 参与方的启动配置
+// 每个选项依次取命令行参数、环境变量（MPHE_ 加大写的选项名，'-' 换成 '_'）和配置文件（JSON，键为选项名）中的值
+type options struct {
+	Config          string
+	Coordinator     string
+	Session         string
+	Host            string
+	Port            int
+	APIPort         int
+	DataDir         string
+	Shard           string
+	Identity        string
+	Keystore        string
+	PassphraseFile  string
+	TLSCA           string
+	TLSCert         string
+	TLSKey          string
+	Compression     string
+	Relay           string
+	ShutdownTimeout time.Duration
+	AutoApprove     bool
+	ApprovePurposes string
+	Dataset         bool
+
+	// common 公共选项的名称，只有这些选项可以来自环境变量和配置文件
+	common map[string]bool
+}
+
+// newFlagSet 创建注册了全部公共选项的参数集，子命令在其上注册自己的参数
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := &options{}
+	registerOptions(fs, opts)
+	return fs, opts
+}
+
+// registerOptions 注册公共选项
+func registerOptions(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.Config, "config", "", "配置文件路径（JSON，键为选项名，例如 {\"coordinator\": \"10.0.0.1\", \"port\": 8082}）")
+	fs.StringVar(&opts.Coordinator, "coordinator", "", "协调器地址：IP或主机名（使用8080端口）、http(s)://主机:端口，或完整的会话URL")
+	fs.StringVar(&opts.Session, "session", "", "要加入的会话的协调器ID（初始化协调器时返回）")
+	fs.StringVar(&opts.Host, "host", "", "向其他参与方公布的地址（默认本机IP，本机测试可用 127.0.0.1）")
+	fs.IntVar(&opts.Port, "port", 8081, "P2P服务端口（同一台机器运行多个参与方时需不同）")
+	fs.IntVar(&opts.APIPort, "api-port", 8061, "本机接口端口（状态查询、协同解密/刷新、退出），同一台机器运行多个参与方时需不同")
+	fs.StringVar(&opts.DataDir, "data-dir", "../../data", "数据集目录，包含 horizontal/vertical 分片子目录")
+	fs.StringVar(&opts.Shard, "shard", "", "数据分片ID（如 001），为空时从数据集目录检测")
+	fs.StringVar(&opts.Identity, "identity", "", "身份文件路径（默认 identity/participant_<分片ID>.json，首次启动时生成）")
+	fs.StringVar(&opts.Keystore, "keystore", "", "加密密钥库路径（默认 keystore/participant_<分片ID>.json）")
+	fs.StringVar(&opts.PassphraseFile, "passphrase-file", "", "从文件读取密钥库口令（优先使用环境变量 MPHE_KEYSTORE_PASSPHRASE）")
+	fs.StringVar(&opts.TLSCA, "tls-ca", "", "会话CA证书（启用mTLS时必填）")
+	fs.StringVar(&opts.TLSCert, "tls-cert", "", "参与方证书")
+	fs.StringVar(&opts.TLSKey, "tls-key", "", "参与方私钥")
+	fs.StringVar(&opts.Compression, "compression", "", "发送密钥份额和密文时的压缩编码（gzip/zstd，默认不压缩）")
+	fs.StringVar(&opts.Relay, "relay", "auto", "经协调器中继P2P请求：auto 直连失败时中继，always 始终中继（位于NAT之后时使用），off 不中继")
+	fs.DurationVar(&opts.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "退出时等待处理中请求完成的最长时间")
+	fs.BoolVar(&opts.AutoApprove, "auto-approve", false, "自动批准其他参与方提议的解密任务（无人值守的测试环境）")
+	fs.StringVar(&opts.ApprovePurposes, "approve-purposes", "", "与 -auto-approve 一起使用，只自动批准这些用途的任务（逗号分隔）")
+	fs.BoolVar(&opts.Dataset, "dataset", true, "密钥生成后载入并分发本地数据集")
+
+	opts.common = make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		opts.common[f.Name] = true
+	})
+}
+
+// parse 解析命令行参数，未在命令行给出的公共选项依次取环境变量和配置文件中的值
+func (opts *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	if !explicit["config"] {
+		if path, ok := os.LookupEnv(envName("config")); ok {
+			opts.Config = path
+		}
+	}
+
+	file := make(map[string]interface{})
+	if opts.Config != "" {
+		data, err := os.ReadFile(opts.Config)
+		if err != nil {
+			return fmt.Errorf("读取配置文件失败: %v", err)
+		}
+		// 数字按原文读取，避免大整数经float64格式化为 1e+06 之类的科学计数法
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&file); err != nil {
+			return fmt.Errorf("解析配置文件失败: %v", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return fmt.Errorf("解析配置文件失败: JSON对象之后有多余内容")
+		}
+		for name := range file {
+			if !opts.common[name] || name == "config" {
+				return fmt.Errorf("配置文件中有未知的选项: %s", name)
+			}
+		}
+	}
+
+	for name := range opts.common {
+		if explicit[name] || name == "config" {
+			continue
+		}
+		value, ok := os.LookupEnv(envName(name))
+		source := "环境变量 " + envName(name)
+		if !ok {
+			var v interface{}
+			if v, ok = file[name]; ok {
+				value = fmt.Sprint(v)
+				source = "配置文件"
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s 中的选项 %s 无效: %v", source, name, err)
+		}
+	}
+	return nil
+}
+
+// envName 选项对应的环境变量名
+func envName(option string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(option, "-", "_"))
+}
+
+// sessionURL 由协调器地址和会话ID得到参与方使用的会话URL
+// 协调器地址可以是IP或主机名（使用8080端口）、带协议和端口的地址，或已包含 /sessions/{ID} 的完整会话URL
+func (opts *options) sessionURL(scheme string) (string, error) {
+	coordinator := strings.TrimRight(opts.Coordinator, "/")
+	if coordinator == "" {
+		return "", fmt.Errorf("需要通过 -coordinator 指定协调器地址")
+	}
+	if !strings.Contains(coordinator, "://") {
+		if !strings.Contains(coordinator, ":") {
+			coordinator += ":8080"
+		}
+		coordinator = scheme + "://" + coordinator
+	}
+	u, err := url.Parse(coordinator)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("无效的协调器地址: %s", opts.Coordinator)
+	}
+	if strings.Contains(u.Path, "/sessions/") {
+		if opts.Session != "" && !strings.HasSuffix(u.Path, "/sessions/"+opts.Session) {
+			return "", fmt.Errorf("协调器地址中的会话与 -session 不一致")
+		}
+		return coordinator, nil
+	}
+	if opts.Session == "" {
+		return "", fmt.Errorf("需要通过 -session 指定会话的协调器ID")
+	}
+	return coordinator + "/sessions/" + opts.Session, nil
+}
+
+// passphrase 密钥库口令：环境变量 MPHE_KEYSTORE_PASSPHRASE，其次为 -passphrase-file 指定的文件
+func (opts *options) passphrase() (string, error) {
+	if passphrase := os.Getenv(services.KeystorePassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if opts.PassphraseFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(opts.PassphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("读取密钥库口令失败: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// approvePurposes 自动批准的任务用途
+func (opts *options) approvePurposes() []string {
+	var purposes []string
+	for _, p := range strings.Split(opts.ApprovePurposes, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			purposes = append(purposes, p)
+		}
+	}
+	return purposes
+}
@@ -0,0 +1,175 @@
+package consumers
+
+import (
+	"MPHEDev/pkg/core/coordinator/store"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== 结果接收方 ====================
+//
+// 结果接收方（模型方、数据方等）不参与密钥生成，只向协调器登记自己的公钥。
+// 参与方通过多方公钥切换（PCKS）把集体公钥下的密文转换为接收方公钥下的密文，
+// 只有接收方能解密，任何参与方和协调器都看不到明文。
+
+// 状态存储中的键
+const (
+	consumerPrefix = "consumers/" // consumers/<接收方ID>
+	resultPrefix   = "results/"   // results/<结果ID>
+)
+
+// Consumer 已登记的结果接收方
+type Consumer struct {
+	ID           string `json:"consumer_id"`
+	Name         string `json:"name"`
+	PublicKey    []byte `json:"-"` // 接收方公钥信封
+	RegisteredAt string `json:"registered_at"`
+}
+
+// Result 公钥切换后发给接收方的密文
+type Result struct {
+	ID         string `json:"result_id"`
+	ConsumerID string `json:"consumer_id"`
+	Ciphertext []byte `json:"-"` // 接收方公钥下的密文信封
+	CreatedAt  string `json:"created_at"`
+}
+
+// Manager 结果接收方管理器
+type Manager struct {
+	mu        sync.RWMutex
+	consumers map[string]*Consumer
+	results   map[string]*Result
+
+	// 状态存储，为空时只保存在内存中
+	store store.Store
+}
+
+// NewManager 创建结果接收方管理器
+func NewManager() *Manager {
+	return &Manager{
+		consumers: make(map[string]*Consumer),
+		results:   make(map[string]*Result),
+	}
+}
+
+// SetStore 设置状态存储，之后登记的接收方和生成的结果都会写入存储
+func (m *Manager) SetStore(s store.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = s
+}
+
+// Register 登记接收方公钥，返回分配的接收方ID
+func (m *Manager) Register(name string, publicKey []byte) (*Consumer, error) {
+	consumer := &Consumer{
+		ID:           uuid.New().String(),
+		Name:         name,
+		PublicKey:    publicKey,
+		RegisteredAt: time.Now().Format(time.RFC3339),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store != nil {
+		if err := store.PutGob(m.store, consumerPrefix+consumer.ID, consumer); err != nil {
+			return nil, fmt.Errorf("保存接收方失败: %v", err)
+		}
+	}
+	m.consumers[consumer.ID] = consumer
+	fmt.Printf("登记结果接收方 %s (%s)\n", consumer.ID, name)
+	return consumer, nil
+}
+
+// Get 按ID查找接收方
+func (m *Manager) Get(consumerID string) (*Consumer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	consumer, ok := m.consumers[consumerID]
+	return consumer, ok
+}
+
+// List 按登记时间列出全部接收方
+func (m *Manager) List() []*Consumer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]*Consumer, 0, len(m.consumers))
+	for _, consumer := range m.consumers {
+		list = append(list, consumer)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].RegisteredAt < list[j].RegisteredAt
+	})
+	return list
+}
+
+// AddResult 保存公钥切换后的密文，返回结果
+func (m *Manager) AddResult(consumerID string, ciphertext []byte) (*Result, error) {
+	result := &Result{
+		ID:         uuid.New().String(),
+		ConsumerID: consumerID,
+		Ciphertext: ciphertext,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.consumers[consumerID]; !ok {
+		return nil, fmt.Errorf("接收方 %s 不存在", consumerID)
+	}
+	if m.store != nil {
+		if err := store.PutGob(m.store, resultPrefix+result.ID, result); err != nil {
+			return nil, fmt.Errorf("保存结果失败: %v", err)
+		}
+	}
+	m.results[result.ID] = result
+	return result, nil
+}
+
+// GetResult 按ID查找结果
+func (m *Manager) GetResult(resultID string) (*Result, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result, ok := m.results[resultID]
+	return result, ok
+}
+
+// Restore 从状态存储恢复接收方和结果
+func (m *Manager) Restore() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store == nil {
+		return fmt.Errorf("未设置状态存储")
+	}
+
+	keys, err := m.store.List(consumerPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var consumer Consumer
+		if _, err := store.GetGob(m.store, key, &consumer); err != nil {
+			return err
+		}
+		m.consumers[consumer.ID] = &consumer
+	}
+
+	keys, err = m.store.List(resultPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var result Result
+		if _, err := store.GetGob(m.store, key, &result); err != nil {
+			return err
+		}
+		m.results[result.ID] = &result
+	}
+	if len(m.consumers) > 0 {
+		fmt.Printf("已恢复 %d 个结果接收方、%d 个结果\n", len(m.consumers), len(m.results))
+	}
+	return nil
+}
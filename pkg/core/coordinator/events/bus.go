@@ -0,0 +1,124 @@
+package events
+
+import (
+	"MPHEDev/pkg/core/coordinator/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	Snapshot           = "snapshot"            // 订阅建立时的完整状态
+	ParticipantJoined  = "participant_joined"  // 参与方注册
+	ParticipantLeft    = "participant_left"    // 参与方注销
+	ParticipantOnline  = "participant_online"  // 参与方上报URL并开始心跳
+	ParticipantOffline = "participant_offline" // 参与方心跳超时
+	ShareReceived      = "share_received"      // 收到一个密钥份额
+	KeyAggregated      = "key_aggregated"      // 一种密钥（或一个伽罗瓦元素的密钥）聚合完成
+	RlkRound1Ready     = "rlk_round1_ready"    // 重线性化密钥第一轮聚合完成，参与方可以提交第二轮份额
+	PhaseChanged       = "phase_changed"       // 会话阶段变化
+)
+
+// subscriberBuffer 每个订阅者的事件缓冲，写满说明订阅者跟不上，断开后由其重新订阅获取快照
+const subscriberBuffer = 64
+
+// Event 协调器推送给参与方的会话事件
+// 每个事件附带发布时的会话阶段、密钥生成进度和在线参与方，订阅者收到任一事件即可得到完整状态
+type Event struct {
+	ID            uint64                 `json:"id"`
+	Type          string                 `json:"type"`
+	Time          time.Time              `json:"time"`
+	Phase         string                 `json:"phase"` // 会话阶段，见 pkg/core/coordinator/phases
+	ParticipantID int                    `json:"participant_id,omitempty"`
+	Key           string                 `json:"key,omitempty"` // public/secret/galois/relin
+	GalEl         uint64                 `json:"gal_el,omitempty"`
+	Round         int                    `json:"round,omitempty"`
+	Status        map[string]interface{} `json:"status"` // 与 /setup/status 相同
+	Online        []utils.PeerInfo       `json:"online"` // 与 /participants/online 相同
+}
+
+// Bus 会话事件总线，发布不阻塞
+type Bus struct {
+	mu     sync.Mutex
+	lastID uint64
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish 为事件编号并发给全部订阅者，返回编号后的事件
+// 订阅者缓冲区已满时关闭其通道，订阅者重新订阅后以新的快照为准
+func (b *Bus) Publish(ev Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ev.ID = b.lastID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// LastID 最近发布的事件编号
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Subscribe 订阅之后发布的事件，总线关闭或订阅者跟不上时通道被关闭，cancel 取消订阅
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Close 关闭总线，结束全部订阅，之后的订阅立即结束
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// WriteSSE 以 Server-Sent Events 格式写出事件，事件体为一行JSON
+func WriteSSE(w io.Writer, ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
@@ -1,7 +1,6 @@
 package keys
 
 import (
-	"MPHEDev/pkg/core/coordinator/utils"
 	"fmt"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
@@ -30,7 +29,7 @@ func (a *Aggregator) AggregatePublicKey(globalCRP multiparty.PublicKeyGenCRP) er
 	publicKeyShares := a.keyManager.GetPublicKeyShares()
 	for _, data := range publicKeyShares {
 		var share multiparty.PublicKeyGenShare
-		if err := utils.DecodeShare(data, &share); err != nil {
+		if err := share.UnmarshalBinary(data); err != nil {
 			return err
 		}
 		if first {
@@ -43,7 +42,9 @@ func (a *Aggregator) AggregatePublicKey(globalCRP multiparty.PublicKeyGenCRP) er
 
 	pk := rlwe.NewPublicKey(a.keyManager.GetParams())
 	proto.GenPublicKey(aggShare, globalCRP, pk)
-	a.keyManager.SetGlobalPK(pk)
+	if err := a.keyManager.SetGlobalPK(pk); err != nil {
+		return err
+	}
 
 	fmt.Println("✓ 公钥聚合完成")
 	return nil
@@ -56,14 +57,16 @@ func (a *Aggregator) AggregateSecretKey() error {
 
 	for _, data := range secretKeyShares {
 		var sk rlwe.SecretKey
-		if err := utils.DecodeShare(data, &sk); err != nil {
+		if err := sk.UnmarshalBinary(data); err != nil {
 			return err
 		}
 		sks = append(sks, &sk)
 	}
 
 	skAgg := a.generateAggregatedSecretKey(a.keyManager.GetParams(), sks)
-	a.keyManager.SetAggregatedSecretKey(skAgg)
+	if err := a.keyManager.SetAggregatedSecretKey(skAgg); err != nil {
+		return err
+	}
 
 	fmt.Println("✓ 私钥聚合完成")
 	return nil
@@ -84,7 +87,7 @@ func (a *Aggregator) AggregateGaloisKey(galEl uint64, galoisCRP multiparty.Galoi
 
 	for _, data := range shares {
 		var share multiparty.GaloisKeyGenShare
-		if err := utils.DecodeShare(data, &share); err != nil {
+		if err := share.UnmarshalBinary(data); err != nil {
 			return err
 		}
 		if first {
@@ -102,7 +105,9 @@ func (a *Aggregator) AggregateGaloisKey(galEl uint64, galoisCRP multiparty.Galoi
 		return err
 	}
 
-	a.keyManager.AddGaloisKey(gk)
+	if err := a.keyManager.AddGaloisKey(gk); err != nil {
+		return err
+	}
 	fmt.Printf("✓ 伽罗瓦密钥聚合完成 (galEl: %d)\n", galEl)
 	return nil
 }
@@ -117,7 +122,7 @@ func (a *Aggregator) AggregateRelinearizationKeyRound1() error {
 	rlkShare1Map := a.keyManager.GetRelinearizationShare1Map()
 	for _, data := range rlkShare1Map {
 		var share multiparty.RelinearizationKeyGenShare
-		if err := utils.DecodeShare(data, &share); err != nil {
+		if err := share.UnmarshalBinary(data); err != nil {
 			return err
 		}
 		if first {
@@ -129,7 +134,9 @@ func (a *Aggregator) AggregateRelinearizationKeyRound1() error {
 	}
 
 	// 存储聚合后的第一轮份额，供第二轮使用
-	a.keyManager.SetRelinearizationShare1Aggregated(&aggShare)
+	if err := a.keyManager.SetRelinearizationShare1Aggregated(&aggShare); err != nil {
+		return err
+	}
 	fmt.Println("✓ 重线性化密钥第一轮聚合完成")
 	return nil
 }
@@ -144,7 +151,7 @@ func (a *Aggregator) AggregateRelinearizationKeyRound2() error {
 	rlkShare2Map := a.keyManager.GetRelinearizationShare2Map()
 	for _, data := range rlkShare2Map {
 		var share multiparty.RelinearizationKeyGenShare
-		if err := utils.DecodeShare(data, &share); err != nil {
+		if err := share.UnmarshalBinary(data); err != nil {
 			return err
 		}
 		if first {
@@ -158,7 +165,9 @@ func (a *Aggregator) AggregateRelinearizationKeyRound2() error {
 	// 生成最终的重线性化密钥
 	rlk := rlwe.NewRelinearizationKey(a.keyManager.GetParams())
 	proto.GenRelinearizationKey(*a.keyManager.GetRelinearizationShare1Aggregated(), aggShare, rlk)
-	a.keyManager.SetRelinearizationKey(rlk)
+	if err := a.keyManager.SetRelinearizationKey(rlk); err != nil {
+		return err
+	}
 
 	fmt.Println("✓ 重线性化密钥第二轮聚合完成")
 	return nil
@@ -1,7 +1,8 @@
 package keys
 
 import (
-	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/envelope"
 	"fmt"
 	"sync"
 
@@ -19,6 +20,7 @@ type Manager struct {
 	// 公钥相关
 	publicKeyShares map[int][]byte
 	globalPK        *rlwe.PublicKey
+	pkFingerprint   envelope.KeyCache // 集体公钥指纹的缓存
 
 	// 私钥相关
 	secretKeyShares map[int][]byte
@@ -36,6 +38,9 @@ type Manager struct {
 	rlk                 *rlwe.RelinearizationKey
 	rlkProto            multiparty.RelinearizationKeyGenProtocol
 	rlkRound            int // 当前轮次：1或2
+
+	// 状态存储，份额和聚合结果先写入存储再更新内存，为空时只保存在内存中
+	store store.Store
 }
 
 // NewManager 创建新的密钥管理器
@@ -62,6 +67,9 @@ func (km *Manager) AddPublicKeyShare(participantID int, data []byte) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
 
+	if err := km.persist(publicShareKey(participantID), data); err != nil {
+		return err
+	}
 	km.publicKeyShares[participantID] = data
 
 	// 只在达到预期数量时输出汇总信息
@@ -79,6 +87,9 @@ func (km *Manager) AddSecretKey(participantID int, data []byte) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
 
+	if err := km.persist(secretShareKey(participantID), data); err != nil {
+		return err
+	}
 	km.secretKeyShares[participantID] = data
 
 	// 只在达到预期数量时输出汇总信息
@@ -96,6 +107,9 @@ func (km *Manager) AddGaloisKeyShare(participantID int, galEl uint64, data []byt
 	km.mu.Lock()
 	defer km.mu.Unlock()
 
+	if err := km.persist(galoisShareKey(galEl, participantID), data); err != nil {
+		return err
+	}
 	if km.galoisKeyShares[galEl] == nil {
 		km.galoisKeyShares[galEl] = make(map[int][]byte)
 	}
@@ -117,6 +131,13 @@ func (km *Manager) AddRelinearizationKeyShare(participantID int, round int, data
 	km.mu.Lock()
 	defer km.mu.Unlock()
 
+	if round != 1 && round != 2 {
+		return fmt.Errorf("无效的轮次: %d", round)
+	}
+	if err := km.persist(rlkShareKey(round, participantID), data); err != nil {
+		return err
+	}
+
 	if round == 1 {
 		km.rlkShare1Map[participantID] = data
 
@@ -127,7 +148,7 @@ func (km *Manager) AddRelinearizationKeyShare(participantID int, round int, data
 			// 每5个或第1个时输出进度
 			fmt.Printf("重线性化密钥第一轮份额收集进度: %d/%d\n", len(km.rlkShare1Map), km.expectedN)
 		}
-	} else if round == 2 {
+	} else {
 		km.rlkShare2Map[participantID] = data
 
 		// 只在达到预期数量时输出汇总信息
@@ -137,28 +158,21 @@ func (km *Manager) AddRelinearizationKeyShare(participantID int, round int, data
 			// 每5个或第1个时输出进度
 			fmt.Printf("重线性化密钥第二轮份额收集进度: %d/%d\n", len(km.rlkShare2Map), km.expectedN)
 		}
-	} else {
-		return fmt.Errorf("无效的轮次: %d", round)
 	}
 
 	return nil
 }
 
-// GetRelinearizationKeyRound1Aggregated 获取聚合后的第一轮重线性化密钥份额
-func (km *Manager) GetRelinearizationKeyRound1Aggregated() (string, error) {
+// GetRelinearizationKeyRound1Aggregated 获取聚合后的第一轮重线性化密钥份额的二进制编码
+func (km *Manager) GetRelinearizationKeyRound1Aggregated() ([]byte, error) {
 	km.mu.RLock()
 	defer km.mu.RUnlock()
 
 	if km.rlkShare1Aggregated == nil {
-		return "", fmt.Errorf("第一轮份额尚未聚合")
-	}
-
-	shareBytes, err := utils.EncodeShare(*km.rlkShare1Aggregated)
-	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("第一轮份额尚未聚合")
 	}
 
-	return utils.EncodeToBase64(shareBytes), nil
+	return km.rlkShare1Aggregated.MarshalBinary()
 }
 
 // GetGlobalPK 获取全局公钥
@@ -168,6 +182,11 @@ func (km *Manager) GetGlobalPK() *rlwe.PublicKey {
 	return km.globalPK
 }
 
+// GlobalPKFingerprint 集体公钥的指纹，密文和份额的信封绑定该指纹，公钥未生成时为零指纹
+func (km *Manager) GlobalPKFingerprint() envelope.Fingerprint {
+	return km.pkFingerprint.Fingerprint(km.GetGlobalPK())
+}
+
 // GetAggregatedSecretKey 获取聚合私钥
 func (km *Manager) GetAggregatedSecretKey() *rlwe.SecretKey {
 	km.mu.RLock()
@@ -182,6 +201,56 @@ func (km *Manager) GetGaloisKeys() []*rlwe.GaloisKey {
 	return km.galoisKeys
 }
 
+// HasGaloisKey 指定伽罗瓦元素的密钥是否已聚合完成
+func (km *Manager) HasGaloisKey(galEl uint64) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	for _, gk := range km.galoisKeys {
+		if gk.GaloisElement == galEl {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPublicKeyShare 是否已收到参与方的公钥份额
+func (km *Manager) HasPublicKeyShare(participantID int) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	_, ok := km.publicKeyShares[participantID]
+	return ok
+}
+
+// HasSecretKey 是否已收到参与方的私钥
+func (km *Manager) HasSecretKey(participantID int) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	_, ok := km.secretKeyShares[participantID]
+	return ok
+}
+
+// HasGaloisKeyShare 是否已收到参与方指定伽罗瓦元素的份额
+func (km *Manager) HasGaloisKeyShare(participantID int, galEl uint64) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	_, ok := km.galoisKeyShares[galEl][participantID]
+	return ok
+}
+
+// HasRelinearizationKeyShare 是否已收到参与方指定轮次的重线性化密钥份额
+func (km *Manager) HasRelinearizationKeyShare(participantID int, round int) bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	var ok bool
+	switch round {
+	case 1:
+		_, ok = km.rlkShare1Map[participantID]
+	case 2:
+		_, ok = km.rlkShare2Map[participantID]
+	}
+	return ok
+}
+
 // GetRelinearizationKey 获取重线性化密钥
 func (km *Manager) GetRelinearizationKey() *rlwe.RelinearizationKey {
 	km.mu.RLock()
@@ -191,6 +260,8 @@ func (km *Manager) GetRelinearizationKey() *rlwe.RelinearizationKey {
 
 // GetExpectedN 获取期望的参与方数量
 func (km *Manager) GetExpectedN() int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
 	return km.expectedN
 }
 
@@ -210,38 +281,58 @@ func (km *Manager) GetRelinearizationProto() multiparty.RelinearizationKeyGenPro
 }
 
 // SetGlobalPK 设置全局公钥
-func (km *Manager) SetGlobalPK(pk *rlwe.PublicKey) {
+func (km *Manager) SetGlobalPK(pk *rlwe.PublicKey) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
+	if err := km.persistObject(aggregatedPublicKey, pk); err != nil {
+		return err
+	}
 	km.globalPK = pk
+	return nil
 }
 
 // SetAggregatedSecretKey 设置聚合私钥
-func (km *Manager) SetAggregatedSecretKey(sk *rlwe.SecretKey) {
+func (km *Manager) SetAggregatedSecretKey(sk *rlwe.SecretKey) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
+	if err := km.persistObject(aggregatedSecretKey, sk); err != nil {
+		return err
+	}
 	km.skAgg = sk
+	return nil
 }
 
 // AddGaloisKey 添加伽罗瓦密钥
-func (km *Manager) AddGaloisKey(gk *rlwe.GaloisKey) {
+func (km *Manager) AddGaloisKey(gk *rlwe.GaloisKey) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
+	if err := km.persistObject(aggregatedGaloisKey(gk.GaloisElement), gk); err != nil {
+		return err
+	}
 	km.galoisKeys = append(km.galoisKeys, gk)
+	return nil
 }
 
 // SetRelinearizationKey 设置重线性化密钥
-func (km *Manager) SetRelinearizationKey(rlk *rlwe.RelinearizationKey) {
+func (km *Manager) SetRelinearizationKey(rlk *rlwe.RelinearizationKey) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
+	if err := km.persistObject(aggregatedRelinKey, rlk); err != nil {
+		return err
+	}
 	km.rlk = rlk
+	return nil
 }
 
 // SetRelinearizationShare1Aggregated 设置聚合后的第一轮重线性化密钥份额
-func (km *Manager) SetRelinearizationShare1Aggregated(share *multiparty.RelinearizationKeyGenShare) {
+func (km *Manager) SetRelinearizationShare1Aggregated(share *multiparty.RelinearizationKeyGenShare) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
+	if err := km.persistObject(aggregatedRelinRound1, share); err != nil {
+		return err
+	}
 	km.rlkShare1Aggregated = share
+	return nil
 }
 
 // GetPublicKeyShares 获取公钥份额
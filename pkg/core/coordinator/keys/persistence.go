@@ -0,0 +1,225 @@
+package keys
+
+import (
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// ==================== 密钥状态持久化 ====================
+//
+// 每个份额单独保存为一个键，上传一个份额只写一次；聚合结果保存在 keys/aggregated 下。
+// 恢复后份额已收齐但尚未聚合的阶段由协调器重新聚合。
+
+// 存储中的键
+const (
+	publicSharePrefix  = "keys/public/"
+	secretSharePrefix  = "keys/secret/"
+	galoisSharePrefix  = "keys/galois/" // keys/galois/<galEl>/<participantID>
+	rlkSharePrefix     = "keys/rlk/"    // keys/rlk/<round>/<participantID>
+	aggregatedPrefix   = "keys/aggregated/"
+	aggregatedGaloisPx = aggregatedPrefix + "galois/"
+
+	aggregatedPublicKey   = aggregatedPrefix + "public"
+	aggregatedSecretKey   = aggregatedPrefix + "secret"
+	aggregatedRelinRound1 = aggregatedPrefix + "rlk_round1"
+	aggregatedRelinKey    = aggregatedPrefix + "rlk"
+)
+
+func publicShareKey(participantID int) string {
+	return publicSharePrefix + strconv.Itoa(participantID)
+}
+
+func secretShareKey(participantID int) string {
+	return secretSharePrefix + strconv.Itoa(participantID)
+}
+
+func galoisShareKey(galEl uint64, participantID int) string {
+	return galoisSharePrefix + strconv.FormatUint(galEl, 10) + "/" + strconv.Itoa(participantID)
+}
+
+func rlkShareKey(round int, participantID int) string {
+	return rlkSharePrefix + strconv.Itoa(round) + "/" + strconv.Itoa(participantID)
+}
+
+func aggregatedGaloisKey(galEl uint64) string {
+	return aggregatedGaloisPx + strconv.FormatUint(galEl, 10)
+}
+
+// SetStore 设置状态存储，之后的份额和聚合结果都会写入存储
+func (km *Manager) SetStore(s store.Store) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.store = s
+}
+
+// persist 写入存储，调用方需持有写锁
+func (km *Manager) persist(key string, data []byte) error {
+	if km.store == nil {
+		return nil
+	}
+	if err := km.store.Put(key, data); err != nil {
+		return fmt.Errorf("保存密钥状态失败: %v", err)
+	}
+	return nil
+}
+
+// persistObject 编码后写入存储，调用方需持有写锁
+func (km *Manager) persistObject(key string, v interface{}) error {
+	if km.store == nil {
+		return nil
+	}
+	data, err := utils.EncodeShare(v)
+	if err != nil {
+		return fmt.Errorf("编码 %s 失败: %v", key, err)
+	}
+	return km.persist(key, data)
+}
+
+// Restore 从状态存储恢复份额和聚合结果
+func (km *Manager) Restore() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if km.store == nil {
+		return fmt.Errorf("未设置状态存储")
+	}
+
+	if err := km.restoreShares(publicSharePrefix, func(path []string, data []byte) error {
+		id, err := strconv.Atoi(path[0])
+		if err != nil {
+			return err
+		}
+		km.publicKeyShares[id] = data
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := km.restoreShares(secretSharePrefix, func(path []string, data []byte) error {
+		id, err := strconv.Atoi(path[0])
+		if err != nil {
+			return err
+		}
+		km.secretKeyShares[id] = data
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := km.restoreShares(galoisSharePrefix, func(path []string, data []byte) error {
+		if len(path) != 2 {
+			return fmt.Errorf("无效的键")
+		}
+		galEl, err := strconv.ParseUint(path[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.Atoi(path[1])
+		if err != nil {
+			return err
+		}
+		if km.galoisKeyShares[galEl] == nil {
+			km.galoisKeyShares[galEl] = make(map[int][]byte)
+		}
+		km.galoisKeyShares[galEl][id] = data
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := km.restoreShares(rlkSharePrefix, func(path []string, data []byte) error {
+		if len(path) != 2 {
+			return fmt.Errorf("无效的键")
+		}
+		id, err := strconv.Atoi(path[1])
+		if err != nil {
+			return err
+		}
+		switch path[0] {
+		case "1":
+			km.rlkShare1Map[id] = data
+		case "2":
+			km.rlkShare2Map[id] = data
+		default:
+			return fmt.Errorf("无效的轮次: %s", path[0])
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// 聚合结果
+	var pk rlwe.PublicKey
+	if ok, err := km.restoreObject(aggregatedPublicKey, &pk); err != nil {
+		return err
+	} else if ok {
+		km.globalPK = &pk
+	}
+	var sk rlwe.SecretKey
+	if ok, err := km.restoreObject(aggregatedSecretKey, &sk); err != nil {
+		return err
+	} else if ok {
+		km.skAgg = &sk
+	}
+	var share1 multiparty.RelinearizationKeyGenShare
+	if ok, err := km.restoreObject(aggregatedRelinRound1, &share1); err != nil {
+		return err
+	} else if ok {
+		km.rlkShare1Aggregated = &share1
+		km.rlkRound = 2
+	}
+	var rlk rlwe.RelinearizationKey
+	if ok, err := km.restoreObject(aggregatedRelinKey, &rlk); err != nil {
+		return err
+	} else if ok {
+		km.rlk = &rlk
+	}
+
+	galoisKeys, err := km.store.List(aggregatedGaloisPx)
+	if err != nil {
+		return err
+	}
+	for _, key := range galoisKeys {
+		var gk rlwe.GaloisKey
+		if _, err := km.restoreObject(key, &gk); err != nil {
+			return err
+		}
+		km.galoisKeys = append(km.galoisKeys, &gk)
+	}
+
+	fmt.Printf("已恢复密钥状态: 公钥份额 %d，伽罗瓦密钥 %d 个，重线性化密钥第一轮份额 %d、第二轮份额 %d\n",
+		len(km.publicKeyShares), len(km.galoisKeys), len(km.rlkShare1Map), len(km.rlkShare2Map))
+	return nil
+}
+
+// restoreShares 读取前缀下的全部份额，path 为键去掉前缀后按 "/" 拆分的各段
+func (km *Manager) restoreShares(prefix string, apply func(path []string, data []byte) error) error {
+	keys, err := km.store.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, _, err := km.store.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := apply(strings.Split(strings.TrimPrefix(key, prefix), "/"), data); err != nil {
+			return fmt.Errorf("恢复 %s 失败: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// restoreObject 读取并解码聚合结果
+func (km *Manager) restoreObject(key string, v interface{}) (bool, error) {
+	data, ok, err := km.store.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := utils.DecodeShare(data, v); err != nil {
+		return false, fmt.Errorf("解码 %s 失败: %v", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,133 @@
+package keys
+
+import (
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"fmt"
+)
+
+// keysPrefix 全部密钥状态的公共前缀
+const keysPrefix = "keys/"
+
+// Replace 用密钥轮换得到的下一纪元密钥替换当前的全部份额和聚合结果
+// next 只保存在内存中：先把它的份额和聚合结果写入存储、删除存储中旧纪元多余的键，再替换内存中的内容。
+// 协调器其他组件持有的是同一个管理器，替换后立即使用新密钥；加入新成员的轮换同时更新参与方数量
+func (km *Manager) Replace(next *Manager) error {
+	next.mu.RLock()
+	defer next.mu.RUnlock()
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	if next.globalPK == nil || next.rlk == nil || len(next.galoisKeys) != len(next.galoisKeyShares) {
+		return fmt.Errorf("下一纪元的密钥尚未全部聚合")
+	}
+	if km.store != nil {
+		written, err := next.writeTo(km.store)
+		if err != nil {
+			return fmt.Errorf("保存新纪元密钥失败: %v", err)
+		}
+		existing, err := km.store.List(keysPrefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range existing {
+			if written[key] {
+				continue
+			}
+			if err := km.store.Delete(key); err != nil {
+				return fmt.Errorf("删除旧纪元密钥状态失败: %v", err)
+			}
+		}
+	}
+
+	km.publicKeyShares = next.publicKeyShares
+	km.globalPK = next.globalPK
+	km.secretKeyShares = next.secretKeyShares
+	km.skAgg = next.skAgg
+	km.galoisKeyShares = next.galoisKeyShares
+	km.galoisKeys = next.galoisKeys
+	km.rlkShare1Map = next.rlkShare1Map
+	km.rlkShare2Map = next.rlkShare2Map
+	km.rlkShare1Aggregated = next.rlkShare1Aggregated
+	km.rlk = next.rlk
+	km.rlkRound = next.rlkRound
+	km.expectedN = next.expectedN
+	return nil
+}
+
+// SetExpectedN 更新参与方数量，恢复加入过新成员的会话时使用
+func (km *Manager) SetExpectedN(n int) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.expectedN = n
+}
+
+// writeTo 把全部份额和聚合结果写入存储s，返回写入的键，调用方需持有读锁
+func (km *Manager) writeTo(s store.Store) (map[string]bool, error) {
+	written := make(map[string]bool)
+	put := func(key string, data []byte) error {
+		if err := s.Put(key, data); err != nil {
+			return err
+		}
+		written[key] = true
+		return nil
+	}
+	putObject := func(key string, v interface{}) error {
+		data, err := utils.EncodeShare(v)
+		if err != nil {
+			return fmt.Errorf("编码 %s 失败: %v", key, err)
+		}
+		return put(key, data)
+	}
+
+	for id, data := range km.publicKeyShares {
+		if err := put(publicShareKey(id), data); err != nil {
+			return nil, err
+		}
+	}
+	for id, data := range km.secretKeyShares {
+		if err := put(secretShareKey(id), data); err != nil {
+			return nil, err
+		}
+	}
+	for galEl, shares := range km.galoisKeyShares {
+		for id, data := range shares {
+			if err := put(galoisShareKey(galEl, id), data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for id, data := range km.rlkShare1Map {
+		if err := put(rlkShareKey(1, id), data); err != nil {
+			return nil, err
+		}
+	}
+	for id, data := range km.rlkShare2Map {
+		if err := put(rlkShareKey(2, id), data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := putObject(aggregatedPublicKey, km.globalPK); err != nil {
+		return nil, err
+	}
+	if km.skAgg != nil {
+		if err := putObject(aggregatedSecretKey, km.skAgg); err != nil {
+			return nil, err
+		}
+	}
+	if km.rlkShare1Aggregated != nil {
+		if err := putObject(aggregatedRelinRound1, km.rlkShare1Aggregated); err != nil {
+			return nil, err
+		}
+	}
+	if err := putObject(aggregatedRelinKey, km.rlk); err != nil {
+		return nil, err
+	}
+	for _, gk := range km.galoisKeys {
+		if err := putObject(aggregatedGaloisKey(gk.GaloisElement), gk); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
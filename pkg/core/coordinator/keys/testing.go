@@ -9,17 +9,29 @@ import (
 )
 
 // Tester 密钥测试器
+// 默认通过协同解密验证密钥，协调器不持有任何私钥；
+// 只有在insecureDebug模式下且参与方上传了私钥时才使用聚合私钥skAgg直接解密
 type Tester struct {
-	keyManager *Manager
+	keyManager    *Manager
+	decryptor     CollaborativeDecryptor
+	insecureDebug bool
 }
 
 // NewTester 创建新的密钥测试器
-func NewTester(keyManager *Manager) *Tester {
+// decryptor 为协同解密函数，insecureDebug 为是否允许使用聚合私钥测试
+func NewTester(keyManager *Manager, decryptor CollaborativeDecryptor, insecureDebug bool) *Tester {
 	return &Tester{
-		keyManager: keyManager,
+		keyManager:    keyManager,
+		decryptor:     decryptor,
+		insecureDebug: insecureDebug,
 	}
 }
 
+// useAggregatedSecretKey 是否使用聚合私钥进行测试（仅调试模式）
+func (t *Tester) useAggregatedSecretKey() bool {
+	return t.insecureDebug && t.keyManager.GetAggregatedSecretKey() != nil
+}
+
 // TestAllKeys 测试所有密钥
 func (t *Tester) TestAllKeys(params ckks.Parameters, galEls []uint64) error {
 	fmt.Println("\n========== 开始密钥测试 ==========")
@@ -28,9 +40,6 @@ func (t *Tester) TestAllKeys(params ckks.Parameters, galEls []uint64) error {
 	if t.keyManager.GetGlobalPK() == nil {
 		return fmt.Errorf("全局公钥未准备就绪")
 	}
-	if t.keyManager.GetAggregatedSecretKey() == nil {
-		return fmt.Errorf("聚合私钥未准备就绪")
-	}
 	if t.keyManager.GetRelinearizationKey() == nil {
 		return fmt.Errorf("重线性化密钥未准备就绪")
 	}
@@ -38,6 +47,15 @@ func (t *Tester) TestAllKeys(params ckks.Parameters, galEls []uint64) error {
 		return fmt.Errorf("伽罗瓦密钥未准备就绪")
 	}
 
+	if !t.useAggregatedSecretKey() {
+		if err := t.testAllKeysCollaborative(params, galEls); err != nil {
+			return err
+		}
+		fmt.Println("\n========== 所有密钥测试完成 ==========")
+		return nil
+	}
+	fmt.Println("[INSECURE-DEBUG] 使用聚合私钥skAgg测试密钥")
+
 	// 创建编码器和加解密器
 	encoder := ckks.NewEncoder(params)
 	encryptor := ckks.NewEncryptor(params, t.keyManager.GetGlobalPK())
@@ -64,8 +82,11 @@ func (t *Tester) TestAllKeys(params ckks.Parameters, galEls []uint64) error {
 
 // TestPublicKeyOnly 仅测试公钥
 func (t *Tester) TestPublicKeyOnly(params ckks.Parameters) error {
-	if t.keyManager.GetGlobalPK() == nil || t.keyManager.GetAggregatedSecretKey() == nil {
-		return fmt.Errorf("公钥或私钥未准备就绪")
+	if t.keyManager.GetGlobalPK() == nil {
+		return fmt.Errorf("公钥未准备就绪")
+	}
+	if !t.useAggregatedSecretKey() {
+		return t.testPublicKeyCollaborative(params)
 	}
 
 	encoder := ckks.NewEncoder(params)
@@ -81,8 +102,11 @@ func (t *Tester) TestRelinearizationKeyOnly(params ckks.Parameters) error {
 	if t.keyManager.GetRelinearizationKey() == nil {
 		return fmt.Errorf("重线性化密钥未准备就绪")
 	}
-	if t.keyManager.GetGlobalPK() == nil || t.keyManager.GetAggregatedSecretKey() == nil {
-		return fmt.Errorf("公钥或私钥未准备就绪")
+	if t.keyManager.GetGlobalPK() == nil {
+		return fmt.Errorf("公钥未准备就绪")
+	}
+	if !t.useAggregatedSecretKey() {
+		return t.testRelinearizationKeyCollaborative(params)
 	}
 
 	encoder := ckks.NewEncoder(params)
@@ -100,8 +124,11 @@ func (t *Tester) TestGaloisKeysOnly(params ckks.Parameters, galEls []uint64) err
 	if len(t.keyManager.GetGaloisKeys()) == 0 {
 		return fmt.Errorf("伽罗瓦密钥未准备就绪")
 	}
-	if t.keyManager.GetAggregatedSecretKey() == nil {
-		return fmt.Errorf("聚合私钥未准备就绪")
+	if !t.useAggregatedSecretKey() {
+		if t.keyManager.GetGlobalPK() == nil {
+			return fmt.Errorf("公钥未准备就绪")
+		}
+		return t.testGaloisKeysCollaborative(params, galEls)
 	}
 
 	evk := rlwe.NewMemEvaluationKeySet(nil, t.keyManager.GetGaloisKeys()...)
@@ -0,0 +1,202 @@
+package keys
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// ==================== 基于协同解密的密钥验证 ====================
+//
+// 协调器只持有公钥和评估密钥：用全局公钥加密测试数据、在密文上执行同态运算，
+// 再把结果密文交给参与方协同解密，与明文计算结果比较。
+// 协同解密引入了平滑噪声，因此按最大误差阈值判断，错误的密钥会得到完全随机的结果。
+
+// CollaborativeDecryptor 协同解密函数，由协调器组织参与方完成一次解密
+type CollaborativeDecryptor func(ct *rlwe.Ciphertext) (*rlwe.Plaintext, error)
+
+// maxVerifyError 协同验证允许的最大单槽误差
+// 淹没噪声带来的误差随参与方数量和统计安全参数增大（见 smudging 包），
+// 默认配置下远小于该阈值，错误密钥的误差则在 2^300 量级
+const maxVerifyError = 0.5
+
+// testAllKeysCollaborative 通过协同解密测试所有密钥
+func (t *Tester) testAllKeysCollaborative(params ckks.Parameters, galEls []uint64) error {
+	fmt.Println("\n--- 协同解密测试公钥功能 ---")
+	if err := t.testPublicKeyCollaborative(params); err != nil {
+		return err
+	}
+
+	fmt.Println("\n--- 协同解密测试重线性化密钥功能 ---")
+	if err := t.testRelinearizationKeyCollaborative(params); err != nil {
+		return err
+	}
+
+	fmt.Println("\n--- 协同解密测试伽罗瓦密钥功能 ---")
+	return t.testGaloisKeysCollaborative(params, galEls)
+}
+
+// testPublicKeyCollaborative 加密后协同解密，验证全局公钥
+func (t *Tester) testPublicKeyCollaborative(params ckks.Parameters) error {
+	encoder := ckks.NewEncoder(params)
+	values := verificationValues(params.MaxSlots(), 1)
+
+	_, ct, err := t.encryptValues(params, encoder, values)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := t.collaborativeDecode(encoder, ct)
+	if err != nil {
+		return fmt.Errorf("公钥测试协同解密失败: %v", err)
+	}
+	if err := checkValues(values, decoded, "公钥"); err != nil {
+		return err
+	}
+	fmt.Println("公钥测试通过")
+	return nil
+}
+
+// testRelinearizationKeyCollaborative 密文乘法并重线性化后协同解密，验证重线性化密钥
+func (t *Tester) testRelinearizationKeyCollaborative(params ckks.Parameters) error {
+	encoder := ckks.NewEncoder(params)
+	values1 := verificationValues(params.MaxSlots(), 1)
+	values2 := verificationValues(params.MaxSlots(), 2)
+
+	_, ct1, err := t.encryptValues(params, encoder, values1)
+	if err != nil {
+		return err
+	}
+	_, ct2, err := t.encryptValues(params, encoder, values2)
+	if err != nil {
+		return err
+	}
+
+	evaluator := ckks.NewEvaluator(params, rlwe.NewMemEvaluationKeySet(t.keyManager.GetRelinearizationKey()))
+	ctMul, err := evaluator.MulRelinNew(ct1, ct2)
+	if err != nil {
+		return fmt.Errorf("密文乘法失败: %v", err)
+	}
+	if err := evaluator.Rescale(ctMul, ctMul); err != nil {
+		return fmt.Errorf("重缩放失败: %v", err)
+	}
+
+	decoded, err := t.collaborativeDecode(encoder, ctMul)
+	if err != nil {
+		return fmt.Errorf("重线性化密钥测试协同解密失败: %v", err)
+	}
+
+	want := make([]complex128, len(values1))
+	for i := range want {
+		want[i] = values1[i] * values2[i]
+	}
+	if err := checkValues(want, decoded, "重线性化密钥"); err != nil {
+		return err
+	}
+	fmt.Println("重线性化密钥测试通过")
+	return nil
+}
+
+// testGaloisKeysCollaborative 对每个伽罗瓦元素执行自同构后协同解密，验证伽罗瓦密钥
+// 期望结果由明文多项式直接做同一自同构得到
+func (t *Tester) testGaloisKeysCollaborative(params ckks.Parameters, galEls []uint64) error {
+	encoder := ckks.NewEncoder(params)
+	values := verificationValues(params.MaxSlots(), 3)
+
+	pt, ct, err := t.encryptValues(params, encoder, values)
+	if err != nil {
+		return err
+	}
+
+	evaluator := ckks.NewEvaluator(params, rlwe.NewMemEvaluationKeySet(nil, t.keyManager.GetGaloisKeys()...))
+	ringQ := params.RingQ().AtLevel(pt.Level())
+
+	validKeys := 0
+	for _, galEl := range galEls {
+		ctRot := ckks.NewCiphertext(params, 1, ct.Level())
+		if err := evaluator.Automorphism(ct, galEl, ctRot); err != nil {
+			return fmt.Errorf("伽罗瓦元素 %d 自同构失败: %v", galEl, err)
+		}
+
+		ptRot := ckks.NewPlaintext(params, pt.Level())
+		ptRot.Scale = pt.Scale
+		ringQ.AutomorphismNTT(pt.Value, galEl, ptRot.Value)
+		want := make([]complex128, len(values))
+		if err := encoder.Decode(ptRot, want); err != nil {
+			return fmt.Errorf("解码期望结果失败: %v", err)
+		}
+
+		decoded, err := t.collaborativeDecode(encoder, ctRot)
+		if err != nil {
+			return fmt.Errorf("伽罗瓦元素 %d 协同解密失败: %v", galEl, err)
+		}
+		if err := checkValues(want, decoded, fmt.Sprintf("伽罗瓦密钥(galEl: %d)", galEl)); err != nil {
+			return err
+		}
+		validKeys++
+	}
+
+	fmt.Printf("成功验证 %d 个伽罗瓦密钥\n", validKeys)
+	fmt.Println("伽罗瓦密钥测试通过")
+	return nil
+}
+
+// encryptValues 编码并用全局公钥加密
+func (t *Tester) encryptValues(params ckks.Parameters, encoder *ckks.Encoder, values []complex128) (*rlwe.Plaintext, *rlwe.Ciphertext, error) {
+	pt := ckks.NewPlaintext(params, params.MaxLevel())
+	if err := encoder.Encode(values, pt); err != nil {
+		return nil, nil, fmt.Errorf("编码失败: %v", err)
+	}
+	encryptor := ckks.NewEncryptor(params, t.keyManager.GetGlobalPK())
+	ct, err := encryptor.EncryptNew(pt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("加密失败: %v", err)
+	}
+	return pt, ct, nil
+}
+
+// collaborativeDecode 协同解密并解码
+func (t *Tester) collaborativeDecode(encoder *ckks.Encoder, ct *rlwe.Ciphertext) ([]complex128, error) {
+	if t.decryptor == nil {
+		return nil, fmt.Errorf("未配置协同解密")
+	}
+	pt, err := t.decryptor(ct)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]complex128, ct.Slots())
+	if err := encoder.Decode(pt, decoded); err != nil {
+		return nil, fmt.Errorf("解码失败: %v", err)
+	}
+	return decoded, nil
+}
+
+// verificationValues 生成[-1,1]范围内的测试数据
+func verificationValues(slots int, seed int64) []complex128 {
+	r := rand.New(rand.NewSource(seed))
+	values := make([]complex128, slots)
+	for i := range values {
+		values[i] = complex(2*r.Float64()-1, 2*r.Float64()-1)
+	}
+	return values
+}
+
+// checkValues 比较期望值和协同解密结果
+func checkValues(want, have []complex128, name string) error {
+	if len(want) != len(have) {
+		return fmt.Errorf("%s测试失败: 长度不匹配 %d/%d", name, len(have), len(want))
+	}
+	maxErr := 0.0
+	for i := range want {
+		maxErr = math.Max(maxErr, cmplx.Abs(want[i]-have[i]))
+	}
+	fmt.Printf("%s 最大误差: %.6f (log2: %.2f)\n", name, maxErr, math.Log2(maxErr))
+	if maxErr > maxVerifyError {
+		return fmt.Errorf("%s测试失败: 最大误差 %.6f 超过阈值 %.2f", name, maxErr, maxVerifyError)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package parameters
+
+import (
+	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/crs"
+	"fmt"
+)
+
+// ==================== 会话CRS种子协商（commit-reveal） ====================
+//
+// 协调器在初始化时生成随机种子，注册时只公开其承诺。开启协商时，每个参与方先提交
+// 自己随机种子的承诺，全部承诺到齐后再公开种子；协调器校验承诺后派生最终种子。
+// 协调器的承诺在参与方公开种子之前就已固定，因此任何一方都无法单独控制最终种子。
+
+// CRS协商阶段
+const (
+	CRSPhaseCommit = "commit" // 等待参与方提交承诺
+	CRSPhaseReveal = "reveal" // 等待参与方公开种子
+	CRSPhaseDone   = "done"   // 最终种子已确定
+)
+
+// GetSessionID 获取会话ID
+func (pm *Manager) GetSessionID() string {
+	return pm.sessionID
+}
+
+// GetCRSCommitment 获取协调器种子的承诺，注册时下发给参与方
+func (pm *Manager) GetCRSCommitment() string {
+	return crs.Commitment(pm.sessionID, crs.CoordinatorID, pm.coordinatorSeed)
+}
+
+// IsCRSContributionRequired 是否需要参与方贡献种子
+func (pm *Manager) IsCRSContributionRequired() bool {
+	return pm.crsContributors > 0
+}
+
+// GetCRSContributors 需要贡献种子的参与方数量，即初始密钥生成的参与方数量，0表示不协商
+func (pm *Manager) GetCRSContributors() int {
+	return pm.crsContributors
+}
+
+// IsCRSReady 最终CRS种子是否已确定
+func (pm *Manager) IsCRSReady() bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.commonCRSSeed != ""
+}
+
+// GetCRSPhase 获取当前协商阶段
+func (pm *Manager) GetCRSPhase() string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.crsPhaseLocked()
+}
+
+func (pm *Manager) crsPhaseLocked() string {
+	if pm.commonCRSSeed != "" {
+		return CRSPhaseDone
+	}
+	if len(pm.crsCommitments) < pm.crsContributors {
+		return CRSPhaseCommit
+	}
+	return CRSPhaseReveal
+}
+
+// CommitCRS 记录参与方的种子承诺
+func (pm *Manager) CommitCRS(participantID int, commitment string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.crsContributors <= 0 {
+		return fmt.Errorf("本会话未开启CRS种子协商")
+	}
+	if len(commitment) != 64 {
+		return fmt.Errorf("无效的承诺长度: %d", len(commitment))
+	}
+	if existing, ok := pm.crsCommitments[participantID]; ok {
+		if existing == commitment {
+			return nil
+		}
+		return fmt.Errorf("参与方 %d 已提交过不同的承诺", participantID)
+	}
+	if pm.crsPhaseLocked() != CRSPhaseCommit {
+		return fmt.Errorf("承诺阶段已结束")
+	}
+
+	pm.crsCommitments[participantID] = commitment
+	if err := pm.persistLocked(); err != nil {
+		delete(pm.crsCommitments, participantID)
+		return err
+	}
+	fmt.Printf("收到参与方 %d 的CRS承诺 (%d/%d)\n", participantID, len(pm.crsCommitments), pm.crsContributors)
+	return nil
+}
+
+// RevealCRS 记录参与方公开的种子，全部到齐后派生最终种子
+func (pm *Manager) RevealCRS(participantID int, seed []byte) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.crsPhaseLocked() == CRSPhaseCommit {
+		return fmt.Errorf("承诺尚未全部提交，不能公开种子")
+	}
+	commitment, ok := pm.crsCommitments[participantID]
+	if !ok {
+		return fmt.Errorf("参与方 %d 未提交承诺", participantID)
+	}
+	if len(seed) != crs.SeedSize {
+		return fmt.Errorf("无效的种子长度: %d", len(seed))
+	}
+	if crs.Commitment(pm.sessionID, participantID, seed) != commitment {
+		return fmt.Errorf("参与方 %d 公开的种子与承诺不符", participantID)
+	}
+	if _, ok := pm.crsContributions[participantID]; ok {
+		return nil
+	}
+
+	pm.crsContributions[participantID] = seed
+	if err := pm.persistLocked(); err != nil {
+		delete(pm.crsContributions, participantID)
+		return err
+	}
+	fmt.Printf("收到参与方 %d 公开的CRS种子 (%d/%d)\n", participantID, len(pm.crsContributions), pm.crsContributors)
+
+	if len(pm.crsContributions) == pm.crsContributors {
+		if err := pm.finalizeCRS(); err != nil {
+			return fmt.Errorf("生成会话CRP失败: %v", err)
+		}
+		fmt.Println("CRS种子协商完成，已生成会话CRP")
+	}
+	return nil
+}
+
+// GetCRSTranscript 获取派生最终种子所需的全部公开材料，供参与方独立验证
+// 返回协调器种子和参与方公开的种子（均为base64）
+func (pm *Manager) GetCRSTranscript() (string, map[int]string) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	contributions := make(map[int]string, len(pm.crsContributions))
+	for id, seed := range pm.crsContributions {
+		contributions[id] = utils.EncodeToBase64(seed)
+	}
+	return utils.EncodeToBase64(pm.coordinatorSeed), contributions
+}
+
+// GetCRSStatus 获取协商进度
+func (pm *Manager) GetCRSStatus() map[string]interface{} {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return map[string]interface{}{
+		"session_id":   pm.sessionID,
+		"required":     pm.crsContributors > 0,
+		"phase":        pm.crsPhaseLocked(),
+		"commitments":  len(pm.crsCommitments),
+		"reveals":      len(pm.crsContributions),
+		"contributors": pm.crsContributors,
+	}
+}
@@ -0,0 +1,98 @@
+package parameters
+
+import (
+	"MPHEDev/pkg/core/crs"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+	"github.com/tuneinsight/lattigo/v6/utils/sampling"
+)
+
+// ==================== 密钥纪元 ====================
+//
+// 初始密钥为第0纪元，CRP由会话种子派生。每次集体密钥轮换进入下一纪元，
+// 新纪元的CRS种子为 crs.EpochSeed(会话种子, 纪元, 尝试次数)，公钥、重线性化密钥和
+// 伽罗瓦密钥的CRP按与初始密钥相同的规则从该种子派生。轮换失败后重试时换用新的尝试次数，
+// 已经公开过份额的CRP不会再被使用。
+
+// EpochCRPs 一个密钥纪元的全部CRP
+type EpochCRPs struct {
+	PublicKey       multiparty.PublicKeyGenCRP
+	Relinearization multiparty.RelinearizationKeyGenCRP
+	Galois          map[uint64]multiparty.GaloisKeyGenCRP
+}
+
+// sampleCRPs 由种子派生全部CRP：同一个PRNG依次生成公钥和重线性化密钥CRP，
+// 每个伽罗瓦元素使用独立派生的种子
+func sampleCRPs(params ckks.Parameters, seed []byte, galEls []uint64) (EpochCRPs, error) {
+	prng, err := sampling.NewKeyedPRNG(seed)
+	if err != nil {
+		return EpochCRPs{}, err
+	}
+	crps := EpochCRPs{
+		PublicKey:       multiparty.NewPublicKeyGenProtocol(params).SampleCRP(prng),
+		Relinearization: multiparty.NewRelinearizationKeyGenProtocol(params).SampleCRP(prng),
+		Galois:          make(map[uint64]multiparty.GaloisKeyGenCRP, len(galEls)),
+	}
+	for _, galEl := range galEls {
+		crp, err := sampleGaloisCRP(params, seed, galEl)
+		if err != nil {
+			return EpochCRPs{}, err
+		}
+		crps.Galois[galEl] = crp
+	}
+	return crps, nil
+}
+
+// sampleGaloisCRP 由种子派生单个伽罗瓦元素的CRP
+func sampleGaloisCRP(params ckks.Parameters, seed []byte, galEl uint64) (multiparty.GaloisKeyGenCRP, error) {
+	prng, err := sampling.NewKeyedPRNG(crs.GaloisSeed(seed, galEl))
+	if err != nil {
+		return multiparty.GaloisKeyGenCRP{}, err
+	}
+	return multiparty.NewGaloisKeyGenProtocol(params).SampleCRP(prng), nil
+}
+
+// GetKeyEpoch 获取当前密钥纪元
+func (pm *Manager) GetKeyEpoch() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.keyEpoch
+}
+
+// SampleEpochCRPs 派生密钥纪元epoch第attempt次尝试的全部CRP，伽罗瓦元素为当前会话的全部元素
+func (pm *Manager) SampleEpochCRPs(epoch, attempt int) (EpochCRPs, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if pm.sessionSeed == nil {
+		return EpochCRPs{}, fmt.Errorf("CRS种子尚未确定")
+	}
+	return sampleCRPs(pm.params, crs.EpochSeed(pm.sessionSeed, epoch, attempt), pm.galEls)
+}
+
+// CommitKeyEpoch 密钥轮换完成后切换到新纪元，之后追加的伽罗瓦元素由新纪元的种子派生CRP
+// crps 必须由 SampleEpochCRPs(epoch, attempt) 得到
+func (pm *Manager) CommitKeyEpoch(epoch, attempt int, crps EpochCRPs) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if epoch != pm.keyEpoch+1 {
+		return fmt.Errorf("纪元 %d 不是当前纪元 %d 的下一纪元", epoch, pm.keyEpoch)
+	}
+	if len(crps.Galois) != len(pm.galEls) {
+		return fmt.Errorf("新纪元的伽罗瓦CRP数量 %d 与伽罗瓦元素数量 %d 不一致", len(crps.Galois), len(pm.galEls))
+	}
+
+	prevEpoch, prevAttempt := pm.keyEpoch, pm.keyAttempt
+	pm.keyEpoch, pm.keyAttempt = epoch, attempt
+	if err := pm.persistLocked(); err != nil {
+		pm.keyEpoch, pm.keyAttempt = prevEpoch, prevAttempt
+		return err
+	}
+	pm.keySeed = crs.EpochSeed(pm.sessionSeed, epoch, attempt)
+	pm.globalCRP = crps.PublicKey
+	pm.rlkCRP = crps.Relinearization
+	pm.galoisCRPs = crps.Galois
+	return nil
+}
@@ -1,16 +1,17 @@
 package parameters
 
 import (
+	"MPHEDev/pkg/core/coordinator/store"
 	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/smudging"
 	"encoding/json"
 	"fmt"
+	"sync"
 
-	"github.com/tuneinsight/lattigo/v6/circuits/ckks/bootstrapping"
+	"github.com/google/uuid"
 	"github.com/tuneinsight/lattigo/v6/multiparty"
-	"github.com/tuneinsight/lattigo/v6/ring"
 	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
-	lattigoUtils "github.com/tuneinsight/lattigo/v6/utils"
-	"github.com/tuneinsight/lattigo/v6/utils/sampling"
 )
 
 // Manager 参数管理器
@@ -19,8 +20,26 @@ type Manager struct {
 	paramsLiteral      ckks.ParametersLiteral
 	paramsLiteralBytes string // base64编码的参数字面量
 
-	// 统一的CRS种子
+	// 参数配置档
+	profile      *Profile
+	securityBits int
+
+	// 会话CRS种子，协商完成前为空
 	commonCRSSeed string // 统一的CRS种子，用于所有参与方生成相同的CRP
+	sessionSeed   []byte // commonCRSSeed的原始字节
+
+	// 当前密钥纪元，见 epochs.go
+	keyEpoch   int
+	keyAttempt int
+	keySeed    []byte // 当前纪元的CRS种子，追加伽罗瓦元素时派生CRP；第0纪元即会话种子
+
+	// 会话与CRS种子协商
+	sessionID        string
+	coordinatorSeed  []byte
+	crsContributors  int            // 需要贡献种子的参与方数量，0表示不协商
+	crsCommitments   map[int]string // 参与方ID -> 种子承诺
+	crsContributions map[int][]byte // 参与方ID -> 公开后的种子
+	mu               sync.RWMutex
 
 	// 内部CRP（不通过网络传输，仅用于协调器内部聚合）
 	globalCRP  multiparty.PublicKeyGenCRP
@@ -28,23 +47,32 @@ type Manager struct {
 	rlkCRP     multiparty.RelinearizationKeyGenCRP
 
 	// 伽罗瓦元素
-	galEls []uint64
+	galEls      []uint64
+	galoisRound int // 伽罗瓦密钥轮次，0为初始密钥生成，每次追加旋转密钥加1
 
 	// 数据集划分类型
 	dataSplitType string
+
+	// 状态存储，为空时只保存在内存中
+	store store.Store
 }
 
-func initCKKSParameters() (ckks.Parameters, error) {
-	originalParams := ckks.ParametersLiteral{
-		LogN:            14,
-		LogQ:            []int{55, 45, 45, 45, 45, 45, 45, 45},
-		LogP:            []int{61},
-		LogDefaultScale: 45,
-		RingType:        ring.Standard,
+// Options 参数管理器配置
+type Options struct {
+	Profile         *Profile  // CKKS参数配置档，为空时使用内置默认参数
+	DataSplitType   string    // 数据集划分类型
+	CRSContributors int       // 参与CRS种子commit-reveal的参与方数量，0表示种子只由协调器随机生成
+	Snapshot        *Snapshot // 从状态存储恢复时的会话参数快照，为空时开始新会话
+}
+
+func initCKKSParameters(profile *Profile) (ckks.Parameters, error) {
+	originalParams, err := profile.Literal()
+	if err != nil {
+		return ckks.Parameters{}, fmt.Errorf("参数配置档 %s 无效: %v", profile.Name, err)
 	}
 
-	fmt.Printf("输入参数: LogN=%d, LogQ=%v, LogP=%v\n",
-		originalParams.LogN, originalParams.LogQ, originalParams.LogP)
+	fmt.Printf("参数配置档: %s，输入参数: LogN=%d, LogQ=%v, LogP=%v\n",
+		profile.Name, originalParams.LogN, originalParams.LogQ, originalParams.LogP)
 
 	params, err := ckks.NewParametersFromLiteral(originalParams)
 	if err != nil {
@@ -63,48 +91,39 @@ func initCKKSParameters() (ckks.Parameters, error) {
 }
 
 // NewManager 创建新的参数管理器
-func NewManager(dataSplitType string) (*Manager, error) {
-	params, err := initCKKSParameters()
+func NewManager(opts Options) (*Manager, error) {
+	profile := opts.Profile
+	if profile == nil {
+		profile = DefaultProfile()
+	}
+
+	params, err := initCKKSParameters(profile)
 	if err != nil {
 		fmt.Printf("参数初始化失败: %v\n", err)
 		return nil, err
 	}
-	// 生成伽罗瓦元素
-	btpParametersLit := bootstrapping.ParametersLiteral{
-		LogN: lattigoUtils.Pointy(params.LogN()),
-		LogP: params.LogPi(),
-		Xs:   params.Xs(),
-	}
-	btpParams, err := bootstrapping.NewParametersFromLiteral(params, btpParametersLit)
+
+	// 校验安全级别
+	securityBits, err := profile.ValidateSecurity(params)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("参数配置档 %s 未通过安全校验: %v", profile.Name, err)
 	}
-	galEls := btpParams.GaloisElements(params)
+	fmt.Printf("  安全级别: %d-bit (logQP=%.1f)\n", securityBits, params.LogQP())
 
-	// 生成一个统一的CRS种子（用于所有参与方生成相同的CRP）
-	commonCRSSeed := []byte("common_crs_seed_32_bytes_long_for_all")
-	commonCRSB64 := utils.EncodeToBase64(commonCRSSeed)
+	// 校验噪声淹没配置
+	smudgingCfg := profile.SmudgingConfig()
+	if err := smudgingCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("参数配置档 %s 的噪声淹没配置无效: %v", profile.Name, err)
+	}
+	fmt.Printf("  噪声淹没: 解密 %d-bit 统计安全，刷新 %d-bit 统计安全\n",
+		smudgingCfg.StatisticalSecurity, smudgingCfg.RefreshSecurity)
 
-	// 使用统一种子生成CRP（协调器内部使用）
-	crs, err := sampling.NewKeyedPRNG(commonCRSSeed)
+	// 生成伽罗瓦元素
+	galEls, err := profile.GaloisElements(params)
 	if err != nil {
 		return nil, err
 	}
-
-	// 生成公钥CRP
-	pubKeyProto := multiparty.NewPublicKeyGenProtocol(params)
-	globalCRP := pubKeyProto.SampleCRP(crs)
-
-	// 生成伽罗瓦密钥CRPs
-	galoisProto := multiparty.NewGaloisKeyGenProtocol(params)
-	galoisCRPs := make(map[uint64]multiparty.GaloisKeyGenCRP)
-	for _, galEl := range galEls {
-		galoisCRPs[galEl] = galoisProto.SampleCRP(crs)
-	}
-
-	// 生成重线性化密钥CRP
-	rlkProto := multiparty.NewRelinearizationKeyGenProtocol(params)
-	rlkCRP := rlkProto.SampleCRP(crs)
+	fmt.Printf("  伽罗瓦元素数量: %d\n", len(galEls))
 
 	// 获取参数字面量并序列化
 	paramsLiteral := params.ParametersLiteral()
@@ -114,22 +133,123 @@ func NewManager(dataSplitType string) (*Manager, error) {
 	}
 	paramsLiteralBytes := utils.EncodeToBase64(jsonBytes)
 
-	return &Manager{
+	// 每个会话使用新的会话ID和协调器随机种子
+	coordinatorSeed, err := crs.NewSeed()
+	if err != nil {
+		return nil, err
+	}
+	sessionID := uuid.New().String()
+
+	pm := &Manager{
 		params:             params,
 		paramsLiteral:      paramsLiteral,
 		paramsLiteralBytes: paramsLiteralBytes,
-		commonCRSSeed:      commonCRSB64, // 统一的CRS种子
-		globalCRP:          globalCRP,    // 协调器内部使用的CRP
-		galoisCRPs:         galoisCRPs,   // 协调器内部使用的CRP
-		rlkCRP:             rlkCRP,       // 协调器内部使用的CRP
+		profile:            profile,
+		securityBits:       securityBits,
 		galEls:             galEls,
-		dataSplitType:      dataSplitType,
-	}, nil
+		dataSplitType:      opts.DataSplitType,
+		sessionID:          sessionID,
+		coordinatorSeed:    coordinatorSeed,
+		crsContributors:    opts.CRSContributors,
+		crsCommitments:     make(map[int]string),
+		crsContributions:   make(map[int][]byte),
+	}
+
+	if opts.Snapshot != nil {
+		// 恢复会话：沿用原会话ID和种子，参与方已生成的份额仍然有效
+		if err := pm.restore(opts.Snapshot); err != nil {
+			return nil, err
+		}
+	} else if opts.CRSContributors <= 0 {
+		// 不需要参与方贡献时立即确定种子并生成CRP
+		if err := pm.finalizeCRS(); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("会话ID: %s，CRS种子协商: %v\n", pm.sessionID, pm.crsContributors > 0)
+	return pm, nil
+}
+
+// finalizeCRS 派生会话最终CRS种子并生成所有CRP，调用方需持有写锁或处于构造阶段
+func (pm *Manager) finalizeCRS() error {
+	seed := crs.DeriveSessionSeed(pm.sessionID, pm.coordinatorSeed, pm.crsContributions)
+
+	// 使用会话种子生成CRP（协调器内部使用）
+	crps, err := sampleCRPs(pm.params, seed, pm.galEls)
+	if err != nil {
+		return err
+	}
+	pm.globalCRP = crps.PublicKey
+	pm.rlkCRP = crps.Relinearization
+	pm.galoisCRPs = crps.Galois
+	pm.sessionSeed = seed
+	pm.keySeed = seed
+
+	pm.commonCRSSeed = utils.EncodeToBase64(seed)
+	return nil
+}
+
+// sampleGaloisCRP 由当前纪元的种子派生单个伽罗瓦元素的CRP，与参与方的计算方式一致
+func (pm *Manager) sampleGaloisCRP(galEl uint64) (multiparty.GaloisKeyGenCRP, error) {
+	return sampleGaloisCRP(pm.params, pm.keySeed, galEl)
+}
+
+// AddGaloisElements 在会话中途追加伽罗瓦元素并生成对应的CRP
+// 返回实际新增的元素（已存在的忽略）以及当前伽罗瓦密钥轮次，有新增时轮次加1
+func (pm *Manager) AddGaloisElements(galEls []uint64) ([]uint64, int, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.commonCRSSeed == "" {
+		return nil, pm.galoisRound, fmt.Errorf("CRS种子尚未确定，不能追加伽罗瓦元素")
+	}
+
+	added := make([]uint64, 0, len(galEls))
+	for _, galEl := range galEls {
+		if _, ok := pm.galoisCRPs[galEl]; ok {
+			continue
+		}
+		crp, err := pm.sampleGaloisCRP(galEl)
+		if err != nil {
+			return nil, pm.galoisRound, fmt.Errorf("生成伽罗瓦CRP失败 (galEl: %d): %v", galEl, err)
+		}
+		pm.galoisCRPs[galEl] = crp
+		pm.galEls = append(pm.galEls, galEl)
+		added = append(added, galEl)
+	}
+	if len(added) > 0 {
+		pm.galoisRound++
+		if err := pm.persistLocked(); err != nil {
+			for _, galEl := range added {
+				delete(pm.galoisCRPs, galEl)
+			}
+			pm.galEls = pm.galEls[:len(pm.galEls)-len(added)]
+			pm.galoisRound--
+			return nil, pm.galoisRound, err
+		}
+		fmt.Printf("伽罗瓦密钥第 %d 轮：新增 %d 个伽罗瓦元素，共 %d 个\n", pm.galoisRound, len(added), len(pm.galEls))
+	}
+	return added, pm.galoisRound, nil
+}
+
+// GetGaloisRound 获取当前伽罗瓦密钥轮次
+func (pm *Manager) GetGaloisRound() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.galoisRound
+}
+
+// GetProfile 获取参数配置档
+func (pm *Manager) GetProfile() *Profile {
+	return pm.profile
 }
 
 // GetParams 获取所有参数
 func (pm *Manager) GetParams() (string, []uint64, string, string) {
-	return pm.paramsLiteralBytes, pm.galEls, pm.commonCRSSeed, pm.dataSplitType
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.paramsLiteralBytes, append([]uint64(nil), pm.galEls...), pm.commonCRSSeed, pm.dataSplitType
 }
 
 // GetCKKSParams 获取CKKS参数
@@ -144,7 +264,24 @@ func (pm *Manager) GetParamsLiteral() ckks.ParametersLiteral {
 
 // GetGalEls 获取伽罗瓦元素列表
 func (pm *Manager) GetGalEls() []uint64 {
-	return pm.galEls
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return append([]uint64(nil), pm.galEls...)
+}
+
+// GetProfileName 获取参数配置档名称
+func (pm *Manager) GetProfileName() string {
+	return pm.profile.Name
+}
+
+// GetSecurityBits 获取按HE标准估计的安全级别
+func (pm *Manager) GetSecurityBits() int {
+	return pm.securityBits
+}
+
+// GetSmudgingConfig 获取噪声淹没配置
+func (pm *Manager) GetSmudgingConfig() smudging.Config {
+	return pm.profile.SmudgingConfig()
 }
 
 // GetDataSplitType 获取数据集划分类型
@@ -154,15 +291,33 @@ func (pm *Manager) GetDataSplitType() string {
 
 // GetGlobalCRP 获取全局CRP
 func (pm *Manager) GetGlobalCRP() multiparty.PublicKeyGenCRP {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.globalCRP
 }
 
 // GetGaloisCRPs 获取伽罗瓦密钥CRPs
 func (pm *Manager) GetGaloisCRPs() map[uint64]multiparty.GaloisKeyGenCRP {
-	return pm.galoisCRPs
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	crps := make(map[uint64]multiparty.GaloisKeyGenCRP, len(pm.galoisCRPs))
+	for galEl, crp := range pm.galoisCRPs {
+		crps[galEl] = crp
+	}
+	return crps
+}
+
+// GetGaloisCRP 获取单个伽罗瓦元素的CRP
+func (pm *Manager) GetGaloisCRP(galEl uint64) (multiparty.GaloisKeyGenCRP, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	crp, ok := pm.galoisCRPs[galEl]
+	return crp, ok
 }
 
 // GetRelinearizationCRP 获取重线性化密钥CRP
 func (pm *Manager) GetRelinearizationCRP() multiparty.RelinearizationKeyGenCRP {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.rlkCRP
 }
@@ -0,0 +1,113 @@
+package parameters
+
+import (
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/crs"
+	"fmt"
+)
+
+// storeKey 会话参数在状态存储中的键
+const storeKey = "parameters"
+
+// Snapshot 会话参数快照：会话ID、协调器种子和CRS协商记录足以重新派生全部CRP，
+// 追加的伽罗瓦元素按顺序保存，密钥纪元和尝试次数足以重新派生当前纪元的CRP
+type Snapshot struct {
+	SessionID        string
+	CoordinatorSeed  []byte
+	CRSContributors  int
+	CRSCommitments   map[int]string
+	CRSContributions map[int][]byte
+	GalEls           []uint64
+	GaloisRound      int
+	KeyEpoch         int
+	KeyAttempt       int
+}
+
+// SetStore 设置状态存储并立即保存当前参数，之后CRS协商和追加伽罗瓦元素都会写入存储
+func (pm *Manager) SetStore(s store.Store) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.store = s
+	return pm.persistLocked()
+}
+
+// persistLocked 保存参数快照，调用方需持有写锁
+func (pm *Manager) persistLocked() error {
+	if pm.store == nil {
+		return nil
+	}
+	snapshot := Snapshot{
+		SessionID:        pm.sessionID,
+		CoordinatorSeed:  pm.coordinatorSeed,
+		CRSContributors:  pm.crsContributors,
+		CRSCommitments:   pm.crsCommitments,
+		CRSContributions: pm.crsContributions,
+		GalEls:           pm.galEls,
+		GaloisRound:      pm.galoisRound,
+		KeyEpoch:         pm.keyEpoch,
+		KeyAttempt:       pm.keyAttempt,
+	}
+	if err := store.PutGob(pm.store, storeKey, snapshot); err != nil {
+		return fmt.Errorf("保存会话参数失败: %v", err)
+	}
+	return nil
+}
+
+// LoadSnapshot 从状态存储读取会话参数快照，不存在时返回 nil
+func LoadSnapshot(s store.Store) (*Snapshot, error) {
+	var snapshot Snapshot
+	ok, err := store.GetGob(s, storeKey, &snapshot)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// restore 用快照中的会话ID、种子和协商记录替换新生成的值，并重新派生CRP
+func (pm *Manager) restore(snapshot *Snapshot) error {
+	pm.sessionID = snapshot.SessionID
+	pm.coordinatorSeed = snapshot.CoordinatorSeed
+	pm.crsContributors = snapshot.CRSContributors
+	for id, commitment := range snapshot.CRSCommitments {
+		pm.crsCommitments[id] = commitment
+	}
+	for id, seed := range snapshot.CRSContributions {
+		pm.crsContributions[id] = seed
+	}
+
+	if pm.crsContributors > 0 && len(pm.crsContributions) < pm.crsContributors {
+		// 种子协商尚未完成，参与方继续提交承诺或公开种子
+		return nil
+	}
+	if err := pm.finalizeCRS(); err != nil {
+		return fmt.Errorf("重新生成会话CRP失败: %v", err)
+	}
+
+	// 追加轮次新增的伽罗瓦元素
+	for _, galEl := range snapshot.GalEls {
+		if _, ok := pm.galoisCRPs[galEl]; ok {
+			continue
+		}
+		crp, err := pm.sampleGaloisCRP(galEl)
+		if err != nil {
+			return fmt.Errorf("生成伽罗瓦CRP失败 (galEl: %d): %v", galEl, err)
+		}
+		pm.galoisCRPs[galEl] = crp
+		pm.galEls = append(pm.galEls, galEl)
+	}
+	pm.galoisRound = snapshot.GaloisRound
+
+	// 密钥轮换后的纪元使用该纪元的种子重新派生全部CRP
+	if snapshot.KeyEpoch > 0 {
+		seed := crs.EpochSeed(pm.sessionSeed, snapshot.KeyEpoch, snapshot.KeyAttempt)
+		crps, err := sampleCRPs(pm.params, seed, pm.galEls)
+		if err != nil {
+			return fmt.Errorf("重新生成第 %d 纪元的CRP失败: %v", snapshot.KeyEpoch, err)
+		}
+		pm.keyEpoch, pm.keyAttempt, pm.keySeed = snapshot.KeyEpoch, snapshot.KeyAttempt, seed
+		pm.globalCRP = crps.PublicKey
+		pm.rlkCRP = crps.Relinearization
+		pm.galoisCRPs = crps.Galois
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package parameters
+
+import (
+	"MPHEDev/pkg/core/smudging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tuneinsight/lattigo/v6/circuits/ckks/bootstrapping"
+	"github.com/tuneinsight/lattigo/v6/ring"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+	lattigoUtils "github.com/tuneinsight/lattigo/v6/utils"
+)
+
+// ==================== CKKS参数配置档 ====================
+//
+// 参数配置档从JSON文件加载，描述环维度、模数链、默认精度、秘密/误差分布、
+// 环类型、需要生成的伽罗瓦元素以及解密和刷新的噪声淹没参数，协调器初始化时按名称选取。
+
+// DefaultMinSecurityBits 未指定时要求的最低安全级别
+const DefaultMinSecurityBits = 128
+
+// maxLogQP HE标准（三元秘密、经典攻击）下各安全级别允许的最大 log2(QP)
+// 键为安全级别，值为 LogN -> 最大logQP
+var maxLogQP = map[int]map[int]int{
+	128: {10: 27, 11: 54, 12: 109, 13: 218, 14: 438, 15: 881, 16: 1761},
+	192: {10: 19, 11: 37, 12: 75, 13: 152, 14: 305, 15: 611},
+	256: {10: 14, 11: 29, 12: 58, 13: 118, 14: 237, 15: 476},
+}
+
+// DistributionConfig 秘密或误差分布配置
+type DistributionConfig struct {
+	Type  string  `json:"type"`            // "ternary" 或 "gaussian"
+	H     int     `json:"h,omitempty"`     // ternary: 汉明重量（稀疏秘密）
+	P     float64 `json:"p,omitempty"`     // ternary: 非零系数概率
+	Sigma float64 `json:"sigma,omitempty"` // gaussian: 标准差
+	Bound float64 `json:"bound,omitempty"` // gaussian: 截断界
+}
+
+// GaloisConfig 需要生成的伽罗瓦密钥
+// 只生成工作负载实际用到的旋转密钥：显式旋转步长，加上按网络层大小和打包方式推导的步长；
+// 自举需要的伽罗瓦元素数量很多，仅在确实需要自举时开启
+type GaloisConfig struct {
+	Bootstrapping         bool     `json:"bootstrapping"`                     // 生成自举所需的全部伽罗瓦元素
+	Rotations             []int    `json:"rotations,omitempty"`               // 额外的槽旋转步长
+	Conjugate             bool     `json:"conjugate"`                         // 生成共轭密钥
+	LayerSizes            []int    `json:"layer_sizes,omitempty"`             // 全连接网络各层神经元数量（含输入层），用于推导打包所需的旋转
+	FeaturesPerCiphertext int      `json:"features_per_ciphertext,omitempty"` // 每个密文打包的特征数k，0表示按层宽度自动选取
+	GaloisElements        []uint64 `json:"galois_elements,omitempty"`         // 直接指定的伽罗瓦元素
+}
+
+// DefaultLayerSizes 默认全连接网络结构（MNIST输入784维，三个64维隐藏层，10类输出）
+var DefaultLayerSizes = []int{784, 64, 64, 64, 10}
+
+// Profile CKKS参数配置档
+type Profile struct {
+	Name            string              `json:"-"`
+	Description     string              `json:"description"`
+	LogN            int                 `json:"log_n"`
+	LogQ            []int               `json:"log_q"`
+	LogP            []int               `json:"log_p"`
+	LogDefaultScale int                 `json:"log_default_scale"`
+	RingType        string              `json:"ring_type"` // "standard" 或 "conjugate_invariant"
+	Xs              *DistributionConfig `json:"xs,omitempty"`
+	Xe              *DistributionConfig `json:"xe,omitempty"`
+	Galois          GaloisConfig        `json:"galois"`
+	MinSecurityBits int                 `json:"min_security_bits"`
+	Smudging        *smudging.Config    `json:"smudging,omitempty"` // 为空时使用默认统计安全参数
+}
+
+// ProfileFile 参数配置文件
+type ProfileFile struct {
+	DefaultProfile string              `json:"default_profile"`
+	Profiles       map[string]*Profile `json:"profiles"`
+}
+
+// DefaultProfile 内置默认参数（未提供配置文件时使用）
+func DefaultProfile() *Profile {
+	return &Profile{
+		Name:            "default",
+		Description:     "LogN=14，仅生成全连接网络打包所需的旋转密钥",
+		LogN:            14,
+		LogQ:            []int{55, 45, 45, 45, 45, 45, 45, 45},
+		LogP:            []int{61},
+		LogDefaultScale: 45,
+		RingType:        "standard",
+		Galois:          GaloisConfig{LayerSizes: DefaultLayerSizes},
+		MinSecurityBits: DefaultMinSecurityBits,
+	}
+}
+
+// LoadProfileFile 读取参数配置文件
+func LoadProfileFile(path string) (*ProfileFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取参数配置文件失败: %v", err)
+	}
+	var file ProfileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析参数配置文件失败: %v", err)
+	}
+	for name, profile := range file.Profiles {
+		if profile == nil {
+			return nil, fmt.Errorf("参数配置档 %s 为空", name)
+		}
+		profile.Name = name
+	}
+	return &file, nil
+}
+
+// LoadProfile 从配置文件中按名称加载参数配置档
+// name 为空时使用文件中的 default_profile；配置文件不存在且未指定名称时使用内置默认参数
+func LoadProfile(path, name string) (*Profile, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) && name == "" {
+		fmt.Printf("参数配置文件 %s 不存在，使用内置默认参数\n", path)
+		return DefaultProfile(), nil
+	}
+
+	file, err := LoadProfileFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = file.DefaultProfile
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("参数配置档 %q 不存在，可用: %v", name, file.Names())
+	}
+	return profile, nil
+}
+
+// Names 返回配置文件中的全部配置档名称
+func (f *ProfileFile) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Literal 将配置档转换为CKKS参数字面量
+func (p *Profile) Literal() (ckks.ParametersLiteral, error) {
+	literal := ckks.ParametersLiteral{
+		LogN:            p.LogN,
+		LogQ:            p.LogQ,
+		LogP:            p.LogP,
+		LogDefaultScale: p.LogDefaultScale,
+	}
+
+	switch strings.ToLower(p.RingType) {
+	case "", "standard":
+		literal.RingType = ring.Standard
+	case "conjugate_invariant", "conjugateinvariant":
+		literal.RingType = ring.ConjugateInvariant
+	default:
+		return literal, fmt.Errorf("未知的环类型: %s", p.RingType)
+	}
+
+	if p.Xs != nil {
+		xs, err := p.Xs.distribution()
+		if err != nil {
+			return literal, fmt.Errorf("秘密分布配置错误: %v", err)
+		}
+		literal.Xs = xs
+	}
+	if p.Xe != nil {
+		xe, err := p.Xe.distribution()
+		if err != nil {
+			return literal, fmt.Errorf("误差分布配置错误: %v", err)
+		}
+		literal.Xe = xe
+	}
+	return literal, nil
+}
+
+// distribution 转换为lattigo分布参数
+func (d *DistributionConfig) distribution() (ring.DistributionParameters, error) {
+	switch strings.ToLower(d.Type) {
+	case "ternary":
+		if (d.H > 0) == (d.P > 0) {
+			return nil, fmt.Errorf("ternary分布需要且只能指定h或p之一")
+		}
+		return ring.Ternary{H: d.H, P: d.P}, nil
+	case "gaussian":
+		if d.Sigma <= 0 || d.Bound <= 0 {
+			return nil, fmt.Errorf("gaussian分布需要正的sigma和bound")
+		}
+		return ring.DiscreteGaussian{Sigma: d.Sigma, Bound: d.Bound}, nil
+	default:
+		return nil, fmt.Errorf("未知的分布类型: %s", d.Type)
+	}
+}
+
+// SecurityLevel 按HE标准估计安全级别，返回满足的最高级别（128/192/256），不满足任何级别时返回0
+func SecurityLevel(logN int, logQP float64) int {
+	best := 0
+	for level, table := range maxLogQP {
+		if limit, ok := table[logN]; ok && logQP <= float64(limit) && level > best {
+			best = level
+		}
+	}
+	return best
+}
+
+// ValidateSecurity 校验参数满足配置档要求的最低安全级别
+func (p *Profile) ValidateSecurity(params ckks.Parameters) (int, error) {
+	minBits := p.MinSecurityBits
+	if minBits <= 0 {
+		minBits = DefaultMinSecurityBits
+	}
+	if _, ok := maxLogQP[minBits]; !ok {
+		return 0, fmt.Errorf("不支持的安全级别: %d（可选128/192/256）", minBits)
+	}
+
+	level := SecurityLevel(params.LogN(), params.LogQP())
+	if level < minBits {
+		limit, ok := maxLogQP[minBits][params.LogN()]
+		if !ok {
+			return level, fmt.Errorf("LogN=%d 没有 %d-bit 安全级别的参考值", params.LogN(), minBits)
+		}
+		return level, fmt.Errorf("LogN=%d 时 logQP=%.1f 超过 %d-bit 安全级别上限 %d", params.LogN(), params.LogQP(), minBits, limit)
+	}
+
+	// HE标准表针对均匀三元秘密，稀疏秘密的实际安全级别更低
+	if xs, ok := params.Xs().(ring.Ternary); ok && xs.H > 0 {
+		fmt.Printf("[WARNING] 秘密分布为汉明重量 %d 的稀疏三元分布，实际安全级别可能低于 %d-bit\n", xs.H, level)
+	}
+	return level, nil
+}
+
+// SmudgingConfig 配置档的噪声淹没配置，未设置的字段取默认值
+func (p *Profile) SmudgingConfig() smudging.Config {
+	if p.Smudging == nil {
+		return smudging.DefaultConfig()
+	}
+	return p.Smudging.Normalize()
+}
+
+// GaloisElements 根据配置档计算需要生成的伽罗瓦元素，按升序去重
+func (p *Profile) GaloisElements(params ckks.Parameters) ([]uint64, error) {
+	return p.Galois.Elements(params)
+}
+
+// Elements 计算配置对应的伽罗瓦元素，按升序去重
+func (g GaloisConfig) Elements(params ckks.Parameters) ([]uint64, error) {
+	set := make(map[uint64]bool)
+
+	if g.Bootstrapping {
+		btpParametersLit := bootstrapping.ParametersLiteral{
+			LogN: lattigoUtils.Pointy(params.LogN()),
+			LogP: params.LogPi(),
+			Xs:   params.Xs(),
+		}
+		btpParams, err := bootstrapping.NewParametersFromLiteral(params, btpParametersLit)
+		if err != nil {
+			return nil, fmt.Errorf("生成自举参数失败: %v", err)
+		}
+		for _, galEl := range btpParams.GaloisElements(params) {
+			set[galEl] = true
+		}
+	}
+
+	rotations := g.Rotations
+	if len(g.LayerSizes) > 0 {
+		packing, err := PackingRotations(params.MaxSlots(), g.LayerSizes, g.FeaturesPerCiphertext)
+		if err != nil {
+			return nil, fmt.Errorf("计算打包旋转步长失败: %v", err)
+		}
+		rotations = append(append([]int{}, rotations...), packing...)
+	}
+	for _, galEl := range params.GaloisElements(rotations) {
+		set[galEl] = true
+	}
+	if g.Conjugate {
+		set[params.GaloisElementOrderTwoOrthogonalSubgroup()] = true
+	}
+
+	nthRoot := params.RingQ().NthRoot()
+	for _, galEl := range g.GaloisElements {
+		if galEl&1 == 0 || galEl >= nthRoot {
+			return nil, fmt.Errorf("无效的伽罗瓦元素: %d", galEl)
+		}
+		set[galEl] = true
+	}
+
+	galEls := make([]uint64, 0, len(set))
+	for galEl := range set {
+		galEls = append(galEls, galEl)
+	}
+	sort.Slice(galEls, func(i, j int) bool { return galEls[i] < galEls[j] })
+	return galEls, nil
+}
@@ -0,0 +1,63 @@
+package parameters
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ==================== 按密文打包方式计算旋转步长 ====================
+//
+// 全连接网络的打包方式见 docs/全连接神经网络的密文打包.md：每个样本取k个特征与
+// 其余样本打包，一个密文分为k块、每块 s/k 个槽。一层的乘加结果需要做 log2(k) 次
+// “旋转 + 相加”把k块求和，旋转步长依次为 (s/k)·2^i（i = 0..log2(k)-1）。
+// 掩码合并和softmax分母只用到明文乘法和密文加法，不需要额外的旋转密钥。
+
+// PackingRotations 计算全连接网络按块打包时需要的旋转步长，按升序去重
+// slots 为密文槽数；layerSizes 为各层神经元数量（含输入层）；
+// featuresPerCiphertext 为每个密文打包的特征数k，<=0 时按每层输入宽度取不小于它的2的幂
+func PackingRotations(slots int, layerSizes []int, featuresPerCiphertext int) ([]int, error) {
+	if slots <= 0 || slots&(slots-1) != 0 {
+		return nil, fmt.Errorf("槽数必须是2的幂: %d", slots)
+	}
+	if featuresPerCiphertext > 0 && (featuresPerCiphertext&(featuresPerCiphertext-1) != 0 || featuresPerCiphertext > slots) {
+		return nil, fmt.Errorf("每个密文的特征数k必须是不超过槽数 %d 的2的幂: %d", slots, featuresPerCiphertext)
+	}
+	if len(layerSizes) < 2 {
+		return nil, fmt.Errorf("至少需要输入层和输出层两层，当前: %v", layerSizes)
+	}
+
+	set := make(map[int]bool)
+	// 每个权重矩阵的输入宽度是上一层的神经元数量
+	for _, width := range layerSizes[:len(layerSizes)-1] {
+		if width <= 0 {
+			return nil, fmt.Errorf("无效的层大小: %v", layerSizes)
+		}
+		k := featuresPerCiphertext
+		if k <= 0 {
+			k = nextPowerOfTwo(width)
+			if k > slots {
+				k = slots
+			}
+		}
+		blockSize := slots / k
+		for step := 1; step < k; step <<= 1 {
+			set[blockSize*step] = true
+		}
+	}
+
+	rotations := make([]int, 0, len(set))
+	for rot := range set {
+		rotations = append(rotations, rot)
+	}
+	sort.Ints(rotations)
+	return rotations, nil
+}
+
+// nextPowerOfTwo 返回不小于n的最小2的幂
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
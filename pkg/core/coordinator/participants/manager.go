@@ -1,8 +1,14 @@
 package participants
 
 import (
+	"MPHEDev/pkg/core/coordinator/store"
 	"MPHEDev/pkg/core/coordinator/utils"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
@@ -10,7 +16,8 @@ import (
 // Manager 参与者管理器
 type Manager struct {
 	participants    map[int]*utils.ParticipantInfo
-	participantURLs map[int]string // 参与方ID -> URL映射
+	participantURLs map[int]string   // 参与方ID -> URL映射
+	relayKeys       map[int]RelayKey // 参与方ID -> 随URL上报的中继公钥
 	nextID          int
 	mu              sync.RWMutex
 
@@ -20,22 +27,41 @@ type Manager struct {
 	minParticipants   int               // 最小参与方数量阈值
 	heartbeatInterval time.Duration     // 心跳间隔
 
+	// 门限配置
+	expectedN int // 参与密钥生成的参与方总数N
+	threshold int // 协同解密/刷新所需的最少在线参与方数量t
+
+	// 持有集体私钥份额的成员，见 membership.go
+	members         map[int]bool
+	membershipEpoch int
+
 	// 新增分片ID映射
 	shardToID map[string]int
 	idToShard map[int]string
 	freeIDs   []int
+
+	// 参与方身份公钥（注册时登记），用于验证请求签名
+	publicKeys map[int]ed25519.PublicKey
+
+	// 状态存储，为空时只保存在内存中
+	store store.Store
 }
 
 // NewManager 创建新的参与者管理器
-func NewManager(expectedN int) *Manager {
-	// 计算最小参与方数量：暂不考虑门限，直接使用参与方数量
-	minParticipants := expectedN
+// threshold 为t-out-of-N门限，取值范围 1..expectedN，<=0 时退化为全员在线模式
+func NewManager(expectedN int, threshold int) *Manager {
+	if threshold <= 0 || threshold > expectedN {
+		threshold = expectedN
+	}
+	// 协同操作只需要t个参与方在线
+	minParticipants := threshold
 
 	return &Manager{
 		//记录每个参与方信息ID和状态
 		participants: make(map[int]*utils.ParticipantInfo),
 		//记录每个参与方URL
 		participantURLs: make(map[int]string),
+		relayKeys:       make(map[int]RelayKey),
 		//参与方ID
 		nextID: 1,
 		//记录每个参与方最近一次心跳时间
@@ -43,20 +69,32 @@ func NewManager(expectedN int) *Manager {
 		//心跳超时时间30s（增加时间给密钥解析）
 		onlineTimeout:   30 * time.Second,
 		minParticipants: minParticipants,
+		expectedN:       expectedN,
+		threshold:       threshold,
 		//心跳间隔5s
 		heartbeatInterval: 5 * time.Second,
 		shardToID:         make(map[string]int),
 		idToShard:         make(map[int]string),
 		freeIDs:           []int{},
+		publicKeys:        make(map[int]ed25519.PublicKey),
 	}
 }
 
-// RegisterParticipant 注册新参与方（分片ID）
-func (m *Manager) RegisterParticipant(shardID string) int {
+// RegisterParticipant 注册新参与方（分片ID），同时登记其身份公钥
+// 同一分片重复注册时必须使用相同的公钥，一个公钥也只能对应一个分片
+func (m *Manager) RegisterParticipant(shardID string, publicKey ed25519.PublicKey) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if id, exists := m.shardToID[shardID]; exists {
-		return id
+		if !bytes.Equal(m.publicKeys[id], publicKey) {
+			return 0, fmt.Errorf("分片 %s 已由其他身份注册", shardID)
+		}
+		return id, nil
+	}
+	for id, existing := range m.publicKeys {
+		if bytes.Equal(existing, publicKey) {
+			return 0, fmt.Errorf("该身份公钥已注册为参与方 %d", id)
+		}
 	}
 
 	// 解析分片ID，提取数字部分（去掉前导零）
@@ -82,8 +120,41 @@ func (m *Manager) RegisterParticipant(shardID string) int {
 	m.shardToID[shardID] = id
 	m.idToShard[id] = shardID
 	m.participants[id] = &utils.ParticipantInfo{ID: id, Status: "registered"}
+	m.publicKeys[id] = publicKey
+	if err := m.persistLocked(); err != nil {
+		delete(m.shardToID, shardID)
+		delete(m.idToShard, id)
+		delete(m.participants, id)
+		delete(m.publicKeys, id)
+		return 0, err
+	}
 	fmt.Printf("分片 %s 注册为参与方 %d\n", shardID, id)
-	return id
+	return id, nil
+}
+
+// GetPublicKey 获取参与方登记的身份公钥
+func (m *Manager) GetPublicKey(participantID int) (ed25519.PublicKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pub, ok := m.publicKeys[participantID]
+	return pub, ok
+}
+
+// GetParticipantIDByShard 按分片ID查找参与方ID
+func (m *Manager) GetParticipantIDByShard(shardID string) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.shardToID[shardID]
+	return id, ok
+}
+
+// publicKeyBase64 base64编码的参与方公钥，调用方需持有锁
+func (m *Manager) publicKeyBase64(participantID int) string {
+	pub, ok := m.publicKeys[participantID]
+	if !ok {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(pub)
 }
 
 // UnregisterParticipant 注销参与方（分片ID）
@@ -98,13 +169,24 @@ func (m *Manager) UnregisterParticipant(shardID string) {
 	delete(m.idToShard, id)
 	delete(m.participants, id)
 	delete(m.participantURLs, id)
+	delete(m.relayKeys, id)
 	delete(m.heartbeats, id)
+	delete(m.publicKeys, id)
 	m.freeIDs = append(m.freeIDs, id)
+	if err := m.persistLocked(); err != nil {
+		fmt.Printf("[警告] %v\n", err)
+	}
 	fmt.Printf("分片 %s 注销，释放参与方ID %d\n", shardID, id)
 }
 
-// AddParticipantURL 添加参与方URL
-func (m *Manager) AddParticipantURL(participantID int, url string) error {
+// RelayKey 参与方的中继公钥及身份私钥对其的签名（均为base64），协调器只转发，不使用
+type RelayKey struct {
+	Key       string
+	Signature string
+}
+
+// AddParticipantURL 添加参与方URL和中继公钥，参与方未启用中继时 relayKey 为空
+func (m *Manager) AddParticipantURL(participantID int, url string, relayKey RelayKey) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -112,11 +194,39 @@ func (m *Manager) AddParticipantURL(participantID int, url string) error {
 		return fmt.Errorf("参与方 %d 不存在", participantID)
 	}
 
+	previous, hadURL := m.participantURLs[participantID]
+	previousKey, hadKey := m.relayKeys[participantID]
 	m.participantURLs[participantID] = url
+	if relayKey.Key != "" {
+		m.relayKeys[participantID] = relayKey
+	} else {
+		delete(m.relayKeys, participantID)
+	}
+	if err := m.persistLocked(); err != nil {
+		if hadURL {
+			m.participantURLs[participantID] = previous
+		} else {
+			delete(m.participantURLs, participantID)
+		}
+		if hadKey {
+			m.relayKeys[participantID] = previousKey
+		} else {
+			delete(m.relayKeys, participantID)
+		}
+		return err
+	}
 	fmt.Printf("添加参与方 %d URL: %s\n", participantID, url)
 	return nil
 }
 
+// IsRegistered 参与方ID是否已注册
+func (m *Manager) IsRegistered(participantID int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.participants[participantID]
+	return exists
+}
+
 // GetParticipantURL 获取参与方URL
 func (m *Manager) GetParticipantURL(participantID int) (string, bool) {
 	m.mu.RLock()
@@ -131,16 +241,25 @@ func (m *Manager) GetAllParticipantURLs() []utils.PeerInfo {
 	defer m.mu.RUnlock()
 
 	var peerInfos []utils.PeerInfo
-	for id, url := range m.participantURLs {
-		peerInfos = append(peerInfos, utils.PeerInfo{
-			ID:  id,
-			URL: url,
-		})
+	for id := range m.participantURLs {
+		peerInfos = append(peerInfos, m.peerInfoLocked(id))
 	}
 
 	return peerInfos
 }
 
+// peerInfoLocked 参与方的URL、身份公钥和中继公钥，调用方需持有锁
+func (m *Manager) peerInfoLocked(id int) utils.PeerInfo {
+	relayKey := m.relayKeys[id]
+	return utils.PeerInfo{
+		ID:                id,
+		URL:               m.participantURLs[id],
+		PublicKey:         m.publicKeyBase64(id),
+		RelayKey:          relayKey.Key,
+		RelayKeySignature: relayKey.Signature,
+	}
+}
+
 // GetParticipants 获取所有参与方信息
 func (m *Manager) GetParticipants() []*utils.ParticipantInfo {
 	m.mu.RLock()
@@ -153,6 +272,32 @@ func (m *Manager) GetParticipants() []*utils.ParticipantInfo {
 	return participants
 }
 
+// Record 参与方登记信息，用于持久化会话状态
+type Record struct {
+	ID        int    `json:"id"`
+	ShardID   string `json:"shard_id"`
+	PublicKey string `json:"public_key,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// Records 获取所有已注册参与方的登记信息，按ID升序
+func (m *Manager) Records() []Record {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]Record, 0, len(m.idToShard))
+	for id, shardID := range m.idToShard {
+		records = append(records, Record{
+			ID:        id,
+			ShardID:   shardID,
+			PublicKey: m.publicKeyBase64(id),
+			URL:       m.participantURLs[id],
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
 // UpdateHeartbeat 更新参与方心跳
 func (m *Manager) UpdateHeartbeat(participantID int) error {
 	m.mu.Lock()
@@ -174,13 +319,10 @@ func (m *Manager) GetOnlineParticipants() []utils.PeerInfo {
 	var onlineParticipants []utils.PeerInfo
 	now := time.Now()
 
-	for id, url := range m.participantURLs {
+	for id := range m.participantURLs {
 		if lastHeartbeat, exists := m.heartbeats[id]; exists {
 			if now.Sub(lastHeartbeat) <= m.onlineTimeout {
-				onlineParticipants = append(onlineParticipants, utils.PeerInfo{
-					ID:  id,
-					URL: url,
-				})
+				onlineParticipants = append(onlineParticipants, m.peerInfoLocked(id))
 			}
 		}
 	}
@@ -211,6 +353,8 @@ func (m *Manager) GetOnlineStatus() map[string]interface{} {
 		"total_count":        totalCount,
 		"online_percentage":  onlinePercentage,
 		"min_participants":   m.minParticipants,
+		"expected_n":         m.expectedN,
+		"threshold":          m.threshold,
 		"can_proceed":        canProceed,
 		"online_timeout":     m.onlineTimeout.Seconds(),
 		"heartbeat_interval": m.heartbeatInterval.Seconds(),
@@ -232,27 +376,51 @@ func (m *Manager) CleanupOfflineParticipants() {
 	}
 }
 
-// StartHeartbeatCleanup 启动心跳清理协程
-func (m *Manager) StartHeartbeatCleanup() {
-	// 启动心跳清理协程，创建定时器每m.heartbeatInterval秒执行一次
-	go func() {
-		ticker := time.NewTicker(m.heartbeatInterval)
-		defer ticker.Stop()
+// RunHeartbeatCleanup 定期清理心跳超时的参与方，每次清理后调用 onCleanup，阻塞直到 ctx 取消
+func (m *Manager) RunHeartbeatCleanup(ctx context.Context, onCleanup func()) {
+	// 创建定时器每m.heartbeatInterval秒执行一次
+	ticker := time.NewTicker(m.heartbeatInterval)
+	defer ticker.Stop()
 
-		for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
 			m.CleanupOfflineParticipants()
+			if onCleanup != nil {
+				onCleanup()
+			}
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
 }
 
 // GetMinParticipants 获取最小参与方数量
 func (m *Manager) GetMinParticipants() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.minParticipants
 }
 
 // GetExpectedN 获取期望的参与方数量
 func (m *Manager) GetExpectedN() int {
-	return m.minParticipants
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.expectedN
+}
+
+// GetThreshold 获取门限值t
+func (m *Manager) GetThreshold() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.threshold
+}
+
+// IsThresholdMode 是否启用了t<N的门限模式
+func (m *Manager) IsThresholdMode() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.threshold < m.expectedN
 }
 
 // GetLastHeartbeat 获取指定参与方的最后心跳时间
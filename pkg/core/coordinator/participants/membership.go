@@ -0,0 +1,122 @@
+package participants
+
+import (
+	"MPHEDev/pkg/core/coordinator/utils"
+	"fmt"
+	"sort"
+)
+
+// ==================== 成员与成员纪元 ====================
+//
+// 成员是持有当前集体私钥份额的参与方。初始密钥生成完成后，上传公钥份额的N个参与方成为
+// 第0成员纪元的成员；之后注册的参与方是候选成员，不参与密钥生成和协同解密，
+// 直到协调器通过一次密钥轮换把它加入集体密钥，此时成员纪元加1，N更新为新的成员数量。
+// 成员设置之前（初始密钥生成期间）全部已注册的参与方都视为成员。
+
+// SetMembers 设置成员及成员纪元，N更新为成员数量
+// 门限模式下t不变；全员模式（t=N）下t随N一起更新，仍需全部成员参与
+func (m *Manager) SetMembers(ids []int, epoch int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(ids) == 0 {
+		return fmt.Errorf("成员列表为空")
+	}
+	prevMembers, prevEpoch, prevN, prevT, prevMin := m.members, m.membershipEpoch, m.expectedN, m.threshold, m.minParticipants
+	m.setMembersLocked(ids, epoch)
+	if err := m.persistLocked(); err != nil {
+		m.members, m.membershipEpoch, m.expectedN, m.threshold, m.minParticipants = prevMembers, prevEpoch, prevN, prevT, prevMin
+		return err
+	}
+	fmt.Printf("成员纪元 %d: 成员 %v\n", epoch, m.sortedMembersLocked())
+	return nil
+}
+
+// setMembersLocked 替换成员集合，调用方需持有写锁
+func (m *Manager) setMembersLocked(ids []int, epoch int) {
+	m.members = make(map[int]bool, len(ids))
+	for _, id := range ids {
+		m.members[id] = true
+	}
+	m.membershipEpoch = epoch
+	if m.threshold >= m.expectedN {
+		m.threshold = len(m.members)
+		m.minParticipants = m.threshold
+	}
+	m.expectedN = len(m.members)
+}
+
+// sortedMembersLocked 按升序返回成员ID，调用方需持有锁
+func (m *Manager) sortedMembersLocked() []int {
+	ids := make([]int, 0, len(m.members))
+	for id := range m.members {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// HasMembers 是否已设置成员（初始密钥生成已完成）
+func (m *Manager) HasMembers() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.members) > 0
+}
+
+// GetMembers 按升序返回当前成员ID
+func (m *Manager) GetMembers() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sortedMembersLocked()
+}
+
+// GetMembershipEpoch 获取当前成员纪元
+func (m *Manager) GetMembershipEpoch() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.membershipEpoch
+}
+
+// IsMember 参与方是否为当前成员，成员设置之前已注册的参与方都视为成员
+func (m *Manager) IsMember(participantID int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.members) == 0 {
+		_, exists := m.participants[participantID]
+		return exists
+	}
+	return m.members[participantID]
+}
+
+// GetCandidates 按升序返回已注册但尚未加入集体密钥的参与方ID
+func (m *Manager) GetCandidates() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := []int{}
+	if len(m.members) == 0 {
+		return ids
+	}
+	for id := range m.participants {
+		if !m.members[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// GetOnlineMembers 获取在线的成员，成员设置之前返回全部在线参与方
+func (m *Manager) GetOnlineMembers() []utils.PeerInfo {
+	online := m.GetOnlineParticipants()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.members) == 0 {
+		return online
+	}
+	members := make([]utils.PeerInfo, 0, len(online))
+	for _, peer := range online {
+		if m.members[peer.ID] {
+			members = append(members, peer)
+		}
+	}
+	return members
+}
@@ -0,0 +1,94 @@
+package participants
+
+import (
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"crypto/ed25519"
+	"fmt"
+)
+
+// storeKey 参与方登记信息在状态存储中的键
+const storeKey = "participants"
+
+// Snapshot 参与方登记信息快照，心跳时间不保存，恢复后参与方重新发送心跳即恢复在线
+type Snapshot struct {
+	NextID     int
+	ShardToID  map[string]int
+	FreeIDs    []int
+	URLs       map[int]string
+	PublicKeys map[int][]byte
+	RelayKeys  map[int]RelayKey
+
+	// 成员及成员纪元，初始密钥生成完成前为空
+	Members         []int
+	MembershipEpoch int
+}
+
+// SetStore 设置状态存储，之后的注册、注销和URL上报都会写入存储
+func (m *Manager) SetStore(s store.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = s
+}
+
+// persistLocked 保存登记信息快照，调用方需持有写锁
+func (m *Manager) persistLocked() error {
+	if m.store == nil {
+		return nil
+	}
+	snapshot := Snapshot{
+		NextID:     m.nextID,
+		ShardToID:  m.shardToID,
+		FreeIDs:    m.freeIDs,
+		URLs:       m.participantURLs,
+		PublicKeys: make(map[int][]byte, len(m.publicKeys)),
+		RelayKeys:  m.relayKeys,
+
+		Members:         m.sortedMembersLocked(),
+		MembershipEpoch: m.membershipEpoch,
+	}
+	for id, pub := range m.publicKeys {
+		snapshot.PublicKeys[id] = pub
+	}
+	if err := store.PutGob(m.store, storeKey, snapshot); err != nil {
+		return fmt.Errorf("保存参与方状态失败: %v", err)
+	}
+	return nil
+}
+
+// Restore 从状态存储恢复参与方登记信息，存储中没有记录时返回 false
+func (m *Manager) Restore() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store == nil {
+		return false, fmt.Errorf("未设置状态存储")
+	}
+
+	var snapshot Snapshot
+	ok, err := store.GetGob(m.store, storeKey, &snapshot)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	m.nextID = snapshot.NextID
+	m.freeIDs = snapshot.FreeIDs
+	for shardID, id := range snapshot.ShardToID {
+		m.shardToID[shardID] = id
+		m.idToShard[id] = shardID
+		m.participants[id] = &utils.ParticipantInfo{ID: id, Status: "registered"}
+	}
+	for id, url := range snapshot.URLs {
+		m.participantURLs[id] = url
+	}
+	for id, pub := range snapshot.PublicKeys {
+		m.publicKeys[id] = ed25519.PublicKey(pub)
+	}
+	for id, key := range snapshot.RelayKeys {
+		m.relayKeys[id] = key
+	}
+	if len(snapshot.Members) > 0 {
+		m.setMembersLocked(snapshot.Members, snapshot.MembershipEpoch)
+	}
+	fmt.Printf("已恢复 %d 个参与方的登记信息\n", len(m.shardToID))
+	return true, nil
+}
@@ -0,0 +1,285 @@
+// Package phases 会话阶段状态机
+//
+// 会话按固定顺序推进：registration → pk → rlk_round1 → rlk_round2 → galois → verification →
+// ready → computing → closed。每个阶段只接受该阶段的密钥份额，阶段可以设置超时，超时或密钥验证
+// 失败时进入 failed。failed 和 closed 是终止阶段，除 closed 外不再离开。
+package phases
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phase 会话阶段
+type Phase string
+
+const (
+	Registration Phase = "registration" // 等待N个参与方注册和CRS种子协商
+	PublicKey    Phase = "pk"           // 收集公钥份额（调试模式下还有私钥）
+	RelinRound1  Phase = "rlk_round1"   // 收集重线性化密钥第一轮份额
+	RelinRound2  Phase = "rlk_round2"   // 收集重线性化密钥第二轮份额
+	Galois       Phase = "galois"       // 收集初始伽罗瓦密钥份额
+	Verification Phase = "verification" // 密钥已全部聚合，协同解密验证密钥
+	Ready        Phase = "ready"        // 密钥验证通过，等待计算
+	Computing    Phase = "computing"    // 已有参与方提议解密任务
+	Closed       Phase = "closed"       // 会话已关闭
+	Failed       Phase = "failed"       // 阶段超时或密钥验证失败
+)
+
+// order 正常推进的顺序，failed 不在其中
+var order = []Phase{Registration, PublicKey, RelinRound1, RelinRound2, Galois, Verification, Ready, Computing, Closed}
+
+// ErrOutOfPhase 请求不属于会话当前阶段
+var ErrOutOfPhase = errors.New("请求不属于会话当前阶段")
+
+// Parse 解析阶段名称
+func Parse(name string) (Phase, error) {
+	if Phase(name) == Failed {
+		return Failed, nil
+	}
+	for _, p := range order {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("未知的会话阶段: %s", name)
+}
+
+// index 阶段在推进顺序中的位置，failed 为 -1
+func (p Phase) index() int {
+	for i, q := range order {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Next 正常推进的下一阶段，computing 和终止阶段没有下一阶段
+func (p Phase) Next() (Phase, bool) {
+	i := p.index()
+	if i < 0 || i+1 >= len(order) || p == Computing {
+		return "", false
+	}
+	return order[i+1], true
+}
+
+// Reached 是否已推进到 target 或之后，终止阶段不算
+func (p Phase) Reached(target Phase) bool {
+	i, j := p.index(), target.index()
+	return !p.Terminal() && j >= 0 && i >= j
+}
+
+// Terminal 是否为终止阶段
+func (p Phase) Terminal() bool {
+	return p == Failed || p == Closed
+}
+
+// Timeouts 各阶段的超时时间，未列出或为0的阶段不限时
+type Timeouts map[Phase]time.Duration
+
+// DefaultTimeouts 默认超时：注册不限时，密钥生成各阶段按默认参数下最慢参与方所需时间留出余量
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		PublicKey:    10 * time.Minute,
+		RelinRound1:  10 * time.Minute,
+		RelinRound2:  10 * time.Minute,
+		Galois:       30 * time.Minute,
+		Verification: 15 * time.Minute,
+	}
+}
+
+// ParseTimeouts 按阶段名称解析以秒为单位的超时，覆盖默认值；0表示不限时
+func ParseTimeouts(seconds map[string]int) (Timeouts, error) {
+	timeouts := DefaultTimeouts()
+	for name, s := range seconds {
+		p, err := Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		if p.Terminal() || p == Ready || p == Computing {
+			return nil, fmt.Errorf("阶段 %s 不能设置超时", name)
+		}
+		if s < 0 {
+			return nil, fmt.Errorf("阶段 %s 的超时不能为负数", name)
+		}
+		timeouts[p] = time.Duration(s) * time.Second
+	}
+	return timeouts, nil
+}
+
+// Transition 一次阶段变化
+type Transition struct {
+	From   Phase
+	To     Phase
+	Reason string // 进入 failed 的原因
+	At     time.Time
+}
+
+// Hook 阶段变化后调用，按变化顺序依次调用，不能在其中推进状态机
+type Hook func(Transition)
+
+// State 当前阶段的快照
+type State struct {
+	Phase    Phase
+	Since    time.Time
+	Deadline time.Time // 超时时间，不限时为零值
+	Error    string    // failed 的原因
+}
+
+// Machine 会话阶段状态机，并发安全
+type Machine struct {
+	// transition 串行化阶段变化和钩子调用，钩子按变化顺序执行
+	transition sync.Mutex
+
+	mu       sync.RWMutex
+	state    State
+	timeouts Timeouts
+	timer    *time.Timer
+	hooks    []Hook
+	// lagging 超时时说明当前阶段在等待什么，写入失败原因
+	lagging func(Phase) string
+}
+
+// NewMachine 创建处于 registration 阶段的状态机
+func NewMachine(timeouts Timeouts) *Machine {
+	if timeouts == nil {
+		timeouts = DefaultTimeouts()
+	}
+	m := &Machine{timeouts: timeouts}
+	m.enterLocked(Registration, "")
+	return m
+}
+
+// OnTransition 注册阶段变化钩子
+func (m *Machine) OnTransition(hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// OnTimeout 设置超时时说明当前阶段在等待什么的函数
+func (m *Machine) OnTimeout(lagging func(Phase) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lagging = lagging
+}
+
+// Current 当前阶段
+func (m *Machine) Current() Phase {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.Phase
+}
+
+// State 当前阶段的快照
+func (m *Machine) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Timeouts 各阶段的超时配置
+func (m *Machine) Timeouts() Timeouts {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	timeouts := make(Timeouts, len(m.timeouts))
+	for p, d := range m.timeouts {
+		timeouts[p] = d
+	}
+	return timeouts
+}
+
+// Require 当前阶段不是 allowed 之一时返回 ErrOutOfPhase
+func (m *Machine) Require(allowed ...Phase) error {
+	current := m.Current()
+	for _, p := range allowed {
+		if current == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 当前为 %s", ErrOutOfPhase, current)
+}
+
+// Advance 当前阶段为 from 时推进到下一阶段，返回是否推进
+// 多个请求同时完成同一阶段时只有一个推进
+func (m *Machine) Advance(from Phase) bool {
+	to, ok := from.Next()
+	if !ok {
+		return false
+	}
+	return m.move(func(current Phase) bool { return current == from }, to, "")
+}
+
+// Fail 进入 failed，终止阶段不变，返回是否变化
+func (m *Machine) Fail(reason string) bool {
+	return m.move(func(current Phase) bool { return !current.Terminal() }, Failed, reason)
+}
+
+// Close 进入 closed 并停止计时，可重复调用
+func (m *Machine) Close() {
+	m.move(func(current Phase) bool { return current != Closed }, Closed, "")
+}
+
+// Restore 恢复会话时直接设置阶段，不调用钩子，超时从恢复时重新计算
+func (m *Machine) Restore(phase Phase, reason string) {
+	m.transition.Lock()
+	defer m.transition.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enterLocked(phase, reason)
+}
+
+// move 满足 allowed 时进入 to 并调用钩子
+func (m *Machine) move(allowed func(Phase) bool, to Phase, reason string) bool {
+	m.transition.Lock()
+	defer m.transition.Unlock()
+
+	m.mu.Lock()
+	from := m.state.Phase
+	if !allowed(from) {
+		m.mu.Unlock()
+		return false
+	}
+	m.enterLocked(to, reason)
+	t := Transition{From: from, To: to, Reason: reason, At: m.state.Since}
+	hooks := append([]Hook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(t)
+	}
+	return true
+}
+
+// enterLocked 设置阶段并重新计时，调用方需持有 mu
+func (m *Machine) enterLocked(phase Phase, reason string) {
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	now := time.Now()
+	m.state = State{Phase: phase, Since: now, Error: reason}
+	if d := m.timeouts[phase]; d > 0 {
+		m.state.Deadline = now.Add(d)
+		m.timer = time.AfterFunc(d, func() { m.expire(phase, now) })
+	}
+}
+
+// expire 阶段超时，阶段在计时后已经变化时忽略
+func (m *Machine) expire(phase Phase, since time.Time) {
+	m.mu.RLock()
+	lagging := m.lagging
+	m.mu.RUnlock()
+	reason := fmt.Sprintf("%s 阶段超时", phase)
+	if lagging != nil {
+		if detail := lagging(phase); detail != "" {
+			reason += "：" + detail
+		}
+	}
+	m.move(func(current Phase) bool {
+		return current == phase && m.state.Since.Equal(since)
+	}, Failed, reason)
+}
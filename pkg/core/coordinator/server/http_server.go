@@ -2,12 +2,16 @@ package server
 
 import (
 	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/pki"
+	"context"
 	"fmt"
+	"net/http"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
-// HTTPServer HTTP服务器
+// HTTPServer HTTP服务器，多个会话共用，按 /sessions/{协调器ID}/ 前缀分发请求
 type HTTPServer struct {
 	//Gin框架的路由引擎，可通过Router.POST()等方法注册API路由和处理函数
 	Router *gin.Engine
@@ -15,10 +19,17 @@ type HTTPServer struct {
 	Port string
 	//本机IP地址
 	LocalIP string
+	//mTLS配置，nil 时使用明文HTTP
+	TLS *pki.Config
+	//底层HTTP服务器，用于优雅关闭
+	server *http.Server
+	//按协调器ID索引的会话路由
+	sessionsMu sync.RWMutex
+	sessions   map[string]*SessionRouter
 }
 
-// NewHTTPServer 创建新的HTTP服务器
-func NewHTTPServer(port string) *HTTPServer {
+// NewHTTPServer 创建新的HTTP服务器，tlsConfig 不为 nil 时只接受mTLS连接
+func NewHTTPServer(port string, tlsConfig *pki.Config) *HTTPServer {
 	// 获取本机IP
 	localIP, err := utils.GetLocalIP()
 	if err != nil {
@@ -27,11 +38,23 @@ func NewHTTPServer(port string) *HTTPServer {
 	}
 
 	router := gin.Default()
-	return &HTTPServer{
-		Router:  router,
-		Port:    port,
-		LocalIP: localIP,
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
 	}
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig.ServerTLS()
+	}
+	hs := &HTTPServer{
+		Router:   router,
+		Port:     port,
+		LocalIP:  localIP,
+		TLS:      tlsConfig,
+		server:   srv,
+		sessions: make(map[string]*SessionRouter),
+	}
+	router.Any(SessionPrefix+":session/*path", hs.dispatchSession)
+	return hs
 }
 
 // Start 启动HTTP服务器
@@ -39,8 +62,8 @@ func (hs *HTTPServer) Start() error {
 	fmt.Printf("协调器启动中...\n")
 	fmt.Printf("本机IP: %s\n", hs.LocalIP)
 	fmt.Printf("监听地址: 0.0.0.0:%s\n", hs.Port)
-	fmt.Printf("详细状态页面: http://%s:%s/status\n", hs.LocalIP, hs.Port)
-	fmt.Printf("在线状态页面: http://%s:%s/status/online\n", hs.LocalIP, hs.Port)
+	fmt.Printf("会话接口: %s://%s:%s%s{协调器ID}/\n", hs.TLS.Scheme(), hs.LocalIP, hs.Port, SessionPrefix)
+	fmt.Printf("详细状态页面: %s://%s:%s%s{协调器ID}/status\n", hs.TLS.Scheme(), hs.LocalIP, hs.Port, SessionPrefix)
 	fmt.Printf("等待参与方连接...\n\n")
 
 	// 设置HTTP服务器超时配置
@@ -50,13 +73,28 @@ func (hs *HTTPServer) Start() error {
 		c.Next()
 	})
 
-	return hs.Router.Run(":" + hs.Port)
+	var err error
+	if hs.TLS == nil {
+		err = hs.server.ListenAndServe()
+	} else {
+		fmt.Printf("已启用mTLS，只接受会话CA签发的客户端证书\n")
+		err = hs.server.ListenAndServeTLS("", "")
+	}
+	// Stop 触发的关闭不是错误
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stop 停止接受新连接，并等待处理中的请求完成或 ctx 超时
+func (hs *HTTPServer) Stop(ctx context.Context) error {
+	return hs.server.Shutdown(ctx)
 }
 
-// Stop 停止HTTP服务器
-func (hs *HTTPServer) Stop() error {
-	// 这里可以实现优雅关闭逻辑
-	return nil
+// SessionURL 会话接口的基础URL，参与方以此作为协调器地址
+func (hs *HTTPServer) SessionURL(id string) string {
+	return fmt.Sprintf("%s://%s:%s%s%s", hs.TLS.Scheme(), hs.LocalIP, hs.Port, SessionPrefix, id)
 }
 
 // GetRouter 获取路由器
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionPrefix 会话接口的路径前缀，参与方访问 /sessions/{协调器ID}/register 等接口
+const SessionPrefix = "/sessions/"
+
+// SessionRouter 单个会话的路由，由共享的HTTP服务器按路径中的协调器ID分发
+// 路由注册在包含 /sessions/{协调器ID} 前缀的完整路径下，请求签名覆盖的路径与参与方发送的一致，
+// 一个会话的签名请求不能在另一个会话中重放
+type SessionRouter struct {
+	ID     string
+	engine *gin.Engine
+
+	mu       sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+// NewSessionRouter 创建会话路由
+func NewSessionRouter(id string) *SessionRouter {
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	return &SessionRouter{ID: id, engine: engine}
+}
+
+// Group 返回会话前缀下的路由组，会话的全部接口注册在其中
+func (s *SessionRouter) Group() *gin.RouterGroup {
+	return s.engine.Group(SessionPrefix + s.ID)
+}
+
+// serve 处理一个请求，会话已关闭时返回404
+func (s *SessionRouter) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		http.Error(w, "会话已关闭", http.StatusNotFound)
+		return
+	}
+	s.inflight.Add(1)
+	s.mu.RUnlock()
+	defer s.inflight.Done()
+
+	s.engine.ServeHTTP(w, r)
+}
+
+// Close 停止接受新请求，并等待处理中的请求完成或 ctx 超时
+func (s *SessionRouter) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AddSession 把会话路由挂到服务器上，之后 /sessions/{协调器ID}/ 下的请求交给该会话处理
+func (hs *HTTPServer) AddSession(s *SessionRouter) {
+	hs.sessionsMu.Lock()
+	defer hs.sessionsMu.Unlock()
+	hs.sessions[s.ID] = s
+}
+
+// RemoveSession 移除会话路由
+func (hs *HTTPServer) RemoveSession(id string) {
+	hs.sessionsMu.Lock()
+	defer hs.sessionsMu.Unlock()
+	delete(hs.sessions, id)
+}
+
+// dispatchSession 按路径中的协调器ID把请求交给对应的会话路由
+func (hs *HTTPServer) dispatchSession(ctx *gin.Context) {
+	hs.sessionsMu.RLock()
+	session, ok := hs.sessions[ctx.Param("session")]
+	hs.sessionsMu.RUnlock()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+	session.serve(ctx.Writer, ctx.Request)
+}
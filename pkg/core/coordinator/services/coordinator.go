@@ -1,16 +1,61 @@
 package services
 
 import (
+	"MPHEDev/pkg/core/coordinator/consumers"
+	"MPHEDev/pkg/core/coordinator/events"
 	"MPHEDev/pkg/core/coordinator/keys"
 	"MPHEDev/pkg/core/coordinator/parameters"
 	"MPHEDev/pkg/core/coordinator/participants"
+	"MPHEDev/pkg/core/coordinator/phases"
 	"MPHEDev/pkg/core/coordinator/server"
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/coordinator/tasks"
 	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/relay"
+	"MPHEDev/pkg/core/wire"
+	"context"
+	"crypto/ed25519"
 	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Config 协调器配置
+type Config struct {
+	ExpectedN     int    // 参与密钥生成的参与方数量N
+	Threshold     int    // 协同解密所需的最少参与方数量t（t-out-of-N），<=0 表示要求全部N个参与方在线
+	DataSplitType string // 数据集划分方式
+	// InsecureDebug 允许参与方上传私钥并在协调器上聚合skAgg，仅用于测试环境
+	InsecureDebug bool
+	// CRSContribution 要求全部参与方通过commit-reveal共同贡献CRS种子
+	CRSContribution bool
+	// Profile CKKS参数配置档，为空时使用内置默认参数
+	Profile *parameters.Profile
+	// TLS 与参与方通信的mTLS配置，为空时使用明文HTTP
+	TLS *pki.Config
+	// Encoding 发往参与方的帧格式消息的压缩编码，为空时不压缩
+	Encoding wire.Encoding
+	// StateDir 关闭时保存会话状态的目录，为空时不保存
+	StateDir string
+	// Store 会话状态存储，为空时状态只保存在内存中，重启后无法恢复
+	Store store.Store
+	// DecryptApprovals 解密任务需要的参与方批准数，<=0 时为协同解密所需的参与方数量
+	DecryptApprovals int
+	// RotateAfterDecryptions 每批准多少个解密任务后轮换集体密钥，<=0 表示只手动轮换
+	RotateAfterDecryptions int
+	// PhaseTimeouts 各会话阶段的超时，为空时使用 phases.DefaultTimeouts
+	PhaseTimeouts phases.Timeouts
+	// ID 协调器ID，参与方通过 /sessions/{ID}/ 访问本会话
+	ID string
+	// Server 多个会话共用的HTTP服务器
+	Server *server.HTTPServer
+}
+
 // Coordinator 重构后的协调器主结构体
 type Coordinator struct {
 	// 参与者管理
@@ -28,44 +73,164 @@ type Coordinator struct {
 	// 密钥测试
 	KeyTester *keys.Tester
 
-	// HTTP服务器
+	// 结果接收方（公钥切换的目标）
+	ConsumerManager *consumers.Manager
+
+	// 解密任务授权
+	TaskManager *tasks.Manager
+
+	// 共享的HTTP服务器和本会话的路由
 	HTTPServer *server.HTTPServer
+	router     *server.SessionRouter
 
 	// 状态管理
-	expectedN int
+	id            string
+	createdAt     time.Time
+	expectedN     int
+	threshold     int
+	insecureDebug bool
+
+	// 访问参与方P2P接口的客户端（协同解密验证），连接不上的参与方经中继访问
+	peerClient *http.Client
+	relayHub   *relay.Hub    // 参与方的中继连接，见 coordinator_relay.go
+	encoding   wire.Encoding // 发往参与方的消息的压缩编码
+
+	// 身份认证：协调器会话签名身份，以及按登记公钥验证参与方请求
+	identity *identity.Identity
+	verifier *identity.Verifier
+
+	// 密钥验证状态
+	verifyMu     sync.Mutex
+	verifyStatus string // pending/running/passed/failed
+	verifyError  string
+
+	// 追加旋转密钥
+	rotationMu       sync.Mutex
+	unverifiedGalEls []uint64   // 追加轮次中尚未验证的伽罗瓦元素
+	galoisAggMu      sync.Mutex // 保证每个伽罗瓦元素只聚合一次
+
+	// 集体密钥轮换
+	keyRotationMu            sync.Mutex
+	keyRotation              *keyRotation // 最近一次轮换，为空表示本次启动后未轮换过
+	rotateAfterDecryptions   int          // 每批准多少个解密任务后轮换，0表示只手动轮换
+	decryptionsSinceRotation int          // 当前纪元已批准的解密任务数
+
+	// 会话事件：推送给订阅的参与方，eventMu 保证事件按状态变化的顺序发布
+	events          *events.Bus
+	eventMu         sync.Mutex
+	announcedOnline map[int]bool // 最近发布的在线参与方
+
+	// 会话阶段，见 coordinator_phases.go
+	phases *phases.Machine
+
+	// 会话状态存储，为空时只保存在内存中
+	store store.Store
+
+	// 生命周期：ctx 在关闭时取消，background 跟踪后台协程
+	ctx          context.Context
+	cancel       context.CancelFunc
+	background   sync.WaitGroup
+	shutdownOnce sync.Once
+	stateDir     string
 }
 
 // NewCoordinator 创建新的协调器实例
-func NewCoordinator(expectedN int, dataSplitType string) (*Coordinator, error) {
+func NewCoordinator(cfg Config) (*Coordinator, error) {
+	coordinator, err := newCoordinator(cfg, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Store != nil {
+		if err := coordinator.initStore(cfg.Store, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return coordinator, nil
+}
+
+// newCoordinator 创建协调器，恢复会话时传入参数快照和原签名身份
+func newCoordinator(cfg Config, snapshot *parameters.Snapshot, coordinatorIdentity *identity.Identity) (*Coordinator, error) {
+	if cfg.ID == "" || cfg.Server == nil {
+		return nil, fmt.Errorf("缺少协调器ID或会话HTTP服务器")
+	}
+
 	// 创建参数管理器
-	paramManager, err := parameters.NewManager(dataSplitType)
+	crsContributors := 0
+	if cfg.CRSContribution {
+		crsContributors = cfg.ExpectedN
+	}
+	paramManager, err := parameters.NewManager(parameters.Options{
+		Profile:         cfg.Profile,
+		DataSplitType:   cfg.DataSplitType,
+		CRSContributors: crsContributors,
+		Snapshot:        snapshot,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("创建参数管理器失败: %v", err)
 	}
 
 	// 创建参与者管理器
-	participantManager := participants.NewManager(expectedN)
+	participantManager := participants.NewManager(cfg.ExpectedN, cfg.Threshold)
 
 	// 创建密钥管理器
-	keyManager := keys.NewManager(paramManager.GetCKKSParams(), expectedN)
+	keyManager := keys.NewManager(paramManager.GetCKKSParams(), cfg.ExpectedN)
 
 	// 创建密钥聚合器
 	keyAggregator := keys.NewAggregator(keyManager)
 
-	// 创建密钥测试器
-	keyTester := keys.NewTester(keyManager)
+	// 默认需要与协同解密相同数量的参与方批准
+	decryptApprovals := cfg.DecryptApprovals
+	if decryptApprovals <= 0 {
+		decryptApprovals = participantManager.GetThreshold()
+	}
 
-	// 创建HTTP服务器
-	httpServer := server.NewHTTPServer("8080")
+	// 每个会话生成新的协调器签名身份
+	if coordinatorIdentity == nil {
+		coordinatorIdentity, err = identity.Generate()
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	coordinator := &Coordinator{
 		ParticipantManager: participantManager,
 		ParameterManager:   paramManager,
 		KeyManager:         keyManager,
 		KeyAggregator:      keyAggregator,
-		KeyTester:          keyTester,
-		HTTPServer:         httpServer,
-		expectedN:          expectedN,
+		ConsumerManager:    consumers.NewManager(),
+		TaskManager:        tasks.NewManager(cfg.ExpectedN, decryptApprovals),
+		HTTPServer:         cfg.Server,
+		router:             server.NewSessionRouter(cfg.ID),
+		id:                 cfg.ID,
+		createdAt:          time.Now(),
+		expectedN:          cfg.ExpectedN,
+		threshold:          participantManager.GetThreshold(),
+		insecureDebug:      cfg.InsecureDebug,
+		peerClient:         newPeerClient(cfg.TLS),
+		relayHub:           relay.NewHub(),
+		encoding:           cfg.Encoding,
+		verifyStatus:       verifyStatusPending,
+		identity:           coordinatorIdentity,
+		verifier:           identity.NewVerifier(participantManager.GetPublicKey),
+		events:             events.NewBus(),
+		announcedOnline:    make(map[int]bool),
+		phases:             phases.NewMachine(cfg.PhaseTimeouts),
+		ctx:                ctx,
+		cancel:             cancel,
+		stateDir:           cfg.StateDir,
+	}
+	if cfg.RotateAfterDecryptions > 0 {
+		coordinator.rotateAfterDecryptions = cfg.RotateAfterDecryptions
+	}
+	coordinator.peerClient.Transport = coordinator.relayTransport(coordinator.peerClient.Transport)
+	coordinator.initPhases()
+
+	// 创建密钥测试器，默认通过参与方协同解密验证密钥
+	coordinator.KeyTester = keys.NewTester(keyManager, coordinator.CollaborativeDecrypt, cfg.InsecureDebug)
+
+	if cfg.InsecureDebug {
+		fmt.Println("[WARNING] 协调器运行在 insecure_debug 模式：参与方将上传私钥，仅可用于测试环境！")
 	}
 
 	// 设置路由
@@ -74,68 +239,127 @@ func NewCoordinator(expectedN int, dataSplitType string) (*Coordinator, error) {
 	return coordinator, nil
 }
 
+// newPeerClient 创建访问参与方P2P接口的客户端，启用mTLS时出示协调器证书
+func newPeerClient(tlsConfig *pki.Config) *http.Client {
+	client := &http.Client{Timeout: 120 * time.Second}
+	if tlsConfig != nil {
+		client.Transport = tlsConfig.Transport()
+	}
+	return client
+}
+
 // setupRoutes 设置HTTP路由
 func (c *Coordinator) setupRoutes() {
-	router := c.HTTPServer.GetRouter()
+	router := c.router.Group()
+
+	// 参与方提交的请求必须带有注册身份的签名
+	auth := c.authenticate()
 
 	// 注册路由处理器
 	router.POST("/register", c.registerHandler)
 	router.GET("/params/ckks", c.getCKKSParamsHandler)
-	router.POST("/keys/public", c.postPublicKeyHandler)
-	router.POST("/keys/secret", c.postSecretKeyHandler)
-	router.POST("/keys/galois", c.postGaloisKeyHandler)
-	router.POST("/keys/relin", c.postRelinearizationKeyHandler)
+	router.POST("/crs/commit", auth, c.commitCRSHandler)
+	router.POST("/crs/reveal", auth, c.revealCRSHandler)
+	router.GET("/crs/status", c.getCRSStatusHandler)
+	router.POST("/keys/public", auth, c.postPublicKeyHandler)
+	router.POST("/keys/secret", auth, c.postSecretKeyHandler)
+	router.POST("/keys/galois", auth, c.postGaloisKeyHandler)
+	router.POST("/keys/galois/rotations", auth, c.addRotationKeysHandler)
+	router.POST("/keys/relin", auth, c.postRelinearizationKeyHandler)
 	router.GET("/keys/relin/round1", c.getRelinearizationKeyRound1AggregatedHandler)
 	router.GET("/keys/aggregated", c.getAggregatedKeysHandler)
 	router.GET("/participants", c.getParticipantsHandler)
 	router.GET("/setup/status", c.getSetupStatusHandler)
+	router.GET("/events", c.eventsHandler)
 
 	// P2P相关路由
-	router.POST("/participants/url", c.reportURLHandler)
+	router.POST("/participants/url", auth, c.reportURLHandler)
 	router.GET("/participants/list", c.getParticipantsListHandler)
 
+	// 中继：参与方保持中继连接，经协调器访问无法直连的参与方
+	router.GET("/relay", auth, c.relayConnectHandler)
+	router.POST("/relay/:to", auth, c.relayForwardHandler)
+
 	// 在线状态管理路由
-	router.POST("/heartbeat", c.heartbeatHandler)
+	router.POST("/heartbeat", auth, c.heartbeatHandler)
 	router.GET("/participants/online", c.getOnlineParticipantsHandler)
 	router.GET("/status/online", c.getOnlineStatusHandler)
 	router.GET("/status", c.getDetailedStatusHandler)
 
-	// 测试相关路由
-	router.POST("/test/all", c.testAllKeysHandler)
-	router.POST("/test/public", c.testPublicKeyHandler)
-	router.POST("/test/relin", c.testRelinearizationKeyHandler)
-	router.POST("/test/galois", c.testGaloisKeysHandler)
+	// 公钥切换：参与方把结果交付给接收方，接收方按结果ID获取密文
+	router.POST("/consumers/reencrypt", auth, c.reencryptHandler)
+	router.GET("/consumers/results/:id", c.getResultHandler)
+
+	// 解密任务授权：参与方提议和表决（包括控制面提议的变更），份额请求前核对任务和授权策略
+	router.POST("/tasks", auth, c.proposeTaskHandler)
+	router.POST("/tasks/:id/vote", auth, c.voteTaskHandler)
+	router.GET("/tasks", c.listTasksHandler)
+	router.GET("/tasks/:id", c.getTaskHandler)
+	router.GET("/policy", c.getPolicyHandler)
+
+	// 测试相关路由：会发起协同解密，仅在insecure_debug模式下接受成员的请求
+	router.POST("/test/all", auth, c.debugOnly, c.testAllKeysHandler)
+	router.POST("/test/public", auth, c.debugOnly, c.testPublicKeyHandler)
+	router.POST("/test/relin", auth, c.debugOnly, c.testRelinearizationKeyHandler)
+	router.POST("/test/galois", auth, c.debugOnly, c.testGaloisKeysHandler)
 
 	// 重线性化密钥状态查询路由
 	router.GET("/keys/relin/status", c.getRelinearizationKeyStatusHandler)
 
-	router.POST("/unregister", c.unregisterHandler)
+	// 集体密钥轮换：参与方上传新纪元的份额、获取新密钥并报告切换和提交进度
+	router.GET("/keys/rotation", c.getKeyRotationHandler)
+	router.POST("/keys/rotation/shares", auth, c.postKeyRotationShareHandler)
+	router.GET("/keys/rotation/relin/round1", c.getKeyRotationRelinRound1Handler)
+	router.GET("/keys/rotation/keys", c.getKeyRotationKeysHandler)
+	router.POST("/keys/rotation/report", auth, c.postKeyRotationReportHandler)
+
+	// 成员和成员纪元
+	router.GET("/members", c.getMembersHandler)
+
+	router.POST("/unregister", auth, c.unregisterHandler)
 }
 
-// Start 启动协调器
-func (c *Coordinator) Start() error {
-	// 启动心跳清理协程
-	c.ParticipantManager.StartHeartbeatCleanup()
+// Start 启动后台协程，并把会话路由挂到共享的HTTP服务器上
+func (c *Coordinator) Start() {
+	// 启动心跳清理协程，清理后发布离线事件
+	c.goBackground(func() {
+		c.ParticipantManager.RunHeartbeatCleanup(c.ctx, c.checkOnline)
+	})
 
-	// 启动HTTP服务器
-	return c.HTTPServer.Start()
+	c.HTTPServer.AddSession(c.router)
+	fmt.Printf("会话 %s 已启动，参与方地址: %s\n", c.id, c.GetSessionURL())
 }
 
 // ==================== 参与者管理方法 ====================
 
-// RegisterParticipant 注册新参与方
-func (c *Coordinator) RegisterParticipant(shardID string) int {
-	return c.ParticipantManager.RegisterParticipant(shardID)
+// RegisterParticipant 注册新参与方并登记身份公钥
+func (c *Coordinator) RegisterParticipant(shardID string, publicKey ed25519.PublicKey) (int, error) {
+	id, err := c.ParticipantManager.RegisterParticipant(shardID, publicKey)
+	if err != nil {
+		return 0, err
+	}
+	c.publish(events.Event{Type: events.ParticipantJoined, ParticipantID: id})
+	c.advancePhases()
+	return id, nil
 }
 
 // UnregisterParticipant 注销参与方
 func (c *Coordinator) UnregisterParticipant(shardID string) {
+	id, ok := c.ParticipantManager.GetParticipantIDByShard(shardID)
 	c.ParticipantManager.UnregisterParticipant(shardID)
+	if ok {
+		c.checkOnline()
+		c.publish(events.Event{Type: events.ParticipantLeft, ParticipantID: id})
+	}
 }
 
-// AddParticipantURL 添加参与方URL
-func (c *Coordinator) AddParticipantURL(participantID int, url string) error {
-	return c.ParticipantManager.AddParticipantURL(participantID, url)
+// AddParticipantURL 添加参与方URL和中继公钥
+func (c *Coordinator) AddParticipantURL(participantID int, url string, relayKey participants.RelayKey) error {
+	if err := c.ParticipantManager.AddParticipantURL(participantID, url, relayKey); err != nil {
+		return err
+	}
+	c.checkOnline()
+	return nil
 }
 
 // GetParticipants 获取所有参与方信息
@@ -150,7 +374,11 @@ func (c *Coordinator) GetAllParticipantURLs() []utils.PeerInfo {
 
 // UpdateHeartbeat 更新参与方心跳
 func (c *Coordinator) UpdateHeartbeat(participantID int) error {
-	return c.ParticipantManager.UpdateHeartbeat(participantID)
+	if err := c.ParticipantManager.UpdateHeartbeat(participantID); err != nil {
+		return err
+	}
+	c.checkOnline()
+	return nil
 }
 
 // GetOnlineParticipants 获取在线参与方列表
@@ -168,14 +396,39 @@ func (c *Coordinator) GetMinParticipants() int {
 	return c.ParticipantManager.GetMinParticipants()
 }
 
+// GetThreshold 获取门限值t
+func (c *Coordinator) GetThreshold() int {
+	return c.threshold
+}
+
+// IsInsecureDebug 是否运行在允许上传私钥的调试模式
+func (c *Coordinator) IsInsecureDebug() bool {
+	return c.insecureDebug
+}
+
 // GetLocalIP 获取本机IP地址
 func (c *Coordinator) GetLocalIP() string {
 	return c.HTTPServer.GetLocalIP()
 }
 
+// GetID 获取协调器ID，控制面和参与方按此ID访问本会话
+func (c *Coordinator) GetID() string {
+	return c.id
+}
+
+// GetSessionURL 参与方访问本会话的基础URL
+func (c *Coordinator) GetSessionURL() string {
+	return c.HTTPServer.SessionURL(c.id)
+}
+
 // ==================== 参数管理方法 ====================
 
 // GetParams 获取参数
 func (c *Coordinator) GetParams() (string, []uint64, string, string) {
 	return c.ParameterManager.GetParams()
 }
+
+// GetSessionID 获取会话ID
+func (c *Coordinator) GetSessionID() string {
+	return c.ParameterManager.GetSessionID()
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/wire"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 参与方身份认证 ====================
+//
+// 参与方注册时登记Ed25519身份公钥，之后提交密钥份额、心跳、URL和CRS种子等请求都必须
+// 携带签名。协调器按签名方ID查找公钥验证签名、时间戳和随机数，并要求请求体中声明的
+// participant_id 与签名方一致，拒绝伪造或重放的份额。协调器自身持有会话签名身份，
+// 发往参与方的请求同样签名，公钥在注册响应中下发。
+
+// authenticatedIDKey gin上下文中通过认证的参与方ID
+const authenticatedIDKey = "authenticated_participant_id"
+
+// authenticate 验证参与方请求签名的中间件
+func (c *Coordinator) authenticate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		signer, err := c.verifier.Verify(ctx.Request, body)
+		if err != nil {
+			fmt.Printf("[认证] 拒绝请求 %s: %v\n", ctx.Request.URL.Path, err)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 签名覆盖压缩后的字节，验证通过后再解压
+		if body, err = wire.DecodeBody(ctx.Request, body); err != nil {
+			if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+				ctx.Header("Accept-Encoding", wire.Supported())
+			}
+			ctx.AbortWithStatusJSON(wire.StatusCode(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		// 请求体（帧格式消息为控制帧）中声明的参与方ID必须与签名方一致
+		var claim struct {
+			ParticipantID *int `json:"participant_id"`
+		}
+		if err := json.Unmarshal(wire.ControlFrame(ctx.Request.Header.Get("Content-Type"), body), &claim); err == nil && claim.ParticipantID != nil && *claim.ParticipantID != signer {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": fmt.Sprintf("签名方 %d 不能代表参与方 %d 提交请求", signer, *claim.ParticipantID),
+			})
+			return
+		}
+
+		ctx.Set(authenticatedIDKey, signer)
+		ctx.Next()
+	}
+}
+
+// authenticatedID 获取通过认证的参与方ID
+func authenticatedID(ctx *gin.Context) int {
+	return ctx.GetInt(authenticatedIDKey)
+}
+
+// signedPost 以协调器身份签名并发送POST请求
+func (c *Coordinator) signedPost(url string, body []byte) (*http.Response, error) {
+	return c.identity.Post(c.peerClient, url, identity.CoordinatorID, body)
+}
+
+// signedPostMessage 以协调器身份签名并发送帧格式消息，签名覆盖压缩后的请求体
+func (c *Coordinator) signedPostMessage(url string, control interface{}, objects ...[]byte) (*http.Response, error) {
+	req, body, err := wire.NewRequest(c.ctx, url, c.encoding, control, objects...)
+	if err != nil {
+		return nil, err
+	}
+	return c.identity.Do(c.peerClient, req, identity.CoordinatorID, body)
+}
+
+// GetIdentityPublicKey 获取协调器会话签名公钥（base64）
+func (c *Coordinator) GetIdentityPublicKey() string {
+	return c.identity.PublicKeyBase64()
+}
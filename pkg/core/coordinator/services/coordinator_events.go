@@ -0,0 +1,112 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/events"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 会话事件 ====================
+//
+// 参与方订阅 GET /sessions/{协调器ID}/events（Server-Sent Events）接收会话中的变化，不再轮询
+// /setup/status 和 /participants/online。每个事件附带发布时的会话阶段、密钥生成进度和在线参与方，
+// 连接建立时先推送 snapshot 事件；断线重连后以新的快照为准，不补发断线期间的事件。
+
+// eventKeepAlive 事件流的保活间隔，参与方据此判断连接是否断开
+const eventKeepAlive = 15 * time.Second
+
+// currentEvent 以当前状态填充事件，调用方需持有 eventMu
+func (c *Coordinator) currentEvent(ev events.Event) events.Event {
+	status := c.GetStatus()
+	online := c.GetOnlineParticipants()
+	if online == nil {
+		online = []utils.PeerInfo{}
+	}
+	ev.Status = status
+	ev.Online = online
+	ev.Phase = string(c.phases.Current())
+	return ev
+}
+
+// publish 发布事件
+// 调用方不能持有参与者管理器或密钥管理器的锁
+func (c *Coordinator) publish(ev events.Event) {
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+	c.publishLocked(ev)
+}
+
+// publishLocked 发布事件，调用方需持有 eventMu
+func (c *Coordinator) publishLocked(ev events.Event) {
+	c.events.Publish(c.currentEvent(ev))
+}
+
+// checkOnline 对比在线参与方与上次发布时的差异，发布上线和离线事件
+// 在心跳、上报URL、注销和心跳清理之后调用
+func (c *Coordinator) checkOnline() {
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+
+	online := make(map[int]bool)
+	for _, peer := range c.GetOnlineParticipants() {
+		online[peer.ID] = true
+		if !c.announcedOnline[peer.ID] {
+			c.publishLocked(events.Event{Type: events.ParticipantOnline, ParticipantID: peer.ID})
+		}
+	}
+	for id := range c.announcedOnline {
+		if !online[id] {
+			c.publishLocked(events.Event{Type: events.ParticipantOffline, ParticipantID: id})
+		}
+	}
+	c.announcedOnline = online
+}
+
+// eventsHandler 以 Server-Sent Events 推送会话事件，直到参与方断开或会话关闭
+func (c *Coordinator) eventsHandler(ctx *gin.Context) {
+	ch, cancel := c.events.Subscribe()
+	defer cancel()
+
+	c.eventMu.Lock()
+	snapshot := c.currentEvent(events.Event{
+		ID:   c.events.LastID(),
+		Type: events.Snapshot,
+		Time: time.Now(),
+	})
+	c.eventMu.Unlock()
+
+	w := ctx.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := events.WriteSSE(w, snapshot); err != nil {
+		return
+	}
+	w.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := events.WriteSSE(w, ev); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-ctx.Request.Context().Done():
+			return
+		}
+		w.Flush()
+	}
+}
@@ -1,23 +1,29 @@
 package services
 
 import (
+	"MPHEDev/pkg/core/coordinator/keys"
+	"MPHEDev/pkg/core/coordinator/parameters"
+	"MPHEDev/pkg/core/coordinator/participants"
+	"MPHEDev/pkg/core/coordinator/phases"
+	"MPHEDev/pkg/core/coordinator/store"
 	"MPHEDev/pkg/core/coordinator/utils"
-	"bytes"
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/wire"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// KeysResponse 聚合密钥响应结构体
+// KeysResponse 聚合密钥响应的控制帧
+// 其后的对象帧依次为公钥、重线性化密钥和 GaloisElements 对应的伽罗瓦密钥（Lattigo二进制编码）
 type KeysResponse struct {
-	PubKey     string            `json:"pub_key"`
-	RelineKey  string            `json:"reline_key"`
-	GaloisKeys map[string]string `json:"galois_keys"`
+	GaloisElements []uint64 `json:"galois_elements"`
 }
 
 // CoordinatorStartResponse is the response structure for /api/coordinator/init
@@ -27,7 +33,12 @@ type KeysResponse struct {
 //	    Success             bool   `json:"success"`
 //	    Message             string `json:"message"`
 //	    CoordinatorID       string `json:"coordinator_id"`
+//	    SessionID           string `json:"session_id"`
+//	    ParamProfile        string `json:"param_profile"`
+//	    SecurityBits        int    `json:"security_bits"`
 //	    ExpectedParticipants int   `json:"expected_participants"`
+//	    Threshold           int    `json:"threshold"`
+//	    InsecureDebug       bool   `json:"insecure_debug"`
 //	    DataSplitType       string `json:"data_split_type"`
 //	    Status              string `json:"status"`
 //	    CoordinatorIP       string `json:"coordinator_ip"`
@@ -38,7 +49,13 @@ type CoordinatorStartResponse struct {
 	Success              bool   `json:"success"`
 	Message              string `json:"message"`
 	CoordinatorID        string `json:"coordinator_id"`
+	SessionID            string `json:"session_id"`
+	SessionURL           string `json:"session_url"` // 参与方使用的协调器地址
+	ParamProfile         string `json:"param_profile"`
+	SecurityBits         int    `json:"security_bits"`
 	ExpectedParticipants int    `json:"expected_participants"`
+	Threshold            int    `json:"threshold"`
+	InsecureDebug        bool   `json:"insecure_debug"`
 	DataSplitType        string `json:"data_split_type"`
 	Status               string `json:"status"`
 	CoordinatorIP        string `json:"coordinator_ip"`
@@ -58,6 +75,12 @@ type CoordinatorStartResponse struct {
 //
 //	type CoordinatorStatusResponse struct {
 //	    ExpectedParticipants   int                 `json:"expected_participants"`
+//	    Threshold              int                 `json:"threshold"`
+//	    InsecureDebug          bool                `json:"insecure_debug"`
+//	    SessionID              string              `json:"session_id"`
+//	    CRSPhase               string              `json:"crs_phase"`
+//	    Phase                  string              `json:"phase"`
+//	    KeyVerification        string              `json:"key_verification"`
 //	    RegisteredParticipants int                 `json:"registered_participants"`
 //	    OnlineParticipants     int                 `json:"online_participants"`
 //	    DataSplitType          string              `json:"data_split_type"`
@@ -69,14 +92,24 @@ type ParticipantStatus struct {
 	URL           string `json:"url"`
 	Status        string `json:"status"` // "online" or "offline"
 	LastHeartbeat string `json:"last_heartbeat"`
+	Member        bool   `json:"member"` // 是否持有集体私钥份额，false 表示候选成员
 }
 type CoordinatorStatusResponse struct {
+	CoordinatorID          string              `json:"coordinator_id"`
+	SessionURL             string              `json:"session_url"`
 	ExpectedParticipants   int                 `json:"expected_participants"`
+	Threshold              int                 `json:"threshold"`
+	InsecureDebug          bool                `json:"insecure_debug"`
+	SessionID              string              `json:"session_id"`
+	CRSPhase               string              `json:"crs_phase"`
+	Phase                  string              `json:"phase"` // 会话阶段，见 coordinator_phases.go
+	KeyVerification        string              `json:"key_verification"`
 	RegisteredParticipants int                 `json:"registered_participants"`
 	OnlineParticipants     int                 `json:"online_participants"`
 	DataSplitType          string              `json:"data_split_type"`
 	Status                 string              `json:"status"`
 	Participants           []ParticipantStatus `json:"participants"`
+	Membership             MembershipStatus    `json:"membership"`
 }
 
 // KeyProgress struct for GET /api/coordinator/key-progress
@@ -105,8 +138,10 @@ type KeyProgress struct {
 		Round2Ready bool   `json:"round2_ready"`
 		Ready       bool   `json:"ready"`
 	} `json:"relinearization_key"`
-	OverallProgress int  `json:"overall_progress"`
-	AllKeysReady    bool `json:"all_keys_ready"`
+	OverallProgress int    `json:"overall_progress"`
+	AllKeysReady    bool   `json:"all_keys_ready"`
+	InsecureDebug   bool   `json:"insecure_debug"`
+	KeyVerification string `json:"key_verification"` // pending/running/passed/failed
 }
 
 // ==================== HTTP处理器方法 ====================
@@ -118,20 +153,57 @@ func (c *Coordinator) registerHandler(ctx *gin.Context) {
 	fmt.Printf("[DEBUG] 收到注册请求，来源IP: %s\n", clientIP)
 	fmt.Printf("[DEBUG] 请求头: %v\n", ctx.Request.Header)
 
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
 	var req struct {
-		ShardID string `json:"shard_id"`
+		ShardID   string `json:"shard_id"`
+		PublicKey string `json:"public_key"`
 	}
-	if err := ctx.ShouldBindJSON(&req); err != nil || req.ShardID == "" {
+	if err := json.Unmarshal(body, &req); err != nil || req.ShardID == "" || req.PublicKey == "" {
 		fmt.Printf("[DEBUG] 注册请求解析失败: %v\n", err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request, shard_id required"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request, shard_id and public_key required"})
+		return
+	}
+
+	// 注册请求用请求中的公钥签名，证明参与方持有对应私钥
+	publicKey, err := identity.ParsePublicKey(req.PublicKey)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := identity.VerifyRequest(ctx.Request, body, publicKey, c.verifier.Guard()); err != nil {
+		fmt.Printf("[认证] 拒绝注册请求: %v\n", err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	fmt.Printf("[DEBUG] 注册请求成功，shard_id: %s\n", req.ShardID)
-	id := c.RegisterParticipant(req.ShardID)
+	id, err := c.RegisterParticipant(req.ShardID, publicKey)
+	if err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	fmt.Printf("[DEBUG] 分配参与方ID: %d\n", id)
 
-	ctx.JSON(http.StatusOK, gin.H{"participant_id": id})
+	// 初始密钥已生成时，新注册的参与方是候选成员，等待控制面把它加入集体密钥
+	keyGenerated := c.KeyManager.GetGlobalPK() != nil
+	ctx.JSON(http.StatusOK, gin.H{
+		"participant_id":         id,
+		"coordinator_public_key": c.GetIdentityPublicKey(),
+		"threshold":              c.GetThreshold(),
+		"expected_participants":  c.expectedN,
+		// 会话信息：参与方据此校验之后收到的参数
+		"session_id":       c.GetSessionID(),
+		"crs_commitment":   c.ParameterManager.GetCRSCommitment(),
+		"crs_contribution": c.ParameterManager.IsCRSContributionRequired(),
+		// 成员状态：候选成员跳过种子协商和初始密钥生成
+		"key_generated":    keyGenerated,
+		"member":           c.ParticipantManager.IsMember(id),
+		"membership_epoch": c.ParticipantManager.GetMembershipEpoch(),
+	})
 }
 
 // unregisterHandler 注销参与方处理器
@@ -143,6 +215,10 @@ func (c *Coordinator) unregisterHandler(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request, shard_id required"})
 		return
 	}
+	if id, ok := c.ParticipantManager.GetParticipantIDByShard(req.ShardID); ok && id != authenticatedID(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能注销自己的分片"})
+		return
+	}
 	c.UnregisterParticipant(req.ShardID)
 	ctx.JSON(http.StatusOK, gin.H{"status": "unregistered"})
 }
@@ -154,12 +230,35 @@ func (c *Coordinator) getCKKSParamsHandler(ctx *gin.Context) {
 			fmt.Printf("参数接口panic: %v\n", r)
 		}
 	}()
+	if !c.ParameterManager.IsCRSReady() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "CRS种子协商尚未完成",
+			"status": c.ParameterManager.GetCRSStatus(),
+		})
+		return
+	}
 	paramsLiteralB64, galEls, commonCRSSeed, dataSplitType := c.GetParams()
+	coordinatorSeed, contributions := c.ParameterManager.GetCRSTranscript()
 	testObj := gin.H{
 		"params_literal":  paramsLiteralB64, // 现在是base64编码的字符串
 		"gal_els":         galEls,
 		"common_crs_seed": commonCRSSeed, // 统一的CRS种子
 		"data_split_type": dataSplitType,
+		// 会话ID和派生CRS种子的公开材料，参与方据此独立验证种子
+		"session_id":           c.GetSessionID(),
+		"crs_coordinator_seed": coordinatorSeed,
+		"crs_contributions":    contributions,
+		"crs_contributors":     c.ParameterManager.GetCRSContributors(),
+		// 参数配置档名称及按HE标准估计的安全级别
+		"param_profile": c.ParameterManager.GetProfileName(),
+		"security_bits": c.ParameterManager.GetSecurityBits(),
+		// 噪声淹没配置：参与方按同样的规则计算解密和刷新份额的噪声
+		"smudging": c.ParameterManager.GetSmudgingConfig(),
+		// 门限配置：参与方据此决定是否交换Shamir份额
+		"threshold":             c.GetThreshold(),
+		"expected_participants": c.expectedN,
+		// 仅调试模式下参与方才上传私钥
+		"insecure_debug": c.insecureDebug,
 	}
 	b, err := json.Marshal(testObj)
 	if err != nil {
@@ -170,44 +269,97 @@ func (c *Coordinator) getCKKSParamsHandler(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, testObj)
 }
 
-// postPublicKeyHandler 提交公钥份额处理器
-func (c *Coordinator) postPublicKeyHandler(ctx *gin.Context) {
-	var req utils.PublicKeyShare
+// commitCRSHandler 提交CRS种子承诺处理器
+func (c *Coordinator) commitCRSHandler(ctx *gin.Context) {
+	var req struct {
+		ParticipantID int    `json:"participant_id"`
+		SessionID     string `json:"session_id"`
+		Commitment    string `json:"commitment"`
+	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	if req.SessionID != c.GetSessionID() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "session mismatch"})
+		return
+	}
+	if !c.ParticipantManager.IsRegistered(req.ParticipantID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "participant not registered"})
+		return
+	}
+	if err := c.ParameterManager.CommitCRS(req.ParticipantID, req.Commitment); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, c.ParameterManager.GetCRSStatus())
+}
 
-	data, err := utils.DecodeFromBase64(req.ShareData)
+// revealCRSHandler 公开CRS种子处理器
+func (c *Coordinator) revealCRSHandler(ctx *gin.Context) {
+	var req struct {
+		ParticipantID int    `json:"participant_id"`
+		SessionID     string `json:"session_id"`
+		Seed          string `json:"seed"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.SessionID != c.GetSessionID() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "session mismatch"})
+		return
+	}
+	seed, err := utils.DecodeFromBase64(req.Seed)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid share data"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid seed"})
+		return
+	}
+	if err := c.ParameterManager.RevealCRS(req.ParticipantID, seed); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 最后一个种子公开后进入密钥生成阶段
+	c.advancePhases()
+	ctx.JSON(http.StatusOK, c.ParameterManager.GetCRSStatus())
+}
+
+// getCRSStatusHandler 获取CRS种子协商进度处理器
+func (c *Coordinator) getCRSStatusHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.ParameterManager.GetCRSStatus())
+}
+
+// postPublicKeyHandler 提交公钥份额处理器
+func (c *Coordinator) postPublicKeyHandler(ctx *gin.Context) {
+	var req utils.PublicKeyShare
+	data, ok := readShare(ctx, &req)
+	if !ok {
 		return
 	}
 
 	if err := c.AddPublicKeyShare(req.ParticipantID, data); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(phaseErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"status": "public key share added"})
 }
 
-// postSecretKeyHandler 提交私钥处理器
+// postSecretKeyHandler 提交私钥处理器，仅在insecure_debug模式下可用
 func (c *Coordinator) postSecretKeyHandler(ctx *gin.Context) {
-	var req utils.SecretKeyShare
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !c.insecureDebug {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": ErrSecretKeyUploadDisabled.Error()})
 		return
 	}
 
-	data, err := utils.DecodeFromBase64(req.ShareData)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid share data"})
+	var req utils.SecretKeyShare
+	data, ok := readShare(ctx, &req)
+	if !ok {
 		return
 	}
 
 	if err := c.AddSecretKey(req.ParticipantID, data); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(phaseErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -217,19 +369,13 @@ func (c *Coordinator) postSecretKeyHandler(ctx *gin.Context) {
 // postGaloisKeyHandler 提交伽罗瓦密钥份额处理器
 func (c *Coordinator) postGaloisKeyHandler(ctx *gin.Context) {
 	var req utils.GaloisKeyShare
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	data, err := utils.DecodeFromBase64(req.ShareData)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid share data"})
+	data, ok := readShare(ctx, &req)
+	if !ok {
 		return
 	}
 
 	if err := c.AddGaloisKeyShare(req.ParticipantID, req.GalEl, data); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(phaseErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -239,19 +385,13 @@ func (c *Coordinator) postGaloisKeyHandler(ctx *gin.Context) {
 // postRelinearizationKeyHandler 提交重线性化密钥份额处理器
 func (c *Coordinator) postRelinearizationKeyHandler(ctx *gin.Context) {
 	var req utils.RelinearizationKeyShare
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	data, err := utils.DecodeFromBase64(req.ShareData)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid share data"})
+	data, ok := readShare(ctx, &req)
+	if !ok {
 		return
 	}
 
 	if err := c.AddRelinearizationKeyShare(req.ParticipantID, req.Round, data); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(phaseErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -266,7 +406,32 @@ func (c *Coordinator) getRelinearizationKeyRound1AggregatedHandler(ctx *gin.Cont
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"share": share})
+	writeMessage(ctx, gin.H{"round": 1}, share)
+}
+
+// readShare 读取帧格式的份额上传请求：控制帧解析到 control，唯一的对象帧为份额的二进制编码
+// 失败时写出错误响应
+func readShare(ctx *gin.Context, control interface{}) ([]byte, bool) {
+	objects, err := wire.ReadRequest(ctx.Request, control)
+	if err != nil {
+		if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+			ctx.Header("Accept-Encoding", wire.Supported())
+		}
+		ctx.JSON(wire.StatusCode(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(objects) != 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求包含 %d 个对象，应为1个", len(objects))})
+		return nil, false
+	}
+	return objects[0], true
+}
+
+// writeMessage 以帧格式写出200响应，压缩编码按请求的 Accept-Encoding 协商
+func writeMessage(ctx *gin.Context, control interface{}, objects ...[]byte) {
+	if err := wire.WriteResponse(ctx.Writer, ctx.Request, control, objects...); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 // getParticipantsHandler 获取参与方列表处理器
@@ -288,8 +453,18 @@ func (c *Coordinator) reportURLHandler(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	if req.ID != authenticatedID(ctx) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只能上报自己的URL"})
+		return
+	}
+
+	relayKey := participants.RelayKey{Key: req.RelayKey, Signature: req.RelayKeySignature}
+	if err := c.verifyRelayKey(req.ID, relayKey); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := c.AddParticipantURL(req.ID, req.URL); err != nil {
+	if err := c.AddParticipantURL(req.ID, req.URL, relayKey); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -344,24 +519,47 @@ func (c *Coordinator) getDetailedStatusHandler(ctx *gin.Context) {
 	// 获取在线参与方列表
 	onlineParticipants := c.GetOnlineParticipants()
 
+	keyVerification, _ := c.GetKeyVerificationStatus()
+
 	// 构造详细状态响应
 	detailedStatus := gin.H{
 		"coordinator_ip":           c.GetLocalIP(),
-		"port":                     8080,
+		"port":                     sessionServerPort,
 		"total_participants":       len(participants),
 		"online_participants":      len(onlineParticipants),
 		"online_percentage":        onlineStatus["online_percentage"],
 		"min_participants":         onlineStatus["min_participants"],
+		"threshold":                onlineStatus["threshold"],
+		"insecure_debug":           c.insecureDebug,
+		"session_id":               c.GetSessionID(),
+		"crs":                      c.ParameterManager.GetCRSStatus(),
+		"key_verification":         keyVerification,
+		"phase":                    c.phaseStatus(),
 		"can_proceed":              onlineStatus["can_proceed"],
 		"online_timeout":           onlineStatus["online_timeout"],
 		"heartbeat_interval":       onlineStatus["heartbeat_interval"],
 		"participants":             participants,
 		"online_participants_list": onlineParticipants,
+		"key_epoch":                c.ParameterManager.GetKeyEpoch(),
+		"membership":               c.GetMembershipStatus(),
 	}
 
 	ctx.JSON(http.StatusOK, detailedStatus)
 }
 
+// debugOnly 只在insecure_debug模式下放行成员的请求
+func (c *Coordinator) debugOnly(ctx *gin.Context) {
+	if !c.insecureDebug {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrKeyTestDisabled.Error()})
+		return
+	}
+	if err := c.checkMember(authenticatedID(ctx)); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Next()
+}
+
 // testAllKeysHandler 测试所有密钥处理器
 func (c *Coordinator) testAllKeysHandler(ctx *gin.Context) {
 	if err := c.TestAllKeys(); err != nil {
@@ -416,49 +614,47 @@ func (c *Coordinator) getAggregatedKeysHandler(ctx *gin.Context) {
 		return
 	}
 
-	// 获取聚合后的密钥
-	pubKey := c.KeyManager.GetGlobalPK()
-	relineKey := c.KeyManager.GetRelinearizationKey()
-	galoisKeys := c.KeyManager.GetGaloisKeys()
-	galEls := c.ParameterManager.GetGalEls() // 获取伽罗瓦元素顺序
+	resp, objects, err := encodeKeysResponse(c.KeyManager)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fmt.Printf("密钥响应构造完成，发送给 %s\n", ctx.ClientIP())
+	writeMessage(ctx, resp, objects...)
+}
 
+// encodeKeysResponse 序列化密钥管理器中聚合完成的公钥、重线性化密钥和伽罗瓦密钥
+// 返回控制帧和按 KeysResponse 说明排列的对象帧
+func encodeKeysResponse(km *keys.Manager) (*KeysResponse, [][]byte, error) {
 	// 序列化公钥
-	pubKeyBytes, err := utils.EncodeShare(pubKey)
+	pubKeyBytes, err := km.GetGlobalPK().MarshalBinary()
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "公钥序列化失败"})
-		return
+		return nil, nil, fmt.Errorf("公钥序列化失败")
 	}
-	pubKeyB64 := utils.EncodeToBase64(pubKeyBytes)
 
 	// 序列化重线性化密钥
-	relineKeyBytes, err := utils.EncodeShare(relineKey)
+	relineKeyBytes, err := km.GetRelinearizationKey().MarshalBinary()
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "重线性化密钥序列化失败"})
-		return
+		return nil, nil, fmt.Errorf("重线性化密钥序列化失败")
 	}
-	relineKeyB64 := utils.EncodeToBase64(relineKeyBytes)
 
-	// 序列化伽罗瓦密钥
-	galoisKeysMap := make(map[string]string)
-	for i, galEl := range galEls {
-		if i < len(galoisKeys) && galoisKeys[i] != nil {
-			gkBytes, err := utils.EncodeShare(galoisKeys[i])
-			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "伽罗瓦密钥序列化失败"})
-				return
-			}
-			galoisKeysMap[strconv.FormatUint(galEl, 10)] = utils.EncodeToBase64(gkBytes)
+	// 序列化伽罗瓦密钥，控制帧按顺序记录每个密钥自身的伽罗瓦元素（聚合顺序与galEls顺序无关）
+	resp := &KeysResponse{GaloisElements: []uint64{}}
+	objects := [][]byte{pubKeyBytes, relineKeyBytes}
+	for _, gk := range km.GetGaloisKeys() {
+		if gk == nil {
+			continue
 		}
+		gkBytes, err := gk.MarshalBinary()
+		if err != nil {
+			return nil, nil, fmt.Errorf("伽罗瓦密钥序列化失败")
+		}
+		resp.GaloisElements = append(resp.GaloisElements, gk.GaloisElement)
+		objects = append(objects, gkBytes)
 	}
 
-	resp := KeysResponse{
-		PubKey:     pubKeyB64,
-		RelineKey:  relineKeyB64,
-		GaloisKeys: galoisKeysMap,
-	}
-
-	fmt.Printf("密钥响应构造完成，发送给 %s\n", ctx.ClientIP())
-	ctx.JSON(http.StatusOK, resp)
+	return resp, objects, nil
 }
 
 // ==================== 密钥分发方法 ====================
@@ -477,17 +673,15 @@ func (c *Coordinator) DistributeKeysToParticipants() error {
 	}
 	fmt.Println("所有密钥测试通过，开始分发...")
 
-	// 构造密钥数据
-	keysData := map[string]interface{}{
-		"params":      c.ParameterManager.GetParamsLiteral(),
-		"pub_key":     c.KeyManager.GetGlobalPK(),
-		"reline_key":  c.KeyManager.GetRelinearizationKey(),
-		"galois_keys": c.KeyManager.GetGaloisKeys(),
+	// 构造密钥数据，格式与 /keys/aggregated 的响应相同
+	keysData, objects, err := encodeKeysResponse(c.KeyManager)
+	if err != nil {
+		return err
 	}
 
 	// 向所有在线参与方分发密钥
 	for _, participant := range onlineParticipants {
-		if err := c.postJSON(participant.URL+"/keys/receive", keysData); err != nil {
+		if err := c.postMessage(participant.URL+"/keys/receive", keysData, objects...); err != nil {
 			fmt.Printf("向参与方 %d 分发密钥失败: %v\n", participant.ID, err)
 		} else {
 			fmt.Printf("向参与方 %d 分发密钥成功\n", participant.ID)
@@ -497,14 +691,9 @@ func (c *Coordinator) DistributeKeysToParticipants() error {
 	return nil
 }
 
-// postJSON 发送JSON请求
-func (c *Coordinator) postJSON(url string, data interface{}) error {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return err
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// postMessage 发送帧格式消息
+func (c *Coordinator) postMessage(url string, control interface{}, objects ...[]byte) error {
+	resp, err := c.signedPostMessage(url, control, objects...)
 	if err != nil {
 		return err
 	}
@@ -521,13 +710,66 @@ func (c *Coordinator) postJSON(url string, data interface{}) error {
 
 type InitRequest struct {
 	NumParticipants int    `json:"num_participants"`
+	Threshold       int    `json:"threshold"`       // t-out-of-N门限，省略时为num_participants
 	DataSplitType   string `json:"data_split_type"` // "horizontal" or "vertical"
+	// InsecureDebug 允许参与方上传私钥、协调器聚合skAgg，仅用于测试
+	InsecureDebug bool `json:"insecure_debug"`
+	// CRSContribution 要求全部参与方通过commit-reveal共同贡献CRS种子
+	CRSContribution bool `json:"crs_contribution"`
+	// ParamProfile 参数配置档名称，省略时使用配置文件中的default_profile
+	ParamProfile string `json:"param_profile"`
+	// Galois 覆盖配置档中的伽罗瓦密钥配置（旋转步长、网络层大小等）
+	Galois *parameters.GaloisConfig `json:"galois"`
+	// DecryptApprovals 解密任务需要的参与方批准数，省略时为协同解密所需的参与方数量
+	DecryptApprovals int `json:"decrypt_approvals"`
+	// RotateAfterDecryptions 每批准多少个解密任务后轮换集体密钥，省略时只手动轮换
+	RotateAfterDecryptions int `json:"rotate_after_decryptions"`
+	// PhaseTimeouts 按阶段名称覆盖默认的阶段超时（秒），0表示不限时
+	PhaseTimeouts map[string]int `json:"phase_timeouts"`
 }
 
 var (
-	globalCoordinator *Coordinator
+	// paramProfilesPath 参数配置文件路径，可由main通过命令行参数修改
+	paramProfilesPath = "configs/ckks_profiles.json"
+
+	// tlsConfig 协调器与参与方之间的mTLS配置，可由main通过命令行参数设置
+	tlsConfig *pki.Config
+
+	// stateDir 协调器关闭时保存会话状态的目录，可由main通过命令行参数修改
+	stateDir = "state"
+
+	// stateStore 会话状态存储，各会话共用，为空时重启后无法恢复会话
+	stateStore store.Store
+
+	// wireEncoding 发往参与方的帧格式消息的压缩编码，可由main通过命令行参数设置
+	wireEncoding = wire.Identity
 )
 
+// SetParamProfilesPath 设置参数配置文件路径
+func SetParamProfilesPath(path string) {
+	paramProfilesPath = path
+}
+
+// SetTLSConfig 设置协调器与参与方之间的mTLS配置，nil 表示使用明文HTTP
+func SetTLSConfig(cfg *pki.Config) {
+	tlsConfig = cfg
+}
+
+// SetStateDir 设置会话状态目录，为空时关闭时不保存状态
+func SetStateDir(dir string) {
+	stateDir = dir
+}
+
+// SetWireEncoding 设置发往参与方的帧格式消息的压缩编码
+func SetWireEncoding(enc wire.Encoding) {
+	wireEncoding = enc
+}
+
+// SetStateStore 设置会话状态存储，各会话的状态写入其中 sessions/{协调器ID}/ 前缀下
+func SetStateStore(s store.Store) {
+	stateStore = s
+}
+
 // InitHandler 初始化协调器
 func InitHandler(ctx *gin.Context) {
 	var req InitRequest
@@ -535,60 +777,122 @@ func InitHandler(ctx *gin.Context) {
 		ctx.JSON(400, gin.H{"error": "invalid num_participants"})
 		return
 	}
+	if req.Threshold < 0 || req.Threshold > req.NumParticipants {
+		ctx.JSON(400, gin.H{"error": "invalid threshold, must be in 1..num_participants (0 or omitted defaults to num_participants)"})
+		return
+	}
+	if req.DecryptApprovals < 0 || req.DecryptApprovals > req.NumParticipants {
+		ctx.JSON(400, gin.H{"error": "invalid decrypt_approvals, must be in 1..num_participants (0 or omitted defaults to the participants required for decryption)"})
+		return
+	}
+	if req.RotateAfterDecryptions < 0 {
+		ctx.JSON(400, gin.H{"error": "invalid rotate_after_decryptions, must not be negative"})
+		return
+	}
+	phaseTimeouts, err := phases.ParseTimeouts(req.PhaseTimeouts)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "invalid phase_timeouts: " + err.Error()})
+		return
+	}
 	dataSplitType := req.DataSplitType
 	if v, ok := ctx.Get("data_split_type"); ok {
 		if s, ok2 := v.(string); ok2 && s != "" {
 			dataSplitType = s
 		}
 	}
-	coordinator, err := NewCoordinator(req.NumParticipants, dataSplitType)
+	profile, err := parameters.LoadProfile(paramProfilesPath, req.ParamProfile)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		ctx.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	globalCoordinator = coordinator
-	go globalCoordinator.Start() // 启动后台服务
+	if req.Galois != nil {
+		profile.Galois = *req.Galois
+	}
 
+	// 每次初始化创建新会话，与已有会话并存
 	coordinatorID := uuid.New().String()
+	sessionState, err := sessionStore(coordinatorID)
+	if err != nil {
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	coordinator, err := NewCoordinator(Config{
+		ExpectedN:        req.NumParticipants,
+		Threshold:        req.Threshold,
+		DataSplitType:    dataSplitType,
+		InsecureDebug:    req.InsecureDebug,
+		CRSContribution:  req.CRSContribution,
+		Profile:          profile,
+		TLS:              tlsConfig,
+		Encoding:         wireEncoding,
+		StateDir:         stateDir,
+		Store:            sessionState,
+		DecryptApprovals: req.DecryptApprovals,
+
+		RotateAfterDecryptions: req.RotateAfterDecryptions,
+		PhaseTimeouts:          phaseTimeouts,
+		ID:                     coordinatorID,
+		Server:                 getSessionServer(),
+	})
+	if err != nil {
+		if sessionState != nil {
+			sessionState.Reset()
+		}
+		ctx.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	addSession(coordinator)
+
 	startTime := time.Now().Format(time.RFC3339)
-	ip := globalCoordinator.GetLocalIP()
-	port := 8080 // 默认端口
+	ip := coordinator.GetLocalIP()
 	resp := CoordinatorStartResponse{
 		Success:              true,
 		Message:              "Coordinator initialized successfully",
 		CoordinatorID:        coordinatorID,
+		SessionID:            coordinator.GetSessionID(),
+		SessionURL:           coordinator.GetSessionURL(),
+		ParamProfile:         coordinator.ParameterManager.GetProfileName(),
+		SecurityBits:         coordinator.ParameterManager.GetSecurityBits(),
 		ExpectedParticipants: req.NumParticipants,
+		Threshold:            coordinator.GetThreshold(),
+		InsecureDebug:        req.InsecureDebug,
 		DataSplitType:        dataSplitType,
 		Status:               "running",
 		CoordinatorIP:        ip,
-		CoordinatorPort:      port,
+		CoordinatorPort:      sessionServerPort,
 		StartTime:            startTime,
 	}
 	ctx.JSON(200, resp)
 }
 
-// RequireCoordinator Gin 中间件，校验 globalCoordinator 是否已初始化
-func RequireCoordinator() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		if globalCoordinator == nil {
-			ctx.JSON(400, gin.H{"error": "Coordinator not initialized"})
-			ctx.Abort()
-			return
-		}
-		ctx.Next()
+// ListParamProfilesHandler 列出配置文件中可用的参数配置档
+func ListParamProfilesHandler(ctx *gin.Context) {
+	file, err := parameters.LoadProfileFile(paramProfilesPath)
+	if err != nil {
+		ctx.JSON(200, gin.H{
+			"default_profile": parameters.DefaultProfile().Name,
+			"profiles":        gin.H{parameters.DefaultProfile().Name: parameters.DefaultProfile()},
+			"warning":         err.Error(),
+		})
+		return
 	}
+	ctx.JSON(200, gin.H{
+		"default_profile": file.DefaultProfile,
+		"profiles":        file.Profiles,
+	})
 }
 
 func PostPublicKeyHandler(ctx *gin.Context) {
-	globalCoordinator.postPublicKeyHandler(ctx)
+	coordinatorOf(ctx).postPublicKeyHandler(ctx)
 }
 
 func PostSecretKeyHandler(ctx *gin.Context) {
-	globalCoordinator.postSecretKeyHandler(ctx)
+	coordinatorOf(ctx).postSecretKeyHandler(ctx)
 }
 
 func GetSetupStatusHandler(ctx *gin.Context) {
-	globalCoordinator.getSetupStatusHandler(ctx)
+	coordinatorOf(ctx).getSetupStatusHandler(ctx)
 }
 
 func (c *Coordinator) getCoordinatorStatusHandler(ctx *gin.Context) {
@@ -622,36 +926,39 @@ func (c *Coordinator) getCoordinatorStatusHandler(ctx *gin.Context) {
 			URL:           url,
 			Status:        status,
 			LastHeartbeat: lastHeartbeatStr,
+			Member:        pm.IsMember(p.ID),
 		})
 	}
 
+	keyVerification, _ := c.GetKeyVerificationStatus()
 	resp := CoordinatorStatusResponse{
-		ExpectedParticipants:   c.ParticipantManager.GetMinParticipants(),
+		CoordinatorID:          c.id,
+		SessionURL:             c.GetSessionURL(),
+		ExpectedParticipants:   c.ParticipantManager.GetExpectedN(),
+		Threshold:              c.ParticipantManager.GetThreshold(),
+		InsecureDebug:          c.insecureDebug,
+		SessionID:              c.GetSessionID(),
+		CRSPhase:               c.ParameterManager.GetCRSPhase(),
+		Phase:                  string(c.phases.Current()),
+		KeyVerification:        keyVerification,
 		RegisteredParticipants: len(participants),
 		OnlineParticipants:     onlineCount,
 		DataSplitType:          c.ParameterManager.GetDataSplitType(),
 		Status:                 "running",
 		Participants:           result,
+		Membership:             c.GetMembershipStatus(),
 	}
 	ctx.JSON(200, resp)
 }
 
 // 全局 handler，便于 main.go 注册
 func GetCoordinatorStatusHandler(ctx *gin.Context) {
-	if globalCoordinator == nil {
-		ctx.JSON(400, gin.H{"error": "Coordinator not initialized"})
-		return
-	}
-	globalCoordinator.getCoordinatorStatusHandler(ctx)
+	coordinatorOf(ctx).getCoordinatorStatusHandler(ctx)
 }
 
 // GetKeyProgressHandler 获取密钥进度处理器
 func GetKeyProgressHandler(ctx *gin.Context) {
-	if globalCoordinator == nil {
-		ctx.JSON(400, gin.H{"error": "Coordinator not initialized"})
-		return
-	}
-	c := globalCoordinator
+	c := coordinatorOf(ctx)
 	status := c.GetStatus()
 
 	progress := KeyProgress{}
@@ -660,11 +967,15 @@ func GetKeyProgressHandler(ctx *gin.Context) {
 	progress.PublicKey.TotalExpected = status["total"].(int)
 	progress.PublicKey.Ready = status["global_pk_ready"].(bool)
 	progress.PublicKey.Status = statusText(progress.PublicKey.Ready, progress.PublicKey.ReceivedShares, progress.PublicKey.TotalExpected)
-	// 私钥
+	// 私钥：仅insecure_debug模式下收集，生产模式显示为disabled且不计入进度
+	progress.InsecureDebug = c.insecureDebug
 	progress.SecretKey.ReceivedShares = status["received_secrets"].(int)
 	progress.SecretKey.TotalExpected = status["total"].(int)
 	progress.SecretKey.Ready = status["sk_agg_ready"].(bool)
 	progress.SecretKey.Status = statusText(progress.SecretKey.Ready, progress.SecretKey.ReceivedShares, progress.SecretKey.TotalExpected)
+	if !c.insecureDebug {
+		progress.SecretKey.Status = "disabled"
+	}
 	// 伽罗瓦密钥
 	progress.GaloisKeys.CompletedKeys = status["completed_galois_keys"].(int)
 	progress.GaloisKeys.TotalKeys = status["total_galois_keys"].(int)
@@ -675,13 +986,17 @@ func GetKeyProgressHandler(ctx *gin.Context) {
 	progress.RelinearizationKey.Round2Ready = status["rlk_round2_ready"].(bool)
 	progress.RelinearizationKey.Ready = status["rlk_ready"].(bool)
 	progress.RelinearizationKey.Status = rlkStatusText(progress.RelinearizationKey.Round1Ready, progress.RelinearizationKey.Round2Ready, progress.RelinearizationKey.Ready)
+	progress.KeyVerification = status["key_verification"].(string)
 	// 总进度和全部就绪
-	readyCount := 0
+	readyCount, totalCount := 0, 3
 	if progress.PublicKey.Ready {
 		readyCount++
 	}
-	if progress.SecretKey.Ready {
-		readyCount++
+	if c.insecureDebug {
+		totalCount++
+		if progress.SecretKey.Ready {
+			readyCount++
+		}
 	}
 	if progress.GaloisKeys.Ready {
 		readyCount++
@@ -689,8 +1004,8 @@ func GetKeyProgressHandler(ctx *gin.Context) {
 	if progress.RelinearizationKey.Ready {
 		readyCount++
 	}
-	progress.OverallProgress = readyCount * 25
-	progress.AllKeysReady = readyCount == 4
+	progress.OverallProgress = readyCount * 100 / totalCount
+	progress.AllKeysReady = readyCount == totalCount
 
 	ctx.JSON(200, progress)
 }
@@ -0,0 +1,819 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/keys"
+	"MPHEDev/pkg/core/coordinator/parameters"
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/coordinator/tasks"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 集体密钥轮换 ====================
+//
+// 安全策略要求每批准一定数量的解密任务后轮换集体密钥（Config.RotateAfterDecryptions），
+// 也可以通过控制面手动发起。初始密钥为第0纪元，每次轮换进入下一纪元，分为三个阶段：
+//   1. keygen：全部N个参与方生成新的私钥份额，按与初始密钥相同的流程上传新纪元的公钥、
+//      伽罗瓦密钥和重线性化密钥份额（/keys/rotation/shares），协调器聚合到单独的密钥管理器；
+//      门限模式下参与方同时交换新私钥的Shamir份额
+//   2. switch：新密钥全部聚合后，每个参与方通过多方协同密钥切换把自己保存的密文从旧集体私钥
+//      切换到新集体私钥，完成后报告 switched；这一阶段参与方同时持有新旧两份私钥份额
+//   3. commit：全部参与方完成切换后，协调器用新密钥替换旧密钥并进入新纪元，参与方清零
+//      旧私钥份额和门限份额、保存密钥库后报告 committed，全部提交后重新验证密钥
+// 轮换期间以及达到解密次数上限后不接受新的解密任务。任一参与方报告失败或超时时轮换中止，
+// 参与方丢弃新纪元的密钥材料，重新发起时换用新的尝试次数和CRP。新纪元的份额只保存在内存中，
+// 协调器在提交前重启时轮换中止，需要重新发起。
+// 加入新成员的轮换由控制面发起（见 coordinator_members.go），新成员与现有成员一起完成三个阶段，
+// 提交时成员纪元加1。
+
+// 密钥轮换阶段
+const (
+	keyRotationIdle    = "idle"
+	keyRotationKeygen  = "keygen"
+	keyRotationSwitch  = "switch"
+	keyRotationCommit  = "commit"
+	keyRotationDone    = "done"
+	keyRotationAborted = "aborted"
+)
+
+// 参与方报告的轮换进度
+const (
+	keyRotationStageSwitched  = "switched"
+	keyRotationStageCommitted = "committed"
+	keyRotationStageFailed    = "failed"
+)
+
+// keyRotationTimeout 一次轮换从发起到全部参与方完成切换的最长时间
+const keyRotationTimeout = 30 * time.Minute
+
+// keyRotationStoreKey 解密计数在状态存储中的键，当前纪元保存在会话参数中
+const keyRotationStoreKey = "key_rotation"
+
+// keyRotationRecord 持久化的轮换策略状态
+type keyRotationRecord struct {
+	DecryptionsSinceRotation int
+}
+
+// KeyRotationNotice 通知参与方开始密钥轮换的消息
+type KeyRotationNotice struct {
+	SessionID     string   `json:"session_id"`
+	Epoch         int      `json:"epoch"`
+	Attempt       int      `json:"attempt"`
+	GalEls        []uint64 `json:"gal_els"`
+	InsecureDebug bool     `json:"insecure_debug,omitempty"`
+
+	// KeyFingerprint 当前纪元集体公钥的指纹（十六进制），加入的新成员据此校验切换请求中的密文
+	KeyFingerprint string `json:"key_fingerprint"`
+
+	// 新纪元的成员（包括加入的参与方）及提交后的成员纪元
+	Members         []int `json:"members"`
+	Joining         []int `json:"joining,omitempty"`
+	MembershipEpoch int   `json:"membership_epoch"`
+}
+
+// KeyRotationShare 参与方上传新纪元密钥份额的控制帧，份额的二进制编码为其后唯一的对象帧
+type KeyRotationShare struct {
+	ParticipantID int    `json:"participant_id"`
+	Epoch         int    `json:"epoch"`
+	Attempt       int    `json:"attempt"`
+	Kind          string `json:"kind"` // public/secret/galois/relin
+	GalEl         uint64 `json:"gal_el,omitempty"`
+	Round         int    `json:"round,omitempty"`
+}
+
+// KeyRotationReport 参与方报告的轮换进度
+type KeyRotationReport struct {
+	ParticipantID int    `json:"participant_id"`
+	Epoch         int    `json:"epoch"`
+	Attempt       int    `json:"attempt"`
+	Stage         string `json:"stage"` // switched/committed/failed
+	Error         string `json:"error,omitempty"`
+}
+
+// StartKeyRotationRequest 控制面发起密钥轮换的请求
+type StartKeyRotationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// KeyRotationStatus 密钥轮换状态
+type KeyRotationStatus struct {
+	Epoch           int    `json:"epoch"` // 当前密钥纪元
+	TargetEpoch     int    `json:"target_epoch,omitempty"`
+	Attempt         int    `json:"attempt,omitempty"`
+	Phase           string `json:"phase"`
+	Reason          string `json:"reason,omitempty"`
+	StartedAt       string `json:"started_at,omitempty"`
+	PublicKeyReady  bool   `json:"public_key_ready"`
+	RlkRound1Ready  bool   `json:"rlk_round1_ready"`
+	RlkReady        bool   `json:"rlk_ready"`
+	GaloisKeysReady int    `json:"galois_keys_ready"`
+	TotalGaloisKeys int    `json:"total_galois_keys"`
+	Switched        []int  `json:"switched"`
+	Committed       []int  `json:"committed"`
+	Error           string `json:"error,omitempty"`
+
+	// 成员：当前成员纪元，以及轮换的新纪元成员和其中加入的参与方
+	MembershipEpoch int   `json:"membership_epoch"`
+	Members         []int `json:"members,omitempty"`
+	Joining         []int `json:"joining,omitempty"`
+
+	// 轮换策略
+	DecryptionsSinceRotation int  `json:"decryptions_since_rotation"`
+	RotateAfterDecryptions   int  `json:"rotate_after_decryptions"`
+	RotationDue              bool `json:"rotation_due"`
+}
+
+// keyRotation 一次密钥轮换
+type keyRotation struct {
+	epoch      int
+	attempt    int
+	phase      string
+	reason     string
+	startedAt  time.Time
+	commitAt   time.Time // 进入提交阶段的时间
+	crps       parameters.EpochCRPs
+	keys       *keys.Manager // 新纪元的份额和聚合结果，只保存在内存中
+	aggregator *keys.Aggregator
+	switched   map[int]bool
+	committed  map[int]bool
+	err        string
+
+	// 新纪元的成员，加入新成员时包括 joining，提交后进入 membershipEpoch
+	members         []int
+	joining         []int
+	membershipEpoch int
+}
+
+// isMember 参与方是否为新纪元的成员
+func (kr *keyRotation) isMember(participantID int) bool {
+	for _, id := range kr.members {
+		if id == participantID {
+			return true
+		}
+	}
+	return false
+}
+
+// active 轮换是否仍在进行
+func (kr *keyRotation) active() bool {
+	return kr.phase == keyRotationKeygen || kr.phase == keyRotationSwitch || kr.phase == keyRotationCommit
+}
+
+// keysReady 新纪元的密钥是否已全部聚合
+func (kr *keyRotation) keysReady(insecureDebug bool) bool {
+	ready := kr.keys.GetGlobalPK() != nil && kr.keys.GetRelinearizationKey() != nil &&
+		len(kr.keys.GetGaloisKeys()) == len(kr.crps.Galois)
+	if insecureDebug {
+		ready = ready && kr.keys.GetAggregatedSecretKey() != nil
+	}
+	return ready
+}
+
+// StartKeyRotation 发起密钥轮换并通知全部成员
+// 上一次轮换尚在生成密钥或切换密文时将其中止，以新的尝试次数重新发起；已进入提交阶段时拒绝
+func (c *Coordinator) StartKeyRotation(reason string) (*KeyRotationStatus, error) {
+	return c.startKeyRotation(reason, nil)
+}
+
+// startKeyRotation 发起密钥轮换，joining 为同时加入集体密钥的候选成员
+func (c *Coordinator) startKeyRotation(reason string, joining []int) (*KeyRotationStatus, error) {
+	c.keyRotationMu.Lock()
+	c.expireKeyRotationLocked()
+	if kr := c.keyRotation; kr != nil && kr.phase == keyRotationCommit {
+		c.keyRotationMu.Unlock()
+		return nil, fmt.Errorf("第 %d 纪元正在提交，不能重新发起轮换", kr.epoch)
+	}
+	if c.KeyManager.GetGlobalPK() == nil || c.KeyManager.GetRelinearizationKey() == nil || len(c.pendingGaloisElements()) > 0 {
+		c.keyRotationMu.Unlock()
+		return nil, fmt.Errorf("当前纪元的密钥尚未全部生成完成")
+	}
+
+	// 新纪元的成员为当前成员加上加入的参与方，全部需要在线
+	members := c.ParticipantManager.GetMembers()
+	if len(members) == 0 {
+		c.keyRotationMu.Unlock()
+		return nil, fmt.Errorf("尚未确定会话成员")
+	}
+	online := c.onlineMemberURLs()
+	if len(online) < len(members) {
+		c.keyRotationMu.Unlock()
+		return nil, fmt.Errorf("密钥轮换需要全部 %d 个成员在线，当前 %d 个", len(members), len(online))
+	}
+	membershipEpoch := c.ParticipantManager.GetMembershipEpoch()
+	if len(joining) > 0 {
+		for _, peer := range c.ParticipantManager.GetOnlineParticipants() {
+			if peer.URL != "" {
+				online[peer.ID] = peer.URL
+			}
+		}
+		for _, id := range joining {
+			if _, ok := online[id]; !ok {
+				c.keyRotationMu.Unlock()
+				return nil, fmt.Errorf("加入的参与方 %d 不在线", id)
+			}
+		}
+		members = append(members, joining...)
+		sort.Ints(members)
+		membershipEpoch++
+	}
+
+	epoch := c.ParameterManager.GetKeyEpoch() + 1
+	attempt := 1
+	if prev := c.keyRotation; prev != nil && prev.epoch == epoch {
+		attempt = prev.attempt + 1
+		if prev.active() {
+			c.abortKeyRotationLocked("重新发起轮换")
+		}
+	}
+	crps, err := c.ParameterManager.SampleEpochCRPs(epoch, attempt)
+	if err != nil {
+		c.keyRotationMu.Unlock()
+		return nil, fmt.Errorf("生成第 %d 纪元的CRP失败: %v", epoch, err)
+	}
+	next := keys.NewManager(c.ParameterManager.GetCKKSParams(), len(members))
+	kr := &keyRotation{
+		epoch:      epoch,
+		attempt:    attempt,
+		phase:      keyRotationKeygen,
+		reason:     reason,
+		startedAt:  time.Now(),
+		crps:       crps,
+		keys:       next,
+		aggregator: keys.NewAggregator(next),
+		switched:   make(map[int]bool),
+		committed:  make(map[int]bool),
+
+		members:         members,
+		joining:         joining,
+		membershipEpoch: membershipEpoch,
+	}
+	c.keyRotation = kr
+	c.keyRotationMu.Unlock()
+	fmt.Printf("\n[密钥轮换] 发起第 %d 纪元（第 %d 次尝试），原因: %s\n", epoch, attempt, reason)
+	if len(joining) > 0 {
+		fmt.Printf("[密钥轮换] 参与方 %v 加入，提交后进入成员纪元 %d，成员 %v\n", joining, membershipEpoch, members)
+	}
+
+	galEls := make([]uint64, 0, len(crps.Galois))
+	for galEl := range crps.Galois {
+		galEls = append(galEls, galEl)
+	}
+	sort.Slice(galEls, func(i, j int) bool { return galEls[i] < galEls[j] })
+	body, err := json.Marshal(KeyRotationNotice{
+		SessionID:     c.GetSessionID(),
+		Epoch:         epoch,
+		Attempt:       attempt,
+		GalEls:        galEls,
+		InsecureDebug: c.insecureDebug,
+
+		KeyFingerprint: c.KeyManager.GlobalPKFingerprint().Hex(),
+
+		Members:         members,
+		Joining:         joining,
+		MembershipEpoch: membershipEpoch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化通知失败: %v", err)
+	}
+
+	// 轮换需要全部成员，任何一个通知失败都中止本次尝试
+	for _, id := range members {
+		if err := c.notifyKeyRotation(online[id], body); err != nil {
+			msg := fmt.Sprintf("通知参与方 %d 失败: %v", id, err)
+			c.keyRotationMu.Lock()
+			if c.keyRotation == kr && kr.active() {
+				c.abortKeyRotationLocked(msg)
+			}
+			c.keyRotationMu.Unlock()
+			return nil, fmt.Errorf("密钥轮换已中止，%s", msg)
+		}
+	}
+	fmt.Printf("[密钥轮换] 已通知 %d 个参与方生成第 %d 纪元的密钥份额\n", len(members), epoch)
+	return c.GetKeyRotationStatus(), nil
+}
+
+// notifyKeyRotation 通知单个参与方，参与方接受后在后台完成轮换
+func (c *Coordinator) notifyKeyRotation(peerURL string, body []byte) error {
+	resp, err := c.signedPost(peerURL+"/keys/rotation", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// abortKeyRotationLocked 中止进行中的轮换，调用方需持有 keyRotationMu
+func (c *Coordinator) abortKeyRotationLocked(reason string) {
+	kr := c.keyRotation
+	kr.phase = keyRotationAborted
+	kr.err = reason
+	kr.keys = nil
+	kr.aggregator = nil
+	fmt.Printf("[密钥轮换] 第 %d 纪元（第 %d 次尝试）已中止: %s\n", kr.epoch, kr.attempt, reason)
+}
+
+// expireKeyRotationLocked 处理超时的轮换，调用方需持有 keyRotationMu
+// 生成密钥或切换密文超时时中止；提交阶段协调器已经使用新密钥，超时后结束轮换并记录未提交的参与方，
+// 这些参与方需要重新加入会话
+func (c *Coordinator) expireKeyRotationLocked() {
+	kr := c.keyRotation
+	if kr == nil {
+		return
+	}
+	switch kr.phase {
+	case keyRotationKeygen, keyRotationSwitch:
+		if time.Since(kr.startedAt) > keyRotationTimeout {
+			c.abortKeyRotationLocked(fmt.Sprintf("超过 %v 仍未完成", keyRotationTimeout))
+		}
+	case keyRotationCommit:
+		if time.Since(kr.commitAt) > keyRotationTimeout {
+			var missing []int
+			for _, id := range kr.members {
+				if !kr.committed[id] {
+					missing = append(missing, id)
+				}
+			}
+			kr.phase = keyRotationDone
+			kr.err = fmt.Sprintf("参与方 %v 超过 %v 仍未提交新纪元", missing, keyRotationTimeout)
+			fmt.Printf("[密钥轮换] %s\n", kr.err)
+		}
+	}
+}
+
+// currentKeyRotationLocked 返回与参与方请求匹配的进行中轮换，调用方需持有 keyRotationMu
+func (c *Coordinator) currentKeyRotationLocked(epoch, attempt int) (*keyRotation, error) {
+	c.expireKeyRotationLocked()
+	kr := c.keyRotation
+	if kr == nil || kr.epoch != epoch || kr.attempt != attempt {
+		return nil, fmt.Errorf("第 %d 纪元第 %d 次尝试不是当前的密钥轮换", epoch, attempt)
+	}
+	if kr.phase == keyRotationAborted {
+		return nil, fmt.Errorf("密钥轮换已中止: %s", kr.err)
+	}
+	return kr, nil
+}
+
+// AddKeyRotationShare 添加新纪元的密钥份额，某类份额收齐全部成员的份额后自动聚合
+func (c *Coordinator) AddKeyRotationShare(participantID int, req KeyRotationShare, data []byte) error {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+
+	kr, err := c.currentKeyRotationLocked(req.Epoch, req.Attempt)
+	if err != nil {
+		return err
+	}
+	if !kr.isMember(participantID) {
+		return fmt.Errorf("参与方 %d 不是第 %d 纪元的成员", participantID, kr.epoch)
+	}
+	n := len(kr.members)
+	if kr.phase != keyRotationKeygen {
+		// 参与方重试上传时份额可能已经聚合
+		return nil
+	}
+
+	next, agg := kr.keys, kr.aggregator
+	switch req.Kind {
+	case "public":
+		if next.GetGlobalPK() != nil {
+			return nil
+		}
+		if err := next.AddPublicKeyShare(participantID, data); err != nil {
+			return err
+		}
+		if len(next.GetPublicKeyShares()) == n {
+			if err := agg.AggregatePublicKey(kr.crps.PublicKey); err != nil {
+				return fmt.Errorf("新纪元公钥聚合失败: %v", err)
+			}
+		}
+	case "secret":
+		if !c.insecureDebug {
+			return ErrSecretKeyUploadDisabled
+		}
+		if next.GetAggregatedSecretKey() != nil {
+			return nil
+		}
+		if err := next.AddSecretKey(participantID, data); err != nil {
+			return err
+		}
+		if len(next.GetSecretKeyShares()) == n {
+			if err := agg.AggregateSecretKey(); err != nil {
+				return fmt.Errorf("新纪元私钥聚合失败: %v", err)
+			}
+		}
+	case "galois":
+		crp, ok := kr.crps.Galois[req.GalEl]
+		if !ok {
+			return fmt.Errorf("伽罗瓦元素 %d 不在本会话的密钥列表中", req.GalEl)
+		}
+		if next.HasGaloisKey(req.GalEl) {
+			return nil
+		}
+		if err := next.AddGaloisKeyShare(participantID, req.GalEl, data); err != nil {
+			return err
+		}
+		if len(next.GetGaloisKeyShares()[req.GalEl]) == n {
+			if err := agg.AggregateGaloisKey(req.GalEl, crp); err != nil {
+				return fmt.Errorf("新纪元伽罗瓦密钥聚合失败 (galEl: %d): %v", req.GalEl, err)
+			}
+		}
+	case "relin":
+		switch req.Round {
+		case 1:
+			if next.GetRelinearizationShare1Aggregated() != nil {
+				return nil
+			}
+			if err := next.AddRelinearizationKeyShare(participantID, 1, data); err != nil {
+				return err
+			}
+			if len(next.GetRelinearizationShare1Map()) == n {
+				if err := agg.AggregateRelinearizationKeyRound1(); err != nil {
+					return fmt.Errorf("新纪元重线性化密钥第一轮聚合失败: %v", err)
+				}
+			}
+		case 2:
+			if next.GetRelinearizationShare1Aggregated() == nil {
+				return fmt.Errorf("新纪元重线性化密钥第一轮尚未聚合")
+			}
+			if next.GetRelinearizationKey() != nil {
+				return nil
+			}
+			if err := next.AddRelinearizationKeyShare(participantID, 2, data); err != nil {
+				return err
+			}
+			if len(next.GetRelinearizationShare2Map()) == n {
+				if err := agg.AggregateRelinearizationKeyRound2(); err != nil {
+					return fmt.Errorf("新纪元重线性化密钥第二轮聚合失败: %v", err)
+				}
+			}
+		default:
+			return fmt.Errorf("无效的轮次: %d", req.Round)
+		}
+	default:
+		return fmt.Errorf("未知的份额类型: %s", req.Kind)
+	}
+
+	if kr.keysReady(c.insecureDebug) {
+		kr.phase = keyRotationSwitch
+		fmt.Printf("[密钥轮换] 第 %d 纪元的密钥已全部聚合，参与方开始切换密文\n", kr.epoch)
+	}
+	return nil
+}
+
+// ReportKeyRotation 记录参与方的轮换进度
+// 全部成员完成切换后提交新纪元，全部成员提交后重新验证密钥
+func (c *Coordinator) ReportKeyRotation(participantID int, req KeyRotationReport) error {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+
+	kr, err := c.currentKeyRotationLocked(req.Epoch, req.Attempt)
+	if err != nil {
+		return err
+	}
+	if !kr.isMember(participantID) {
+		return fmt.Errorf("参与方 %d 不是第 %d 纪元的成员", participantID, kr.epoch)
+	}
+
+	switch req.Stage {
+	case keyRotationStageFailed:
+		if kr.phase == keyRotationCommit || kr.phase == keyRotationDone {
+			return fmt.Errorf("第 %d 纪元已提交，不能中止", kr.epoch)
+		}
+		c.abortKeyRotationLocked(fmt.Sprintf("参与方 %d 失败: %s", participantID, req.Error))
+		return nil
+	case keyRotationStageSwitched:
+		if kr.phase != keyRotationSwitch {
+			if kr.switched[participantID] {
+				return nil
+			}
+			return fmt.Errorf("密钥轮换处于 %s 阶段，不能报告完成切换", kr.phase)
+		}
+		kr.switched[participantID] = true
+		fmt.Printf("[密钥轮换] 参与方 %d 已完成密文切换 (%d/%d)\n", participantID, len(kr.switched), len(kr.members))
+		if len(kr.switched) == len(kr.members) {
+			return c.commitKeyRotationLocked()
+		}
+		return nil
+	case keyRotationStageCommitted:
+		if kr.phase != keyRotationCommit && kr.phase != keyRotationDone {
+			return fmt.Errorf("密钥轮换处于 %s 阶段，不能报告已提交", kr.phase)
+		}
+		kr.committed[participantID] = true
+		if kr.phase == keyRotationCommit && len(kr.committed) == len(kr.members) {
+			kr.phase = keyRotationDone
+			fmt.Printf("[密钥轮换] 第 %d 纪元已完成，全部参与方已清除旧私钥份额，开始验证新密钥\n", kr.epoch)
+			c.verifyMu.Lock()
+			c.verifyStatus = verifyStatusPending
+			c.verifyError = ""
+			c.verifyMu.Unlock()
+			c.startKeyVerification()
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的轮换进度: %s", req.Stage)
+	}
+}
+
+// commitKeyRotationLocked 用新纪元的密钥替换当前密钥并切换CRP，调用方需持有 keyRotationMu
+func (c *Coordinator) commitKeyRotationLocked() error {
+	kr := c.keyRotation
+	if err := c.KeyManager.Replace(kr.keys); err != nil {
+		c.abortKeyRotationLocked(fmt.Sprintf("替换密钥失败: %v", err))
+		return err
+	}
+	if err := c.ParameterManager.CommitKeyEpoch(kr.epoch, kr.attempt, kr.crps); err != nil {
+		kr.err = fmt.Sprintf("密钥已替换但保存纪元失败: %v", err)
+		fmt.Printf("[密钥轮换] %s\n", kr.err)
+		return err
+	}
+	if len(kr.joining) > 0 {
+		if err := c.ParticipantManager.SetMembers(kr.members, kr.membershipEpoch); err != nil {
+			kr.err = fmt.Sprintf("密钥已替换但保存成员失败: %v", err)
+			fmt.Printf("[密钥轮换] %s\n", kr.err)
+		}
+		c.applyMemberCount(len(kr.members))
+	}
+	c.decryptionsSinceRotation = 0
+	if err := c.persistKeyRotationLocked(); err != nil {
+		fmt.Printf("[警告] %v\n", err)
+	}
+	kr.phase = keyRotationCommit
+	kr.commitAt = time.Now()
+	kr.keys = nil
+	kr.aggregator = nil
+	fmt.Printf("[密钥轮换] 全部参与方已完成密文切换，协调器已进入第 %d 纪元\n", kr.epoch)
+	return nil
+}
+
+// GetKeyRotationStatus 获取密钥轮换状态
+func (c *Coordinator) GetKeyRotationStatus() *KeyRotationStatus {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+	c.expireKeyRotationLocked()
+
+	status := &KeyRotationStatus{
+		Epoch:                    c.ParameterManager.GetKeyEpoch(),
+		Phase:                    keyRotationIdle,
+		Switched:                 []int{},
+		Committed:                []int{},
+		DecryptionsSinceRotation: c.decryptionsSinceRotation,
+		RotateAfterDecryptions:   c.rotateAfterDecryptions,
+		RotationDue:              c.rotationDueLocked(),
+		MembershipEpoch:          c.ParticipantManager.GetMembershipEpoch(),
+	}
+	kr := c.keyRotation
+	if kr == nil {
+		return status
+	}
+	status.Members = kr.members
+	status.Joining = kr.joining
+	status.TargetEpoch = kr.epoch
+	status.Attempt = kr.attempt
+	status.Phase = kr.phase
+	status.Reason = kr.reason
+	status.StartedAt = kr.startedAt.Format(time.RFC3339)
+	status.TotalGaloisKeys = len(kr.crps.Galois)
+	status.Error = kr.err
+	status.Switched = sortedIDs(kr.switched)
+	status.Committed = sortedIDs(kr.committed)
+	switch {
+	case kr.keys != nil:
+		status.PublicKeyReady = kr.keys.GetGlobalPK() != nil
+		status.RlkRound1Ready = kr.keys.GetRelinearizationShare1Aggregated() != nil
+		status.RlkReady = kr.keys.GetRelinearizationKey() != nil
+		status.GaloisKeysReady = len(kr.keys.GetGaloisKeys())
+	case kr.phase == keyRotationCommit || kr.phase == keyRotationDone:
+		// 新密钥已替换到当前密钥管理器
+		status.PublicKeyReady, status.RlkRound1Ready, status.RlkReady = true, true, true
+		status.GaloisKeysReady = status.TotalGaloisKeys
+	}
+	return status
+}
+
+// rotationKeys 序列化新纪元的集体密钥，新密钥全部聚合后可用
+func (c *Coordinator) rotationKeys(epoch, attempt int) (*KeysResponse, [][]byte, error) {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+
+	kr, err := c.currentKeyRotationLocked(epoch, attempt)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch kr.phase {
+	case keyRotationSwitch:
+		return encodeKeysResponse(kr.keys)
+	case keyRotationCommit, keyRotationDone:
+		return encodeKeysResponse(c.KeyManager)
+	default:
+		return nil, nil, fmt.Errorf("第 %d 纪元的密钥尚未全部聚合", epoch)
+	}
+}
+
+// rotationRelinRound1 获取新纪元聚合后的第一轮重线性化密钥份额
+func (c *Coordinator) rotationRelinRound1(epoch, attempt int) ([]byte, error) {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+
+	kr, err := c.currentKeyRotationLocked(epoch, attempt)
+	if err != nil {
+		return nil, err
+	}
+	if kr.keys == nil {
+		return nil, fmt.Errorf("第 %d 纪元的密钥已提交", epoch)
+	}
+	return kr.keys.GetRelinearizationKeyRound1Aggregated()
+}
+
+// ==================== 轮换策略 ====================
+
+// rotationDueLocked 是否已达到轮换前允许的解密次数，调用方需持有 keyRotationMu
+func (c *Coordinator) rotationDueLocked() bool {
+	return c.rotateAfterDecryptions > 0 && c.decryptionsSinceRotation >= c.rotateAfterDecryptions
+}
+
+// checkDecryptionBudget 检查是否可以接受新的解密任务
+// 轮换进行中或已达到解密次数上限时拒绝；达到上限且没有进行中的轮换时在后台发起轮换
+func (c *Coordinator) checkDecryptionBudget() error {
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+	c.expireKeyRotationLocked()
+
+	if kr := c.keyRotation; kr != nil && kr.active() {
+		return fmt.Errorf("正在轮换到第 %d 纪元的密钥（%s 阶段），轮换完成前不接受新的解密任务", kr.epoch, kr.phase)
+	}
+	if !c.rotationDueLocked() {
+		return nil
+	}
+	c.startDueKeyRotationLocked()
+	return fmt.Errorf("当前密钥已批准 %d 个解密任务，达到轮换上限，密钥轮换完成前不接受新的解密任务", c.decryptionsSinceRotation)
+}
+
+// startDueKeyRotationLocked 在后台发起策略要求的轮换，调用方需持有 keyRotationMu
+func (c *Coordinator) startDueKeyRotationLocked() {
+	reason := fmt.Sprintf("已批准 %d 个解密任务", c.decryptionsSinceRotation)
+	c.goBackground(func() {
+		if _, err := c.StartKeyRotation(reason); err != nil {
+			fmt.Printf("[密钥轮换] 自动轮换发起失败: %v\n", err)
+		}
+	})
+}
+
+// recordDecryption 记录一个批准的解密任务，达到策略上限时自动发起轮换
+// 协调器自己的密钥验证任务和变更不计入
+func (c *Coordinator) recordDecryption(task *tasks.Task) {
+	if task.Status != tasks.StatusApproved || task.IsChange() || task.Computation == keyVerificationComputation {
+		return
+	}
+	c.keyRotationMu.Lock()
+	defer c.keyRotationMu.Unlock()
+
+	c.decryptionsSinceRotation++
+	if err := c.persistKeyRotationLocked(); err != nil {
+		fmt.Printf("[警告] %v\n", err)
+	}
+	if c.rotationDueLocked() && c.decryptionsSinceRotation == c.rotateAfterDecryptions {
+		fmt.Printf("[密钥轮换] 当前密钥已批准 %d 个解密任务，达到策略上限\n", c.decryptionsSinceRotation)
+		c.startDueKeyRotationLocked()
+	}
+}
+
+// persistKeyRotationLocked 保存解密计数，调用方需持有 keyRotationMu
+func (c *Coordinator) persistKeyRotationLocked() error {
+	if c.store == nil {
+		return nil
+	}
+	record := keyRotationRecord{DecryptionsSinceRotation: c.decryptionsSinceRotation}
+	if err := store.PutGob(c.store, keyRotationStoreKey, record); err != nil {
+		return fmt.Errorf("保存密钥轮换状态失败: %v", err)
+	}
+	return nil
+}
+
+// restoreKeyRotation 从状态存储恢复解密计数
+func (c *Coordinator) restoreKeyRotation() error {
+	var record keyRotationRecord
+	if _, err := store.GetGob(c.store, keyRotationStoreKey, &record); err != nil {
+		return err
+	}
+	c.keyRotationMu.Lock()
+	c.decryptionsSinceRotation = record.DecryptionsSinceRotation
+	c.keyRotationMu.Unlock()
+	return nil
+}
+
+// sortedIDs 按升序返回集合中的参与方ID
+func sortedIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// ==================== 密钥轮换处理器 ====================
+
+// postKeyRotationShareHandler 参与方上传新纪元的密钥份额
+func (c *Coordinator) postKeyRotationShareHandler(ctx *gin.Context) {
+	var req KeyRotationShare
+	data, ok := readShare(ctx, &req)
+	if !ok {
+		return
+	}
+	if err := c.AddKeyRotationShare(authenticatedID(ctx), req, data); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": "rotation share added"})
+}
+
+// postKeyRotationReportHandler 参与方报告轮换进度
+func (c *Coordinator) postKeyRotationReportHandler(ctx *gin.Context) {
+	var req KeyRotationReport
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := c.ReportKeyRotation(authenticatedID(ctx), req); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, c.GetKeyRotationStatus())
+}
+
+// getKeyRotationHandler 查询密钥轮换状态
+func (c *Coordinator) getKeyRotationHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.GetKeyRotationStatus())
+}
+
+// getKeyRotationKeysHandler 获取新纪元的集体密钥，查询参数 epoch、attempt
+func (c *Coordinator) getKeyRotationKeysHandler(ctx *gin.Context) {
+	epoch, attempt, ok := rotationQuery(ctx)
+	if !ok {
+		return
+	}
+	resp, objects, err := c.rotationKeys(epoch, attempt)
+	if err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	writeMessage(ctx, resp, objects...)
+}
+
+// getKeyRotationRelinRound1Handler 获取新纪元聚合后的第一轮重线性化密钥份额，查询参数 epoch、attempt
+func (c *Coordinator) getKeyRotationRelinRound1Handler(ctx *gin.Context) {
+	epoch, attempt, ok := rotationQuery(ctx)
+	if !ok {
+		return
+	}
+	share, err := c.rotationRelinRound1(epoch, attempt)
+	if err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	writeMessage(ctx, gin.H{"round": 1, "epoch": epoch, "attempt": attempt}, share)
+}
+
+// rotationQuery 解析查询参数中的纪元和尝试次数，格式错误时写出400响应
+func rotationQuery(ctx *gin.Context) (int, int, bool) {
+	epoch, err1 := strconv.Atoi(ctx.Query("epoch"))
+	attempt, err2 := strconv.Atoi(ctx.Query("attempt"))
+	if err1 != nil || err2 != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "需要整数查询参数 epoch 和 attempt"})
+		return 0, 0, false
+	}
+	return epoch, attempt, true
+}
+
+// StartKeyRotationHandler 控制面提议密钥轮换接口，参与方批准后发起轮换
+func StartKeyRotationHandler(ctx *gin.Context) {
+	var req StartKeyRotationRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "手动发起"
+	}
+	task, err := coordinatorOf(ctx).TaskManager.ProposeRotation(req.Reason)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, task)
+}
+
+// GetKeyRotationHandler 控制面查询密钥轮换状态接口
+func GetKeyRotationHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getKeyRotationHandler(ctx)
+}
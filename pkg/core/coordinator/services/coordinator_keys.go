@@ -1,40 +1,42 @@
 package services
 
 import (
+	"MPHEDev/pkg/core/coordinator/events"
+	"MPHEDev/pkg/core/coordinator/phases"
+	"errors"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ==================== 密钥管理方法 ====================
-
-// checkAndTestAllKeys 检查所有密钥是否完成，如果完成则进行最终测试
-func (c *Coordinator) checkAndTestAllKeys() {
-	status := c.GetStatus()
+// ErrSecretKeyUploadDisabled 生产模式下禁止上传私钥
+var ErrSecretKeyUploadDisabled = errors.New("secret key upload is disabled; restart the coordinator with insecure_debug for testing")
 
-	// 检查所有密钥是否都已完成
-	allKeysReady := status["global_pk_ready"].(bool) &&
-		status["sk_agg_ready"].(bool) &&
-		status["rlk_ready"].(bool) &&
-		status["completed_galois_keys"].(int) == status["total_galois_keys"].(int)
+// ErrKeyTestDisabled 生产模式下禁止手动触发密钥测试（集体密钥生成后已自动协同验证）
+var ErrKeyTestDisabled = errors.New("manual key tests are disabled; restart the coordinator with insecure_debug for testing")
 
-	if allKeysReady {
-		fmt.Println("\n 所有密钥生成完成！")
-		fmt.Println(" 开始最终密钥测试...")
+// ==================== 密钥管理方法 ====================
 
-		if err := c.TestAllKeys(); err != nil {
-			fmt.Printf(" 最终密钥测试失败: %v\n", err)
-		} else {
-			fmt.Println(" 所有密钥测试通过！系统准备就绪。")
-		}
+// checkMember 初始密钥生成完成后只接受成员的密钥份额，候选成员通过密钥轮换加入
+func (c *Coordinator) checkMember(participantID int) error {
+	if !c.ParticipantManager.IsMember(participantID) {
+		return fmt.Errorf("参与方 %d 不是会话成员，需要先通过成员变更加入集体密钥", participantID)
 	}
+	return nil
 }
 
 // AddPublicKeyShare 添加公钥份额
 func (c *Coordinator) AddPublicKeyShare(participantID int, data []byte) error {
+	if duplicate, err := c.checkSharePhase(c.KeyManager.HasPublicKeyShare(participantID), phases.PublicKey); duplicate || err != nil {
+		return err
+	}
+	if err := c.checkMember(participantID); err != nil {
+		return err
+	}
 	if err := c.KeyManager.AddPublicKeyShare(participantID, data); err != nil {
 		return err
 	}
+	c.publish(events.Event{Type: events.ShareReceived, ParticipantID: participantID, Key: "public"})
 
 	// 检查是否所有份额都已收集完成，如果是则自动聚合
 	publicKeyShares := c.KeyManager.GetPublicKeyShares()
@@ -44,25 +46,39 @@ func (c *Coordinator) AddPublicKeyShare(participantID int, data []byte) error {
 		if err := c.KeyAggregator.AggregatePublicKey(globalCRP); err != nil {
 			return fmt.Errorf("公钥聚合失败: %v", err)
 		}
-
-		// 自动测试公钥
-		fmt.Println(" 开始测试公钥...")
-		if err := c.TestPublicKeyOnly(); err != nil {
-			fmt.Printf(" 公钥测试失败: %v\n", err)
+		// 上传公钥份额的参与方成为第0成员纪元的成员
+		c.initMembership()
+		c.publish(events.Event{Type: events.KeyAggregated, Key: "public"})
+
+		// 调试模式下用聚合私钥自动测试公钥，生产模式在全部密钥完成后统一协同验证
+		if c.insecureDebug {
+			fmt.Println(" 开始测试公钥...")
+			if err := c.TestPublicKeyOnly(); err != nil {
+				fmt.Printf(" 公钥测试失败: %v\n", err)
+			}
 		}
 
-		// 检查是否所有密钥都已完成
-		c.checkAndTestAllKeys()
+		c.advancePhases()
 	}
 
 	return nil
 }
 
-// AddSecretKey 添加私钥
+// AddSecretKey 添加私钥，仅在insecure_debug模式下允许
 func (c *Coordinator) AddSecretKey(participantID int, data []byte) error {
+	if !c.insecureDebug {
+		return ErrSecretKeyUploadDisabled
+	}
+	if duplicate, err := c.checkSharePhase(c.KeyManager.HasSecretKey(participantID), phases.PublicKey); duplicate || err != nil {
+		return err
+	}
+	if err := c.checkMember(participantID); err != nil {
+		return err
+	}
 	if err := c.KeyManager.AddSecretKey(participantID, data); err != nil {
 		return err
 	}
+	c.publish(events.Event{Type: events.ShareReceived, ParticipantID: participantID, Key: "secret"})
 
 	// 检查是否所有私钥都已收集完成，如果是则自动聚合
 	secretKeyShares := c.KeyManager.GetSecretKeyShares()
@@ -71,9 +87,9 @@ func (c *Coordinator) AddSecretKey(participantID int, data []byte) error {
 		if err := c.KeyAggregator.AggregateSecretKey(); err != nil {
 			return fmt.Errorf("私钥聚合失败: %v", err)
 		}
+		c.publish(events.Event{Type: events.KeyAggregated, Key: "secret"})
 
-		// 检查是否所有密钥都已完成
-		c.checkAndTestAllKeys()
+		c.advancePhases()
 	}
 
 	return nil
@@ -81,23 +97,48 @@ func (c *Coordinator) AddSecretKey(participantID int, data []byte) error {
 
 // AddGaloisKeyShare 添加伽罗瓦密钥份额
 func (c *Coordinator) AddGaloisKeyShare(participantID int, galEl uint64, data []byte) error {
+	galoisCRP, ok := c.ParameterManager.GetGaloisCRP(galEl)
+	if !ok {
+		return fmt.Errorf("伽罗瓦元素 %d 不在本会话的密钥列表中", galEl)
+	}
+	// 已聚合的密钥不再接受份额（参与方重试追加轮次时可能重复上传）
+	if c.KeyManager.HasGaloisKey(galEl) {
+		return nil
+	}
+	// 初始伽罗瓦元素在 galois 阶段生成，追加轮次在密钥验证通过之后
+	allowed := []phases.Phase{phases.Galois}
+	if c.ParameterManager.GetGaloisRound() > 0 {
+		allowed = []phases.Phase{phases.Ready, phases.Computing}
+	}
+	if duplicate, err := c.checkSharePhase(c.KeyManager.HasGaloisKeyShare(participantID, galEl), allowed...); duplicate || err != nil {
+		return err
+	}
+	if err := c.checkMember(participantID); err != nil {
+		return err
+	}
 	if err := c.KeyManager.AddGaloisKeyShare(participantID, galEl, data); err != nil {
 		return err
 	}
+	c.publish(events.Event{Type: events.ShareReceived, ParticipantID: participantID, Key: "galois", GalEl: galEl})
 
 	// 检查该galEl的所有份额是否都已收集完成，如果是则自动聚合
+	c.galoisAggMu.Lock()
+	defer c.galoisAggMu.Unlock()
 	galoisKeyShares := c.KeyManager.GetGaloisKeyShares()
 	shares := galoisKeyShares[galEl]
-	if len(shares) == c.expectedN {
+	if len(shares) == c.expectedN && !c.KeyManager.HasGaloisKey(galEl) {
 		fmt.Printf("\n 开始聚合伽罗瓦密钥 (galEl: %d)...\n", galEl)
-		galoisCRPs := c.ParameterManager.GetGaloisCRPs()
-		galoisCRP := galoisCRPs[galEl]
 		if err := c.KeyAggregator.AggregateGaloisKey(galEl, galoisCRP); err != nil {
 			return fmt.Errorf("伽罗瓦密钥聚合失败 (galEl: %d): %v", galEl, err)
 		}
+		c.publish(events.Event{Type: events.KeyAggregated, Key: "galois", GalEl: galEl})
 
-		// 检查是否所有密钥都已完成
-		c.checkAndTestAllKeys()
+		// 初始轮次推进会话阶段，追加轮次检查本轮是否完成
+		if c.ParameterManager.GetGaloisRound() == 0 {
+			c.advancePhases()
+		} else {
+			c.checkRotationRound()
+		}
 	}
 
 	return nil
@@ -105,9 +146,23 @@ func (c *Coordinator) AddGaloisKeyShare(participantID int, galEl uint64, data []
 
 // AddRelinearizationKeyShare 添加重线性化密钥份额
 func (c *Coordinator) AddRelinearizationKeyShare(participantID int, round int, data []byte) error {
+	if round != 1 && round != 2 {
+		return fmt.Errorf("无效的轮次: %d", round)
+	}
+	phase := phases.RelinRound1
+	if round == 2 {
+		phase = phases.RelinRound2
+	}
+	if duplicate, err := c.checkSharePhase(c.KeyManager.HasRelinearizationKeyShare(participantID, round), phase); duplicate || err != nil {
+		return err
+	}
+	if err := c.checkMember(participantID); err != nil {
+		return err
+	}
 	if err := c.KeyManager.AddRelinearizationKeyShare(participantID, round, data); err != nil {
 		return err
 	}
+	c.publish(events.Event{Type: events.ShareReceived, ParticipantID: participantID, Key: "relin", Round: round})
 
 	if round == 1 {
 		// 检查第一轮份额是否都已收集完成，如果是则自动聚合
@@ -120,6 +175,8 @@ func (c *Coordinator) AddRelinearizationKeyShare(participantID int, round int, d
 				return fmt.Errorf("重线性化密钥第一轮聚合失败: %v", err)
 			}
 			fmt.Println(" 重线性化密钥第一轮聚合完成，参与方可以获取聚合结果并提交第二轮份额")
+			c.publish(events.Event{Type: events.RlkRound1Ready, Key: "relin", Round: 1})
+			c.advancePhases()
 
 			// 验证聚合结果是否正确设置
 			if c.KeyManager.GetRelinearizationShare1Aggregated() != nil {
@@ -140,15 +197,17 @@ func (c *Coordinator) AddRelinearizationKeyShare(participantID int, round int, d
 			if err := c.KeyAggregator.AggregateRelinearizationKeyRound2(); err != nil {
 				return fmt.Errorf("重线性化密钥第二轮聚合失败: %v", err)
 			}
-
-			// 自动测试重线性化密钥
-			fmt.Println(" 开始测试重线性化密钥...")
-			if err := c.TestRelinearizationKeyOnly(); err != nil {
-				fmt.Printf(" 重线性化密钥测试失败: %v\n", err)
+			c.publish(events.Event{Type: events.KeyAggregated, Key: "relin"})
+
+			// 调试模式下用聚合私钥自动测试重线性化密钥
+			if c.insecureDebug {
+				fmt.Println(" 开始测试重线性化密钥...")
+				if err := c.TestRelinearizationKeyOnly(); err != nil {
+					fmt.Printf(" 重线性化密钥测试失败: %v\n", err)
+				}
 			}
 
-			// 检查是否所有密钥都已完成
-			c.checkAndTestAllKeys()
+			c.advancePhases()
 		} else {
 			fmt.Printf(" 重线性化密钥第二轮份额收集进度: %d/%d\n", len(rlkShare2Map), c.expectedN)
 		}
@@ -157,8 +216,8 @@ func (c *Coordinator) AddRelinearizationKeyShare(participantID int, round int, d
 	return nil
 }
 
-// GetRelinearizationKeyRound1Aggregated 获取聚合后的第一轮重线性化密钥份额
-func (c *Coordinator) GetRelinearizationKeyRound1Aggregated() (string, error) {
+// GetRelinearizationKeyRound1Aggregated 获取聚合后的第一轮重线性化密钥份额的二进制编码
+func (c *Coordinator) GetRelinearizationKeyRound1Aggregated() ([]byte, error) {
 	return c.KeyManager.GetRelinearizationKeyRound1Aggregated()
 }
 
@@ -187,20 +246,30 @@ func (c *Coordinator) GetStatus() gin.H {
 	rlkRound1Ready := c.KeyManager.GetRelinearizationShare1Aggregated() != nil
 	rlkRound2Ready := len(rlkShare2Map) == c.expectedN
 	rlkReady := c.KeyManager.GetRelinearizationKey() != nil
-
-	return gin.H{
-		"received_shares":       len(publicKeyShares),
-		"received_secrets":      len(secretKeyShares),
-		"total":                 len(participants),
-		"global_pk_ready":       globalPKReady,
-		"sk_agg_ready":          skAggReady,
-		"galois_keys_ready":     galoisKeysReady,
-		"total_galois_keys":     totalGaloisKeys,
-		"completed_galois_keys": completedGaloisKeys,
-		"rlk_round1_ready":      rlkRound1Ready,
-		"rlk_round2_ready":      rlkRound2Ready,
-		"rlk_ready":             rlkReady,
+	verifyStatus, verifyError := c.GetKeyVerificationStatus()
+
+	status := gin.H{
+		"received_shares":        len(publicKeyShares),
+		"received_secrets":       len(secretKeyShares),
+		"total":                  len(participants),
+		"global_pk_ready":        globalPKReady,
+		"sk_agg_ready":           skAggReady,
+		"galois_keys_ready":      galoisKeysReady,
+		"total_galois_keys":      totalGaloisKeys,
+		"completed_galois_keys":  completedGaloisKeys,
+		"galois_round":           c.ParameterManager.GetGaloisRound(),
+		"rlk_round1_ready":       rlkRound1Ready,
+		"rlk_round2_ready":       rlkRound2Ready,
+		"rlk_ready":              rlkReady,
+		"insecure_debug":         c.insecureDebug,
+		"key_verification":       verifyStatus,
+		"key_verification_error": verifyError,
+		"keys_verified":          verifyStatus == verifyStatusPassed,
+	}
+	for k, v := range c.phaseStatus() {
+		status[k] = v
 	}
+	return status
 }
 
 // ==================== 密钥测试方法 ====================
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/participants"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 生命周期管理 ====================
+//
+// 关闭顺序：先停止接受新请求并等待处理中的密钥份额上传、协同解密等请求完成，
+// 再取消 ctx 通知心跳清理、密钥验证等后台协程退出，最后保存会话状态。
+
+// shutdownTimeout 重新初始化时等待上一个会话关闭的最长时间
+const shutdownTimeout = 30 * time.Second
+
+// SessionState 关闭时保存的会话状态
+type SessionState struct {
+	CoordinatorID string                `json:"coordinator_id"`
+	SessionID     string                `json:"session_id"`
+	SavedAt       string                `json:"saved_at"`
+	ParamProfile  string                `json:"param_profile"`
+	ExpectedN     int                   `json:"expected_participants"`
+	Threshold     int                   `json:"threshold"`
+	InsecureDebug bool                  `json:"insecure_debug"`
+	Participants  []participants.Record `json:"participants"`
+	KeyStatus     gin.H                 `json:"key_status"`
+}
+
+// goBackground 启动受生命周期管理的后台协程，Shutdown 会等待其退出
+func (c *Coordinator) goBackground(fn func()) {
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		fn()
+	}()
+}
+
+// sleepOrDone 等待指定时间，协调器关闭时提前返回 false
+func (c *Coordinator) sleepOrDone(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// Shutdown 优雅关闭协调器，可重复调用
+func (c *Coordinator) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	c.shutdownOnce.Do(func() {
+		fmt.Println("协调器正在关闭...")
+
+		// 1. 进入 closed 阶段，结束事件流和中继连接，停止接受本会话的新请求，等待处理中的请求完成
+		c.phases.Close()
+		c.events.Close()
+		c.relayHub.Close()
+		if err := c.router.Close(ctx); err != nil {
+			shutdownErr = fmt.Errorf("等待处理中的请求完成失败: %v", err)
+		}
+		c.HTTPServer.RemoveSession(c.id)
+
+		// 2. 通知后台协程退出并等待
+		c.cancel()
+		done := make(chan struct{})
+		go func() {
+			c.background.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			fmt.Println("[警告] 等待后台协程退出超时")
+		}
+
+		// 3. 保存会话状态
+		if c.stateDir != "" {
+			path, err := c.SaveState(c.stateDir)
+			if err != nil {
+				fmt.Printf("[警告] 保存会话状态失败: %v\n", err)
+				if shutdownErr == nil {
+					shutdownErr = err
+				}
+			} else {
+				fmt.Printf("会话状态已保存到 %s\n", path)
+			}
+		}
+		fmt.Println("协调器已关闭")
+	})
+	return shutdownErr
+}
+
+// SaveState 将会话状态写入 dir/coordinator_<会话ID>.json，返回文件路径
+func (c *Coordinator) SaveState(dir string) (string, error) {
+	state := SessionState{
+		CoordinatorID: c.id,
+		SessionID:     c.GetSessionID(),
+		SavedAt:       time.Now().Format(time.RFC3339),
+		ParamProfile:  c.ParameterManager.GetProfileName(),
+		ExpectedN:     c.expectedN,
+		Threshold:     c.threshold,
+		InsecureDebug: c.insecureDebug,
+		Participants:  c.ParticipantManager.Records(),
+		KeyStatus:     c.GetStatus(),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("序列化会话状态失败: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建状态目录失败: %v", err)
+	}
+	path := filepath.Join(dir, "coordinator_"+state.SessionID+".json")
+	// 先写临时文件再重命名，避免关闭过程中被中断留下不完整的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", fmt.Errorf("写入会话状态失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("写入会话状态失败: %v", err)
+	}
+	return path, nil
+}
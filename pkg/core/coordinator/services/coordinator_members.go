@@ -0,0 +1,154 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 成员变更 ====================
+//
+// 初始密钥生成完成后，参与方数量不再固定为启动时的N：之后注册的参与方是候选成员，
+// 不参与协同解密和追加旋转密钥。控制面把候选成员加入会话时发起一次带新成员的密钥轮换
+// （见 coordinator_key_rotation.go）：现有成员和新成员一起生成新纪元的集体密钥，
+// 切换密文时现有成员使用旧私钥份额、新成员以零作为旧私钥份额，切换后的密文在包含新成员的
+// 集体私钥下有效。提交时成员纪元加1，N更新为新的成员数量，门限模式下t不变；
+// 参与方从轮换通知和 /members 得知新的成员列表。
+
+// AddMembersRequest 控制面加入候选成员的请求
+type AddMembersRequest struct {
+	ParticipantIDs []int `json:"participant_ids"`
+}
+
+// MembershipStatus 成员状态
+type MembershipStatus struct {
+	Epoch      int   `json:"epoch"`     // 成员纪元
+	KeyEpoch   int   `json:"key_epoch"` // 密钥纪元
+	Members    []int `json:"members"`
+	Candidates []int `json:"candidates"`
+}
+
+// GetMembershipStatus 获取成员状态
+func (c *Coordinator) GetMembershipStatus() MembershipStatus {
+	pm := c.ParticipantManager
+	return MembershipStatus{
+		Epoch:      pm.GetMembershipEpoch(),
+		KeyEpoch:   c.ParameterManager.GetKeyEpoch(),
+		Members:    pm.GetMembers(),
+		Candidates: pm.GetCandidates(),
+	}
+}
+
+// initMembership 初始公钥聚合后，把上传公钥份额的参与方设为第0成员纪元的成员
+func (c *Coordinator) initMembership() {
+	if c.ParticipantManager.HasMembers() {
+		return
+	}
+	shares := c.KeyManager.GetPublicKeyShares()
+	ids := make([]int, 0, len(shares))
+	for id := range shares {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	if err := c.ParticipantManager.SetMembers(ids, 0); err != nil {
+		fmt.Printf("[警告] 设置初始成员失败: %v\n", err)
+	}
+}
+
+// restoreMembership 恢复成员数量，状态中没有成员记录但公钥已聚合时按公钥份额设置成员
+func (c *Coordinator) restoreMembership() {
+	if c.KeyManager.GetGlobalPK() != nil {
+		c.initMembership()
+	}
+	if members := c.ParticipantManager.GetMembers(); len(members) > 0 {
+		c.applyMemberCount(len(members))
+	}
+}
+
+// applyMemberCount 成员数量变化后更新密钥、任务和协同解密使用的N，全员模式下t随之更新
+func (c *Coordinator) applyMemberCount(n int) {
+	c.expectedN = n
+	c.threshold = c.ParticipantManager.GetThreshold()
+	c.KeyManager.SetExpectedN(n)
+	c.TaskManager.SetExpectedN(n)
+}
+
+// onlineMemberURLs 在线成员的P2P地址，不包括尚未上报地址的参与方
+func (c *Coordinator) onlineMemberURLs() map[int]string {
+	online := make(map[int]string)
+	for _, peer := range c.ParticipantManager.GetOnlineMembers() {
+		if peer.URL != "" {
+			online[peer.ID] = peer.URL
+		}
+	}
+	return online
+}
+
+// AddMembers 把候选成员加入会话，发起一次带新成员的密钥轮换
+func (c *Coordinator) AddMembers(ids []int) (*KeyRotationStatus, error) {
+	joining, err := c.checkJoining(ids)
+	if err != nil {
+		return nil, err
+	}
+	return c.startKeyRotation(fmt.Sprintf("加入参与方 %v", joining), joining)
+}
+
+// checkJoining 检查加入的参与方都是已注册的候选成员，返回排序后的ID
+func (c *Coordinator) checkJoining(ids []int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("需要指定加入的参与方")
+	}
+	pm := c.ParticipantManager
+	if !pm.HasMembers() {
+		return nil, fmt.Errorf("初始密钥尚未生成完成，新参与方可以直接参与密钥生成")
+	}
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fmt.Errorf("参与方 %d 重复", id)
+		}
+		seen[id] = true
+		if !pm.IsRegistered(id) {
+			return nil, fmt.Errorf("参与方 %d 未注册", id)
+		}
+		if pm.IsMember(id) {
+			return nil, fmt.Errorf("参与方 %d 已经是成员", id)
+		}
+	}
+	joining := append([]int(nil), ids...)
+	sort.Ints(joining)
+	return joining, nil
+}
+
+// getMembersHandler 参与方查询当前成员和候选成员
+func (c *Coordinator) getMembersHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.GetMembershipStatus())
+}
+
+// AddMembersHandler 控制面提议加入候选成员接口，参与方批准后发起带新成员的密钥轮换
+func AddMembersHandler(ctx *gin.Context) {
+	var req AddMembersRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c := coordinatorOf(ctx)
+	joining, err := c.checkJoining(req.ParticipantIDs)
+	if err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := c.TaskManager.ProposeMembers(joining)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, task)
+}
+
+// GetMembersHandler 控制面查询成员接口
+func GetMembersHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getMembersHandler(ctx)
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/consumers"
+	"MPHEDev/pkg/core/coordinator/phases"
+	"MPHEDev/pkg/core/coordinator/tasks"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/wire"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// ==================== 公钥切换（向结果接收方交付密文） ====================
+//
+// 协同解密会在发起方得到明文。需要把结果交给外部接收方时改用多方公钥切换：
+// 活跃参与方各自用私钥份额为密文生成PCKS份额（目标为接收方公钥），协调器聚合后
+// 得到接收方公钥下的密文。协调器和参与方都只接触密文，只有接收方能解密。
+
+// RegisterConsumerRequest 登记结果接收方的请求
+type RegisterConsumerRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"` // Base64编码的接收方公钥信封
+}
+
+// ReencryptRequest 公钥切换请求，task_id 为已批准的公钥切换任务
+// 帧格式请求的密文信封为控制帧之后唯一的对象帧，JSON请求（控制面）放在 ciphertext 字段
+type ReencryptRequest struct {
+	TaskID     string `json:"task_id"`
+	ConsumerID string `json:"consumer_id"`
+	Ciphertext string `json:"ciphertext,omitempty"` // Base64编码的集体公钥下的密文信封
+}
+
+// pcksShareRequest 发给参与方的公钥切换份额请求的控制帧
+// 其后的对象帧依次为密文信封和接收方公钥信封
+type pcksShareRequest struct {
+	TaskID       string `json:"task_id"`
+	ConsumerID   string `json:"consumer_id"`
+	Participants []int  `json:"participants"` // 活跃参与方集合，门限模式下据此计算加法份额
+}
+
+// ReencryptResponse 公钥切换结果
+// 帧格式响应的结果密文信封为控制帧之后唯一的对象帧，JSON响应放在 ciphertext 字段
+type ReencryptResponse struct {
+	ResultID   string `json:"result_id"`
+	ConsumerID string `json:"consumer_id"`
+	Ciphertext string `json:"ciphertext,omitempty"` // Base64编码的接收方公钥下的密文信封
+	CreatedAt  string `json:"created_at"`
+}
+
+// RegisterConsumer 校验并登记结果接收方公钥
+func (c *Coordinator) RegisterConsumer(name, publicKeyB64 string) (*consumers.Consumer, error) {
+	if name == "" {
+		return nil, fmt.Errorf("接收方名称不能为空")
+	}
+	params := c.ParameterManager.GetCKKSParams()
+	pk, err := utils.DecodePublicKey(params, publicKeyB64)
+	if err != nil {
+		return nil, fmt.Errorf("接收方公钥校验失败: %v", err)
+	}
+	// 统一保存为信封，原样转发给参与方
+	data, err := envelope.SealPublicKey(params, pk)
+	if err != nil {
+		return nil, fmt.Errorf("编码接收方公钥失败: %v", err)
+	}
+	return c.ConsumerManager.Register(name, data)
+}
+
+// consumerKeyFingerprint 接收方公钥的指纹，结果密文的信封绑定该指纹
+func (c *Coordinator) consumerKeyFingerprint(consumer *consumers.Consumer) (envelope.Fingerprint, error) {
+	pk, err := envelope.OpenPublicKey(c.ParameterManager.GetCKKSParams(), consumer.PublicKey)
+	if err != nil {
+		return envelope.Fingerprint{}, fmt.Errorf("接收方 %s 的公钥无效: %v", consumer.ID, err)
+	}
+	return envelope.KeyFingerprint(pk), nil
+}
+
+// 公钥切换失败的原因，reencryptHandler 据此选择状态码（见 reencryptErrorStatus）
+var (
+	errConsumerNotFound        = errors.New("接收方不存在")
+	errTaskNotAuthorized       = errors.New("公钥切换未获授权")
+	errCiphertextRejected      = errors.New("拒绝切换该密文")
+	errParticipantsUnavailable = errors.New("在线参与方不足")
+	errParticipantsFailed      = errors.New("参与方未能提供公钥切换份额")
+)
+
+// ReencryptForConsumer 组织参与方把集体公钥下的密文切换到接收方公钥下，并保存结果
+// 任务须已批准且与密文和接收方一致。非门限模式需要全部N个参与方，门限模式下选取t个在线参与方，
+// 失败的参与方会被排除后重试
+func (c *Coordinator) ReencryptForConsumer(taskID, consumerID string, ct *rlwe.Ciphertext) (*consumers.Result, error) {
+	consumer, ok := c.ConsumerManager.Get(consumerID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errConsumerNotFound, consumerID)
+	}
+	// 密钥验证通过之前不切换
+	if err := c.requireReady(); err != nil {
+		return nil, err
+	}
+	hash, err := utils.CiphertextHash(ct)
+	if err != nil {
+		return nil, fmt.Errorf("计算密文哈希失败: %v", err)
+	}
+	task, err := c.TaskManager.Authorize(taskID, tasks.KindReencrypt, hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errTaskNotAuthorized, err)
+	}
+	if task.ConsumerID != consumer.ID {
+		return nil, fmt.Errorf("%w: 任务 %s 的接收方为 %s", errTaskNotAuthorized, task.ID, task.ConsumerID)
+	}
+	est, err := c.keySwitchNoise(ct)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCiphertextRejected, err)
+	}
+	fmt.Printf("公钥切换淹没噪声: %s\n", est)
+
+	params, key := c.ParameterManager.GetCKKSParams(), c.KeyManager.GlobalPKFingerprint()
+	consumerKey, err := c.consumerKeyFingerprint(consumer)
+	if err != nil {
+		return nil, err
+	}
+	if consumerKey.Hex() != task.ConsumerKey {
+		return nil, fmt.Errorf("%w: 接收方 %s 的公钥与任务 %s 批准的公钥不一致", errTaskNotAuthorized, consumer.ID, task.ID)
+	}
+	ctData, err := envelope.SealCiphertext(params, key, ct)
+	if err != nil {
+		return nil, fmt.Errorf("密文序列化失败: %v", err)
+	}
+	req := pcksShareRequest{
+		TaskID:     task.ID,
+		ConsumerID: consumer.ID,
+	}
+
+	online := c.onlineMemberURLs()
+
+	failed := make(map[int]bool)
+	for {
+		active, err := c.selectActiveParticipants(online, failed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errParticipantsUnavailable, err)
+		}
+
+		shares, failedPeers := c.requestPCKSShares(active, online, req, ct.Level(), ctData, consumer.PublicKey)
+		if len(failedPeers) == 0 {
+			out, err := c.finalizePCKS(ct, shares)
+			if err != nil {
+				return nil, err
+			}
+			// 结果密文在接收方公钥下，信封绑定接收方公钥的指纹
+			data, err := envelope.SealCiphertext(params, consumerKey, out)
+			if err != nil {
+				return nil, fmt.Errorf("密文序列化失败: %v", err)
+			}
+			result, err := c.ConsumerManager.AddResult(consumer.ID, data)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Printf("已为接收方 %s 生成结果 %s（活跃参与方 %v）\n", consumer.Name, result.ID, active)
+			return result, nil
+		}
+		for _, id := range failedPeers {
+			failed[id] = true
+		}
+		if !c.ParticipantManager.IsThresholdMode() {
+			return nil, fmt.Errorf("%w: %v", errParticipantsFailed, failedPeers)
+		}
+		fmt.Printf("参与方 %v 未能提供公钥切换份额，重新选择活跃集合\n", failedPeers)
+	}
+}
+
+// requestPCKSShares 并发向活跃集合请求公钥切换份额，返回成功的份额和失败的参与方
+// 份额须绑定集体公钥且层级为被切换密文的层级 level
+func (c *Coordinator) requestPCKSShares(active []int, online map[int]string, req pcksShareRequest, level int, ctData, consumerPK []byte) ([]multiparty.PublicKeySwitchShare, []int) {
+	params, key := c.ParameterManager.GetCKKSParams(), c.KeyManager.GlobalPKFingerprint()
+	type peerResp struct {
+		PeerID int
+		Share  multiparty.PublicKeySwitchShare
+		Err    error
+	}
+	results := make(chan peerResp, len(active))
+
+	req.Participants = active
+
+	for _, peerID := range active {
+		go func(peerID int, peerURL string) {
+			data, err := c.requestShare(peerURL+"/pcks_share", req, ctData, consumerPK)
+			if err != nil {
+				results <- peerResp{PeerID: peerID, Err: err}
+				return
+			}
+			share, err := envelope.OpenPublicKeySwitchShare(params, key, level, data)
+			if err != nil {
+				results <- peerResp{PeerID: peerID, Err: fmt.Errorf("份额校验失败: %v", err)}
+				return
+			}
+			results <- peerResp{PeerID: peerID, Share: share}
+		}(peerID, online[peerID])
+	}
+
+	shares := make([]multiparty.PublicKeySwitchShare, 0, len(active))
+	var failedPeers []int
+	for range active {
+		res := <-results
+		if res.Err != nil {
+			fmt.Printf("[警告] 获取参与方 %d 公钥切换份额失败: %v\n", res.PeerID, res.Err)
+			failedPeers = append(failedPeers, res.PeerID)
+			continue
+		}
+		shares = append(shares, res.Share)
+	}
+	return shares, failedPeers
+}
+
+// finalizePCKS 聚合公钥切换份额，输出接收方公钥下的密文
+func (c *Coordinator) finalizePCKS(ct *rlwe.Ciphertext, shares []multiparty.PublicKeySwitchShare) (*rlwe.Ciphertext, error) {
+	params := c.ParameterManager.GetCKKSParams()
+	est, err := c.keySwitchNoise(ct)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := multiparty.NewPublicKeySwitchProtocol(params, est.Distribution())
+	if err != nil {
+		return nil, err
+	}
+
+	level := ct.Level()
+	agg := proto.AllocateShare(level)
+	for i := range shares {
+		if err := proto.AggregateShares(shares[i], agg, &agg); err != nil {
+			return nil, fmt.Errorf("聚合公钥切换份额失败: %v", err)
+		}
+	}
+
+	out := rlwe.NewCiphertext(params, 1, level)
+	*out.MetaData = *ct.MetaData
+	proto.KeySwitch(ct, agg, out)
+	return out, nil
+}
+
+// ==================== 接收方相关处理器 ====================
+
+// reencryptHandler 参与方请求把密文交付给接收方
+// 参与方发送帧格式请求，控制面（浏览器）可以发送JSON请求，响应格式与请求一致
+func (c *Coordinator) reencryptHandler(ctx *gin.Context) {
+	var req ReencryptRequest
+	var ctData []byte
+	if wire.IsFramed(ctx.ContentType()) {
+		data, ok := readShare(ctx, &req)
+		if !ok {
+			return
+		}
+		ctData = data
+	} else {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := utils.DecodeFromBase64(req.Ciphertext)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ciphertext"})
+			return
+		}
+		ctData = data
+	}
+	ct, err := envelope.OpenCiphertext(c.ParameterManager.GetCKKSParams(), c.KeyManager.GlobalPKFingerprint(), ctData)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("密文校验失败: %v", err)})
+		return
+	}
+
+	result, err := c.ReencryptForConsumer(req.TaskID, req.ConsumerID, ct)
+	if err != nil {
+		ctx.JSON(reencryptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeResult(ctx, result)
+}
+
+// reencryptErrorStatus 公钥切换失败的HTTP状态码：未授权为403，会话尚未就绪为409，
+// 参与方不足为503、未能提供份额为502，其余为内部错误
+func reencryptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errConsumerNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errTaskNotAuthorized):
+		return http.StatusForbidden
+	case errors.Is(err, errCiphertextRejected):
+		return http.StatusBadRequest
+	case errors.Is(err, phases.ErrOutOfPhase):
+		return http.StatusConflict
+	case errors.Is(err, errParticipantsUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, errParticipantsFailed):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// getResultHandler 接收方按结果ID获取密文，密文只有接收方能解密
+func (c *Coordinator) getResultHandler(ctx *gin.Context) {
+	result, ok := c.ConsumerManager.GetResult(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "结果不存在"})
+		return
+	}
+	writeResult(ctx, result)
+}
+
+// writeResult 写出公钥切换结果，请求方接受帧格式时密文作为对象帧，否则以JSON返回
+func writeResult(ctx *gin.Context, result *consumers.Result) {
+	resp := ReencryptResponse{
+		ResultID:   result.ID,
+		ConsumerID: result.ConsumerID,
+		CreatedAt:  result.CreatedAt,
+	}
+	if wire.Accepts(ctx.Request) {
+		writeMessage(ctx, resp, result.Ciphertext)
+		return
+	}
+	resp.Ciphertext = utils.EncodeToBase64(result.Ciphertext)
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// registerConsumerHandler 登记结果接收方
+func (c *Coordinator) registerConsumerHandler(ctx *gin.Context) {
+	var req RegisterConsumerRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	consumer, err := c.RegisterConsumer(req.Name, req.PublicKey)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, consumer)
+}
+
+// RegisterConsumerHandler 控制面登记结果接收方接口
+func RegisterConsumerHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).registerConsumerHandler(ctx)
+}
+
+// ListConsumersHandler 控制面列出结果接收方接口
+func ListConsumersHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"consumers": coordinatorOf(ctx).ConsumerManager.List()})
+}
+
+// ReencryptHandler 控制面公钥切换接口
+func ReencryptHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).reencryptHandler(ctx)
+}
+
+// GetResultHandler 控制面获取公钥切换结果接口
+func GetResultHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getResultHandler(ctx)
+}
+
+// GetCKKSParamsHandler 控制面获取会话参数接口，接收方据此生成密钥对
+func GetCKKSParamsHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getCKKSParamsHandler(ctx)
+}
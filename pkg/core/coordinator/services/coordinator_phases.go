@@ -0,0 +1,214 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/events"
+	"MPHEDev/pkg/core/coordinator/phases"
+	"MPHEDev/pkg/core/coordinator/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 会话阶段 ====================
+//
+// 会话按 registration → pk → rlk_round1 → rlk_round2 → galois → verification → ready → computing → closed
+// 推进（见 pkg/core/coordinator/phases）。一个阶段的份额全部聚合后进入下一阶段，每个阶段只接受本阶段的份额，
+// 超时或密钥验证失败时进入 failed。阶段变化时持久化并推送 phase_changed，参与方按 /setup/status 中的
+// phase 决定下一步上传哪种份额。
+
+// phaseStoreKey 会话阶段在状态存储中的键
+const phaseStoreKey = "phase"
+
+// phaseRecord 持久化的会话阶段，恢复时区分 ready/computing/failed
+type phaseRecord struct {
+	Phase phases.Phase
+	Error string
+}
+
+// initPhases 注册阶段变化钩子和超时说明
+func (c *Coordinator) initPhases() {
+	c.phases.OnTransition(c.onPhaseTransition)
+	c.phases.OnTimeout(c.laggingDescription)
+}
+
+// onPhaseTransition 阶段变化钩子：输出日志、持久化、推送事件，进入 verification 时开始验证密钥
+func (c *Coordinator) onPhaseTransition(t phases.Transition) {
+	if t.To == phases.Failed {
+		fmt.Printf("[会话阶段] %s → failed: %s\n", t.From, t.Reason)
+	} else {
+		fmt.Printf("[会话阶段] %s → %s\n", t.From, t.To)
+	}
+	// 关闭不持久化，协调器重启后按关闭前的阶段恢复
+	if c.store != nil && t.To != phases.Closed {
+		if err := store.PutGob(c.store, phaseStoreKey, phaseRecord{Phase: t.To, Error: t.Reason}); err != nil {
+			fmt.Printf("[警告] 保存会话阶段失败: %v\n", err)
+		}
+	}
+	c.publish(events.Event{Type: events.PhaseChanged})
+
+	if t.To == phases.Verification {
+		fmt.Println("\n 所有密钥生成完成！")
+		fmt.Println(" 开始最终密钥测试...")
+		c.startKeyVerification()
+	}
+}
+
+// phaseComplete 阶段要求的份额是否已全部聚合
+func (c *Coordinator) phaseComplete(p phases.Phase) bool {
+	km := c.KeyManager
+	switch p {
+	case phases.Registration:
+		return c.ParameterManager.IsCRSReady() && len(c.GetParticipants()) >= c.expectedN
+	case phases.PublicKey:
+		return km.GetGlobalPK() != nil && (!c.insecureDebug || km.GetAggregatedSecretKey() != nil)
+	case phases.RelinRound1:
+		return km.GetRelinearizationShare1Aggregated() != nil
+	case phases.RelinRound2:
+		return km.GetRelinearizationKey() != nil
+	case phases.Galois:
+		// 追加轮次在密钥验证通过后才开始，此时初始伽罗瓦密钥已全部生成
+		return c.ParameterManager.GetGaloisRound() > 0 || len(c.pendingGaloisElements()) == 0
+	default:
+		return false
+	}
+}
+
+// advancePhases 当前阶段完成时推进，一次可推进多个阶段（例如没有伽罗瓦密钥时直接进入验证）
+// 在注册、CRS协商完成和每次聚合之后调用
+func (c *Coordinator) advancePhases() {
+	for {
+		current := c.phases.Current()
+		if !c.phaseComplete(current) || !c.phases.Advance(current) {
+			return
+		}
+	}
+}
+
+// restorePhase 恢复会话时由已聚合的密钥推出密钥生成阶段，密钥已全部生成时沿用保存的 ready/computing/failed
+func (c *Coordinator) restorePhase() error {
+	phase := phases.Registration
+	for c.phaseComplete(phase) {
+		phase, _ = phase.Next()
+	}
+
+	var record phaseRecord
+	if _, err := store.GetGob(c.store, phaseStoreKey, &record); err != nil {
+		return fmt.Errorf("恢复会话阶段失败: %v", err)
+	}
+	reason := ""
+	switch {
+	case record.Phase == phases.Failed:
+		phase, reason = phases.Failed, record.Error
+	case phase == phases.Verification && (record.Phase == phases.Ready || record.Phase == phases.Computing):
+		phase = record.Phase
+	}
+	c.phases.Restore(phase, reason)
+	fmt.Printf("恢复: 会话阶段 %s\n", phase)
+
+	// 验证结果不保存，密钥已全部生成时重新验证；追加轮次未完成时等本轮完成后验证
+	if phase.Reached(phases.Verification) && len(c.pendingGaloisElements()) == 0 {
+		c.startKeyVerification()
+	}
+	return nil
+}
+
+// checkSharePhase 份额只在对应阶段接受
+// 阶段推进后重传已收到的份额（上传响应丢失后重试）返回 duplicate，调用方直接返回成功
+func (c *Coordinator) checkSharePhase(received bool, allowed ...phases.Phase) (duplicate bool, err error) {
+	if err := c.phases.Require(allowed...); err != nil {
+		if received && !c.phases.Current().Terminal() {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// startComputing 参与方提议第一个解密任务时进入 computing
+func (c *Coordinator) startComputing() {
+	c.phases.Advance(phases.Ready)
+}
+
+// requireReady 密钥验证通过之后才接受的操作
+func (c *Coordinator) requireReady() error {
+	return c.phases.Require(phases.Ready, phases.Computing)
+}
+
+// laggingDescription 阶段超时时说明在等待什么，写入失败原因
+func (c *Coordinator) laggingDescription(p phases.Phase) string {
+	km := c.KeyManager
+	var missing []int
+	switch p {
+	case phases.Registration:
+		if !c.ParameterManager.IsCRSReady() {
+			return "CRS种子协商未完成"
+		}
+		return fmt.Sprintf("已注册 %d/%d 个参与方", len(c.GetParticipants()), c.expectedN)
+	case phases.PublicKey:
+		missing = c.membersWithout(func(id int) bool {
+			return km.HasPublicKeyShare(id) && (!c.insecureDebug || km.HasSecretKey(id))
+		})
+	case phases.RelinRound1:
+		missing = c.membersWithout(func(id int) bool { return km.HasRelinearizationKeyShare(id, 1) })
+	case phases.RelinRound2:
+		missing = c.membersWithout(func(id int) bool { return km.HasRelinearizationKeyShare(id, 2) })
+	case phases.Galois:
+		pending := c.pendingGaloisElements()
+		missing = c.membersWithout(func(id int) bool {
+			for _, galEl := range pending {
+				if !km.HasGaloisKeyShare(id, galEl) {
+					return false
+				}
+			}
+			return true
+		})
+	case phases.Verification:
+		if _, verifyErr := c.GetKeyVerificationStatus(); verifyErr != "" {
+			return "密钥验证未完成: " + verifyErr
+		}
+		return "密钥验证未完成"
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("参与方 %v 未提交份额", missing)
+}
+
+// membersWithout 按升序返回不满足 done 的成员
+func (c *Coordinator) membersWithout(done func(id int) bool) []int {
+	var ids []int
+	for _, p := range c.GetParticipants() {
+		if c.ParticipantManager.IsMember(p.ID) && !done(p.ID) {
+			ids = append(ids, p.ID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// phaseStatus /setup/status 和 /status 中的阶段字段
+func (c *Coordinator) phaseStatus() gin.H {
+	state := c.phases.State()
+	status := gin.H{
+		"phase":          string(state.Phase),
+		"phase_since":    state.Since.Format(time.RFC3339),
+		"phase_deadline": "",
+		"phase_error":    state.Error,
+	}
+	if !state.Deadline.IsZero() {
+		status["phase_deadline"] = state.Deadline.Format(time.RFC3339)
+	}
+	return status
+}
+
+// phaseErrorStatus 份额上传错误的HTTP状态码：不属于当前阶段时为409
+func phaseErrorStatus(err error) int {
+	if errors.Is(err, phases.ErrOutOfPhase) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/participants"
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/relay"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// ==================== 中继 ====================
+//
+// 位于NAT或防火墙之后的参与方无法被直接访问。参与方通过 GET /sessions/{协调器ID}/relay 与协调器
+// 保持一条WebSocket长连接，其他参与方直连失败时把端到端加密的请求信封 POST 到 /relay/{目标ID}，
+// 协调器沿目标的中继连接转发并带回响应信封。协调器自己访问参与方（密钥验证、追加旋转密钥、
+// 集体密钥轮换、公钥切换份额）时同样先直连，连接不上再经中继。信封格式见 pkg/core/relay。
+
+// relayUpgrader 中继连接的WebSocket升级器，参与方不是浏览器，不发送 Origin
+var relayUpgrader = websocket.Upgrader{}
+
+// relayTransport 包装访问参与方的传输层：直连失败时经本会话的中继转发
+func (c *Coordinator) relayTransport(base http.RoundTripper) http.RoundTripper {
+	return &relay.Transport{
+		Direct:  relay.DirectTransport(base),
+		Mode:    relay.ModeAuto,
+		Lookup:  c.relayPeer,
+		PeerKey: c.relayPeerKey,
+		Forward: func(ctx context.Context, to int, sealed []byte) ([]byte, error) {
+			return c.relayHub.Forward(ctx, identity.CoordinatorID, to, sealed)
+		},
+	}
+}
+
+// relayPeer 按参与方上报的URL的主机查找参与方，多个参与方上报相同地址时不中继
+func (c *Coordinator) relayPeer(host string) (int, bool) {
+	found, matches := 0, 0
+	for _, peer := range c.GetAllParticipantURLs() {
+		if u, err := url.Parse(peer.URL); err == nil && u.Host == host {
+			found = peer.ID
+			matches++
+		}
+	}
+	return found, matches == 1
+}
+
+// relayPeerKey 参与方上报的中继公钥，上报时已核对签名
+func (c *Coordinator) relayPeerKey(id int) ([]byte, error) {
+	for _, peer := range c.GetAllParticipantURLs() {
+		if peer.ID == id && peer.RelayKey != "" {
+			return base64.StdEncoding.DecodeString(peer.RelayKey)
+		}
+	}
+	return nil, fmt.Errorf("参与方 %d 未启用中继", id)
+}
+
+// verifyRelayKey 用参与方登记的身份公钥核对其上报的中继公钥，未上报时不核对
+func (c *Coordinator) verifyRelayKey(participantID int, key participants.RelayKey) error {
+	if key.Key == "" {
+		return nil
+	}
+	pub, ok := c.ParticipantManager.GetPublicKey(participantID)
+	if !ok {
+		return fmt.Errorf("参与方 %d 不存在", participantID)
+	}
+	_, err := relay.VerifyKey(pub, participantID, key.Key, key.Signature)
+	return err
+}
+
+// relayConnectHandler 参与方建立中继连接，连接保持到参与方断开或会话关闭
+func (c *Coordinator) relayConnectHandler(ctx *gin.Context) {
+	ws, err := relayUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// 升级失败时已写出错误响应
+		return
+	}
+	c.relayHub.Serve(authenticatedID(ctx), ws)
+}
+
+// relayForwardHandler 把参与方的请求信封转发给目标参与方，返回响应信封
+func (c *Coordinator) relayForwardHandler(ctx *gin.Context) {
+	to, err := strconv.Atoi(ctx.Param("to"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的参与方ID"})
+		return
+	}
+	sealed, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+	if !c.relayHub.Connected(to) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("参与方 %d 未连接中继", to)})
+		return
+	}
+
+	out, err := c.relayHub.Forward(ctx.Request.Context(), authenticatedID(ctx), to, sealed)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Data(http.StatusOK, "application/octet-stream", out)
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/parameters"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 追加旋转密钥（额外的多方密钥生成轮次） ====================
+//
+// 初始密钥生成只覆盖参数配置档中声明的旋转。会话进行中需要新的旋转时，协调器追加
+// 伽罗瓦元素并由会话种子派生对应CRP，然后通知全部参与方在 /keys/galois/round 上
+// 生成份额；参与方照常通过 /keys/galois 上传，收齐N个份额后聚合。伽罗瓦密钥需要
+// 全部N个成员的私钥份额，因此追加轮次要求所有成员在线，尚未加入集体密钥的候选成员不参与。
+
+// RotationRoundNotice 通知参与方生成伽罗瓦密钥份额的消息
+type RotationRoundNotice struct {
+	SessionID string   `json:"session_id"`
+	Round     int      `json:"round"`
+	GalEls    []uint64 `json:"gal_els"`
+}
+
+// RotationRoundResponse 追加旋转密钥的响应
+type RotationRoundResponse struct {
+	Round    int            `json:"round"`
+	Added    []uint64       `json:"added_gal_els"`
+	Pending  []uint64       `json:"pending_gal_els"`
+	Notified []int          `json:"notified"`
+	Failed   map[int]string `json:"failed,omitempty"`
+}
+
+// AddRotationKeys 追加旋转密钥并通知参与方生成份额
+// 重复调用（包括不带新旋转的调用）会重新通知尚未完成的伽罗瓦元素，用于参与方掉线后重试
+func (c *Coordinator) AddRotationKeys(cfg parameters.GaloisConfig) (*RotationRoundResponse, error) {
+	c.rotationMu.Lock()
+	defer c.rotationMu.Unlock()
+
+	// 初始密钥验证通过后才能追加轮次
+	if err := c.requireReady(); err != nil {
+		return nil, err
+	}
+	c.keyRotationMu.Lock()
+	rotating := c.keyRotation != nil && c.keyRotation.active()
+	c.keyRotationMu.Unlock()
+	if rotating {
+		return nil, fmt.Errorf("集体密钥轮换进行中，轮换完成后再追加旋转密钥")
+	}
+
+	galEls, err := cfg.Elements(c.ParameterManager.GetCKKSParams())
+	if err != nil {
+		return nil, err
+	}
+
+	online := c.onlineMemberURLs()
+	if len(online) < c.expectedN {
+		return nil, fmt.Errorf("生成伽罗瓦密钥需要全部 %d 个参与方在线，当前 %d 个", c.expectedN, len(online))
+	}
+
+	added, round, err := c.ParameterManager.AddGaloisElements(galEls)
+	if err != nil {
+		return nil, err
+	}
+	c.unverifiedGalEls = append(c.unverifiedGalEls, added...)
+
+	resp := &RotationRoundResponse{
+		Round:    round,
+		Added:    added,
+		Pending:  c.pendingGaloisElements(),
+		Notified: []int{},
+		Failed:   make(map[int]string),
+	}
+	if len(resp.Pending) == 0 {
+		return resp, nil
+	}
+
+	notice := RotationRoundNotice{
+		SessionID: c.GetSessionID(),
+		Round:     round,
+		GalEls:    resp.Pending,
+	}
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return nil, fmt.Errorf("序列化通知失败: %v", err)
+	}
+
+	ids := make([]int, 0, len(online))
+	for id := range online {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if err := c.notifyRotationRound(online[id], body); err != nil {
+			fmt.Printf("[警告] 通知参与方 %d 生成伽罗瓦密钥份额失败: %v\n", id, err)
+			resp.Failed[id] = err.Error()
+			continue
+		}
+		resp.Notified = append(resp.Notified, id)
+	}
+	fmt.Printf("伽罗瓦密钥第 %d 轮：已通知 %d 个参与方生成 %d 个伽罗瓦元素的份额\n", round, len(resp.Notified), len(resp.Pending))
+	return resp, nil
+}
+
+// notifyRotationRound 通知单个参与方，参与方接受后在后台生成并上传份额
+func (c *Coordinator) notifyRotationRound(peerURL string, body []byte) error {
+	resp, err := c.signedPost(peerURL+"/keys/galois/round", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pendingGaloisElements 返回尚未聚合出密钥的伽罗瓦元素
+func (c *Coordinator) pendingGaloisElements() []uint64 {
+	pending := make([]uint64, 0)
+	for _, galEl := range c.ParameterManager.GetGalEls() {
+		if !c.KeyManager.HasGaloisKey(galEl) {
+			pending = append(pending, galEl)
+		}
+	}
+	return pending
+}
+
+// checkRotationRound 追加轮次的密钥全部聚合后，在后台验证新增的伽罗瓦密钥
+func (c *Coordinator) checkRotationRound() {
+	if len(c.pendingGaloisElements()) > 0 {
+		return
+	}
+
+	c.rotationMu.Lock()
+	galEls := c.unverifiedGalEls
+	c.unverifiedGalEls = nil
+	c.rotationMu.Unlock()
+	if len(galEls) == 0 {
+		return
+	}
+
+	round := c.ParameterManager.GetGaloisRound()
+	fmt.Printf("\n 伽罗瓦密钥第 %d 轮生成完成，开始验证 %d 个新增密钥...\n", round, len(galEls))
+	c.goBackground(func() {
+		if err := c.KeyTester.TestGaloisKeysOnly(c.ParameterManager.GetCKKSParams(), galEls); err != nil {
+			fmt.Printf(" 第 %d 轮伽罗瓦密钥验证失败: %v\n", round, err)
+			return
+		}
+		fmt.Printf(" 第 %d 轮伽罗瓦密钥验证通过\n", round)
+	})
+}
+
+// addRotationKeysHandler 成员追加旋转密钥处理器（需签名）
+func (c *Coordinator) addRotationKeysHandler(ctx *gin.Context) {
+	var req parameters.GaloisConfig
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 每个成员都要生成并上传份额，只接受成员的请求
+	if err := c.checkMember(authenticatedID(ctx)); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.AddRotationKeys(req)
+	if err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// AddRotationKeysHandler 控制面提议追加旋转密钥接口，参与方批准后通知参与方生成份额
+func AddRotationKeysHandler(ctx *gin.Context) {
+	var req parameters.GaloisConfig
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c := coordinatorOf(ctx)
+	if _, err := req.Elements(c.ParameterManager.GetCKKSParams()); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := c.TaskManager.ProposeGalois(req)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, task)
+}
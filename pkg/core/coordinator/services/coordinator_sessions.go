@@ -0,0 +1,268 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/server"
+	"MPHEDev/pkg/core/coordinator/store"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 多会话管理 ====================
+//
+// 一个协调器服务可同时运行多个会话，每个会话有独立的参与方、参数和密钥管理器，以初始化时返回的
+// 协调器ID为键。参与方接口共用8080端口，路径为 /sessions/{协调器ID}/...；控制面接口为
+// /api/coordinator/sessions/{协调器ID}/...，只有一个会话时原来的 /api/coordinator/... 接口作用于该会话。
+// 各会话的状态写入同一存储中 sessions/{协调器ID}/ 前缀下，重启后逐个恢复。
+
+// sessionServerPort 各会话共用的参与方接口端口
+const sessionServerPort = 8080
+
+// sessionStorePrefix 会话状态在状态存储中的前缀
+const sessionStorePrefix = "sessions"
+
+// coordinatorKey gin上下文中控制面请求所操作的会话
+const coordinatorKey = "coordinator"
+
+var (
+	sessionsMu sync.RWMutex
+	sessions   = make(map[string]*Coordinator)
+
+	// sessionServer 各会话共用的HTTP服务器，第一个会话创建时启动
+	sessionServer     *server.HTTPServer
+	sessionServerOnce sync.Once
+)
+
+// SessionSummary 会话列表中的一项
+type SessionSummary struct {
+	CoordinatorID          string `json:"coordinator_id"`
+	SessionID              string `json:"session_id"`
+	SessionURL             string `json:"session_url"`
+	ParamProfile           string `json:"param_profile"`
+	ExpectedParticipants   int    `json:"expected_participants"`
+	Threshold              int    `json:"threshold"`
+	RegisteredParticipants int    `json:"registered_participants"`
+	OnlineParticipants     int    `json:"online_participants"`
+	KeyEpoch               int    `json:"key_epoch"`
+	Phase                  string `json:"phase"`
+	KeyVerification        string `json:"key_verification"`
+	CreatedAt              string `json:"created_at"`
+}
+
+// getSessionServer 返回各会话共用的HTTP服务器，第一次调用时创建并启动
+func getSessionServer() *server.HTTPServer {
+	sessionServerOnce.Do(func() {
+		sessionServer = server.NewHTTPServer(strconv.Itoa(sessionServerPort), tlsConfig)
+		go func() {
+			if err := sessionServer.Start(); err != nil {
+				fmt.Printf("协调器HTTP服务器错误: %v\n", err)
+			}
+		}()
+	})
+	return sessionServer
+}
+
+// sessionStore 返回会话在状态存储中的视图，未配置状态存储时返回 nil
+func sessionStore(id string) (store.Store, error) {
+	if stateStore == nil {
+		return nil, nil
+	}
+	return store.WithPrefix(stateStore, sessionStorePrefix+"/"+id)
+}
+
+// addSession 登记会话并开始接受参与方请求
+func addSession(c *Coordinator) {
+	sessionsMu.Lock()
+	sessions[c.GetID()] = c
+	sessionsMu.Unlock()
+	c.Start()
+}
+
+// getSession 按协调器ID查找会话
+func getSession(id string) (*Coordinator, bool) {
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+	c, ok := sessions[id]
+	return c, ok
+}
+
+// listSessions 按创建时间返回全部会话
+func listSessions() []*Coordinator {
+	sessionsMu.RLock()
+	list := make([]*Coordinator, 0, len(sessions))
+	for _, c := range sessions {
+		list = append(list, c)
+	}
+	sessionsMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].createdAt.Before(list[j].createdAt) })
+	return list
+}
+
+// removeSession 注销会话，返回被移除的会话
+func removeSession(id string) (*Coordinator, bool) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	c, ok := sessions[id]
+	delete(sessions, id)
+	return c, ok
+}
+
+// RecoverCoordinator 从状态存储恢复上一次运行的全部会话并启动，返回恢复的会话数
+func RecoverCoordinator() (int, error) {
+	if stateStore == nil {
+		return 0, nil
+	}
+	keys, err := stateStore.List(sessionStorePrefix + "/")
+	if err != nil {
+		return 0, err
+	}
+	recovered := 0
+	var errs []string
+	for _, key := range keys {
+		// 每个会话有一条 sessions/{协调器ID}/session 记录
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 || parts[2] != sessionStoreKey {
+			continue
+		}
+		id := parts[1]
+		s, err := sessionStore(id)
+		if err != nil {
+			return recovered, err
+		}
+		coordinator, err := RestoreCoordinator(s, id, getSessionServer(), tlsConfig, stateDir)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		if coordinator == nil {
+			continue
+		}
+		addSession(coordinator)
+		recovered++
+	}
+	if len(errs) > 0 {
+		return recovered, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return recovered, nil
+}
+
+// ShutdownCoordinator 优雅关闭全部会话和共用的HTTP服务器，会话状态保留在存储中供重启后恢复
+func ShutdownCoordinator(ctx context.Context) error {
+	var shutdownErr error
+	for _, c := range listSessions() {
+		removeSession(c.GetID())
+		if err := c.Shutdown(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = fmt.Errorf("关闭会话 %s 失败: %v", c.GetID(), err)
+		}
+	}
+	if sessionServer != nil {
+		if err := sessionServer.Stop(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = fmt.Errorf("关闭HTTP服务器失败: %v", err)
+		}
+	}
+	return shutdownErr
+}
+
+// ==================== 控制面会话解析 ====================
+
+// RequireCoordinator Gin 中间件，确定控制面请求所操作的会话
+// 路径带 :session 参数时按协调器ID查找，否则要求当前只有一个会话
+func RequireCoordinator() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var c *Coordinator
+		if id := ctx.Param("session"); id != "" {
+			found, ok := getSession(id)
+			if !ok {
+				ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+				return
+			}
+			c = found
+		} else {
+			list := listSessions()
+			switch len(list) {
+			case 0:
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Coordinator not initialized"})
+				return
+			case 1:
+				c = list[0]
+			default:
+				ctx.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "存在多个会话，请通过 /api/coordinator/sessions/{coordinator_id}/... 指定会话",
+				})
+				return
+			}
+		}
+		ctx.Set(coordinatorKey, c)
+		ctx.Next()
+	}
+}
+
+// coordinatorOf 返回 RequireCoordinator 确定的会话
+func coordinatorOf(ctx *gin.Context) *Coordinator {
+	return ctx.MustGet(coordinatorKey).(*Coordinator)
+}
+
+// ==================== 会话管理接口 ====================
+
+// summary 会话列表中的摘要
+func (c *Coordinator) summary() SessionSummary {
+	keyVerification, _ := c.GetKeyVerificationStatus()
+	return SessionSummary{
+		CoordinatorID:          c.id,
+		SessionID:              c.GetSessionID(),
+		SessionURL:             c.GetSessionURL(),
+		ParamProfile:           c.ParameterManager.GetProfileName(),
+		ExpectedParticipants:   c.ParticipantManager.GetExpectedN(),
+		Threshold:              c.threshold,
+		RegisteredParticipants: len(c.GetParticipants()),
+		OnlineParticipants:     len(c.GetOnlineParticipants()),
+		KeyEpoch:               c.ParameterManager.GetKeyEpoch(),
+		Phase:                  string(c.phases.Current()),
+		KeyVerification:        keyVerification,
+		CreatedAt:              c.createdAt.Format(time.RFC3339),
+	}
+}
+
+// ListSessionsHandler 列出全部会话
+func ListSessionsHandler(ctx *gin.Context) {
+	list := listSessions()
+	summaries := make([]SessionSummary, 0, len(list))
+	for _, c := range list {
+		summaries = append(summaries, c.summary())
+	}
+	ctx.JSON(http.StatusOK, gin.H{"sessions": summaries})
+}
+
+// GetSessionHandler 查看单个会话的详细状态，与该会话的 /status 接口相同
+func GetSessionHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getCoordinatorStatusHandler(ctx)
+}
+
+// CloseSessionHandler 关闭会话：等待处理中的请求完成、保存状态快照，并从状态存储中删除该会话
+func CloseSessionHandler(ctx *gin.Context) {
+	c, ok := removeSession(ctx.Param("session"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := c.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("[警告] 关闭会话 %s 失败: %v\n", c.GetID(), err)
+	}
+	// 关闭的会话不再恢复
+	if c.store != nil {
+		if err := c.store.Reset(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("清空会话状态失败: %v", err)})
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"coordinator_id": c.GetID(), "status": "closed"})
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/parameters"
+	"MPHEDev/pkg/core/coordinator/phases"
+	"MPHEDev/pkg/core/coordinator/server"
+	"MPHEDev/pkg/core/coordinator/store"
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/pki"
+	"fmt"
+)
+
+// ==================== 会话状态持久化与恢复 ====================
+//
+// 会话配置、协调器签名身份、会话参数、参与方登记信息、全部密钥份额和聚合结果
+// 以及结果接收方和解密任务都写入状态存储，参与方登记信息包括成员和成员纪元。协调器重启后按同一会话ID和CRS种子重建参数，
+// 恢复份额和聚合结果，再把份额已收齐但尚未聚合的阶段聚合完，参与方从停下来的阶段继续上传即可。
+// 会话阶段由已聚合的密钥推出，ready/computing/failed 取保存的阶段。
+// 密钥验证状态和防重放的随机数记录不保存，恢复后重新验证密钥。
+
+// sessionStoreKey 会话配置在状态存储中的键
+const sessionStoreKey = "session"
+
+// sessionRecord 重建协调器所需的会话配置
+type sessionRecord struct {
+	ExpectedN       int
+	Threshold       int
+	DataSplitType   string
+	InsecureDebug   bool
+	CRSContribution bool
+	Profile         *parameters.Profile
+	// DecryptApprovals 会话初始的解密授权策略，之后修改的策略单独保存
+	DecryptApprovals int
+	// RotateAfterDecryptions 每批准多少个解密任务后轮换集体密钥
+	RotateAfterDecryptions int
+	// PhaseTimeouts 各会话阶段的超时
+	PhaseTimeouts phases.Timeouts
+	// IdentitySeed 协调器签名身份的私钥种子，恢复后参与方仍能验证协调器的请求
+	IdentitySeed []byte
+}
+
+// initStore 保存会话配置并让各管理器把之后的状态写入存储
+func (c *Coordinator) initStore(s store.Store, cfg Config) error {
+	record := sessionRecord{
+		ExpectedN:        cfg.ExpectedN,
+		Threshold:        cfg.Threshold,
+		DataSplitType:    cfg.DataSplitType,
+		InsecureDebug:    cfg.InsecureDebug,
+		CRSContribution:  cfg.CRSContribution,
+		Profile:          c.ParameterManager.GetProfile(),
+		DecryptApprovals: cfg.DecryptApprovals,
+		IdentitySeed:     c.identity.Seed(),
+
+		RotateAfterDecryptions: cfg.RotateAfterDecryptions,
+		PhaseTimeouts:          c.phases.Timeouts(),
+	}
+	if err := store.PutGob(s, sessionStoreKey, record); err != nil {
+		return fmt.Errorf("保存会话配置失败: %v", err)
+	}
+	return c.attachStore(s)
+}
+
+// attachStore 为参数、参与方和密钥管理器设置状态存储
+func (c *Coordinator) attachStore(s store.Store) error {
+	c.store = s
+	if err := c.ParameterManager.SetStore(s); err != nil {
+		return err
+	}
+	c.ParticipantManager.SetStore(s)
+	c.KeyManager.SetStore(s)
+	c.ConsumerManager.SetStore(s)
+	c.TaskManager.SetStore(s)
+	return nil
+}
+
+// RestoreCoordinator 从会话的状态存储恢复协调器ID为 id 的会话，存储中没有会话时返回 nil
+func RestoreCoordinator(s store.Store, id string, srv *server.HTTPServer, tlsConfig *pki.Config, stateDir string) (*Coordinator, error) {
+	var record sessionRecord
+	ok, err := store.GetGob(s, sessionStoreKey, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	snapshot, err := parameters.LoadSnapshot(s)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("状态存储中缺少会话参数")
+	}
+	coordinatorIdentity, err := identity.FromSeed(record.IdentitySeed)
+	if err != nil {
+		return nil, fmt.Errorf("恢复协调器签名身份失败: %v", err)
+	}
+
+	fmt.Printf("正在恢复会话 %s ...\n", snapshot.SessionID)
+	c, err := newCoordinator(Config{
+		ExpectedN:        record.ExpectedN,
+		Threshold:        record.Threshold,
+		DataSplitType:    record.DataSplitType,
+		InsecureDebug:    record.InsecureDebug,
+		CRSContribution:  record.CRSContribution,
+		Profile:          record.Profile,
+		DecryptApprovals: record.DecryptApprovals,
+		TLS:              tlsConfig,
+		Encoding:         wireEncoding,
+		StateDir:         stateDir,
+
+		RotateAfterDecryptions: record.RotateAfterDecryptions,
+		PhaseTimeouts:          record.PhaseTimeouts,
+		ID:                     id,
+		Server:                 srv,
+	}, snapshot, coordinatorIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.attachStore(s); err != nil {
+		return nil, err
+	}
+	if _, err := c.ParticipantManager.Restore(); err != nil {
+		return nil, fmt.Errorf("恢复参与方登记信息失败: %v", err)
+	}
+	if err := c.KeyManager.Restore(); err != nil {
+		return nil, fmt.Errorf("恢复密钥状态失败: %v", err)
+	}
+	if err := c.ConsumerManager.Restore(); err != nil {
+		return nil, fmt.Errorf("恢复结果接收方失败: %v", err)
+	}
+	if err := c.TaskManager.Restore(); err != nil {
+		return nil, fmt.Errorf("恢复解密任务失败: %v", err)
+	}
+	if err := c.restoreKeyRotation(); err != nil {
+		return nil, fmt.Errorf("恢复密钥轮换状态失败: %v", err)
+	}
+	// 加入过新成员的会话按成员数量收集份额
+	c.restoreMembership()
+	if err := c.resumeKeyGeneration(); err != nil {
+		return nil, err
+	}
+	if err := c.restorePhase(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("会话 %s 已恢复\n", c.GetSessionID())
+	return c, nil
+}
+
+// resumeKeyGeneration 聚合份额已收齐但在重启前尚未聚合的阶段
+func (c *Coordinator) resumeKeyGeneration() error {
+	km := c.KeyManager
+	n := c.expectedN
+
+	if km.GetGlobalPK() == nil && len(km.GetPublicKeyShares()) == n {
+		fmt.Println("恢复: 聚合公钥...")
+		if err := c.KeyAggregator.AggregatePublicKey(c.ParameterManager.GetGlobalCRP()); err != nil {
+			return fmt.Errorf("公钥聚合失败: %v", err)
+		}
+		c.initMembership()
+	}
+	if c.insecureDebug && km.GetAggregatedSecretKey() == nil && len(km.GetSecretKeyShares()) == n {
+		fmt.Println("恢复: 聚合私钥...")
+		if err := c.KeyAggregator.AggregateSecretKey(); err != nil {
+			return fmt.Errorf("私钥聚合失败: %v", err)
+		}
+	}
+	if km.GetRelinearizationShare1Aggregated() == nil && len(km.GetRelinearizationShare1Map()) == n {
+		fmt.Println("恢复: 聚合重线性化密钥第一轮...")
+		if err := c.KeyAggregator.AggregateRelinearizationKeyRound1(); err != nil {
+			return fmt.Errorf("重线性化密钥第一轮聚合失败: %v", err)
+		}
+	}
+	if km.GetRelinearizationKey() == nil && km.GetRelinearizationShare1Aggregated() != nil &&
+		len(km.GetRelinearizationShare2Map()) == n {
+		fmt.Println("恢复: 聚合重线性化密钥第二轮...")
+		if err := c.KeyAggregator.AggregateRelinearizationKeyRound2(); err != nil {
+			return fmt.Errorf("重线性化密钥第二轮聚合失败: %v", err)
+		}
+	}
+
+	// 追加轮次中尚未聚合的伽罗瓦元素在本轮完成后重新验证
+	if c.ParameterManager.GetGaloisRound() > 0 {
+		c.unverifiedGalEls = c.pendingGaloisElements()
+	}
+	for galEl, shares := range km.GetGaloisKeyShares() {
+		if len(shares) != n || km.HasGaloisKey(galEl) {
+			continue
+		}
+		galoisCRP, ok := c.ParameterManager.GetGaloisCRP(galEl)
+		if !ok {
+			return fmt.Errorf("伽罗瓦元素 %d 不在本会话的密钥列表中", galEl)
+		}
+		fmt.Printf("恢复: 聚合伽罗瓦密钥 (galEl: %d)...\n", galEl)
+		if err := c.KeyAggregator.AggregateGaloisKey(galEl, galoisCRP); err != nil {
+			return fmt.Errorf("伽罗瓦密钥聚合失败 (galEl: %d): %v", galEl, err)
+		}
+	}
+
+	// 全部密钥完成时统一验证，已包含追加轮次的伽罗瓦密钥
+	if len(c.pendingGaloisElements()) == 0 {
+		c.unverifiedGalEls = nil
+	}
+	return nil
+}
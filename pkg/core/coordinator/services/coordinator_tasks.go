@@ -0,0 +1,231 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/tasks"
+	"MPHEDev/pkg/core/coordinator/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// ==================== 解密任务授权 ====================
+//
+// 参与方只为已批准的任务提供解密/公钥切换份额。参与方通过 /tasks 提议任务并表决，
+// 收到份额请求时通过 GET /tasks/:id 核对任务状态和密文哈希。协调器验证密钥时
+// 把自己生成的测试密文登记为 key_verification 计算的输出，任务随即自动批准。
+// 参与方的任务每批准一个计入当前密钥纪元的解密次数，达到策略上限后轮换集体密钥，见 coordinator_key_rotation.go。
+// 控制面修改授权策略、登记计算输出、加入成员、手动轮换密钥和追加旋转密钥只是提议变更，参与方通过同一表决接口批准后才生效（见 applyChange）。
+
+// keyVerificationComputation 密钥验证测试密文所属的计算
+const keyVerificationComputation = "key_verification"
+
+// ProposeTaskRequest 提议解密任务的请求
+type ProposeTaskRequest struct {
+	ParticipantID  int    `json:"participant_id"`
+	Kind           string `json:"kind"` // decrypt/reencrypt
+	Purpose        string `json:"purpose"`
+	CiphertextHash string `json:"ciphertext_hash"` // 密文二进制编码的SHA-256（十六进制）
+	ConsumerID     string `json:"consumer_id,omitempty"`
+}
+
+// VoteTaskRequest 表决解密任务的请求
+type VoteTaskRequest struct {
+	ParticipantID int  `json:"participant_id"`
+	Approve       bool `json:"approve"`
+}
+
+// RegisterOutputsRequest 登记计算输出的请求
+type RegisterOutputsRequest struct {
+	Computation      string   `json:"computation"`
+	CiphertextHashes []string `json:"ciphertext_hashes"`
+}
+
+// proposeOwnTask 协调器为自己生成的密文创建任务，密文登记为指定计算的输出后自动批准
+func (c *Coordinator) proposeOwnTask(computation, kind, purpose string, ct *rlwe.Ciphertext) (*tasks.Task, error) {
+	hash, err := utils.CiphertextHash(ct)
+	if err != nil {
+		return nil, fmt.Errorf("计算密文哈希失败: %v", err)
+	}
+	if err := c.TaskManager.RegisterOutputs(computation, []string{hash}); err != nil {
+		return nil, err
+	}
+	return c.TaskManager.Propose(kind, purpose, hash, "", "", tasks.ProposerCoordinator)
+}
+
+// ==================== 任务相关处理器 ====================
+
+// proposeTaskHandler 参与方提议解密任务
+func (c *Coordinator) proposeTaskHandler(ctx *gin.Context) {
+	var req ProposeTaskRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 公钥切换任务记录接收方公钥的指纹，表决方批准的是这把公钥
+	var consumerKey string
+	if req.Kind == tasks.KindReencrypt {
+		consumer, ok := c.ConsumerManager.Get(req.ConsumerID)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("接收方 %s 不存在", req.ConsumerID)})
+			return
+		}
+		fingerprint, err := c.consumerKeyFingerprint(consumer)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		consumerKey = fingerprint.Hex()
+	}
+	// 只有持有私钥份额的成员可以提议和批准任务
+	if err := c.checkMember(authenticatedID(ctx)); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	// 密钥验证通过之前不接受任务
+	if err := c.requireReady(); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	// 密钥轮换进行中或达到轮换前的解密次数上限时不接受新任务
+	if err := c.checkDecryptionBudget(); err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := c.TaskManager.Propose(req.Kind, req.Purpose, req.CiphertextHash, req.ConsumerID, consumerKey, authenticatedID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.recordDecryption(task)
+	c.startComputing()
+	ctx.JSON(http.StatusOK, task)
+}
+
+// voteTaskHandler 参与方批准或拒绝解密任务
+func (c *Coordinator) voteTaskHandler(ctx *gin.Context) {
+	var req VoteTaskRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.checkMember(authenticatedID(ctx)); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	current, ok := c.TaskManager.Get(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	if req.Approve && !current.IsChange() {
+		if err := c.checkDecryptionBudget(); err != nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	task, err := c.TaskManager.Vote(current.ID, authenticatedID(ctx), req.Approve)
+	if err != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if task.IsChange() {
+		if err := c.applyChange(task); err != nil {
+			ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("变更已批准但未能生效: %v", err)})
+			return
+		}
+	} else {
+		c.recordDecryption(task)
+	}
+	ctx.JSON(http.StatusOK, task)
+}
+
+// applyChange 变更获得批准后生效，每个变更只会被批准一次
+func (c *Coordinator) applyChange(task *tasks.Task) error {
+	if task.Status != tasks.StatusApproved {
+		return nil
+	}
+	fmt.Printf("变更 %s 已由参与方 %v 批准\n", task.ID, task.Approvals)
+	switch task.Kind {
+	case tasks.KindPolicy:
+		_, err := c.TaskManager.SetPolicy(*task.Policy)
+		return err
+	case tasks.KindOutputs:
+		return c.TaskManager.RegisterOutputs(task.Computation, task.CiphertextHashes)
+	case tasks.KindMembers:
+		_, err := c.AddMembers(task.ParticipantIDs)
+		return err
+	case tasks.KindRotation:
+		_, err := c.StartKeyRotation(task.Purpose)
+		return err
+	case tasks.KindGalois:
+		_, err := c.AddRotationKeys(*task.Galois)
+		return err
+	default:
+		return fmt.Errorf("未知的变更类型: %s", task.Kind)
+	}
+}
+
+// getTaskHandler 查询解密任务，参与方据此决定是否提供份额
+func (c *Coordinator) getTaskHandler(ctx *gin.Context) {
+	task, ok := c.TaskManager.Get(ctx.Param("id"))
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	ctx.JSON(http.StatusOK, task)
+}
+
+// listTasksHandler 列出解密任务，可按 status 过滤
+func (c *Coordinator) listTasksHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"policy": c.TaskManager.GetPolicy(),
+		"tasks":  c.TaskManager.List(ctx.Query("status")),
+	})
+}
+
+// getPolicyHandler 查询当前授权策略，参与方据此决定是否同意
+func (c *Coordinator) getPolicyHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.TaskManager.GetPolicy())
+}
+
+// ListTasksHandler 控制面列出解密任务接口
+func ListTasksHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).listTasksHandler(ctx)
+}
+
+// GetPolicyHandler 控制面获取授权策略接口
+func GetPolicyHandler(ctx *gin.Context) {
+	coordinatorOf(ctx).getPolicyHandler(ctx)
+}
+
+// SetPolicyHandler 控制面提议修改授权策略接口，参与方批准后生效
+func SetPolicyHandler(ctx *gin.Context) {
+	var policy tasks.Policy
+	if err := ctx.ShouldBindJSON(&policy); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := coordinatorOf(ctx).TaskManager.ProposePolicy(policy)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, task)
+}
+
+// RegisterOutputsHandler 控制面提议登记计算输出接口，参与方批准后这些密文的解密任务自动批准
+func RegisterOutputsHandler(ctx *gin.Context) {
+	var req RegisterOutputsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	task, err := coordinatorOf(ctx).TaskManager.ProposeOutputs(req.Computation, req.CiphertextHashes)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, task)
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/coordinator/phases"
+	"MPHEDev/pkg/core/coordinator/tasks"
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/smudging"
+	"MPHEDev/pkg/core/wire"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// 密钥验证状态
+const (
+	verifyStatusPending = "pending"
+	verifyStatusRunning = "running"
+	verifyStatusPassed  = "passed"
+	verifyStatusFailed  = "failed"
+)
+
+// 密钥验证重试配置：参与方可能仍在交换门限份额，暂时无法提供解密份额
+const (
+	verifyMaxAttempts   = 10
+	verifyRetryInterval = 10 * time.Second
+)
+
+// ==================== 协同解密（密钥验证） ====================
+
+// CollaborativeDecrypt 组织参与方对密文进行协同解密
+// 协调器不持有私钥：向活跃参与方的 /partial_decrypt 请求解密份额（目标密钥为零），
+// 聚合后做密钥切换得到明文。非门限模式需要全部N个参与方，门限模式下选取t个在线参与方
+// 测试密文由协调器生成，登记为密钥验证计算的输出，对应的解密任务自动批准
+func (c *Coordinator) CollaborativeDecrypt(ct *rlwe.Ciphertext) (*rlwe.Plaintext, error) {
+	est, err := c.keySwitchNoise(ct)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("协同解密淹没噪声: %s\n", est)
+	ctData, err := envelope.SealCiphertext(c.ParameterManager.GetCKKSParams(), c.KeyManager.GlobalPKFingerprint(), ct)
+	if err != nil {
+		return nil, fmt.Errorf("密文序列化失败: %v", err)
+	}
+	task, err := c.proposeOwnTask(keyVerificationComputation, tasks.KindDecrypt, "密钥验证", ct)
+	if err != nil {
+		return nil, err
+	}
+	taskID := task.ID
+
+	online := c.onlineMemberURLs()
+
+	failed := make(map[int]bool)
+	for {
+		active, err := c.selectActiveParticipants(online, failed)
+		if err != nil {
+			return nil, err
+		}
+
+		shares, failedPeers := c.requestDecryptShares(active, online, ctData, taskID, ct.Level())
+		if len(failedPeers) == 0 {
+			return c.finalizeDecryption(ct, shares)
+		}
+		for _, id := range failedPeers {
+			failed[id] = true
+		}
+		// 非门限模式下任何一个参与方失败都无法完成解密
+		if !c.ParticipantManager.IsThresholdMode() {
+			return nil, fmt.Errorf("参与方 %v 未能提供解密份额", failedPeers)
+		}
+		fmt.Printf("参与方 %v 未能提供解密份额，重新选择活跃集合\n", failedPeers)
+	}
+}
+
+// selectActiveParticipants 按ID升序选出本次协同解密的活跃集合
+func (c *Coordinator) selectActiveParticipants(online map[int]string, exclude map[int]bool) ([]int, error) {
+	required := c.expectedN
+	if c.ParticipantManager.IsThresholdMode() {
+		required = c.threshold
+	}
+
+	candidates := make([]int, 0, len(online))
+	for id := range online {
+		if !exclude[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Ints(candidates)
+
+	if len(candidates) < required {
+		return nil, fmt.Errorf("在线参与方不足: 需要 %d 个，当前可用 %d 个", required, len(candidates))
+	}
+	return candidates[:required], nil
+}
+
+// requestDecryptShares 并发向活跃集合请求解密份额，返回成功的份额和失败的参与方
+// 份额须绑定集体公钥且层级为密文的层级 level
+func (c *Coordinator) requestDecryptShares(active []int, online map[int]string, ctData []byte, taskID string, level int) ([]multiparty.KeySwitchShare, []int) {
+	params, key := c.ParameterManager.GetCKKSParams(), c.KeyManager.GlobalPKFingerprint()
+	type peerResp struct {
+		PeerID int
+		Share  multiparty.KeySwitchShare
+		Err    error
+	}
+	results := make(chan peerResp, len(active))
+
+	control := gin.H{
+		"task_id":      taskID,
+		"participants": active,
+	}
+	for _, peerID := range active {
+		go func(peerID int, peerURL string) {
+			data, err := c.requestShare(peerURL+"/partial_decrypt", control, ctData)
+			if err != nil {
+				results <- peerResp{PeerID: peerID, Err: err}
+				return
+			}
+			share, err := envelope.OpenKeySwitchShare(params, key, level, data)
+			if err != nil {
+				results <- peerResp{PeerID: peerID, Err: fmt.Errorf("份额校验失败: %v", err)}
+				return
+			}
+			results <- peerResp{PeerID: peerID, Share: share}
+		}(peerID, online[peerID])
+	}
+
+	shares := make([]multiparty.KeySwitchShare, 0, len(active))
+	var failedPeers []int
+	for range active {
+		res := <-results
+		if res.Err != nil {
+			fmt.Printf("[警告] 获取参与方 %d 解密份额失败: %v\n", res.PeerID, res.Err)
+			failedPeers = append(failedPeers, res.PeerID)
+			continue
+		}
+		shares = append(shares, res.Share)
+	}
+	return shares, failedPeers
+}
+
+// requestShare 向参与方发送帧格式的份额请求，返回响应中唯一的份额信封
+func (c *Coordinator) requestShare(url string, control interface{}, objects ...[]byte) ([]byte, error) {
+	resp, err := c.signedPostMessage(url, control, objects...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	objects, err = wire.ReadResponse(resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("响应包含 %d 个对象，应为1个", len(objects))
+	}
+	return objects[0], nil
+}
+
+// keySwitchNoise 按会话的噪声淹没配置计算密文ct的淹没噪声
+// 参与方按同样的规则计算并校验，达不到统计安全要求或超出密文模数时拒绝解密
+func (c *Coordinator) keySwitchNoise(ct *rlwe.Ciphertext) (smudging.Estimate, error) {
+	est, err := smudging.ForKeySwitch(c.ParameterManager.GetCKKSParams(), c.ParameterManager.GetSmudgingConfig(), ct, c.expectedN)
+	if err != nil {
+		return est, fmt.Errorf("拒绝解密: %v", err)
+	}
+	return est, nil
+}
+
+// finalizeDecryption 聚合解密份额并输出明文
+func (c *Coordinator) finalizeDecryption(ct *rlwe.Ciphertext, shares []multiparty.KeySwitchShare) (*rlwe.Plaintext, error) {
+	params := c.ParameterManager.GetCKKSParams()
+	est, err := c.keySwitchNoise(ct)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := multiparty.NewKeySwitchProtocol(params, est.Distribution())
+	if err != nil {
+		return nil, err
+	}
+
+	level := ct.Level()
+	agg := proto.AllocateShare(level)
+	for i := range shares {
+		if err := proto.AggregateShares(shares[i], agg, &agg); err != nil {
+			return nil, fmt.Errorf("聚合解密份额失败: %v", err)
+		}
+	}
+
+	resultCT := rlwe.NewCiphertext(params, 1, level)
+	*resultCT.MetaData = *ct.MetaData
+	proto.KeySwitch(ct, agg, resultCT)
+
+	pt := ckks.NewPlaintext(params, level)
+	pt.Value.CopyLvl(level, resultCT.Value[0])
+	pt.Scale = resultCT.Scale
+	pt.IsNTT = resultCT.IsNTT
+	return pt, nil
+}
+
+// ==================== 密钥验证状态 ====================
+
+// startKeyVerification 后台异步验证所有密钥，只会启动一次
+func (c *Coordinator) startKeyVerification() {
+	c.verifyMu.Lock()
+	if c.verifyStatus != verifyStatusPending {
+		c.verifyMu.Unlock()
+		return
+	}
+	c.verifyStatus = verifyStatusRunning
+	c.verifyMu.Unlock()
+
+	c.goBackground(func() {
+		var err error
+		for attempt := 1; attempt <= verifyMaxAttempts; attempt++ {
+			if err = c.TestAllKeys(); err == nil {
+				break
+			}
+			fmt.Printf(" 密钥验证失败 (第%d次): %v\n", attempt, err)
+			if attempt < verifyMaxAttempts && !c.sleepOrDone(verifyRetryInterval) {
+				err = fmt.Errorf("协调器关闭，密钥验证中止: %v", err)
+				break
+			}
+		}
+
+		c.verifyMu.Lock()
+		if err != nil {
+			c.verifyStatus = verifyStatusFailed
+			c.verifyError = err.Error()
+		} else {
+			c.verifyStatus = verifyStatusPassed
+			c.verifyError = ""
+		}
+		c.verifyMu.Unlock()
+
+		// 只有初始密钥的验证推进会话阶段，集体密钥轮换后的重新验证不改变阶段
+		// 阶段变化钩子会读取验证状态，不能持有 verifyMu
+		if err != nil {
+			fmt.Printf(" 最终密钥测试失败: %v\n", err)
+			if c.phases.Current() == phases.Verification {
+				c.phases.Fail("密钥验证失败: " + err.Error())
+			}
+			return
+		}
+		fmt.Println(" 所有密钥测试通过！系统准备就绪。")
+		c.phases.Advance(phases.Verification)
+	})
+}
+
+// GetKeyVerificationStatus 获取密钥验证状态和错误信息
+func (c *Coordinator) GetKeyVerificationStatus() (string, string) {
+	c.verifyMu.Lock()
+	defer c.verifyMu.Unlock()
+	return c.verifyStatus, c.verifyError
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// valueSuffix 值文件扩展名，目录中其他文件（如写入中的临时文件）被忽略
+const valueSuffix = ".gob"
+
+// FileStore 基于目录的存储，每个键对应一个文件
+// 写入先写临时文件并同步到磁盘，再原子重命名，崩溃时不会留下写了一半的值
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore 打开（不存在时创建）目录存储
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建状态目录失败: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Dir 存储目录
+func (f *FileStore) Dir() string {
+	return f.dir
+}
+
+// path 键对应的文件路径
+func (f *FileStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key)+valueSuffix)
+}
+
+// Put 写入键值
+func (f *FileStore) Put(key string, value []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入 %s 失败: %v", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("同步 %s 失败: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", key, err)
+	}
+	return nil
+}
+
+// Get 读取键值
+func (f *FileStore) Get(key string) ([]byte, bool, error) {
+	if err := validKey(key); err != nil {
+		return nil, false, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data, err := os.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("读取 %s 失败: %v", key, err)
+	}
+	return data, true, nil
+}
+
+// List 列出指定前缀下的所有键
+func (f *FileStore) List(prefix string) ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	keys := make([]string, 0)
+	err := filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, valueSuffix) || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(filepath.ToSlash(rel), valueSuffix)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出状态失败: %v", err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete 删除键
+func (f *FileStore) Delete(key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(f.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除 %s 失败: %v", key, err)
+	}
+	return nil
+}
+
+// Reset 清空全部状态
+func (f *FileStore) Reset() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return fmt.Errorf("读取状态目录失败: %v", err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(f.dir, entry.Name())); err != nil {
+			return fmt.Errorf("清空状态目录失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close 关闭存储
+func (f *FileStore) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+// prefixStore 底层存储中某个前缀下的视图，多个会话共用一个存储时各自使用不同前缀
+type prefixStore struct {
+	s      Store
+	prefix string
+}
+
+// WithPrefix 返回 s 中 prefix/ 下的存储视图，键自动加上前缀
+// Reset 只清空该前缀下的键，Close 不关闭底层存储
+func WithPrefix(s Store, prefix string) (Store, error) {
+	if err := validKey(prefix); err != nil {
+		return nil, fmt.Errorf("无效的存储前缀: %q", prefix)
+	}
+	return &prefixStore{s: s, prefix: prefix + "/"}, nil
+}
+
+// Put 写入键值
+func (p *prefixStore) Put(key string, value []byte) error {
+	return p.s.Put(p.prefix+key, value)
+}
+
+// Get 读取键值
+func (p *prefixStore) Get(key string) ([]byte, bool, error) {
+	return p.s.Get(p.prefix + key)
+}
+
+// List 列出指定前缀下的所有键，返回的键不含视图前缀
+func (p *prefixStore) List(prefix string) ([]string, error) {
+	keys, err := p.s.List(p.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, p.prefix)
+	}
+	return keys, nil
+}
+
+// Delete 删除键
+func (p *prefixStore) Delete(key string) error {
+	return p.s.Delete(p.prefix + key)
+}
+
+// Reset 清空视图前缀下的全部键
+func (p *prefixStore) Reset() error {
+	keys, err := p.s.List(p.prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := p.s.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 底层存储由创建方关闭
+func (p *prefixStore) Close() error {
+	return nil
+}
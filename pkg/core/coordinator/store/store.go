@@ -0,0 +1,131 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ==================== 协调器会话状态存储 ====================
+//
+// 密钥份额、聚合结果、参与方登记信息和会话参数在写入内存的同时写入存储，
+// 协调器崩溃重启后从存储恢复，继续停下来的密钥生成阶段，参与方不必重新生成密钥。
+// 键为以 "/" 分隔的路径，例如 keys/galois/5/1 表示参与方1对伽罗瓦元素5的份额。
+
+// Store 会话状态存储，实现需并发安全
+type Store interface {
+	// Put 写入键值，写入完成后才返回
+	Put(key string, value []byte) error
+	// Get 读取键值，键不存在时返回 ok=false
+	Get(key string) (value []byte, ok bool, err error)
+	// List 按字典序列出指定前缀下的所有键
+	List(prefix string) ([]string, error)
+	// Delete 删除键，键不存在时不报错
+	Delete(key string) error
+	// Reset 清空全部状态，开始新会话时调用
+	Reset() error
+	// Close 关闭存储
+	Close() error
+}
+
+// PutGob gob编码后写入
+func PutGob(s Store, key string, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("编码 %s 失败: %v", key, err)
+	}
+	return s.Put(key, buf.Bytes())
+}
+
+// GetGob 读取并gob解码，键不存在时返回 ok=false
+func GetGob(s Store, key string, v interface{}) (bool, error) {
+	data, ok, err := s.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return false, fmt.Errorf("解码 %s 失败: %v", key, err)
+	}
+	return true, nil
+}
+
+// validKey 键必须是不含空段和 ".." 的相对路径
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("无效的键: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("无效的键: %q", key)
+		}
+	}
+	return nil
+}
+
+// MemoryStore 内存存储，用于嵌入测试或不需要持久化的场景
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// Put 写入键值
+func (m *MemoryStore) Put(key string, value []byte) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Get 读取键值
+func (m *MemoryStore) Get(key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.data[key]
+	return append([]byte(nil), value...), ok, nil
+}
+
+// List 列出指定前缀下的所有键
+func (m *MemoryStore) List(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0)
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete 删除键
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// Reset 清空全部状态
+func (m *MemoryStore) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = make(map[string][]byte)
+	return nil
+}
+
+// Close 关闭存储
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,496 @@
+package tasks
+
+import (
+	"MPHEDev/pkg/core/coordinator/parameters"
+	"MPHEDev/pkg/core/coordinator/store"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== 解密任务授权 ====================
+//
+// 参与方的解密份额和公钥切换份额能够揭示密文内容，不能对任意密文提供。
+// 需要解密时先向协调器提议任务，声明用途和密文哈希，按授权策略批准后参与方才提供份额：
+//   - 密文是已登记计算的输出（哈希已登记）时自动批准
+//   - 否则需要k个不同参与方批准（提议方计入）
+// 参与方收到份额请求时向协调器查询任务，只为已批准、未过期且密文哈希一致的任务提供份额。
+//
+// 修改授权策略和登记计算输出会放宽上述规则，加入成员和轮换集体密钥会改变持有私钥份额的参与方，
+// 追加旋转密钥要求全部参与方生成并上传份额，这些操作同样作为任务提议（变更），由k个参与方表决批准后才生效，
+// 不能由控制面直接执行。
+
+// 任务类型
+const (
+	KindDecrypt   = "decrypt"   // 协同解密，发起方得到明文
+	KindReencrypt = "reencrypt" // 公钥切换，结果交付给接收方
+	KindPolicy    = "policy"    // 变更：修改授权策略
+	KindOutputs   = "outputs"   // 变更：登记计算输出
+	KindMembers   = "members"   // 变更：加入候选成员（带新成员的密钥轮换）
+	KindRotation  = "rotation"  // 变更：轮换集体密钥
+	KindGalois    = "galois"    // 变更：追加旋转密钥
+)
+
+// 任务状态
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// 状态存储中的键
+const (
+	policyStoreKey = "tasks_policy"
+	outputsKey     = "tasks_outputs"
+	taskPrefix     = "tasks/" // tasks/<任务ID>
+)
+
+// ProposerCoordinator 协调器提议的任务（密钥验证）
+const ProposerCoordinator = 0
+
+// Task 解密任务
+type Task struct {
+	ID             string `json:"task_id"`
+	Kind           string `json:"kind"`
+	Purpose        string `json:"purpose"`
+	CiphertextHash string `json:"ciphertext_hash"`
+	ConsumerID     string `json:"consumer_id,omitempty"`  // 公钥切换的接收方
+	ConsumerKey    string `json:"consumer_key,omitempty"` // 接收方公钥指纹（十六进制），参与方只为该公钥生成份额
+	ProposerID     int    `json:"proposer_id"`
+	Status         string `json:"status"`
+	Approvals      []int  `json:"approvals"`
+	Rejections     []int  `json:"rejections"`
+	Computation    string `json:"computation,omitempty"` // 按已登记计算自动批准时或登记输出的计算名称
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+
+	// 变更的内容：新的授权策略（policy），登记的计算输出哈希（outputs，计算名称见 Computation），
+	// 加入的候选成员（members），或追加的旋转（galois）；轮换的原因见 Purpose
+	Policy           *Policy                  `json:"policy,omitempty"`
+	CiphertextHashes []string                 `json:"ciphertext_hashes,omitempty"`
+	ParticipantIDs   []int                    `json:"participant_ids,omitempty"`
+	Galois           *parameters.GaloisConfig `json:"galois,omitempty"`
+}
+
+// IsChange 是否为变更（修改授权策略、登记计算输出、加入成员、轮换密钥、追加旋转密钥），而不是解密任务
+func (t *Task) IsChange() bool {
+	return t.Kind != KindDecrypt && t.Kind != KindReencrypt
+}
+
+// Policy 授权策略
+type Policy struct {
+	// RequiredApprovals 未登记密文需要的批准数（不同参与方，提议方计入）
+	RequiredApprovals int `json:"required_approvals"`
+	// TaskTTLSeconds 任务有效期，过期后参与方不再提供份额
+	TaskTTLSeconds int `json:"task_ttl_seconds"`
+}
+
+// DefaultTaskTTL 默认任务有效期
+const DefaultTaskTTL = 30 * time.Minute
+
+// Manager 解密任务管理器
+type Manager struct {
+	mu        sync.RWMutex
+	expectedN int
+	policy    Policy
+	outputs   map[string]string // 已登记计算输出的密文哈希 -> 计算名称
+	tasks     map[string]*Task
+
+	// 状态存储，为空时只保存在内存中
+	store store.Store
+}
+
+// NewManager 创建解密任务管理器
+// requiredApprovals 取值范围 1..expectedN
+func NewManager(expectedN, requiredApprovals int) *Manager {
+	m := &Manager{
+		expectedN: expectedN,
+		outputs:   make(map[string]string),
+		tasks:     make(map[string]*Task),
+	}
+	m.policy = m.normalize(Policy{RequiredApprovals: requiredApprovals})
+	return m
+}
+
+// normalize 把策略限制在有效范围内
+func (m *Manager) normalize(p Policy) Policy {
+	if p.RequiredApprovals <= 0 || p.RequiredApprovals > m.expectedN {
+		p.RequiredApprovals = m.expectedN
+	}
+	if p.TaskTTLSeconds <= 0 {
+		p.TaskTTLSeconds = int(DefaultTaskTTL / time.Second)
+	}
+	return p
+}
+
+// SetStore 设置状态存储，之后修改的策略、登记的计算输出和任务都会写入存储
+func (m *Manager) SetStore(s store.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = s
+}
+
+// GetPolicy 获取授权策略
+func (m *Manager) GetPolicy() Policy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.policy
+}
+
+// SetPolicy 更新授权策略，只影响之后的审批
+func (m *Manager) SetPolicy(p Policy) (Policy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p = m.normalize(p)
+	if m.store != nil {
+		if err := store.PutGob(m.store, policyStoreKey, p); err != nil {
+			return m.policy, fmt.Errorf("保存授权策略失败: %v", err)
+		}
+	}
+	m.policy = p
+	fmt.Printf("解密授权策略: 需要 %d 个参与方批准，任务有效期 %d 秒\n", p.RequiredApprovals, p.TaskTTLSeconds)
+	return p, nil
+}
+
+// SetExpectedN 成员数量变化后更新可参与审批的参与方数量
+func (m *Manager) SetExpectedN(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectedN = n
+}
+
+// RegisterOutputs 登记计算输出的密文哈希，这些密文的解密任务自动批准
+// 只用于协调器自己生成的密文和已批准的变更，控制面通过 ProposeOutputs 提议
+func (m *Manager) RegisterOutputs(computation string, hashes []string) error {
+	if computation == "" {
+		return fmt.Errorf("计算名称不能为空")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range hashes {
+		m.outputs[h] = computation
+	}
+	if m.store != nil {
+		if err := store.PutGob(m.store, outputsKey, m.outputs); err != nil {
+			return fmt.Errorf("保存计算输出失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// Propose 提议解密任务，密文为已登记计算的输出时直接批准
+// 公钥切换任务需要接收方ID和提议时接收方公钥的指纹
+func (m *Manager) Propose(kind, purpose, ciphertextHash, consumerID, consumerKey string, proposerID int) (*Task, error) {
+	if kind != KindDecrypt && kind != KindReencrypt {
+		return nil, fmt.Errorf("未知的任务类型: %s", kind)
+	}
+	if purpose == "" {
+		return nil, fmt.Errorf("需要声明解密用途")
+	}
+	if len(ciphertextHash) != 64 {
+		return nil, fmt.Errorf("密文哈希格式错误")
+	}
+	if kind == KindReencrypt && (consumerID == "" || consumerKey == "") {
+		return nil, fmt.Errorf("公钥切换任务需要指定接收方")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task := m.newTaskLocked(kind, purpose, proposerID)
+	task.CiphertextHash = ciphertextHash
+	task.ConsumerID = consumerID
+	task.ConsumerKey = consumerKey
+	if computation, ok := m.outputs[ciphertextHash]; ok {
+		task.Status = StatusApproved
+		task.Computation = computation
+	} else if proposerID != ProposerCoordinator {
+		task.Approvals = append(task.Approvals, proposerID)
+		m.updateStatusLocked(task)
+	}
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("解密任务 %s (%s): 参与方 %d 提议，用途 \"%s\"，状态 %s\n", task.ID, kind, proposerID, purpose, task.Status)
+	copied := *task
+	return &copied, nil
+}
+
+// ProposePolicy 提议修改授权策略，k个参与方批准后由调用方通过 SetPolicy 生效
+func (m *Manager) ProposePolicy(p Policy) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p = m.normalize(p)
+	task := m.newTaskLocked(KindPolicy, "修改授权策略", ProposerCoordinator)
+	task.Policy = &p
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("变更 %s: 提议授权策略改为需要 %d 个参与方批准、任务有效期 %d 秒，等待参与方表决\n",
+		task.ID, p.RequiredApprovals, p.TaskTTLSeconds)
+	copied := *task
+	return &copied, nil
+}
+
+// ProposeOutputs 提议登记计算输出，k个参与方批准后由调用方通过 RegisterOutputs 生效
+func (m *Manager) ProposeOutputs(computation string, hashes []string) (*Task, error) {
+	if computation == "" {
+		return nil, fmt.Errorf("计算名称不能为空")
+	}
+	for _, h := range hashes {
+		if len(h) != 64 {
+			return nil, fmt.Errorf("密文哈希格式错误: %s", h)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task := m.newTaskLocked(KindOutputs, fmt.Sprintf("登记计算 %s 的 %d 个输出", computation, len(hashes)), ProposerCoordinator)
+	task.Computation = computation
+	task.CiphertextHashes = hashes
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("变更 %s: 提议%s，等待参与方表决\n", task.ID, task.Purpose)
+	copied := *task
+	return &copied, nil
+}
+
+// ProposeMembers 提议把候选成员加入集体密钥，k个参与方批准后由调用方发起带新成员的密钥轮换
+func (m *Manager) ProposeMembers(ids []int) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task := m.newTaskLocked(KindMembers, fmt.Sprintf("加入参与方 %v", ids), ProposerCoordinator)
+	task.ParticipantIDs = ids
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("变更 %s: 提议%s，等待参与方表决\n", task.ID, task.Purpose)
+	copied := *task
+	return &copied, nil
+}
+
+// ProposeRotation 提议轮换集体密钥，k个参与方批准后由调用方发起轮换
+func (m *Manager) ProposeRotation(reason string) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task := m.newTaskLocked(KindRotation, reason, ProposerCoordinator)
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("变更 %s: 提议轮换集体密钥（%s），等待参与方表决\n", task.ID, reason)
+	copied := *task
+	return &copied, nil
+}
+
+// ProposeGalois 提议追加旋转密钥，k个参与方批准后由调用方通知参与方生成份额
+func (m *Manager) ProposeGalois(cfg parameters.GaloisConfig) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task := m.newTaskLocked(KindGalois, "追加旋转密钥", ProposerCoordinator)
+	task.Galois = &cfg
+	if err := m.addTaskLocked(task); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("变更 %s: 提议追加旋转密钥，等待参与方表决\n", task.ID)
+	copied := *task
+	return &copied, nil
+}
+
+// newTaskLocked 按当前策略的有效期创建待批准的任务，调用方需持有写锁
+func (m *Manager) newTaskLocked(kind, purpose string, proposerID int) *Task {
+	now := time.Now()
+	return &Task{
+		ID:         uuid.New().String(),
+		Kind:       kind,
+		Purpose:    purpose,
+		ProposerID: proposerID,
+		Status:     StatusPending,
+		Approvals:  []int{},
+		Rejections: []int{},
+		CreatedAt:  now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(time.Duration(m.policy.TaskTTLSeconds) * time.Second).Format(time.RFC3339),
+	}
+}
+
+// addTaskLocked 保存并登记新任务，调用方需持有写锁
+func (m *Manager) addTaskLocked(task *Task) error {
+	if err := m.persistTaskLocked(task); err != nil {
+		return err
+	}
+	m.tasks[task.ID] = task
+	return nil
+}
+
+// Vote 参与方批准或拒绝任务，每个参与方只能表决一次
+func (m *Manager) Vote(taskID string, participantID int, approve bool) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return nil, fmt.Errorf("任务 %s 不存在", taskID)
+	}
+	if task.Status != StatusPending {
+		return nil, fmt.Errorf("任务 %s 已是 %s 状态", taskID, task.Status)
+	}
+	if task.Expired() {
+		return nil, fmt.Errorf("任务 %s 已过期", taskID)
+	}
+	if contains(task.Approvals, participantID) || contains(task.Rejections, participantID) {
+		return nil, fmt.Errorf("参与方 %d 已对任务 %s 表决", participantID, taskID)
+	}
+
+	if approve {
+		task.Approvals = append(task.Approvals, participantID)
+	} else {
+		task.Rejections = append(task.Rejections, participantID)
+	}
+	m.updateStatusLocked(task)
+	if err := m.persistTaskLocked(task); err != nil {
+		return nil, err
+	}
+	fmt.Printf("解密任务 %s: 参与方 %d 表决 %v，批准 %d/%d，状态 %s\n",
+		taskID, participantID, approve, len(task.Approvals), m.policy.RequiredApprovals, task.Status)
+	copied := *task
+	return &copied, nil
+}
+
+// updateStatusLocked 按策略更新任务状态：批准数达到k时批准，剩余参与方不足以达到k时拒绝
+func (m *Manager) updateStatusLocked(task *Task) {
+	required := m.policy.RequiredApprovals
+	if len(task.Approvals) >= required {
+		task.Status = StatusApproved
+	} else if m.expectedN-len(task.Rejections) < required {
+		task.Status = StatusRejected
+	}
+}
+
+// Get 按ID查找任务
+func (m *Manager) Get(taskID string) (*Task, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return nil, false
+	}
+	copied := *task
+	return &copied, true
+}
+
+// List 按创建时间列出任务，status 为空时列出全部
+func (m *Manager) List(status string) []*Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]*Task, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		if status == "" || task.Status == status {
+			copied := *task
+			list = append(list, &copied)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+	return list
+}
+
+// Authorize 检查任务已批准、未过期且与密文一致
+func (m *Manager) Authorize(taskID, kind, ciphertextHash string) (*Task, error) {
+	task, ok := m.Get(taskID)
+	if !ok {
+		return nil, fmt.Errorf("任务 %s 不存在", taskID)
+	}
+	if err := task.Check(kind, ciphertextHash); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// Check 检查任务已批准、未过期且与密文一致
+func (t *Task) Check(kind, ciphertextHash string) error {
+	if t.Status != StatusApproved {
+		return fmt.Errorf("任务 %s 未批准（%s）", t.ID, t.Status)
+	}
+	if t.Kind != kind {
+		return fmt.Errorf("任务 %s 类型为 %s，不能用于 %s", t.ID, t.Kind, kind)
+	}
+	if t.CiphertextHash != ciphertextHash {
+		return fmt.Errorf("密文与任务 %s 声明的哈希不一致", t.ID)
+	}
+	if t.Expired() {
+		return fmt.Errorf("任务 %s 已过期", t.ID)
+	}
+	return nil
+}
+
+// Expired 任务是否已过期
+func (t *Task) Expired() bool {
+	expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	return err != nil || time.Now().After(expiresAt)
+}
+
+// persistTaskLocked 保存任务，调用方需持有写锁
+func (m *Manager) persistTaskLocked(task *Task) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := store.PutGob(m.store, taskPrefix+task.ID, task); err != nil {
+		return fmt.Errorf("保存任务失败: %v", err)
+	}
+	return nil
+}
+
+// Restore 从状态存储恢复策略、已登记的计算输出和任务，未修改过的策略沿用会话配置
+func (m *Manager) Restore() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.store == nil {
+		return fmt.Errorf("未设置状态存储")
+	}
+
+	var policy Policy
+	if ok, err := store.GetGob(m.store, policyStoreKey, &policy); err != nil {
+		return err
+	} else if ok {
+		m.policy = m.normalize(policy)
+	}
+	if _, err := store.GetGob(m.store, outputsKey, &m.outputs); err != nil {
+		return err
+	}
+	if m.outputs == nil {
+		m.outputs = make(map[string]string)
+	}
+
+	keys, err := m.store.List(taskPrefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		var task Task
+		if _, err := store.GetGob(m.store, key, &task); err != nil {
+			return err
+		}
+		m.tasks[task.ID] = &task
+	}
+	if len(m.tasks) > 0 {
+		fmt.Printf("已恢复 %d 个解密任务\n", len(m.tasks))
+	}
+	return nil
+}
+
+// contains 判断切片中是否包含id
+func contains(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
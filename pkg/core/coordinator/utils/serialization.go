@@ -1,14 +1,21 @@
 // 序列化与编码工具函数
-// 提供结构体与字节流、Base64字符串之间的转换，便于网络传输和存储
+// 提供结构体与字节流、Base64字符串之间的转换，用于本地存储和JSON控制消息
 package utils
 
 import (
+	"MPHEDev/pkg/core/envelope"
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/hex"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 )
 
-// EncodeShare 将结构体（如密钥份额、CRP等）序列化为字节流
+// EncodeShare 将结构体序列化为字节流，仅用于本地持久化（状态存储）
+// 与参与方交换的密钥份额、评估密钥和密文使用 Lattigo 二进制编码，见 wire 包
 // 参数：share 需要序列化的结构体
 // 返回：序列化后的字节切片和错误信息
 func EncodeShare(share interface{}) ([]byte, error) {
@@ -30,7 +37,7 @@ func DecodeShare(data []byte, share interface{}) error {
 	return dec.Decode(share)
 }
 
-// EncodeToBase64 将字节流编码为Base64字符串，便于网络传输
+// EncodeToBase64 将字节流编码为Base64字符串，用于JSON控制消息
 // 参数：data 字节流
 // 返回：Base64字符串
 func EncodeToBase64(data []byte) string {
@@ -43,3 +50,46 @@ func EncodeToBase64(data []byte) string {
 func DecodeFromBase64(s string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(s)
 }
+
+// CiphertextHash 计算密文二进制编码的SHA-256（十六进制），用于把解密任务绑定到具体密文
+func CiphertextHash(ct *rlwe.Ciphertext) (string, error) {
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ==================== 信封编码 ====================
+//
+// 控制面的JSON接口（接收方登记、结果查询）以信封（见 envelope 包）的Base64形式传递密文和公钥，
+// 解码时校验参数哈希、集体公钥指纹、对象类型和层级，不符时返回错误。
+// 协调器与参与方之间直接传输信封的二进制，见 wire 包。
+
+// DecodeCiphertext 解码Base64密文信封并校验
+func DecodeCiphertext(params ckks.Parameters, key envelope.Fingerprint, s string) (*rlwe.Ciphertext, error) {
+	data, err := DecodeFromBase64(s)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.OpenCiphertext(params, key, data)
+}
+
+// EncodePublicKey 把结果接收方公钥封装为信封并编码为Base64
+func EncodePublicKey(params ckks.Parameters, pk *rlwe.PublicKey) (string, error) {
+	data, err := envelope.SealPublicKey(params, pk)
+	if err != nil {
+		return "", err
+	}
+	return EncodeToBase64(data), nil
+}
+
+// DecodePublicKey 解码Base64公钥信封并校验
+func DecodePublicKey(params ckks.Parameters, s string) (*rlwe.PublicKey, error) {
+	data, err := DecodeFromBase64(s)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.OpenPublicKey(params, data)
+}
@@ -10,30 +10,32 @@ type ParticipantInfo struct {
 }
 
 type PeerInfo struct {
-	ID  int    `json:"id"`
-	URL string `json:"url"`
+	ID        int    `json:"id"`
+	URL       string `json:"url"`
+	PublicKey string `json:"public_key,omitempty"` // base64编码的Ed25519身份公钥，供参与方之间验证签名
+
+	// 中继公钥（X25519，base64）及身份私钥对其的签名，参与方未启用中继时为空
+	RelayKey          string `json:"relay_key,omitempty"`
+	RelayKeySignature string `json:"relay_key_signature,omitempty"`
 }
 
+// PublicKeyShare 等为密钥份额上传请求的控制帧，份额的二进制编码为其后唯一的对象帧
 type PublicKeyShare struct {
-	ParticipantID int    `json:"participant_id"`
-	ShareData     string `json:"share_data"`
+	ParticipantID int `json:"participant_id"`
 }
 
 type SecretKeyShare struct {
-	ParticipantID int    `json:"participant_id"`
-	ShareData     string `json:"share_data"`
+	ParticipantID int `json:"participant_id"`
 }
 
 type GaloisKeyShare struct {
 	ParticipantID int    `json:"participant_id"`
 	GalEl         uint64 `json:"gal_el"`
-	ShareData     string `json:"share_data"`
 }
 
 type RelinearizationKeyShare struct {
-	ParticipantID int    `json:"participant_id"`
-	Round         int    `json:"round"`
-	ShareData     string `json:"share_data"`
+	ParticipantID int `json:"participant_id"`
+	Round         int `json:"round"`
 }
 
 // CustomParametersLiteral 自定义参数结构体，用于正确的JSON序列化
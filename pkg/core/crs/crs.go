@@ -0,0 +1,99 @@
+// 会话CRS种子
+// 协调器和参与方共用的种子生成、承诺和派生规则，双方必须使用完全相同的计算方式
+package crs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// SeedSize 种子长度（字节）
+const SeedSize = 32
+
+// CoordinatorID 协调器在承诺中使用的编号，参与方ID从1开始
+const CoordinatorID = 0
+
+// domainSeed 派生最终种子时使用的域分隔标签
+const domainSeed = "MPHE-CRS"
+
+// domainCommit 计算承诺时使用的域分隔标签
+const domainCommit = "MPHE-CRS-COMMIT"
+
+// NewSeed 使用密码学安全随机数生成新的种子
+func NewSeed() ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("生成随机种子失败: %v", err)
+	}
+	return seed, nil
+}
+
+// Commitment 计算种子承诺 sha256(domain ‖ session_id ‖ id ‖ seed)，返回十六进制字符串
+// 承诺绑定会话和提交方，不能被其他会话或其他参与方复用
+func Commitment(sessionID string, id int, seed []byte) string {
+	h := sha256.New()
+	h.Write([]byte(domainCommit))
+	h.Write([]byte(sessionID))
+	h.Write(uint32Bytes(id))
+	h.Write(seed)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DeriveSessionSeed 派生会话最终CRS种子
+// seed = sha256(domain ‖ session_id ‖ 协调器种子 ‖ 按ID升序的 (id ‖ 参与方种子))
+// contributions 为空时只由协调器种子决定
+func DeriveSessionSeed(sessionID string, coordinatorSeed []byte, contributions map[int][]byte) []byte {
+	ids := make([]int, 0, len(contributions))
+	for id := range contributions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	h := sha256.New()
+	h.Write([]byte(domainSeed))
+	h.Write([]byte(sessionID))
+	h.Write(coordinatorSeed)
+	for _, id := range ids {
+		h.Write(uint32Bytes(id))
+		h.Write(contributions[id])
+	}
+	return h.Sum(nil)
+}
+
+// DeriveLabeled 从会话种子派生带标签的子种子，用于区分不同用途的CRS
+func DeriveLabeled(seed []byte, label string) []byte {
+	h := sha256.New()
+	h.Write(seed)
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// GaloisSeed 派生单个伽罗瓦元素的CRP种子
+// 每个伽罗瓦元素的CRP独立派生，与元素顺序无关，会话中途追加旋转密钥时双方也能得到相同的CRP
+func GaloisSeed(seed []byte, galEl uint64) []byte {
+	return DeriveLabeled(seed, "galois-"+strconv.FormatUint(galEl, 10))
+}
+
+// RefreshSeed 派生单次协同刷新的CRP种子
+// 每个刷新任务按任务ID和密文层级独立派生，同一会话中多次刷新不会复用CRP
+func RefreshSeed(seed []byte, taskID string, level int) []byte {
+	return DeriveLabeled(seed, "refresh-"+taskID+"-"+strconv.Itoa(level))
+}
+
+// EpochSeed 派生密钥轮换纪元的CRS种子
+// 每个纪元的每次尝试独立派生，纪元内的公钥、重线性化密钥和伽罗瓦密钥CRP按与初始密钥相同的规则从该种子派生
+func EpochSeed(seed []byte, epoch, attempt int) []byte {
+	return DeriveLabeled(seed, "epoch-"+strconv.Itoa(epoch)+"-"+strconv.Itoa(attempt))
+}
+
+// uint32Bytes 大端编码ID
+func uint32Bytes(id int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(id))
+	return b
+}
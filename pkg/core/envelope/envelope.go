@@ -0,0 +1,447 @@
+// 密文信封
+// 协调器和参与方共用的密文、份额和公钥的二进制封装格式，双方必须使用完全相同的编码和校验规则。
+//
+// 信封格式（整数均为大端序）：
+//
+//	magic "MPHE" (4) ‖ 版本 (1) ‖ 对象类型 (1) ‖ 层级 (2) ‖ 缩放因子 float64 (8) ‖
+//	参数哈希 (32) ‖ 集体公钥指纹 (32) ‖ 载荷长度 (4) ‖ 载荷（Lattigo 二进制编码）
+//
+// 参数哈希为 sha256(CKKS参数的二进制编码)，集体公钥指纹为 sha256(公钥的二进制编码)，
+// 绑定对象所在的集体密钥（即密钥纪元）；结果接收方公钥下的密文绑定接收方公钥。
+// 打开信封时逐项校验：魔数、版本、类型、参数、密钥、载荷长度，
+// 载荷解码后还要与头部声明的层级和缩放因子一致，且环维数与会话参数相同，任何一项不符都拒绝。
+package envelope
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/ring"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// Magic 信封魔数
+const Magic = "MPHE"
+
+// Version 当前信封版本，版本不同的信封一律拒绝
+const Version = 1
+
+// HeaderSize 信封头部长度（字节）
+const HeaderSize = len(Magic) + 1 + 1 + 2 + 8 + sha256.Size + sha256.Size + 4
+
+// MaxPayloadSize 载荷长度上限，与批量请求的单帧上限一致
+const MaxPayloadSize = 256 << 20
+
+// ObjectType 信封中对象的类型
+type ObjectType uint8
+
+// 对象类型，数值写入信封，不能修改已有取值
+const (
+	TypeCiphertext           ObjectType = 1 // rlwe.Ciphertext
+	TypeKeySwitchShare       ObjectType = 2 // multiparty.KeySwitchShare（协同解密、密钥轮换切换）
+	TypeRefreshShare         ObjectType = 3 // multiparty.RefreshShare
+	TypePublicKeySwitchShare ObjectType = 4 // multiparty.PublicKeySwitchShare
+	TypePublicKey            ObjectType = 5 // rlwe.PublicKey（结果接收方公钥）
+)
+
+// String 对象类型名称
+func (t ObjectType) String() string {
+	switch t {
+	case TypeCiphertext:
+		return "ciphertext"
+	case TypeKeySwitchShare:
+		return "key_switch_share"
+	case TypeRefreshShare:
+		return "refresh_share"
+	case TypePublicKeySwitchShare:
+		return "public_key_switch_share"
+	case TypePublicKey:
+		return "public_key"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// Fingerprint 参数哈希或公钥指纹
+type Fingerprint [sha256.Size]byte
+
+// String 十六进制表示的前8字节，用于日志和错误信息
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f[:8])
+}
+
+// Hex 完整的十六进制表示，用于在JSON消息中传递指纹
+func (f Fingerprint) Hex() string {
+	return hex.EncodeToString(f[:])
+}
+
+// IsZero 是否为零指纹（未绑定密钥）
+func (f Fingerprint) IsZero() bool {
+	return f == Fingerprint{}
+}
+
+// ParseFingerprint 解析十六进制表示的指纹
+func ParseFingerprint(s string) (Fingerprint, error) {
+	var f Fingerprint
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(f) {
+		return f, fmt.Errorf("无效的指纹 %q", s)
+	}
+	copy(f[:], data)
+	return f, nil
+}
+
+// ParamsHash 计算CKKS参数的哈希
+func ParamsHash(params ckks.Parameters) (Fingerprint, error) {
+	data, err := params.MarshalBinary()
+	if err != nil {
+		return Fingerprint{}, fmt.Errorf("参数序列化失败: %v", err)
+	}
+	return sha256.Sum256(data), nil
+}
+
+// KeyFingerprint 计算公钥指纹，pk 为空时返回零指纹
+func KeyFingerprint(pk *rlwe.PublicKey) Fingerprint {
+	var f Fingerprint
+	if pk == nil {
+		return f
+	}
+	h := sha256.New()
+	if _, err := pk.WriteTo(h); err != nil {
+		return f
+	}
+	copy(f[:], h.Sum(nil))
+	return f
+}
+
+// KeyCache 缓存公钥指纹，公钥对象替换后重新计算
+// 集体公钥较大，每次封装都重新哈希代价太高
+type KeyCache struct {
+	mu sync.Mutex
+	pk *rlwe.PublicKey
+	fp Fingerprint
+}
+
+// Fingerprint 返回 pk 的指纹
+func (c *KeyCache) Fingerprint(pk *rlwe.PublicKey) Fingerprint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pk != c.pk {
+		c.pk, c.fp = pk, KeyFingerprint(pk)
+	}
+	return c.fp
+}
+
+// Header 信封头部
+type Header struct {
+	Version        uint8
+	Type           ObjectType
+	Level          int
+	Scale          float64 // 只有密文和刷新份额携带缩放因子，其他对象为0
+	ParamsHash     Fingerprint
+	KeyFingerprint Fingerprint
+}
+
+// seal 写出头部和载荷
+func seal(h Header, payload []byte) ([]byte, error) {
+	if h.Level < 0 || h.Level > math.MaxUint16 {
+		return nil, fmt.Errorf("层级 %d 超出范围", h.Level)
+	}
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("载荷长度 %d 超过上限 %d", len(payload), MaxPayloadSize)
+	}
+	buf := make([]byte, HeaderSize, HeaderSize+len(payload))
+	off := copy(buf, Magic)
+	buf[off] = Version
+	buf[off+1] = byte(h.Type)
+	binary.BigEndian.PutUint16(buf[off+2:], uint16(h.Level))
+	binary.BigEndian.PutUint64(buf[off+4:], math.Float64bits(h.Scale))
+	off += 12
+	off += copy(buf[off:], h.ParamsHash[:])
+	off += copy(buf[off:], h.KeyFingerprint[:])
+	binary.BigEndian.PutUint32(buf[off:], uint32(len(payload)))
+	return append(buf, payload...), nil
+}
+
+// ReadHeader 解析信封头部，检查魔数、版本和载荷长度，返回头部和载荷
+func ReadHeader(data []byte) (Header, []byte, error) {
+	var h Header
+	if len(data) < HeaderSize {
+		return h, nil, fmt.Errorf("信封长度 %d 小于头部长度 %d", len(data), HeaderSize)
+	}
+	if !bytes.Equal(data[:len(Magic)], []byte(Magic)) {
+		return h, nil, fmt.Errorf("不是信封格式（魔数不符）")
+	}
+	off := len(Magic)
+	h.Version = data[off]
+	if h.Version != Version {
+		return h, nil, fmt.Errorf("不支持的信封版本 %d（当前版本 %d）", h.Version, Version)
+	}
+	h.Type = ObjectType(data[off+1])
+	h.Level = int(binary.BigEndian.Uint16(data[off+2:]))
+	h.Scale = math.Float64frombits(binary.BigEndian.Uint64(data[off+4:]))
+	off += 12
+	off += copy(h.ParamsHash[:], data[off:])
+	off += copy(h.KeyFingerprint[:], data[off:])
+	size := int(binary.BigEndian.Uint32(data[off:]))
+	payload := data[HeaderSize:]
+	if size > MaxPayloadSize || size != len(payload) {
+		return h, nil, fmt.Errorf("载荷长度 %d 与头部声明的 %d 不一致", len(payload), size)
+	}
+	return h, payload, nil
+}
+
+// open 解析信封并校验类型、参数、密钥和层级范围
+func open(data []byte, params ckks.Parameters, typ ObjectType, key Fingerprint) (Header, []byte, error) {
+	h, payload, err := ReadHeader(data)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.Type != typ {
+		return h, nil, fmt.Errorf("对象类型为 %s，期望 %s", h.Type, typ)
+	}
+	paramsHash, err := ParamsHash(params)
+	if err != nil {
+		return h, nil, err
+	}
+	if h.ParamsHash != paramsHash {
+		return h, nil, fmt.Errorf("参数哈希 %s 与会话参数 %s 不一致", h.ParamsHash, paramsHash)
+	}
+	if h.KeyFingerprint != key {
+		return h, nil, fmt.Errorf("集体公钥指纹 %s 与本方密钥 %s 不一致（密钥纪元不同？）", h.KeyFingerprint, key)
+	}
+	if h.Level > params.MaxLevel() {
+		return h, nil, fmt.Errorf("层级 %d 超过参数最大层级 %d", h.Level, params.MaxLevel())
+	}
+	return h, payload, nil
+}
+
+// newHeader 按会话参数和密钥构造头部
+func newHeader(params ckks.Parameters, typ ObjectType, key Fingerprint, level int, scale float64) (Header, error) {
+	paramsHash, err := ParamsHash(params)
+	if err != nil {
+		return Header{}, err
+	}
+	return Header{Version: Version, Type: typ, Level: level, Scale: scale, ParamsHash: paramsHash, KeyFingerprint: key}, nil
+}
+
+// checkPoly 检查多项式的环维数和层级
+func checkPoly(params ckks.Parameters, p ring.Poly, level int) error {
+	if p.N() != params.N() {
+		return fmt.Errorf("环维数 %d 与参数 %d 不一致", p.N(), params.N())
+	}
+	if p.Level() != level {
+		return fmt.Errorf("层级 %d 与头部声明的 %d 不一致", p.Level(), level)
+	}
+	return nil
+}
+
+// checkScale 检查缩放因子有效且与头部一致
+func checkScale(scale rlwe.Scale, declared float64) error {
+	value := scale.Float64()
+	if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return fmt.Errorf("缩放因子 %v 无效", value)
+	}
+	if value != declared {
+		return fmt.Errorf("缩放因子 %v 与头部声明的 %v 不一致", value, declared)
+	}
+	return nil
+}
+
+// SealCiphertext 封装集体公钥（指纹为 key）下的密文
+func SealCiphertext(params ckks.Parameters, key Fingerprint, ct *rlwe.Ciphertext) ([]byte, error) {
+	h, err := newHeader(params, TypeCiphertext, key, ct.Level(), ct.Scale.Float64())
+	if err != nil {
+		return nil, err
+	}
+	payload, err := ct.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("密文序列化失败: %v", err)
+	}
+	return seal(h, payload)
+}
+
+// OpenCiphertext 打开密文信封，密文须属于会话参数和指纹为 key 的公钥
+func OpenCiphertext(params ckks.Parameters, key Fingerprint, data []byte) (*rlwe.Ciphertext, error) {
+	h, payload, err := open(data, params, TypeCiphertext, key)
+	if err != nil {
+		return nil, err
+	}
+	ct := new(rlwe.Ciphertext)
+	if err := ct.UnmarshalBinary(payload); err != nil {
+		return nil, fmt.Errorf("密文反序列化失败: %v", err)
+	}
+	if ct.Degree() < 1 || ct.Degree() > 2 {
+		return nil, fmt.Errorf("密文次数 %d 无效", ct.Degree())
+	}
+	for _, p := range ct.Value {
+		if err := checkPoly(params, p, h.Level); err != nil {
+			return nil, fmt.Errorf("密文%v", err)
+		}
+	}
+	if err := checkScale(ct.Scale, h.Scale); err != nil {
+		return nil, fmt.Errorf("密文%v", err)
+	}
+	max := params.LogMaxDimensions()
+	if ct.LogDimensions.Rows > max.Rows || ct.LogDimensions.Cols > max.Cols {
+		return nil, fmt.Errorf("密文槽位维数 %v 超过参数上限 %v", ct.LogDimensions, max)
+	}
+	return ct, nil
+}
+
+// SealKeySwitchShare 封装协同解密或密钥轮换切换的份额，key 为被切换密文所在的集体公钥
+func SealKeySwitchShare(params ckks.Parameters, key Fingerprint, share multiparty.KeySwitchShare) ([]byte, error) {
+	h, err := newHeader(params, TypeKeySwitchShare, key, share.Value.Level(), 0)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := share.Value.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("份额序列化失败: %v", err)
+	}
+	return seal(h, payload)
+}
+
+// OpenKeySwitchShare 打开密钥切换份额信封，份额层级须等于被切换密文的层级 level
+func OpenKeySwitchShare(params ckks.Parameters, key Fingerprint, level int, data []byte) (multiparty.KeySwitchShare, error) {
+	var share multiparty.KeySwitchShare
+	h, payload, err := open(data, params, TypeKeySwitchShare, key)
+	if err != nil {
+		return share, err
+	}
+	if h.Level != level {
+		return share, fmt.Errorf("份额层级 %d 与密文层级 %d 不一致", h.Level, level)
+	}
+	if err := share.Value.UnmarshalBinary(payload); err != nil {
+		return share, fmt.Errorf("份额反序列化失败: %v", err)
+	}
+	if err := checkPoly(params, share.Value, level); err != nil {
+		return share, fmt.Errorf("份额%v", err)
+	}
+	return share, nil
+}
+
+// SealRefreshShare 封装刷新份额，层级和缩放因子取被刷新密文的层级和缩放因子
+func SealRefreshShare(params ckks.Parameters, key Fingerprint, share multiparty.RefreshShare) ([]byte, error) {
+	h, err := newHeader(params, TypeRefreshShare, key, share.EncToShareShare.Value.Level(), share.MetaData.Scale.Float64())
+	if err != nil {
+		return nil, err
+	}
+	payload, err := share.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("份额序列化失败: %v", err)
+	}
+	return seal(h, payload)
+}
+
+// OpenRefreshShare 打开刷新份额信封，份额须对应层级为 level 的密文，输出层级为参数最大层级
+func OpenRefreshShare(params ckks.Parameters, key Fingerprint, level int, data []byte) (multiparty.RefreshShare, error) {
+	var share multiparty.RefreshShare
+	h, payload, err := open(data, params, TypeRefreshShare, key)
+	if err != nil {
+		return share, err
+	}
+	if h.Level != level {
+		return share, fmt.Errorf("份额层级 %d 与密文层级 %d 不一致", h.Level, level)
+	}
+	if err := share.UnmarshalBinary(payload); err != nil {
+		return share, fmt.Errorf("份额反序列化失败: %v", err)
+	}
+	if err := checkPoly(params, share.EncToShareShare.Value, level); err != nil {
+		return share, fmt.Errorf("份额%v", err)
+	}
+	if err := checkPoly(params, share.ShareToEncShare.Value, params.MaxLevel()); err != nil {
+		return share, fmt.Errorf("份额%v", err)
+	}
+	if share.MetaData.Scale.Float64() != h.Scale {
+		return share, fmt.Errorf("份额缩放因子 %v 与头部声明的 %v 不一致", share.MetaData.Scale.Float64(), h.Scale)
+	}
+	return share, nil
+}
+
+// SealPublicKeySwitchShare 封装公钥切换份额，key 为被切换密文所在的集体公钥
+func SealPublicKeySwitchShare(params ckks.Parameters, key Fingerprint, share multiparty.PublicKeySwitchShare) ([]byte, error) {
+	if len(share.Value) == 0 {
+		return nil, fmt.Errorf("公钥切换份额为空")
+	}
+	h, err := newHeader(params, TypePublicKeySwitchShare, key, share.Value[0].Level(), 0)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := share.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("份额序列化失败: %v", err)
+	}
+	return seal(h, payload)
+}
+
+// OpenPublicKeySwitchShare 打开公钥切换份额信封，份额层级须等于被切换密文的层级 level
+func OpenPublicKeySwitchShare(params ckks.Parameters, key Fingerprint, level int, data []byte) (multiparty.PublicKeySwitchShare, error) {
+	var share multiparty.PublicKeySwitchShare
+	h, payload, err := open(data, params, TypePublicKeySwitchShare, key)
+	if err != nil {
+		return share, err
+	}
+	if h.Level != level {
+		return share, fmt.Errorf("份额层级 %d 与密文层级 %d 不一致", h.Level, level)
+	}
+	if err := share.UnmarshalBinary(payload); err != nil {
+		return share, fmt.Errorf("份额反序列化失败: %v", err)
+	}
+	if len(share.Value) != 2 {
+		return share, fmt.Errorf("份额包含 %d 个多项式，期望 2 个", len(share.Value))
+	}
+	for _, p := range share.Value {
+		if err := checkPoly(params, p, level); err != nil {
+			return share, fmt.Errorf("份额%v", err)
+		}
+	}
+	return share, nil
+}
+
+// SealPublicKey 封装结果接收方公钥，指纹字段为公钥自身的指纹
+func SealPublicKey(params ckks.Parameters, pk *rlwe.PublicKey) ([]byte, error) {
+	h, err := newHeader(params, TypePublicKey, KeyFingerprint(pk), pk.LevelQ(), 0)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("公钥序列化失败: %v", err)
+	}
+	return seal(h, payload)
+}
+
+// OpenPublicKey 打开公钥信封，公钥须覆盖参数的全部模数且与头部中的指纹一致
+func OpenPublicKey(params ckks.Parameters, data []byte) (*rlwe.PublicKey, error) {
+	h, payload, err := ReadHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := open(data, params, TypePublicKey, h.KeyFingerprint); err != nil {
+		return nil, err
+	}
+	pk := new(rlwe.PublicKey)
+	if err := pk.UnmarshalBinary(payload); err != nil {
+		return nil, fmt.Errorf("公钥反序列化失败: %v", err)
+	}
+	if pk.LevelQ() != params.MaxLevelQ() || pk.LevelP() != params.MaxLevelP() || h.Level != pk.LevelQ() {
+		return nil, fmt.Errorf("公钥层级 (Q=%d, P=%d) 与会话参数不一致", pk.LevelQ(), pk.LevelP())
+	}
+	for _, v := range pk.Value {
+		if v.Q.N() != params.N() {
+			return nil, fmt.Errorf("公钥环维数 %d 与参数 %d 不一致", v.Q.N(), params.N())
+		}
+	}
+	if KeyFingerprint(pk) != h.KeyFingerprint {
+		return nil, fmt.Errorf("公钥与头部中的指纹不一致")
+	}
+	return pk, nil
+}
@@ -0,0 +1,134 @@
+// 参与方身份
+// 每个参与方持有一个Ed25519签名密钥，首次启动时生成并持久化，注册时向协调器登记公钥；
+// 之后发往协调器和其他参与方的请求都携带签名，接收方据此拒绝伪造或重放的请求
+package identity
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CoordinatorID 协调器签名时使用的编号，参与方ID从1开始
+const CoordinatorID = 0
+
+// UnassignedID 注册前尚未分配ID时使用的编号，此时用请求中的公钥验证签名
+const UnassignedID = -1
+
+// Identity Ed25519签名身份
+type Identity struct {
+	PublicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// identityFile 持久化格式
+type identityFile struct {
+	PublicKey  string `json:"public_key"`  // base64
+	PrivateKey string `json:"private_key"` // base64编码的32字节种子
+}
+
+// Generate 生成新的签名身份
+func Generate() (*Identity, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %v", err)
+	}
+	return &Identity{PublicKey: pub, privateKey: priv}, nil
+}
+
+// LoadOrCreate 从文件加载签名身份，文件不存在时生成并保存（权限0600）
+func LoadOrCreate(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		id, err := Generate()
+		if err != nil {
+			return nil, err
+		}
+		if err := id.Save(path); err != nil {
+			return nil, err
+		}
+		logs.Printf("已生成新的身份密钥: %s\n", path)
+		return id, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取身份文件失败: %v", err)
+	}
+
+	var file identityFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析身份文件失败: %v", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(file.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("身份文件中的私钥无效")
+	}
+	id, err := FromSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+	if file.PublicKey != "" && file.PublicKey != id.PublicKeyBase64() {
+		return nil, fmt.Errorf("身份文件中的公钥与私钥不匹配")
+	}
+	return id, nil
+}
+
+// FromSeed 由32字节私钥种子恢复签名身份
+func FromSeed(seed []byte) (*Identity, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("无效的私钥种子长度: %d", len(seed))
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	return &Identity{PublicKey: priv.Public().(ed25519.PublicKey), privateKey: priv}, nil
+}
+
+// Seed 私钥种子，用于持久化
+func (id *Identity) Seed() []byte {
+	return id.privateKey.Seed()
+}
+
+// Save 保存签名身份
+func (id *Identity) Save(path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("创建身份目录失败: %v", err)
+		}
+	}
+	data, err := json.MarshalIndent(identityFile{
+		PublicKey:  id.PublicKeyBase64(),
+		PrivateKey: base64.StdEncoding.EncodeToString(id.Seed()),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("写入身份文件失败: %v", err)
+	}
+	return nil
+}
+
+// PublicKeyBase64 base64编码的公钥，注册时上报
+func (id *Identity) PublicKeyBase64() string {
+	return base64.StdEncoding.EncodeToString(id.PublicKey)
+}
+
+// Sign 对消息签名
+func (id *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(id.privateKey, message)
+}
+
+// ParsePublicKey 解析base64编码的公钥
+func ParsePublicKey(b64 string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("公钥解码失败: %v", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("无效的公钥长度: %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
@@ -0,0 +1,66 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// KeyRing 已知签名方的公钥表（参与方ID -> 公钥，协调器为 CoordinatorID）
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[int]ed25519.PublicKey
+}
+
+// NewKeyRing 创建公钥表
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: make(map[int]ed25519.PublicKey)}
+}
+
+// Set 登记签名方公钥
+func (k *KeyRing) Set(id int, pub ed25519.PublicKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = pub
+}
+
+// Get 获取签名方公钥
+func (k *KeyRing) Get(id int) (ed25519.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	pub, ok := k.keys[id]
+	return pub, ok
+}
+
+// Verifier 按签名方ID查找公钥并验证请求
+type Verifier struct {
+	lookup func(id int) (ed25519.PublicKey, bool)
+	guard  *ReplayGuard
+}
+
+// NewVerifier 创建请求验证器，lookup 返回签名方登记的公钥
+func NewVerifier(lookup func(id int) (ed25519.PublicKey, bool)) *Verifier {
+	return &Verifier{lookup: lookup, guard: NewReplayGuard()}
+}
+
+// Verify 验证请求签名，返回通过认证的签名方ID
+func (v *Verifier) Verify(r *http.Request, body []byte) (int, error) {
+	signer, err := SignerOf(r)
+	if err != nil {
+		return 0, err
+	}
+	pub, ok := v.lookup(signer)
+	if !ok {
+		return 0, fmt.Errorf("签名方 %d 未登记身份公钥", signer)
+	}
+	if err := VerifyRequest(r, body, pub, v.guard); err != nil {
+		return 0, err
+	}
+	return signer, nil
+}
+
+// Guard 获取重放保护，用于以请求内公钥验证的注册请求
+func (v *Verifier) Guard() *ReplayGuard {
+	return v.guard
+}
@@ -0,0 +1,39 @@
+package identity
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplayGuard 记录时间窗口内见过的 (签名方, 随机数)，拒绝重放的请求
+// 超出 MaxClockSkew 的请求已被时间戳校验拒绝，因此只需保留窗口内的记录
+type ReplayGuard struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewReplayGuard 创建重放保护
+func NewReplayGuard() *ReplayGuard {
+	return &ReplayGuard{seen: make(map[string]time.Time)}
+}
+
+// Check 记录随机数，已见过时返回错误
+func (g *ReplayGuard) Check(signer int, nonce string, signedAt time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for key, at := range g.seen {
+		if now.Sub(at) > 2*MaxClockSkew {
+			delete(g.seen, key)
+		}
+	}
+
+	key := fmt.Sprintf("%d/%s", signer, nonce)
+	if _, ok := g.seen[key]; ok {
+		return fmt.Errorf("检测到重放请求 (签名方: %d)", signer)
+	}
+	g.seen[key] = signedAt
+	return nil
+}
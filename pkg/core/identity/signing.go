@@ -0,0 +1,139 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 签名请求头
+const (
+	HeaderSigner    = "X-MPHE-Signer"
+	HeaderTimestamp = "X-MPHE-Timestamp"
+	HeaderNonce     = "X-MPHE-Nonce"
+	HeaderSignature = "X-MPHE-Signature"
+)
+
+// MaxClockSkew 允许的最大时钟偏差，超出的请求视为过期
+const MaxClockSkew = 2 * time.Minute
+
+// domainRequest 请求签名的域分隔标签，v2 起签名覆盖查询参数
+const domainRequest = "MPHE-REQ-v2"
+
+// canonicalMessage 待签名内容：域标签、方法、路径、规范化的查询参数、签名方、时间戳、随机数和请求体哈希
+func canonicalMessage(method string, u *url.URL, signer int, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	var buf bytes.Buffer
+	buf.WriteString(domainRequest)
+	for _, field := range []string{method, u.Path, canonicalQuery(u.RawQuery), strconv.Itoa(signer), timestamp, nonce, hex.EncodeToString(bodyHash[:])} {
+		buf.WriteByte('\n')
+		buf.WriteString(field)
+	}
+	return buf.Bytes()
+}
+
+// canonicalQuery 按键排序并重新编码查询参数，使参数顺序和编码方式不影响签名
+// 无法解析的查询参数原样签名，接收方解析时同样失败
+func canonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+// SignRequest 为请求添加签名头，body 必须与实际发送的请求体一致
+func (id *Identity) SignRequest(req *http.Request, signer int, body []byte) error {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return fmt.Errorf("生成随机数失败: %v", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	sig := id.Sign(canonicalMessage(req.Method, req.URL, signer, timestamp, nonce, body))
+	req.Header.Set(HeaderSigner, strconv.Itoa(signer))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// Post 发送带签名的JSON POST请求
+func (id *Identity) Post(client *http.Client, url string, signer int, body []byte) (*http.Response, error) {
+	return id.PostContext(context.Background(), client, url, signer, body)
+}
+
+// PostContext 发送带签名的JSON POST请求，ctx 取消或超时时中止请求
+func (id *Identity) PostContext(ctx context.Context, client *http.Client, url string, signer int, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return id.Do(client, req, signer, body)
+}
+
+// Do 为请求签名并发送，body 必须与请求实际发送的字节一致（帧格式消息为压缩后的字节）
+func (id *Identity) Do(client *http.Client, req *http.Request, signer int, body []byte) (*http.Response, error) {
+	if err := id.SignRequest(req, signer, body); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// SignerOf 读取请求声明的签名方ID
+func SignerOf(r *http.Request) (int, error) {
+	value := r.Header.Get(HeaderSigner)
+	if value == "" {
+		return 0, fmt.Errorf("缺少签名头 %s", HeaderSigner)
+	}
+	signer, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的签名方: %s", value)
+	}
+	return signer, nil
+}
+
+// VerifyRequest 用给定公钥验证请求签名和时间戳，guard 不为空时同时拒绝重放
+func VerifyRequest(r *http.Request, body []byte, pub ed25519.PublicKey, guard *ReplayGuard) error {
+	signer, err := SignerOf(r)
+	if err != nil {
+		return err
+	}
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(HeaderSignature))
+	if timestamp == "" || nonce == "" || err != nil || len(sig) == 0 {
+		return fmt.Errorf("签名头不完整")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无效的时间戳: %s", timestamp)
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := time.Since(signedAt); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("请求时间戳超出允许范围: %s", signedAt.Format(time.RFC3339))
+	}
+
+	if !ed25519.Verify(pub, canonicalMessage(r.Method, r.URL, signer, timestamp, nonce, body), sig) {
+		return fmt.Errorf("签名验证失败")
+	}
+	// 签名验证通过后再记录随机数，避免未认证的请求占用缓存
+	if guard != nil {
+		if err := guard.Check(signer, nonce, signedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
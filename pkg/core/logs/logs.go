@@ -0,0 +1,28 @@
+// 日志输出
+// 参与方和共用组件的日志都经由本包写出，默认写到标准输出；
+// 命令模式把 Writer 换成标准错误，标准输出只保留命令的JSON结果
+package logs
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Writer 日志写出的位置，应在启动时设置
+var Writer io.Writer = os.Stdout
+
+// Printf 按格式写出日志
+func Printf(format string, a ...interface{}) {
+	fmt.Fprintf(Writer, format, a...)
+}
+
+// Println 写出一行日志
+func Println(a ...interface{}) {
+	fmt.Fprintln(Writer, a...)
+}
+
+// Print 写出日志
+func Print(a ...interface{}) {
+	fmt.Fprint(Writer, a...)
+}
@@ -1,11 +1,16 @@
 package coordinator
 
 import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/types"
 	"MPHEDev/pkg/core/participant/utils"
-	"bytes"
+	"MPHEDev/pkg/core/smudging"
+	"MPHEDev/pkg/core/wire"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -35,21 +40,26 @@ func (cc *CoordinatorClient) SetParticipantID(id int) {
 	cc.participantID = id
 }
 
-// Register 注册到协调器
-func (cc *CoordinatorClient) Register(shardID string) (*types.RegisterResponse, error) {
-	// 构造注册请求，包含shard_id
-	reqBody := map[string]interface{}{
-		"shard_id": shardID,
-	}
-	jsonData, err := json.Marshal(reqBody)
+// Register 注册到协调器，登记身份公钥
+// 注册时尚未分配ID，请求以 UnassignedID 签名，协调器用请求中的公钥验证
+func (cc *CoordinatorClient) Register(shardID string, id *identity.Identity) (*types.RegisterResponse, error) {
+	// 构造注册请求，包含shard_id和身份公钥
+	jsonData, err := json.Marshal(types.RegisterRequest{
+		ShardID:   shardID,
+		PublicKey: id.PublicKeyBase64(),
+	})
 	if err != nil {
 		return nil, err
 	}
-	resp, err := cc.client.Client.Post(cc.baseURL+"/register", "application/json", bytes.NewReader(jsonData))
+	resp, err := id.Post(cc.client.Client, cc.baseURL+"/register", identity.UnassignedID, jsonData)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("注册失败: %d %s", resp.StatusCode, string(body))
+	}
 	var regResp types.RegisterResponse
 	if err := json.NewDecoder(resp.Body).Decode(&regResp); err != nil {
 		return nil, err
@@ -66,7 +76,7 @@ func (cc *CoordinatorClient) Unregister(shardID string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := cc.client.Client.Post(cc.baseURL+"/unregister", "application/json", bytes.NewReader(jsonData))
+	resp, err := cc.client.PostSigned(cc.baseURL+"/unregister", jsonData)
 	if err != nil {
 		return err
 	}
@@ -79,31 +89,52 @@ func (cc *CoordinatorClient) GetParams() (*types.ParamsResponse, error) {
 	maxRetries := 3
 	url := cc.baseURL + "/params/ckks"
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		fmt.Printf("尝试获取参数 (第%d次): %s\n", attempt, url)
+		logs.Printf("尝试获取参数 (第%d次): %s\n", attempt, url)
 		resp, err := cc.client.Client.Get(url)
 		if err != nil {
 			if attempt == maxRetries {
 				return nil, fmt.Errorf("获取参数失败，已重试%d次: %v", maxRetries, err)
 			}
-			fmt.Printf("获取参数失败，第%d次尝试: %v，正在重试...\n", attempt, err)
+			logs.Printf("获取参数失败，第%d次尝试: %v，正在重试...\n", attempt, err)
 			time.Sleep(2 * time.Second)
 			continue
 		}
 		defer resp.Body.Close()
 
-		fmt.Printf("参数请求成功，状态码: %d\n", resp.StatusCode)
+		if resp.StatusCode != http.StatusOK {
+			if attempt == maxRetries {
+				return nil, fmt.Errorf("获取参数失败，状态码: %d", resp.StatusCode)
+			}
+			logs.Printf("参数尚未就绪 (状态码 %d)，正在重试...\n", resp.StatusCode)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		logs.Printf("参数请求成功，状态码: %d\n", resp.StatusCode)
 		// 解析所有字段，params_literal现在是base64编码的字符串
 		var raw struct {
 			ParamsLiteral string   `json:"params_literal"` // 现在是base64编码的字符串
 			GalEls        []uint64 `json:"gal_els"`
 			CommonCRSSeed string   `json:"common_crs_seed"` // 统一的CRS种子
 			DataSplitType string   `json:"data_split_type"`
+			Threshold     int      `json:"threshold"`
+			ExpectedN     int      `json:"expected_participants"`
+			InsecureDebug bool     `json:"insecure_debug"`
+
+			SessionID          string         `json:"session_id"`
+			CRSCoordinatorSeed string         `json:"crs_coordinator_seed"`
+			CRSContributions   map[int]string `json:"crs_contributions"`
+			CRSContributors    int            `json:"crs_contributors"`
+
+			ParamProfile string          `json:"param_profile"`
+			SecurityBits int             `json:"security_bits"`
+			Smudging     smudging.Config `json:"smudging"`
 		}
 		if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
 			if attempt == maxRetries {
 				return nil, fmt.Errorf("解析参数失败，已重试%d次: %v", maxRetries, err)
 			}
-			fmt.Printf("解析参数失败，第%d次尝试: %v，正在重试...\n", attempt, err)
+			logs.Printf("解析参数失败，第%d次尝试: %v，正在重试...\n", attempt, err)
 			time.Sleep(2 * time.Second)
 			continue
 		}
@@ -114,37 +145,48 @@ func (cc *CoordinatorClient) GetParams() (*types.ParamsResponse, error) {
 			// Base64解码
 			paramsBytes, err := utils.DecodeFromBase64(raw.ParamsLiteral)
 			if err != nil {
-				fmt.Printf("参数base64解码失败: %v\n", err)
+				logs.Printf("参数base64解码失败: %v\n", err)
 				if attempt == maxRetries {
 					return nil, fmt.Errorf("参数base64解码失败，已重试%d次: %v", maxRetries, err)
 				}
-				fmt.Printf("参数base64解码失败，第%d次尝试: %v，正在重试...\n", attempt, err)
+				logs.Printf("参数base64解码失败，第%d次尝试: %v，正在重试...\n", attempt, err)
 				time.Sleep(2 * time.Second)
 				continue
 			}
 
 			// JSON反序列化
 			if err := json.Unmarshal(paramsBytes, &paramsLiteral); err != nil {
-				fmt.Printf("参数JSON反序列化失败: %v\n", err)
+				logs.Printf("参数JSON反序列化失败: %v\n", err)
 				if attempt == maxRetries {
 					return nil, fmt.Errorf("参数JSON反序列化失败，已重试%d次: %v", maxRetries, err)
 				}
-				fmt.Printf("参数JSON反序列化失败，第%d次尝试: %v，正在重试...\n", attempt, err)
+				logs.Printf("参数JSON反序列化失败，第%d次尝试: %v，正在重试...\n", attempt, err)
 				time.Sleep(2 * time.Second)
 				continue
 			}
 
-			fmt.Printf("成功解析paramsLiteral，LogN: %d, LogQ长度: %d\n", paramsLiteral.LogN, len(paramsLiteral.LogQ))
+			logs.Printf("成功解析paramsLiteral，LogN: %d, LogQ长度: %d\n", paramsLiteral.LogN, len(paramsLiteral.LogQ))
 		}
 
-		fmt.Printf("收到数据集划分方式: %s\n", raw.DataSplitType)
+		logs.Printf("收到数据集划分方式: %s\n", raw.DataSplitType)
+		logs.Printf("参数配置档: %s，安全级别: %d-bit\n", raw.ParamProfile, raw.SecurityBits)
 
 		params := &types.ParamsResponse{
-			Params:        paramsLiteral,
-			ParamsB64:     raw.ParamsLiteral,
-			GalEls:        raw.GalEls,
-			CommonCRSSeed: raw.CommonCRSSeed, // 统一的CRS种子
-			DataSplitType: raw.DataSplitType,
+			Params:               paramsLiteral,
+			ParamsB64:            raw.ParamsLiteral,
+			GalEls:               raw.GalEls,
+			CommonCRSSeed:        raw.CommonCRSSeed, // 统一的CRS种子
+			DataSplitType:        raw.DataSplitType,
+			Threshold:            raw.Threshold,
+			ExpectedParticipants: raw.ExpectedN,
+			InsecureDebug:        raw.InsecureDebug,
+			SessionID:            raw.SessionID,
+			CRSCoordinatorSeed:   raw.CRSCoordinatorSeed,
+			CRSContributions:     raw.CRSContributions,
+			CRSContributors:      raw.CRSContributors,
+			ParamProfile:         raw.ParamProfile,
+			SecurityBits:         raw.SecurityBits,
+			Smudging:             raw.Smudging.Normalize(),
 		}
 
 		return params, nil
@@ -152,169 +194,473 @@ func (cc *CoordinatorClient) GetParams() (*types.ParamsResponse, error) {
 	return nil, fmt.Errorf("获取参数失败，已达到最大重试次数")
 }
 
-// UploadPublicKeyShare 上传公钥份额
-func (cc *CoordinatorClient) UploadPublicKeyShare(shareData string) error {
-	reqBody, _ := json.Marshal(map[string]interface{}{
+// CommitCRS 提交CRS种子承诺
+func (cc *CoordinatorClient) CommitCRS(sessionID, commitment string) (*types.CRSStatusResponse, error) {
+	return cc.postCRS("/crs/commit", map[string]interface{}{
 		"participant_id": cc.participantID,
-		"share_data":     shareData,
+		"session_id":     sessionID,
+		"commitment":     commitment,
 	})
+}
 
-	resp, err := cc.client.Client.Post(cc.baseURL+"/keys/public", "application/json", bytes.NewReader(reqBody))
+// RevealCRS 公开CRS种子
+func (cc *CoordinatorClient) RevealCRS(sessionID, seedB64 string) (*types.CRSStatusResponse, error) {
+	return cc.postCRS("/crs/reveal", map[string]interface{}{
+		"participant_id": cc.participantID,
+		"session_id":     sessionID,
+		"seed":           seedB64,
+	})
+}
+
+// GetCRSStatus 获取CRS种子协商进度
+func (cc *CoordinatorClient) GetCRSStatus() (*types.CRSStatusResponse, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/crs/status")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status types.CRSStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// postCRS 发送CRS协商请求
+func (cc *CoordinatorClient) postCRS(path string, body map[string]interface{}) (*types.CRSStatusResponse, error) {
+	reqBody, _ := json.Marshal(body)
+	resp, err := cc.client.PostSigned(cc.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("上传公钥份额失败: %d", resp.StatusCode)
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("CRS协商请求失败: %d %s", resp.StatusCode, errResp.Error)
 	}
 
-	return nil
+	var status types.CRSStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
 }
 
-// UploadSecretKey 上传私钥
-func (cc *CoordinatorClient) UploadSecretKey(secretData string) error {
-	reqBody, _ := json.Marshal(map[string]interface{}{
-		"participant_id": cc.participantID,
-		"share_data":     secretData,
-	})
+// postRetry 发送上传请求，协调器重启恢复会话期间连接失败时重试
+// 协调器按 participant_id 保存份额，重复上传只会覆盖原份额
+func (cc *CoordinatorClient) postRetry(path string, send func(url string) (*http.Response, error)) (*http.Response, error) {
+	maxRetries := 10
+	for attempt := 1; ; attempt++ {
+		resp, err := send(cc.baseURL + path)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt == maxRetries {
+			return nil, fmt.Errorf("上传 %s 失败，已重试%d次: %v", path, maxRetries, err)
+		}
+		logs.Printf("上传 %s 失败，第%d次尝试: %v，正在重试...\n", path, attempt, err)
+		time.Sleep(3 * time.Second)
+	}
+}
 
-	resp, err := cc.client.Client.Post(cc.baseURL+"/keys/secret", "application/json", bytes.NewReader(reqBody))
+// postShare 以帧格式上传密钥份额：控制帧和份额的二进制编码
+func (cc *CoordinatorClient) postShare(path string, control map[string]interface{}, share []byte) error {
+	resp, err := cc.postRetry(path, func(url string) (*http.Response, error) {
+		return cc.client.PostMessage(url, control, share)
+	})
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("上传私钥失败: %d", resp.StatusCode)
+		return fmt.Errorf("%s", readError(resp))
 	}
+	return nil
+}
 
+// UploadPublicKeyShare 上传公钥份额
+func (cc *CoordinatorClient) UploadPublicKeyShare(share []byte) error {
+	if err := cc.postShare("/keys/public", map[string]interface{}{
+		"participant_id": cc.participantID,
+	}, share); err != nil {
+		return fmt.Errorf("上传公钥份额失败: %v", err)
+	}
+	return nil
+}
+
+// UploadSecretKey 上传私钥
+func (cc *CoordinatorClient) UploadSecretKey(secret []byte) error {
+	if err := cc.postShare("/keys/secret", map[string]interface{}{
+		"participant_id": cc.participantID,
+	}, secret); err != nil {
+		return fmt.Errorf("上传私钥失败: %v", err)
+	}
 	return nil
 }
 
 // UploadGaloisKeyShare 上传伽罗瓦密钥份额
-func (cc *CoordinatorClient) UploadGaloisKeyShare(galEl uint64, shareData string) error {
-	reqBody, _ := json.Marshal(map[string]interface{}{
+func (cc *CoordinatorClient) UploadGaloisKeyShare(galEl uint64, share []byte) error {
+	if err := cc.postShare("/keys/galois", map[string]interface{}{
 		"participant_id": cc.participantID,
 		"gal_el":         galEl,
-		"share_data":     shareData,
-	})
+	}, share); err != nil {
+		return fmt.Errorf("上传伽罗瓦密钥份额失败: %v", err)
+	}
+	return nil
+}
 
-	resp, err := cc.client.Client.Post(cc.baseURL+"/keys/galois", "application/json", bytes.NewReader(reqBody))
+// UploadRelinearizationKeyShare 上传重线性化密钥份额
+func (cc *CoordinatorClient) UploadRelinearizationKeyShare(round int, share []byte) error {
+	if err := cc.postShare("/keys/relin", map[string]interface{}{
+		"participant_id": cc.participantID,
+		"round":          round,
+	}, share); err != nil {
+		return fmt.Errorf("上传重线性化密钥份额失败: %v", err)
+	}
+	return nil
+}
+
+// GetRelinearizationKeyRound1Aggregated 获取第一轮聚合结果
+func (cc *CoordinatorClient) GetRelinearizationKeyRound1Aggregated() (multiparty.RelinearizationKeyGenShare, error) {
+	return cc.getRelinRound1(cc.baseURL + "/keys/relin/round1")
+}
+
+// getRelinRound1 下载聚合后的第一轮重线性化密钥份额，响应为控制帧和份额的二进制编码
+func (cc *CoordinatorClient) getRelinRound1(url string) (multiparty.RelinearizationKeyGenShare, error) {
+	var share multiparty.RelinearizationKeyGenShare
+	resp, err := cc.client.GetMessage(url)
+	if err != nil {
+		return share, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return share, fmt.Errorf("获取重线性化密钥第一轮份额失败: %s", readError(resp))
+	}
+
+	objects, err := wire.ReadResponse(resp, nil)
+	if err != nil {
+		return share, err
+	}
+	if len(objects) != 1 {
+		return share, fmt.Errorf("响应包含 %d 个对象，应为1个", len(objects))
+	}
+	if err := share.UnmarshalBinary(objects[0]); err != nil {
+		return share, fmt.Errorf("反序列化第一轮份额失败: %v", err)
+	}
+	return share, nil
+}
+
+// PollStatus 查询一次密钥生成状态，等待状态变化使用 WaitForStatus
+func (cc *CoordinatorClient) PollStatus() (*types.StatusResponse, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/setup/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status types.StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// WaitForCompletion 等待重线性化密钥聚合完成
+func (cc *CoordinatorClient) WaitForCompletion() error {
+	_, err := cc.WaitForStatus(context.Background(), func(status *types.StatusResponse) bool {
+		if !status.RlkReady {
+			logs.Printf("等待密钥生成完成... (重线性化密钥: %v)\n", status.RlkReady)
+		}
+		return status.RlkReady
+	})
 	if err != nil {
 		return err
 	}
+	logs.Println("所有密钥生成完成！")
+	return nil
+}
+
+// GetParticipantsList 获取已上报URL的参与方列表
+func (cc *CoordinatorClient) GetParticipantsList() ([]types.PeerInfo, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/participants/list")
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
+	var peers []types.PeerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// GetMembers 获取持有集体私钥份额的成员、候选成员和成员纪元
+func (cc *CoordinatorClient) GetMembers() (*types.MembershipResponse, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/members")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("上传伽罗瓦密钥份额失败: %d", resp.StatusCode)
+		return nil, fmt.Errorf("获取成员失败: %s", readError(resp))
 	}
 
-	return nil
+	var members types.MembershipResponse
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, err
+	}
+	return &members, nil
 }
 
-// UploadRelinearizationKeyShare 上传重线性化密钥份额
-func (cc *CoordinatorClient) UploadRelinearizationKeyShare(round int, shareData string) error {
+// Reencrypt 请求协调器组织公钥切换，把集体公钥下的密文（信封）交付给已登记的结果接收方
+// taskID 为已批准的公钥切换任务
+func (cc *CoordinatorClient) Reencrypt(taskID, consumerID string, ciphertext []byte) (*types.ReencryptResponse, error) {
+	resp, err := cc.client.PostMessage(cc.baseURL+"/consumers/reencrypt", map[string]interface{}{
+		"task_id":     taskID,
+		"consumer_id": consumerID,
+	}, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("公钥切换失败: %s", readError(resp))
+	}
+
+	var result types.ReencryptResponse
+	objects, err := wire.ReadResponse(resp, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("公钥切换结果包含 %d 个对象，应为1个", len(objects))
+	}
+	result.Ciphertext = objects[0]
+	return &result, nil
+}
+
+// ProposeTask 向协调器提议解密任务，声明用途和密文哈希
+func (cc *CoordinatorClient) ProposeTask(kind, purpose, ciphertextHash, consumerID string) (*types.TaskInfo, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"participant_id":  cc.participantID,
+		"kind":            kind,
+		"purpose":         purpose,
+		"ciphertext_hash": ciphertextHash,
+		"consumer_id":     consumerID,
+	})
+	return cc.postTask("/tasks", reqBody)
+}
+
+// VoteTask 批准或拒绝解密任务
+func (cc *CoordinatorClient) VoteTask(taskID string, approve bool) (*types.TaskInfo, error) {
 	reqBody, _ := json.Marshal(map[string]interface{}{
 		"participant_id": cc.participantID,
-		"round":          round,
-		"share_data":     shareData,
+		"approve":        approve,
 	})
+	return cc.postTask("/tasks/"+taskID+"/vote", reqBody)
+}
 
-	resp, err := cc.client.Client.Post(cc.baseURL+"/keys/relin", "application/json", bytes.NewReader(reqBody))
+// postTask 发送任务提议或表决请求
+func (cc *CoordinatorClient) postTask(path string, reqBody []byte) (*types.TaskInfo, error) {
+	resp, err := cc.client.PostSigned(cc.baseURL+path, reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("上传重线性化密钥份额失败: %d", resp.StatusCode)
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return nil, fmt.Errorf("任务请求失败: %d %s", resp.StatusCode, errResp.Error)
 	}
 
-	return nil
+	var task types.TaskInfo
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
 }
 
-// GetRelinearizationKeyRound1Aggregated 获取第一轮聚合结果
-func (cc *CoordinatorClient) GetRelinearizationKeyRound1Aggregated() (multiparty.RelinearizationKeyGenShare, error) {
-	resp, err := cc.client.Client.Get(cc.baseURL + "/keys/relin/round1")
+// GetTask 查询解密任务
+func (cc *CoordinatorClient) GetTask(taskID string) (*types.TaskInfo, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/tasks/" + taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("查询任务 %s 失败: %d", taskID, resp.StatusCode)
+	}
+	var task types.TaskInfo
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ListTasks 列出解密任务和授权策略，status 为空时列出全部
+func (cc *CoordinatorClient) ListTasks(status string) ([]types.TaskInfo, *types.TaskPolicy, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/tasks?status=" + status)
 	if err != nil {
-		return multiparty.RelinearizationKeyGenShare{}, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	var response struct {
-		Share string `json:"share"`
+		Policy types.TaskPolicy `json:"policy"`
+		Tasks  []types.TaskInfo `json:"tasks"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return multiparty.RelinearizationKeyGenShare{}, err
+		return nil, nil, err
 	}
+	return response.Tasks, &response.Policy, nil
+}
 
-	shareBytes, err := utils.DecodeFromBase64(response.Share)
+// GetPolicy 查询协调器当前的解密授权策略
+func (cc *CoordinatorClient) GetPolicy() (*types.TaskPolicy, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/policy")
 	if err != nil {
-		return multiparty.RelinearizationKeyGenShare{}, err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	var share multiparty.RelinearizationKeyGenShare
-	if err := utils.DecodeShare(shareBytes, &share); err != nil {
-		return multiparty.RelinearizationKeyGenShare{}, err
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("查询授权策略失败: %d", resp.StatusCode)
+	}
+	var policy types.TaskPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, err
 	}
+	return &policy, nil
+}
 
-	return share, nil
+// GetAggregatedKeys 获取聚合后的密钥
+func (cc *CoordinatorClient) GetAggregatedKeys() (*types.KeysResponse, error) {
+	logs.Printf("开始请求聚合密钥...\n")
+
+	keys, err := cc.getKeys(cc.baseURL + "/keys/aggregated")
+	if err != nil {
+		logs.Printf("获取聚合密钥失败: %v\n", err)
+		return nil, err
+	}
+
+	logs.Printf("成功获取聚合密钥，包含 %d 个伽罗瓦密钥\n", len(keys.GaloisKeys))
+	return keys, nil
 }
 
-// PollStatus 轮询状态
-func (cc *CoordinatorClient) PollStatus() (*types.StatusResponse, error) {
-	resp, err := cc.client.Client.Get(cc.baseURL + "/setup/status")
+// getKeys 下载并解码集体密钥，响应格式见 types.KeysHeader
+func (cc *CoordinatorClient) getKeys(url string) (*types.KeysResponse, error) {
+	resp, err := cc.client.GetMessage(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", readError(resp))
+	}
 
-	var status types.StatusResponse
-	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+	var header types.KeysHeader
+	objects, err := wire.ReadResponse(resp, &header)
+	if err != nil {
 		return nil, err
 	}
+	return types.DecodeKeys(header, objects)
+}
 
-	return &status, nil
+// ==================== 集体密钥轮换 ====================
+
+// UploadKeyRotationShare 上传新纪元的密钥份额，kind 为 public/secret/galois/relin
+func (cc *CoordinatorClient) UploadKeyRotationShare(epoch, attempt int, kind string, galEl uint64, round int, share []byte) error {
+	if err := cc.postShare("/keys/rotation/shares", map[string]interface{}{
+		"participant_id": cc.participantID,
+		"epoch":          epoch,
+		"attempt":        attempt,
+		"kind":           kind,
+		"gal_el":         galEl,
+		"round":          round,
+	}, share); err != nil {
+		return fmt.Errorf("上传第 %d 纪元的 %s 份额失败: %v", epoch, kind, err)
+	}
+	return nil
 }
 
-// WaitForCompletion 等待完成
-func (cc *CoordinatorClient) WaitForCompletion() error {
-	for {
-		status, err := cc.PollStatus()
-		if err != nil {
-			fmt.Println("状态查询失败:", err)
-			time.Sleep(2 * time.Second)
-			continue
-		}
+// GetKeyRotationStatus 查询密钥轮换状态
+func (cc *CoordinatorClient) GetKeyRotationStatus() (*types.KeyRotationStatus, error) {
+	resp, err := cc.client.Client.Get(cc.baseURL + "/keys/rotation")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		if status.RlkReady {
-			fmt.Println("所有密钥生成完成！")
-			return nil
-		}
+	var status types.KeyRotationStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
 
-		fmt.Printf("等待密钥生成完成... (重线性化密钥: %v)\n", status.RlkReady)
-		time.Sleep(2 * time.Second)
+// GetKeyRotationRelinRound1 获取新纪元聚合后的第一轮重线性化密钥份额
+func (cc *CoordinatorClient) GetKeyRotationRelinRound1(epoch, attempt int) (multiparty.RelinearizationKeyGenShare, error) {
+	share, err := cc.getRelinRound1(fmt.Sprintf("%s/keys/rotation/relin/round1?epoch=%d&attempt=%d", cc.baseURL, epoch, attempt))
+	if err != nil {
+		return share, fmt.Errorf("第 %d 纪元: %v", epoch, err)
 	}
+	return share, nil
 }
 
-// GetAggregatedKeys 获取聚合后的密钥
-func (cc *CoordinatorClient) GetAggregatedKeys() (*types.KeysResponse, error) {
-	fmt.Printf("开始请求聚合密钥...\n")
+// GetKeyRotationKeys 获取新纪元的集体密钥
+func (cc *CoordinatorClient) GetKeyRotationKeys(epoch, attempt int) (*types.KeysResponse, error) {
+	keys, err := cc.getKeys(fmt.Sprintf("%s/keys/rotation/keys?epoch=%d&attempt=%d", cc.baseURL, epoch, attempt))
+	if err != nil {
+		return nil, fmt.Errorf("获取第 %d 纪元的集体密钥失败: %v", epoch, err)
+	}
+	return keys, nil
+}
+
+// ReportKeyRotation 报告密钥轮换进度，stage 为 switched/committed/failed
+func (cc *CoordinatorClient) ReportKeyRotation(epoch, attempt int, stage, errMsg string) (*types.KeyRotationStatus, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"participant_id": cc.participantID,
+		"epoch":          epoch,
+		"attempt":        attempt,
+		"stage":          stage,
+		"error":          errMsg,
+	})
 
-	resp, err := cc.client.Client.Get(cc.baseURL + "/keys/aggregated")
+	resp, err := cc.postRetry("/keys/rotation/report", func(url string) (*http.Response, error) {
+		return cc.client.PostSigned(url, reqBody)
+	})
 	if err != nil {
-		fmt.Printf("请求聚合密钥失败: %v\n", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("报告密钥轮换进度失败: %s", readError(resp))
+	}
 
-	var keys types.KeysResponse
-	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
-		fmt.Printf("解析聚合密钥响应失败: %v\n", err)
+	var status types.KeyRotationStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
 		return nil, err
 	}
+	return &status, nil
+}
 
-	fmt.Printf("成功获取聚合密钥，包含 %d 个伽罗瓦密钥\n", len(keys.GaloisKeys))
-	return &keys, nil
+// readError 读取协调器错误响应中的error字段
+func readError(resp *http.Response) string {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	return fmt.Sprintf("%d %s", resp.StatusCode, errResp.Error)
 }
@@ -0,0 +1,172 @@
+package coordinator
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// eventIdleTimeout 超过该时间没有收到事件或保活消息时认为连接已断开（协调器每15秒发送一次保活）
+	eventIdleTimeout = 45 * time.Second
+	// eventRetryInterval 事件流断开后重新订阅的间隔，也是订阅失败时退回轮询的间隔
+	eventRetryInterval = 2 * time.Second
+)
+
+// Events 订阅协调器的会话事件流（Server-Sent Events），连接建立后第一个事件为 snapshot
+// 连接断开、协调器关闭会话或 ctx 取消时关闭返回的通道，重新订阅后以新的快照为准
+func (cc *CoordinatorClient) Events(ctx context.Context) (<-chan types.CoordinatorEvent, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cc.baseURL+"/events", nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// 事件流是长连接，不能使用带整体超时的客户端，只复用其传输层（mTLS）
+	client := &http.Client{Transport: cc.client.Client.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		defer cancel()
+		return nil, fmt.Errorf("订阅会话事件失败: %d %s", resp.StatusCode, readError(resp))
+	}
+
+	ch := make(chan types.CoordinatorEvent, 16)
+	// 长时间收不到保活消息时断开连接，使读取返回
+	idle := time.AfterFunc(eventIdleTimeout, cancel)
+	go func() {
+		defer close(ch)
+		defer cancel()
+		defer idle.Stop()
+		defer resp.Body.Close()
+		readEvents(resp.Body, func() { idle.Reset(eventIdleTimeout) }, func(data []byte) bool {
+			var ev types.CoordinatorEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				logs.Printf("解析会话事件失败: %v\n", err)
+				return true
+			}
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch, nil
+}
+
+// readEvents 逐个读取Server-Sent Events的 data 字段，每读到一行调用 onLine，handle 返回 false 时停止
+func readEvents(r io.Reader, onLine func(), handle func(data []byte) bool) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		onLine()
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			// 空行结束一个事件
+			if data.Len() > 0 {
+				if !handle(data.Bytes()) {
+					return
+				}
+				data.Reset()
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+		}
+		// 以 ':' 开头的保活注释和 id/event 字段忽略，事件体中已包含编号和类型
+	}
+}
+
+// WaitForStatus 等待密钥生成状态满足 ready，由协调器推送的事件驱动，每收到一个状态调用一次 ready
+// 事件流断开时重新订阅；协调器不支持事件流或订阅失败时退回轮询 /setup/status
+func (cc *CoordinatorClient) WaitForStatus(ctx context.Context, ready func(*types.StatusResponse) bool) (*types.StatusResponse, error) {
+	for {
+		status, err := cc.watchStatus(ctx, ready)
+		if status != nil {
+			return status, nil
+		}
+		if err != nil {
+			// 订阅失败时轮询一次
+			if status, pollErr := cc.PollStatus(); pollErr == nil && ready(status) {
+				return status, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(eventRetryInterval):
+		}
+	}
+}
+
+// WaitForPhase 等待会话推进到 phase 或之后的阶段，会话进入 failed 或提前关闭时返回错误
+func (cc *CoordinatorClient) WaitForPhase(ctx context.Context, phase string) (*types.StatusResponse, error) {
+	target := phaseIndex(phase)
+	if target < 0 {
+		return nil, fmt.Errorf("未知的会话阶段: %s", phase)
+	}
+	var ended error
+	status, err := cc.WaitForStatus(ctx, func(status *types.StatusResponse) bool {
+		switch {
+		case status.Phase == types.PhaseFailed:
+			ended = fmt.Errorf("会话已失败: %s", status.PhaseError)
+			return true
+		case status.Phase == types.PhaseClosed && phase != types.PhaseClosed:
+			ended = fmt.Errorf("会话已关闭")
+			return true
+		}
+		return phaseIndex(status.Phase) >= target
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ended != nil {
+		return nil, ended
+	}
+	return status, nil
+}
+
+// phaseIndex 阶段在推进顺序中的位置，failed 和未知阶段为 -1
+func phaseIndex(phase string) int {
+	for i, p := range types.SessionPhases {
+		if p == phase {
+			return i
+		}
+	}
+	return -1
+}
+
+// watchStatus 订阅一次事件流，直到状态满足 ready 或连接断开
+func (cc *CoordinatorClient) watchStatus(ctx context.Context, ready func(*types.StatusResponse) bool) (*types.StatusResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := cc.Events(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for ev := range events {
+		if ev.Status != nil && ready(ev.Status) {
+			return ev.Status, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,70 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayHandshakeTimeout 建立中继连接的握手超时
+const relayHandshakeTimeout = 10 * time.Second
+
+// RelayDial 建立到协调器的中继连接，握手请求以本方身份签名
+// tlsConfig 为启用mTLS时的客户端配置，明文HTTP时为 nil
+func (cc *CoordinatorClient) RelayDial(ctx context.Context, tlsConfig *tls.Config) (*websocket.Conn, error) {
+	if cc.client.Identity == nil {
+		return nil, fmt.Errorf("未设置签名身份")
+	}
+	req, err := http.NewRequest(http.MethodGet, cc.baseURL+"/relay", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := cc.client.Identity.SignRequest(req, cc.client.SignerID, nil); err != nil {
+		return nil, err
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: relayHandshakeTimeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	// http:// -> ws://，https:// -> wss://
+	wsURL := "ws" + strings.TrimPrefix(cc.baseURL, "http") + "/relay"
+	ws, resp, err := dialer.DialContext(ctx, wsURL, req.Header)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			return nil, fmt.Errorf("建立中继连接失败: %s", readError(resp))
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+// RelayForward 把请求信封经协调器转发给参与方 to，返回响应信封
+func (cc *CoordinatorClient) RelayForward(ctx context.Context, to int, sealed []byte) ([]byte, error) {
+	if cc.client.Identity == nil {
+		return nil, fmt.Errorf("未设置签名身份")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/relay/%d", cc.baseURL, to), bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := cc.client.Identity.Do(cc.client.Client, req, cc.client.SignerID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("中继转发失败: %s", readError(resp))
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,366 @@
+package crypto
+
+import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/wire"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// ==================== 批量协同解密与刷新 ====================
+//
+// 多个密文合并为一轮：向活跃集合内每个参与方只发一次请求（/partial_decrypt/batch、/partial_refresh/batch），
+// 对方用工作池并行生成份额并流式返回。本地份额生成和聚合同样并行进行。
+// 某个参与方整体失败（连接失败、非200响应、流中断）时将其排除，尚未完成的密文换一组活跃集合重试；
+// 参与方对单个密文拒绝（任务未获授权）时该密文直接失败，其他密文不受影响。
+
+// batchRound 一轮批量份额收集的配置
+type batchRound[S any] struct {
+	name   string                               // 日志中的操作名称
+	path   string                               // 批量份额接口路径
+	cts    []*rlwe.Ciphertext                   // 待处理的密文
+	items  []types.BatchItem                    // 与密文一一对应的描述
+	local  func(i int, active []int) (S, error) // 生成本地份额
+	decode func(i int, data []byte) (S, error)  // 解析对方为第i个密文返回的份额信封
+	key    envelope.Fingerprint                 // 密文所在集体公钥的指纹，密文和份额的信封绑定该指纹
+
+	required int               // 活跃集合的大小，为0时按门限配置
+	members  []int             // 可选入活跃集合的参与方，为空时为当前成员
+	header   types.BatchHeader // 请求头的附加字段，数量和活跃集合每轮填写
+}
+
+// peerBatchShare 参与方对单个密文的响应
+type peerBatchShare[S any] struct {
+	share   S
+	err     error
+	refused bool
+}
+
+// CollaborativeDecryptBatch 在一轮中协同解密多个密文，taskIDs 与密文一一对应，须为已批准的解密任务
+// 返回与输入一一对应的明文和错误，以及最后一组活跃参与方和各参与方的失败原因
+func (ds *DecryptionService) CollaborativeDecryptBatch(ctx context.Context, cts []*rlwe.Ciphertext, taskIDs []string, onlinePeers map[int]string, myID int) ([]*rlwe.Plaintext, []error, types.RoundReport) {
+	items := make([]types.BatchItem, len(cts))
+	for i, ct := range cts {
+		items[i] = types.BatchItem{TaskID: taskIDs[i], Level: ct.Level()}
+	}
+	params, key := ds.keyManager.GetParams(), ds.keyManager.KeyFingerprint()
+	round := batchRound[multiparty.KeySwitchShare]{
+		name:  "解密",
+		path:  "/partial_decrypt/batch",
+		cts:   cts,
+		items: items,
+		local: func(i int, active []int) (multiparty.KeySwitchShare, error) {
+			return ds.GeneratePartialDecryptShare(cts[i], taskIDs[i], active)
+		},
+		decode: func(i int, data []byte) (multiparty.KeySwitchShare, error) {
+			return envelope.OpenKeySwitchShare(params, key, cts[i].Level(), data)
+		},
+		key: key,
+	}
+	shares, errs, report := collectBatchShares(ctx, ds.client, ds.keyManager, round, onlinePeers, myID)
+
+	pts := make([]*rlwe.Plaintext, len(cts))
+	parallelFor(len(cts), func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		if pts[i], errs[i] = ds.FinalizeCollaborativeDecryption(cts[i], shares[i]); errs[i] != nil {
+			errs[i] = fmt.Errorf("聚合解密失败: %v", errs[i])
+		}
+	})
+	return pts, errs, report
+}
+
+// CollaborativeRefreshBatch 在一轮中协同刷新多个密文，taskIDs 与密文一一对应且每次刷新必须不同
+// 返回与输入一一对应的刷新后密文和错误，以及最后一组活跃参与方和各参与方的失败原因
+func (rs *RefreshService) CollaborativeRefreshBatch(ctx context.Context, cts []*rlwe.Ciphertext, taskIDs []string, onlinePeers map[int]string, myID int) ([]*rlwe.Ciphertext, []error, types.RoundReport) {
+	items := make([]types.BatchItem, len(cts))
+	for i, ct := range cts {
+		items[i] = types.BatchItem{TaskID: taskIDs[i], Level: ct.Level()}
+	}
+	params, key := rs.keyManager.GetParams(), rs.keyManager.KeyFingerprint()
+	round := batchRound[multiparty.RefreshShare]{
+		name:  "刷新",
+		path:  "/partial_refresh/batch",
+		cts:   cts,
+		items: items,
+		local: func(i int, active []int) (multiparty.RefreshShare, error) {
+			return rs.GenerateRefreshShare(cts[i], taskIDs[i], active)
+		},
+		decode: func(i int, data []byte) (multiparty.RefreshShare, error) {
+			return envelope.OpenRefreshShare(params, key, cts[i].Level(), data)
+		},
+		key: key,
+	}
+	shares, errs, report := collectBatchShares(ctx, rs.client, rs.keyManager, round, onlinePeers, myID)
+
+	refreshed := make([]*rlwe.Ciphertext, len(cts))
+	parallelFor(len(cts), func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		if refreshed[i], errs[i] = rs.FinalizeCollaborativeRefresh(cts[i], shares[i], taskIDs[i]); errs[i] != nil {
+			errs[i] = fmt.Errorf("聚合刷新失败: %v", errs[i])
+		}
+	})
+	return refreshed, errs, report
+}
+
+// collectBatchShares 从活跃参与方集合收集每个密文的全部份额
+// 返回每个密文收集到的份额（包括本地份额）和失败原因
+func collectBatchShares[S any](ctx context.Context, client *types.HTTPClient, km *KeyManager, round batchRound[S], onlinePeers map[int]string, myID int) ([][]S, []error, types.RoundReport) {
+	var report types.RoundReport
+	n := len(round.cts)
+	shares := make([][]S, n)
+	errs := make([]error, n)
+
+	// 密文信封在各轮之间复用
+	params := km.GetParams()
+	encoded := make([][]byte, n)
+	pending := make([]int, 0, n)
+	for i, ct := range round.cts {
+		data, err := envelope.SealCiphertext(params, round.key, ct)
+		if err != nil {
+			errs[i] = fmt.Errorf("密文序列化失败: %v", err)
+			continue
+		}
+		encoded[i] = data
+		pending = append(pending, i)
+	}
+
+	required := round.required
+	if required == 0 {
+		required = km.RequiredParticipants()
+	}
+	// 候选成员没有当前集体私钥的份额，不能进入活跃集合
+	if round.members != nil {
+		onlinePeers = filterPeers(onlinePeers, round.members)
+	} else {
+		onlinePeers = km.MemberPeers(onlinePeers)
+	}
+	failed := make(map[int]bool)
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			markFailed(errs, pending, fmt.Errorf("协同%s超时: %v", round.name, err))
+			break
+		}
+		active, err := SelectActiveParticipants(onlinePeers, myID, required, failed)
+		if err != nil {
+			markFailed(errs, pending, err)
+			break
+		}
+		report.Participants = active
+		logs.Printf("本次批量协同%s活跃参与方: %v，密文 %d 个\n", round.name, active, len(pending))
+
+		// 自己先为每个密文算一份份额，换组后份额随活跃集合变化需要重新计算
+		local := make([]S, len(pending))
+		localErrs := make([]error, len(pending))
+		parallelFor(len(pending), func(k int) {
+			local[k], localErrs[k] = round.local(pending[k], active)
+		})
+		var items []int
+		for k, i := range pending {
+			if localErrs[k] != nil {
+				errs[i] = fmt.Errorf("本地%s份额生成失败: %v", round.name, localErrs[k])
+				continue
+			}
+			shares[i] = []S{local[k]}
+			items = append(items, i)
+		}
+		if len(items) == 0 {
+			break
+		}
+		header := round.header
+		header.Count, header.Participants = len(items), active
+		body, err := encodeBatchRequest(client, header, round.items, encoded, items)
+		if err != nil {
+			markFailed(errs, items, err)
+			break
+		}
+
+		// 向活跃集合内的其他参与方并发发送同一个批量请求
+		type peerResp struct {
+			PeerID int
+			Shares []peerBatchShare[S]
+			Err    error
+		}
+		results := make(chan peerResp, len(active)-1)
+		for _, peerID := range active {
+			if peerID == myID {
+				continue // 跳过自己
+			}
+			go func(peerID int, peerURL string) {
+				shares, err := requestBatchShares(ctx, client, peerURL+round.path, body, items, round.decode)
+				results <- peerResp{PeerID: peerID, Shares: shares, Err: err}
+			}(peerID, onlinePeers[peerID])
+		}
+
+		// 整体失败的参与方被排除，单个密文失败时区分拒绝（密文失败）和其他错误（换组重试）
+		retry := make([]bool, len(items))
+		for r := 0; r < len(active)-1; r++ {
+			res := <-results
+			if res.Err != nil {
+				logs.Printf("[警告] 获取参与方 %d 批量%s份额失败: %v\n", res.PeerID, round.name, res.Err)
+				report.PeerErrors = append(report.PeerErrors, types.PeerError{PeerID: res.PeerID, Error: res.Err.Error()})
+				failed[res.PeerID] = true
+				for k := range retry {
+					retry[k] = true
+				}
+				continue
+			}
+			peerFailed := false
+			for k, i := range items {
+				item := res.Shares[k]
+				switch {
+				case item.refused:
+					errs[i] = fmt.Errorf("参与方 %d 拒绝提供%s份额: %v", res.PeerID, round.name, item.err)
+				case item.err != nil:
+					if !peerFailed {
+						report.PeerErrors = append(report.PeerErrors, types.PeerError{PeerID: res.PeerID, Error: item.err.Error()})
+					}
+					peerFailed = true
+					retry[k] = true
+				default:
+					shares[i] = append(shares[i], item.share)
+				}
+			}
+			if peerFailed {
+				logs.Printf("[警告] 参与方 %d 未能为部分密文提供%s份额\n", res.PeerID, round.name)
+				failed[res.PeerID] = true
+			}
+		}
+
+		pending = pending[:0]
+		for k, i := range items {
+			if errs[i] != nil {
+				shares[i] = nil
+				continue
+			}
+			if retry[k] {
+				shares[i] = nil
+				pending = append(pending, i)
+			}
+		}
+		if len(pending) > 0 {
+			logs.Printf("%d 个密文需要重试，排除 %v 后重新选择活跃集合\n", len(pending), keysOf(failed))
+		}
+	}
+
+	done := 0
+	for i := range errs {
+		if errs[i] == nil {
+			done++
+		}
+	}
+	logs.Printf("批量协同%s: %d/%d 个密文收集到全部份额\n", round.name, done, n)
+	return shares, errs, report
+}
+
+// encodeBatchRequest 按帧格式编码批量份额请求：请求头之后每个密文依次为描述帧和密文信封
+func encodeBatchRequest(client *types.HTTPClient, header types.BatchHeader, items []types.BatchItem, encoded [][]byte, indices []int) ([]byte, error) {
+	objects := make([][]byte, 0, 2*len(indices))
+	for _, i := range indices {
+		meta, err := json.Marshal(items[i])
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, meta, encoded[i])
+	}
+	return client.EncodeMessage(header, objects...)
+}
+
+// requestBatchShares 发送批量请求并流式读取请求中每个密文（items 为密文序号）的份额，返回按请求顺序排列的结果
+func requestBatchShares[S any](ctx context.Context, client *types.HTTPClient, url string, body []byte, items []int, decode func(int, []byte) (S, error)) ([]peerBatchShare[S], error) {
+	resp, err := client.PostEncodedContext(ctx, url, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, peerStatusError(resp)
+	}
+	stream, err := wire.ResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	count := len(items)
+	results := make([]peerBatchShare[S], count)
+	received := make([]bool, count)
+	for r := 0; r < count; r++ {
+		frame, err := wire.ReadFrame(stream)
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("响应只包含 %d/%d 个份额", r, count)
+			}
+			return nil, fmt.Errorf("读取份额失败: %v", err)
+		}
+		var header types.BatchShareHeader
+		if err := json.Unmarshal(frame, &header); err != nil {
+			return nil, fmt.Errorf("份额描述解析失败: %v", err)
+		}
+		if header.Index < 0 || header.Index >= count || received[header.Index] {
+			return nil, fmt.Errorf("份额序号 %d 无效或重复", header.Index)
+		}
+		received[header.Index] = true
+
+		if frame, err = wire.ReadFrame(stream); err != nil {
+			return nil, fmt.Errorf("读取份额失败: %v", err)
+		}
+		if header.Error != "" {
+			results[header.Index] = peerBatchShare[S]{err: fmt.Errorf("%s", header.Error), refused: header.Refused}
+			continue
+		}
+		share, err := decode(items[header.Index], frame)
+		if err != nil {
+			results[header.Index] = peerBatchShare[S]{err: fmt.Errorf("份额反序列化失败: %v", err)}
+			continue
+		}
+		results[header.Index] = peerBatchShare[S]{share: share}
+	}
+	return results, nil
+}
+
+// markFailed 把indices中尚未失败的密文标记为err
+func markFailed(errs []error, indices []int, err error) {
+	for _, i := range indices {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+	}
+}
+
+// parallelFor 用与CPU核数相同的工作协程并行执行 fn(0..n-1)
+func parallelFor(n int, fn func(i int)) {
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
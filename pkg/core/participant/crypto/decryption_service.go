@@ -1,12 +1,19 @@
 package crypto
 
 import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/types"
-	"MPHEDev/pkg/core/participant/utils"
+	"MPHEDev/pkg/core/smudging"
+	"MPHEDev/pkg/core/wire"
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net/http"
+	"time"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/multiparty"
@@ -14,10 +21,22 @@ import (
 	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 )
 
+// DefaultRoundTimeout 一次协同解密/刷新收集份额的默认超时（包括换组重试）
+const DefaultRoundTimeout = 2 * time.Minute
+
 // DecryptionService 解密服务
 type DecryptionService struct {
 	keyManager *KeyManager
 	client     *types.HTTPClient
+	authorize  TaskAuthorizer
+}
+
+// TaskAuthorizer 为密文提议解密任务并等待批准，返回任务ID
+type TaskAuthorizer func(kind, purpose string, ct *rlwe.Ciphertext) (string, error)
+
+// SetTaskAuthorizer 设置解密任务授权，发起协同解密前须先获得批准
+func (ds *DecryptionService) SetTaskAuthorizer(authorize TaskAuthorizer) {
+	ds.authorize = authorize
 }
 
 // NewDecryptionService 创建新的解密服务
@@ -29,14 +48,23 @@ func NewDecryptionService(keyManager *KeyManager, client *types.HTTPClient) *Dec
 }
 
 // GeneratePartialDecryptShare 生成本地解密份额
-func (ds *DecryptionService) GeneratePartialDecryptShare(ciphertext *rlwe.Ciphertext, taskID string) (multiparty.KeySwitchShare, error) {
+// active 为本次协同解密的活跃参与方集合，门限模式下用于计算加法份额
+func (ds *DecryptionService) GeneratePartialDecryptShare(ciphertext *rlwe.Ciphertext, taskID string, active []int) (multiparty.KeySwitchShare, error) {
 	params := ds.keyManager.GetParams()
 
+	sk, err := ds.keyManager.SecretKeyForActiveSet(active)
+	if err != nil {
+		return multiparty.KeySwitchShare{}, err
+	}
+
+	// 按会话配置计算淹没噪声，噪声不足以掩盖密文误差时不提供份额
+	noise, err := ds.keySwitchNoise(ciphertext)
+	if err != nil {
+		return multiparty.KeySwitchShare{}, err
+	}
+
 	// 创建解密协议实例
-	decryptionProto, err := multiparty.NewKeySwitchProtocol(params, ring.DiscreteGaussian{
-		Sigma: 1 << 30,
-		Bound: 6 * (1 << 30),
-	})
+	decryptionProto, err := multiparty.NewKeySwitchProtocol(params, noise)
 	if err != nil {
 		return multiparty.KeySwitchShare{}, err
 	}
@@ -46,26 +74,36 @@ func (ds *DecryptionService) GeneratePartialDecryptShare(ciphertext *rlwe.Cipher
 
 	// 生成份额（目标密钥为零）
 	zeroSk := rlwe.NewSecretKey(params)
-	decryptionProto.GenShare(ds.keyManager.GetSecretKey(), zeroSk, ciphertext, &share)
+	decryptionProto.GenShare(sk, zeroSk, ciphertext, &share)
 
 	return share, nil
 }
 
-// RequestCollaborativeDecrypt 发起协同解密请求
+// keySwitchNoise 按会话的噪声淹没配置计算密文的淹没噪声
+// 达不到统计安全要求、超出密文模数或完全覆盖明文时返回错误
+func (ds *DecryptionService) keySwitchNoise(ct *rlwe.Ciphertext) (ring.DiscreteGaussian, error) {
+	est, err := smudging.ForKeySwitch(ds.keyManager.GetParams(), ds.keyManager.SmudgingConfig(), ct, ds.keyManager.ExpectedN)
+	if err != nil {
+		return ring.DiscreteGaussian{}, fmt.Errorf("拒绝解密: %v", err)
+	}
+	return est.Distribution(), nil
+}
+
+// RequestCollaborativeDecrypt 发起协同解密测试：随机生成明文、加密后协同解密并打印结果
 func (ds *DecryptionService) RequestCollaborativeDecrypt(onlinePeers map[int]string, myID int) error {
-	fmt.Println("[协同解密] 自动生成明文并加密...")
+	logs.Println("[协同解密] 自动生成明文并加密...")
 
-	// 生成明文测试用，实际使用时传入待解密的密文
+	// 生成明文测试用，实际使用时通过 CollaborativeDecrypt 传入待解密的密文
 	slots := 8
 	values := make([]complex128, slots)
 	for i := range values {
 		values[i] = complex(rand.Float64()*10, 0)
 	}
-	fmt.Printf("原始明文: ")
+	logs.Printf("原始明文: ")
 	for i := range values {
-		fmt.Printf("%.2f ", real(values[i]))
+		logs.Printf("%.2f ", real(values[i]))
 	}
-	fmt.Println()
+	logs.Println()
 
 	// 编码加密
 	params := ds.keyManager.GetParams()
@@ -81,85 +119,187 @@ func (ds *DecryptionService) RequestCollaborativeDecrypt(onlinePeers map[int]str
 		return fmt.Errorf("加密失败: %v", err)
 	}
 
-	// 序列化密文为base64
-	ctBytes, err := utils.EncodeShare(ct)
+	// 其他参与方只为已批准的任务提供解密份额
+	if ds.authorize == nil {
+		return fmt.Errorf("未设置解密任务授权")
+	}
+	taskID, err := ds.authorize(types.TaskKindDecrypt, "协同解密测试", ct)
 	if err != nil {
-		return fmt.Errorf("密文序列化失败: %v", err)
+		return fmt.Errorf("解密任务未获批准: %v", err)
 	}
-	ctB64 := utils.EncodeToBase64(ctBytes)
 
-	// 自己先算一份解密份额
-	myShare, err := ds.GeneratePartialDecryptShare(ct, "task1")
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRoundTimeout)
+	defer cancel()
+	ptOut, _, err := ds.CollaborativeDecrypt(ctx, ct, taskID, onlinePeers, myID)
 	if err != nil {
-		return fmt.Errorf("本地解密份额生成失败: %v", err)
+		return err
 	}
+	decoded := make([]complex128, slots)
+	if err := encoder.Decode(ptOut, decoded); err != nil {
+		return fmt.Errorf("解码失败: %v", err)
+	}
+	logs.Printf("解密结果: ")
+	for i := range decoded {
+		logs.Printf("%.2f ", real(decoded[i]))
+	}
+	logs.Println()
+	return nil
+}
 
-	// 向所有在线Peers（不包括自己）并发请求解密份额
-	type peerResp struct {
-		PeerID int
-		Share  multiparty.KeySwitchShare
-		Err    error
+// CollaborativeDecrypt 协同解密密文ct，taskID 须为已批准的解密任务
+// ctx 限制整个过程（包括换组重试）的时间；返回的报告记录最后一组活跃参与方和各参与方的失败原因
+func (ds *DecryptionService) CollaborativeDecrypt(ctx context.Context, ct *rlwe.Ciphertext, taskID string, onlinePeers map[int]string, myID int) (*rlwe.Plaintext, types.RoundReport, error) {
+	var report types.RoundReport
+
+	// 把密文封装为信封，绑定当前集体公钥
+	ctData, err := envelope.SealCiphertext(ds.keyManager.GetParams(), ds.keyManager.KeyFingerprint(), ct)
+	if err != nil {
+		return nil, report, fmt.Errorf("密文序列化失败: %v", err)
 	}
-	results := make(chan peerResp, len(onlinePeers)-1)
 
-	fmt.Printf("向 %d 个在线参与方请求解密份额...\n", len(onlinePeers)-1)
-	for peerID, peerURL := range onlinePeers {
-		if peerID == myID {
-			continue // 跳过自己
+	// 收集活跃集合内所有参与方的解密份额，某个参与方失败时换一组重试
+	shares, err := ds.collectDecryptShares(ctx, ct, ctData, taskID, onlinePeers, myID, &report)
+	if err != nil {
+		return nil, report, err
+	}
+
+	// 聚合份额并解密
+	pt, err := ds.FinalizeCollaborativeDecryption(ct, shares)
+	if err != nil {
+		return nil, report, fmt.Errorf("聚合解密失败: %v", err)
+	}
+	return pt, report, nil
+}
+
+// collectDecryptShares 从活跃参与方集合收集解密份额
+// 非门限模式要求全部N个参与方都返回份额；门限模式下只需t个，若活跃集合中有参与方失败，
+// 则将其排除后重新选取活跃集合，直到成功、在线参与方不足或 ctx 超时为止。
+// 参与方以 403 拒绝时说明任务未获授权，换组重试没有意义，直接返回错误
+func (ds *DecryptionService) collectDecryptShares(ctx context.Context, ct *rlwe.Ciphertext, ctData []byte, taskID string, onlinePeers map[int]string, myID int, report *types.RoundReport) ([]multiparty.KeySwitchShare, error) {
+	required := ds.keyManager.RequiredParticipants()
+	onlinePeers = ds.keyManager.MemberPeers(onlinePeers)
+	failed := make(map[int]bool)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("协同解密超时: %v", err)
 		}
-		go func(peerID int, peerURL string) {
-			// 构造请求体
-			reqBody, _ := json.Marshal(map[string]interface{}{
-				"task_id":    "task1",
-				"ciphertext": ctB64, // 传递base64字符串
-			})
-			resp, err := ds.client.Client.Post(peerURL+"/partial_decrypt", "application/json", bytes.NewReader(reqBody))
-			if err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
-			}
-			defer resp.Body.Close()
-			var respData struct {
-				Share multiparty.KeySwitchShare `json:"share"`
+		active, err := SelectActiveParticipants(onlinePeers, myID, required, failed)
+		if err != nil {
+			return nil, err
+		}
+		report.Participants = active
+		logs.Printf("本次协同解密活跃参与方: %v\n", active)
+
+		// 自己先算一份解密份额
+		myShare, err := ds.GeneratePartialDecryptShare(ct, taskID, active)
+		if err != nil {
+			return nil, fmt.Errorf("本地解密份额生成失败: %v", err)
+		}
+
+		// 向活跃集合内的其他参与方并发请求解密份额
+		type peerResp struct {
+			PeerID int
+			Share  multiparty.KeySwitchShare
+			Err    error
+		}
+		results := make(chan peerResp, len(active)-1)
+
+		logs.Printf("向 %d 个在线参与方请求解密份额...\n", len(active)-1)
+		for _, peerID := range active {
+			if peerID == myID {
+				continue // 跳过自己
 			}
-			if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
+			go func(peerID int, peerURL string) {
+				data, err := requestShare(ctx, ds.client, peerURL+"/partial_decrypt", types.PartialDecryptRequest{
+					TaskID:       taskID,
+					Participants: active,
+				}, ctData)
+				if err != nil {
+					results <- peerResp{PeerID: peerID, Err: err}
+					return
+				}
+				share, err := envelope.OpenKeySwitchShare(ds.keyManager.GetParams(), ds.keyManager.KeyFingerprint(), ct.Level(), data)
+				if err != nil {
+					results <- peerResp{PeerID: peerID, Err: fmt.Errorf("份额校验失败: %v", err)}
+					return
+				}
+				results <- peerResp{PeerID: peerID, Share: share}
+			}(peerID, onlinePeers[peerID])
+		}
+
+		// 收集所有份额，缺少任何一份都会得到错误的明文
+		shares := []multiparty.KeySwitchShare{myShare}
+		retry := false
+		var refused error
+		for i := 0; i < len(active)-1; i++ {
+			res := <-results
+			if res.Err != nil {
+				logs.Printf("[警告] 获取参与方 %d 份额失败: %v\n", res.PeerID, res.Err)
+				report.PeerErrors = append(report.PeerErrors, types.PeerError{PeerID: res.PeerID, Error: res.Err.Error()})
+				if errors.Is(res.Err, errShareRefused) {
+					refused = fmt.Errorf("参与方 %d 拒绝提供解密份额: %v", res.PeerID, res.Err)
+				}
+				failed[res.PeerID] = true
+				retry = true
+				continue
 			}
-			results <- peerResp{PeerID: peerID, Share: respData.Share}
-		}(peerID, peerURL)
-	}
-
-	// 收集所有份额
-	shares := []multiparty.KeySwitchShare{myShare}
-	successCount := 1 // 包括自己的份额
-	for i := 0; i < len(onlinePeers)-1; i++ {
-		res := <-results
-		if res.Err != nil {
-			fmt.Printf("[警告] 获取参与方 %d 份额失败: %v\n", res.PeerID, res.Err)
-			continue
+			shares = append(shares, res.Share)
+		}
+
+		if refused != nil {
+			return nil, refused
+		}
+		if !retry {
+			logs.Printf("成功收集 %d 个解密份额 (包括本地份额)\n", len(shares))
+			return shares, nil
 		}
-		shares = append(shares, res.Share)
-		successCount++
+		logs.Printf("活跃集合中有参与方失败，排除 %v 后重新选择活跃集合\n", keysOf(failed))
 	}
+}
 
-	fmt.Printf("成功收集 %d 个解密份额 (包括本地份额)\n", successCount)
+// errShareRefused 参与方拒绝为该任务提供份额（403）
+var errShareRefused = errors.New("任务未获授权")
 
-	// 聚合份额并解密
-	ptOut, err := ds.FinalizeCollaborativeDecryption(ct, shares)
+// requestShare 以帧格式发送单个份额请求（控制帧和密文信封），返回响应中的份额信封
+func requestShare(ctx context.Context, client *types.HTTPClient, url string, control interface{}, ctData []byte) ([]byte, error) {
+	resp, err := client.PostMessageContext(ctx, url, control, ctData)
 	if err != nil {
-		return fmt.Errorf("聚合解密失败: %v", err)
+		return nil, err
 	}
-	decoded := make([]complex128, slots)
-	if err := encoder.Decode(ptOut, decoded); err != nil {
-		return fmt.Errorf("解码失败: %v", err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, peerStatusError(resp)
 	}
-	fmt.Printf("解密结果: ")
-	for i := range decoded {
-		fmt.Printf("%.2f ", real(decoded[i]))
+	objects, err := wire.ReadResponse(resp, nil)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println()
-	return nil
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("响应包含 %d 个对象，应为1个", len(objects))
+	}
+	return objects[0], nil
+}
+
+// peerStatusError 把参与方的非200响应转换为错误，附带响应中的错误信息
+func peerStatusError(resp *http.Response) error {
+	msg := fmt.Sprintf("状态码 %d", resp.StatusCode)
+	if body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)); len(bytes.TrimSpace(body)) > 0 {
+		msg += ": " + string(bytes.TrimSpace(body))
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w（%s）", errShareRefused, msg)
+	}
+	return errors.New(msg)
+}
+
+// keysOf 返回map中的键
+func keysOf(m map[int]bool) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // FinalizeCollaborativeDecryption 聚合份额并输出明文
@@ -169,10 +309,11 @@ func (ds *DecryptionService) FinalizeCollaborativeDecryption(ct *rlwe.Ciphertext
 	}
 
 	params := ds.keyManager.GetParams()
-	proto, err := multiparty.NewKeySwitchProtocol(params, ring.DiscreteGaussian{
-		Sigma: 1 << 30,
-		Bound: 6 * (1 << 30),
-	})
+	noise, err := ds.keySwitchNoise(ct)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := multiparty.NewKeySwitchProtocol(params, noise)
 	if err != nil {
 		return nil, err
 	}
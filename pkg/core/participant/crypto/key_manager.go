@@ -1,7 +1,12 @@
 package crypto
 
 import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/smudging"
+	"sync"
+
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
 	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 )
 
@@ -13,6 +18,27 @@ type KeyManager struct {
 	RelineKey       *rlwe.RelinearizationKey
 	GaloisKeys      []*rlwe.GaloisKey
 	Sk              *rlwe.SecretKey
+	Epoch           int // 当前密钥纪元，初始密钥为0，每次集体密钥轮换加1
+
+	// 集体公钥指纹的缓存，密文和份额的信封绑定该指纹
+	pkFingerprint envelope.KeyCache
+
+	// 会话的噪声淹没配置，决定解密、公钥切换和刷新份额的噪声
+	smudging smudging.Config
+
+	// 进行中的集体密钥轮换，见 rotation.go
+	rotation *rotationState
+
+	// 门限相关
+	SelfID                  int                                  // 本方ID，同时作为ShamirPublicPoint
+	Threshold               int                                  // 门限t
+	ExpectedN               int                                  // 参与方总数N
+	Members                 []int                                // 持有当前集体私钥份额的成员，为空时不限制
+	MembershipEpoch         int                                  // 成员纪元，每次加入新成员加1
+	thresholdShare          *multiparty.ShamirSecretShare        // 聚合后的本方门限份额
+	receivedThresholdShares map[int]multiparty.ShamirSecretShare // 参与方ID -> 收到的Shamir份额
+	thresholdSenders        []int                                // 交换Shamir份额的参与方，开始交换前为空
+	mu                      sync.RWMutex
 }
 
 // NewKeyManager 创建新的密钥管理器
@@ -25,6 +51,20 @@ func (km *KeyManager) SetParams(params ckks.Parameters) {
 	km.Params = params
 }
 
+// SetSmudgingConfig 设置会话的噪声淹没配置
+func (km *KeyManager) SetSmudgingConfig(cfg smudging.Config) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.smudging = cfg.Normalize()
+}
+
+// SmudgingConfig 获取会话的噪声淹没配置
+func (km *KeyManager) SmudgingConfig() smudging.Config {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.smudging.Normalize()
+}
+
 // SetSecretKey 设置私钥
 func (km *KeyManager) SetSecretKey(sk *rlwe.SecretKey) {
 	km.Sk = sk
@@ -61,6 +101,11 @@ func (km *KeyManager) GetPublicKey() *rlwe.PublicKey {
 	return km.PubKey
 }
 
+// KeyFingerprint 当前集体公钥的指纹，公钥未设置时为零指纹
+func (km *KeyManager) KeyFingerprint() envelope.Fingerprint {
+	return km.pkFingerprint.Fingerprint(km.PubKey)
+}
+
 // GetRelinearizationKey 获取重线性化密钥
 func (km *KeyManager) GetRelinearizationKey() *rlwe.RelinearizationKey {
 	return km.RelineKey
@@ -71,6 +116,42 @@ func (km *KeyManager) GetGaloisKeys() []*rlwe.GaloisKey {
 	return km.GaloisKeys
 }
 
+// SetMembership 设置持有当前集体私钥份额的成员及成员纪元
+func (km *KeyManager) SetMembership(members []int, epoch int) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.Members = members
+	km.MembershipEpoch = epoch
+}
+
+// GetMembership 获取当前成员及成员纪元
+func (km *KeyManager) GetMembership() ([]int, int) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.Members, km.MembershipEpoch
+}
+
+// MemberPeers 从在线参与方中去掉尚未加入集体密钥的候选成员，未设置成员时原样返回
+func (km *KeyManager) MemberPeers(onlinePeers map[int]string) map[int]string {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if len(km.Members) == 0 {
+		return onlinePeers
+	}
+	return filterPeers(onlinePeers, km.Members)
+}
+
+// filterPeers 只保留 ids 中的参与方
+func filterPeers(onlinePeers map[int]string, ids []int) map[int]string {
+	peers := make(map[int]string, len(ids))
+	for _, id := range ids {
+		if url, ok := onlinePeers[id]; ok {
+			peers[id] = url
+		}
+	}
+	return peers
+}
+
 // IsReady 检查密钥是否准备就绪
 func (km *KeyManager) IsReady() bool {
 	return km.Sk != nil && km.PubKey != nil && km.RelineKey != nil
@@ -0,0 +1,342 @@
+package crypto
+
+import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/participant/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"golang.org/x/crypto/argon2"
+)
+
+// ==================== 加密密钥库 ====================
+//
+// 私钥份额只存在于参与方本地，参与方重启丢失私钥会使整个集体密钥失效。
+// 密钥库把私钥份额、门限份额、集体公钥/重线性化/伽罗瓦密钥和会话信息gob编码后，
+// 用口令经Argon2id派生的密钥以AES-256-GCM加密保存。会话ID等元数据以明文保存并
+// 作为GCM附加数据参与认证，参与方重启后据此判断能否重新加入同一会话。
+
+// ErrWrongPassphrase 口令错误或密钥库被篡改
+var ErrWrongPassphrase = errors.New("密钥库口令错误或文件已损坏")
+
+// 密钥库文件格式
+const (
+	keystoreVersion = 1
+	keystoreKDF     = "argon2id"
+)
+
+// Argon2id 默认参数（RFC 9106 推荐的低内存配置）
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	saltSize      = 16
+)
+
+// 读取密钥库时接受的Argon2id参数范围，超出范围的文件视为损坏，
+// 防止篡改的参数使派生耗尽内存或CPU（argon2 在参数为0时panic）
+const (
+	argon2MaxTime   = 64
+	argon2MinMemory = 8 * 1024    // KiB
+	argon2MaxMemory = 1024 * 1024 // KiB
+	maxSaltSize     = 64
+)
+
+// Keystore 密钥库中保存的会话信息和密钥材料
+type Keystore struct {
+	SessionID     string
+	ShardID       string
+	ParticipantID int
+	Threshold     int
+	ExpectedN     int
+
+	// CRSSeed 本方贡献的CRS种子，重新加入会话时校验会话参数需要
+	CRSSeed []byte
+	// SessionSeed 会话最终CRS种子
+	SessionSeed []byte
+	// KeyEpoch 当前密钥纪元，KeySeed 为该纪元的种子，追加旋转密钥时派生伽罗瓦CRP
+	// 旧版本的密钥库没有这两项，按第0纪元和SessionSeed处理
+	KeyEpoch int
+	KeySeed  []byte
+	// Members 持有当前集体私钥份额的成员，MembershipEpoch 为成员纪元
+	Members         []int
+	MembershipEpoch int
+	// AgreedApprovals、AgreedTaskTTLSeconds 本方同意的解密授权策略，旧版本的密钥库没有这两项
+	AgreedApprovals      int
+	AgreedTaskTTLSeconds int
+
+	SecretKey          *rlwe.SecretKey
+	ThresholdShare     *multiparty.ShamirSecretShare // 门限模式下聚合后的本方门限份额
+	PublicKey          *rlwe.PublicKey
+	RelinearizationKey *rlwe.RelinearizationKey
+	GaloisKeys         []*rlwe.GaloisKey
+
+	// Rotation 已切换密文、等待协调器提交的新纪元密钥材料
+	// 本方在这次轮换中加入集体密钥时 SecretKey 为空，只有 Rotation
+	Rotation *RotationKeystore
+}
+
+// RotationKeystore 密钥库中保存的进行中的密钥轮换
+// 参与方报告完成切换后协调器可能随时提交新纪元，新私钥份额必须在此之前落盘
+type RotationKeystore struct {
+	Epoch              int
+	Attempt            int
+	Members            []int
+	MembershipEpoch    int
+	Joining            bool
+	OldKey             envelope.Fingerprint // 当前纪元集体公钥的指纹
+	SecretKey          *rlwe.SecretKey
+	ThresholdShare     *multiparty.ShamirSecretShare
+	PublicKey          *rlwe.PublicKey
+	RelinearizationKey *rlwe.RelinearizationKey
+	GaloisKeys         []*rlwe.GaloisKey
+}
+
+// keystoreFile 密钥库文件（JSON）
+type keystoreFile struct {
+	Version       int    `json:"version"`
+	SessionID     string `json:"session_id"`
+	ShardID       string `json:"shard_id"`
+	ParticipantID int    `json:"participant_id"`
+	SavedAt       string `json:"saved_at"`
+
+	KDF     string `json:"kdf"`
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// additionalData 明文元数据和KDF参数作为GCM附加数据，任何一项被修改都无法解密
+func (f *keystoreFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("MPHE-KEYSTORE-v%d\n%s\n%s\n%d\n%s\n%s\n%s\n%d\n%d\n%d",
+		f.Version, f.SessionID, f.ShardID, f.ParticipantID, f.SavedAt, f.KDF, f.Salt, f.Time, f.Memory, f.Threads))
+}
+
+// deriveKey 由口令派生AES-256密钥
+func (f *keystoreFile) deriveKey(passphrase []byte) ([]byte, error) {
+	if f.KDF != keystoreKDF {
+		return nil, fmt.Errorf("不支持的密钥派生算法: %s", f.KDF)
+	}
+	if f.Time < 1 || f.Time > argon2MaxTime {
+		return nil, fmt.Errorf("密钥派生迭代次数 %d 超出范围 [1, %d]", f.Time, argon2MaxTime)
+	}
+	if f.Memory < argon2MinMemory || f.Memory > argon2MaxMemory {
+		return nil, fmt.Errorf("密钥派生内存 %d KiB 超出范围 [%d, %d]", f.Memory, argon2MinMemory, argon2MaxMemory)
+	}
+	if f.Threads < 1 {
+		return nil, fmt.Errorf("密钥派生并行度不能为0")
+	}
+	salt, err := utils.DecodeFromBase64(f.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("解码盐值失败: %v", err)
+	}
+	if len(salt) < saltSize || len(salt) > maxSaltSize {
+		return nil, fmt.Errorf("盐值长度 %d 超出范围 [%d, %d]", len(salt), saltSize, maxSaltSize)
+	}
+	return argon2.IDKey(passphrase, salt, f.Time, f.Memory, f.Threads, argon2KeyLen), nil
+}
+
+// newGCM 创建AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveKeystore 用口令加密并保存密钥库，先写临时文件再重命名，文件权限0600
+func SaveKeystore(path string, passphrase []byte, ks *Keystore) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("密钥库口令不能为空")
+	}
+	plaintext, err := utils.EncodeShare(ks)
+	if err != nil {
+		return fmt.Errorf("编码密钥库失败: %v", err)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("生成盐值失败: %v", err)
+	}
+	file := keystoreFile{
+		Version:       keystoreVersion,
+		SessionID:     ks.SessionID,
+		ShardID:       ks.ShardID,
+		ParticipantID: ks.ParticipantID,
+		SavedAt:       time.Now().Format(time.RFC3339),
+		KDF:           keystoreKDF,
+		Salt:          utils.EncodeToBase64(salt),
+		Time:          argon2Time,
+		Memory:        argon2Memory,
+		Threads:       argon2Threads,
+	}
+	key, err := file.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成随机数失败: %v", err)
+	}
+	file.Nonce = utils.EncodeToBase64(nonce)
+	file.Ciphertext = utils.EncodeToBase64(gcm.Seal(nil, nonce, plaintext, file.additionalData()))
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥库失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建密钥库目录失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入密钥库失败: %v", err)
+	}
+	return nil
+}
+
+// LoadKeystore 读取并用口令解密密钥库
+func LoadKeystore(path string, passphrase []byte) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析密钥库失败: %v", err)
+	}
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("不支持的密钥库版本: %d", file.Version)
+	}
+
+	key, err := file.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.DecodeFromBase64(file.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("密钥库随机数无效")
+	}
+	ciphertext, err := utils.DecodeFromBase64(file.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("解码密钥库密文失败: %v", err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, file.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var ks Keystore
+	if err := utils.DecodeShare(plaintext, &ks); err != nil {
+		return nil, fmt.Errorf("解码密钥库失败: %v", err)
+	}
+	if ks.SessionID != file.SessionID || ks.ParticipantID != file.ParticipantID || ks.ShardID != file.ShardID {
+		return nil, fmt.Errorf("密钥库元数据与内容不一致")
+	}
+	return &ks, nil
+}
+
+// ExportKeystore 导出当前密钥材料，会话信息由调用方填写
+func (km *KeyManager) ExportKeystore() (*Keystore, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	joining := km.rotation != nil && km.rotation.joining && km.rotation.pk != nil
+	if km.Sk == nil && !joining {
+		return nil, fmt.Errorf("私钥未生成")
+	}
+	ks := &Keystore{
+		ParticipantID:      km.SelfID,
+		Threshold:          km.Threshold,
+		ExpectedN:          km.ExpectedN,
+		KeyEpoch:           km.Epoch,
+		Members:            km.Members,
+		MembershipEpoch:    km.MembershipEpoch,
+		SecretKey:          km.Sk,
+		ThresholdShare:     km.thresholdShare,
+		PublicKey:          km.PubKey,
+		RelinearizationKey: km.RelineKey,
+		GaloisKeys:         km.GaloisKeys,
+	}
+	// 只有下载了新纪元集体密钥的轮换才可能被提交
+	if rs := km.rotation; rs != nil && rs.pk != nil {
+		ks.Rotation = &RotationKeystore{
+			Epoch:              rs.epoch,
+			Attempt:            rs.attempt,
+			Members:            rs.members,
+			MembershipEpoch:    rs.membershipEpoch,
+			Joining:            rs.joining,
+			OldKey:             rs.oldKey,
+			SecretKey:          rs.sk,
+			ThresholdShare:     rs.thresholdShare,
+			PublicKey:          rs.pk,
+			RelinearizationKey: rs.rlk,
+			GaloisKeys:         rs.galoisKeys,
+		}
+	}
+	return ks, nil
+}
+
+// ImportKeystore 从密钥库恢复密钥材料，调用前需已设置参数
+func (km *KeyManager) ImportKeystore(ks *Keystore) error {
+	if ks.SecretKey == nil && (ks.Rotation == nil || !ks.Rotation.Joining) {
+		return fmt.Errorf("密钥库中没有私钥")
+	}
+	if ks.Threshold > 0 && ks.Threshold < ks.ExpectedN && ks.ThresholdShare == nil {
+		return fmt.Errorf("门限模式下密钥库中缺少门限份额")
+	}
+	km.SetThresholdConfig(ks.ParticipantID, ks.Threshold, ks.ExpectedN)
+
+	km.mu.Lock()
+	km.thresholdShare = ks.ThresholdShare
+	km.Epoch = ks.KeyEpoch
+	km.Members = ks.Members
+	km.MembershipEpoch = ks.MembershipEpoch
+	km.rotation = nil
+	if r := ks.Rotation; r != nil {
+		km.rotation = &rotationState{
+			epoch:           r.Epoch,
+			attempt:         r.Attempt,
+			members:         r.Members,
+			membershipEpoch: r.MembershipEpoch,
+			joining:         r.Joining,
+			oldKey:          r.OldKey,
+			sk:              r.SecretKey,
+			thresholdShare:  r.ThresholdShare,
+			pk:              r.PublicKey,
+			rlk:             r.RelinearizationKey,
+			galoisKeys:      r.GaloisKeys,
+		}
+	}
+	km.mu.Unlock()
+	km.SetSecretKey(ks.SecretKey)
+	km.SetPublicKey(ks.PublicKey)
+	km.SetRelinearizationKey(ks.RelinearizationKey)
+	km.SetGaloisKeys(ks.GaloisKeys)
+	return nil
+}
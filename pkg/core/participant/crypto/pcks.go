@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// GeneratePCKSShare 生成公钥切换份额，把集体公钥下的密文切换到结果接收方公钥下
+// active 为本次公钥切换的活跃参与方集合，门限模式下用于计算加法份额
+func (ds *DecryptionService) GeneratePCKSShare(ciphertext *rlwe.Ciphertext, consumerPK *rlwe.PublicKey, active []int) (multiparty.PublicKeySwitchShare, error) {
+	params := ds.keyManager.GetParams()
+
+	sk, err := ds.keyManager.SecretKeyForActiveSet(active)
+	if err != nil {
+		return multiparty.PublicKeySwitchShare{}, err
+	}
+
+	// 与协同解密使用相同的噪声淹没规则
+	noise, err := ds.keySwitchNoise(ciphertext)
+	if err != nil {
+		return multiparty.PublicKeySwitchShare{}, err
+	}
+	pcksProto, err := multiparty.NewPublicKeySwitchProtocol(params, noise)
+	if err != nil {
+		return multiparty.PublicKeySwitchShare{}, err
+	}
+
+	share := pcksProto.AllocateShare(ciphertext.Level())
+	pcksProto.GenShare(sk, consumerPK, ciphertext, &share)
+	return share, nil
+}
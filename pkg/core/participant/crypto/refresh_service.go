@@ -1,12 +1,17 @@
 package crypto
 
 import (
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/types"
 	"MPHEDev/pkg/core/participant/utils"
-	"bytes"
-	"encoding/json"
+	"MPHEDev/pkg/core/smudging"
+	"context"
 	"fmt"
 	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/multiparty"
@@ -16,12 +21,21 @@ import (
 	"github.com/tuneinsight/lattigo/v6/utils/sampling"
 )
 
+// refreshPrecision 刷新协议中编码器的大数精度（比特）
+const refreshPrecision = 128
+
 // RefreshService 刷新服务
 type RefreshService struct {
 	keyManager    *KeyManager
 	client        *types.HTTPClient
 	params        ckks.Parameters
 	commonCRSSeed []byte // 统一的CRS种子
+
+	// 有效期内已使用的刷新任务ID -> 密文哈希，同一任务ID（即同一CRP）不能用于不同密文，见 refresh_tasks.go
+	tasksMu     sync.Mutex
+	usedTasks   map[string]string
+	taskLogPath string    // 记录文件，为空时只保存在内存中
+	lastPrune   time.Time // 上次删除过期记录的时间
 }
 
 // NewRefreshService 创建新的刷新服务
@@ -30,6 +44,7 @@ func NewRefreshService(keyManager *KeyManager, client *types.HTTPClient) *Refres
 		keyManager: keyManager,
 		client:     client,
 		params:     keyManager.GetParams(),
+		usedTasks:  make(map[string]string),
 	}
 }
 
@@ -44,30 +59,90 @@ func (rs *RefreshService) SetCommonCRSSeed(seed []byte) {
 	rs.commonCRSSeed = seed
 }
 
+// sampleCRP 由会话种子、任务ID和密文层级派生本次刷新的CRP
+func (rs *RefreshService) sampleCRP(refreshProto mpckks.RefreshProtocol, taskID string, level int) (multiparty.KeySwitchCRP, error) {
+	if len(rs.commonCRSSeed) == 0 {
+		return multiparty.KeySwitchCRP{}, fmt.Errorf("CRS种子未设置")
+	}
+	prng, err := sampling.NewKeyedPRNG(crs.RefreshSeed(rs.commonCRSSeed, taskID, level))
+	if err != nil {
+		return multiparty.KeySwitchCRP{}, fmt.Errorf("生成CRS失败: %v", err)
+	}
+	return refreshProto.SampleCRP(rs.params.MaxLevel(), prng), nil
+}
+
+// claimTask 登记刷新任务ID，拒绝空的、已过期的任务ID或同一任务ID用于不同密文（会复用CRP）
+func (rs *RefreshService) claimTask(taskID string, ct *rlwe.Ciphertext) error {
+	if taskID == "" {
+		return fmt.Errorf("缺少刷新任务ID")
+	}
+	issued, err := refreshTaskTime(taskID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if now.Sub(issued) > RefreshTaskTTL {
+		return fmt.Errorf("刷新任务 %s 已过期", taskID)
+	}
+	if issued.Sub(now) > refreshTaskClockSkew {
+		return fmt.Errorf("刷新任务 %s 的发起时间晚于本地时间", taskID)
+	}
+	hash, err := utils.CiphertextHash(ct)
+	if err != nil {
+		return fmt.Errorf("计算密文哈希失败: %v", err)
+	}
+	rs.tasksMu.Lock()
+	defer rs.tasksMu.Unlock()
+	rs.pruneTasksLocked(now)
+	if used, ok := rs.usedTasks[taskID]; ok {
+		if used != hash {
+			return fmt.Errorf("刷新任务 %s 已用于其他密文", taskID)
+		}
+		return nil
+	}
+	return rs.recordTaskLocked(taskID, hash)
+}
+
+// refreshMask 按会话的噪声淹没配置计算刷新掩码位数和份额误差分布
+func (rs *RefreshService) refreshMask(ct *rlwe.Ciphertext) (uint, ring.DiscreteGaussian, error) {
+	logBound, noise, err := smudging.RefreshMask(rs.params, rs.keyManager.SmudgingConfig(), ct, rs.keyManager.ExpectedN)
+	if err != nil {
+		return 0, noise, fmt.Errorf("拒绝刷新: %v", err)
+	}
+	return logBound, noise, nil
+}
+
 // GenerateRefreshShare 生成本地刷新份额
-func (rs *RefreshService) GenerateRefreshShare(ciphertext *rlwe.Ciphertext, taskID string) (multiparty.RefreshShare, error) {
-	refreshNoise := ring.DiscreteGaussian{
-		Sigma: 6.36,
-		Bound: 128,
+// active 为本次协同刷新的活跃参与方集合，门限模式下用于计算加法份额
+func (rs *RefreshService) GenerateRefreshShare(ciphertext *rlwe.Ciphertext, taskID string, active []int) (multiparty.RefreshShare, error) {
+	sk, err := rs.keyManager.SecretKeyForActiveSet(active)
+	if err != nil {
+		return multiparty.RefreshShare{}, err
+	}
+
+	// 掩码位数由会话的刷新统计安全参数和密文缩放因子决定，层级不足时拒绝刷新
+	logBound, refreshNoise, err := rs.refreshMask(ciphertext)
+	if err != nil {
+		return multiparty.RefreshShare{}, err
 	}
-	refreshProto, err := mpckks.NewRefreshProtocol(rs.params, 128, refreshNoise)
+	refreshProto, err := mpckks.NewRefreshProtocol(rs.params, refreshPrecision, refreshNoise)
 	if err != nil {
 		return multiparty.RefreshShare{}, err
 	}
 
-	// 从统一CRS种子生成PRNG
-	crs, err := sampling.NewKeyedPRNG(rs.commonCRSSeed)
+	if err := rs.claimTask(taskID, ciphertext); err != nil {
+		return multiparty.RefreshShare{}, err
+	}
+	refreshCRP, err := rs.sampleCRP(refreshProto, taskID, ciphertext.Level())
 	if err != nil {
-		return multiparty.RefreshShare{}, fmt.Errorf("生成CRS失败: %v", err)
+		return multiparty.RefreshShare{}, err
 	}
-	// 用统一CRS生成CRP
-	refreshCRP := refreshProto.SampleCRP(rs.params.MaxLevel(), crs)
 
 	level := ciphertext.Level()
 	maxLevel := rs.params.MaxLevel()
 	share := refreshProto.AllocateShare(level, maxLevel)
 
-	if err := refreshProto.GenShare(rs.keyManager.GetSecretKey(), 128, ciphertext, refreshCRP, &share); err != nil {
+	if err := refreshProto.GenShare(sk, logBound, ciphertext, refreshCRP, &share); err != nil {
 		return multiparty.RefreshShare{}, err
 	}
 
@@ -81,7 +156,7 @@ func (rs *RefreshService) RequestCollaborativeRefresh(onlinePeers map[int]string
 		return fmt.Errorf("CKKS参数未设置，请先完成密钥生成")
 	}
 
-	fmt.Println("[协同刷新测试] 自动生成明文并加密...")
+	logs.Println("[协同刷新测试] 自动生成明文并加密...")
 
 	//生成明文 仅用于测试环境
 	slots := 8
@@ -89,11 +164,11 @@ func (rs *RefreshService) RequestCollaborativeRefresh(onlinePeers map[int]string
 	for i := range values {
 		values[i] = complex(rand.Float64()*10, 0)
 	}
-	fmt.Printf("原始明文: ")
+	logs.Printf("原始明文: ")
 	for i := range values {
-		fmt.Printf("%.2f ", real(values[i]))
+		logs.Printf("%.2f ", real(values[i]))
 	}
-	fmt.Println()
+	logs.Println()
 
 	// 编码加密
 	encoder := ckks.NewEncoder(rs.params)
@@ -109,7 +184,7 @@ func (rs *RefreshService) RequestCollaborativeRefresh(onlinePeers map[int]string
 	}
 
 	// 消耗深度：进行真实的乘法运算来降低密文级别
-	fmt.Printf("原始密文: Level=%d, Scale=2^%.2f\n", ct.Level(), ct.Scale.Log2())
+	logs.Printf("原始密文: Level=%d, Scale=2^%.2f\n", ct.Level(), ct.Scale.Log2())
 
 	// 进行同态乘法运算消耗深度（模拟真实应用场景）
 	evaluator := ckks.NewEvaluator(rs.params, nil)
@@ -129,97 +204,137 @@ func (rs *RefreshService) RequestCollaborativeRefresh(onlinePeers map[int]string
 
 			// 执行乘法运算
 			evaluator.Mul(ct, randomPt, ct)
-			fmt.Printf("第%d次乘法后: Level=%d, Scale=2^%.2f\n", i+1, ct.Level(), ct.Scale.Log2())
+			logs.Printf("第%d次乘法后: Level=%d, Scale=2^%.2f\n", i+1, ct.Level(), ct.Scale.Log2())
 		}
 	}
 
-	fmt.Printf("消耗深度后密文: Level=%d, Scale=2^%.2f\n", ct.Level(), ct.Scale.Log2())
+	logs.Printf("消耗深度后密文: Level=%d, Scale=2^%.2f\n", ct.Level(), ct.Scale.Log2())
 
-	// 序列化密文为base64
-	ctBytes, err := utils.EncodeShare(ct)
+	// 每次刷新使用新的任务ID，各参与方据此派生本次刷新的CRP
+	taskID := NewRefreshTaskID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRoundTimeout)
+	defer cancel()
+	refreshedCT, _, err := rs.CollaborativeRefresh(ctx, ct, taskID, onlinePeers, myID)
 	if err != nil {
-		return fmt.Errorf("密文序列化失败: %v", err)
+		return err
 	}
-	ctB64 := utils.EncodeToBase64(ctBytes)
 
-	// 自己先算一份刷新份额
-	myShare, err := rs.GenerateRefreshShare(ct, "refresh_task1")
+	// 显示刷新效果（不输出解密结果）
+	logs.Printf("刷新效果: Level从 %d 提升到 %d, Scale从 2^%.2f 提升到 2^%.2f\n",
+		ct.Level(), refreshedCT.Level(), ct.Scale.Log2(), refreshedCT.Scale.Log2())
+
+	return nil
+}
+
+// CollaborativeRefresh 协同刷新密文ct，taskID 每次刷新必须不同（各参与方据此派生CRP）
+// ctx 限制整个过程（包括换组重试）的时间；返回的报告记录最后一组活跃参与方和各参与方的失败原因
+func (rs *RefreshService) CollaborativeRefresh(ctx context.Context, ct *rlwe.Ciphertext, taskID string, onlinePeers map[int]string, myID int) (*rlwe.Ciphertext, types.RoundReport, error) {
+	var report types.RoundReport
+
+	// 检查参数是否已设置
+	if rs.params.LogN() == 0 {
+		return nil, report, fmt.Errorf("CKKS参数未设置，请先完成密钥生成")
+	}
+
+	// 把密文封装为信封，绑定当前集体公钥
+	ctData, err := envelope.SealCiphertext(rs.keyManager.GetParams(), rs.keyManager.KeyFingerprint(), ct)
+	if err != nil {
+		return nil, report, fmt.Errorf("密文序列化失败: %v", err)
+	}
+
+	// 收集活跃集合内所有参与方的刷新份额
+	shares, err := rs.collectRefreshShares(ctx, ct, ctData, taskID, onlinePeers, myID, &report)
 	if err != nil {
-		return fmt.Errorf("本地刷新份额生成失败: %v", err)
+		return nil, report, err
 	}
 
-	// 向所有在线Peers（不包括自己）并发请求刷新份额
-	type peerResp struct {
-		PeerID int
-		Share  multiparty.RefreshShare
-		Err    error
+	// 聚合份额并刷新
+	refreshedCT, err := rs.FinalizeCollaborativeRefresh(ct, shares, taskID)
+	if err != nil {
+		return nil, report, fmt.Errorf("聚合刷新失败: %v", err)
 	}
-	results := make(chan peerResp, len(onlinePeers)-1)
+	return refreshedCT, report, nil
+}
 
-	fmt.Printf("向 %d 个在线参与方请求刷新份额...\n", len(onlinePeers)-1)
-	for peerID, peerURL := range onlinePeers {
-		if peerID == myID {
-			continue // 跳过自己
+// collectRefreshShares 从活跃参与方集合收集刷新份额，失败时排除失败参与方后重试，直到成功或 ctx 超时
+func (rs *RefreshService) collectRefreshShares(ctx context.Context, ct *rlwe.Ciphertext, ctData []byte, taskID string, onlinePeers map[int]string, myID int, report *types.RoundReport) ([]multiparty.RefreshShare, error) {
+	required := rs.keyManager.RequiredParticipants()
+	onlinePeers = rs.keyManager.MemberPeers(onlinePeers)
+	failed := make(map[int]bool)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("协同刷新超时: %v", err)
 		}
-		go func(peerID int, peerURL string) {
-			// 构造请求体
-			reqBody, _ := json.Marshal(types.RefreshRequest{
-				TaskID:     "refresh_task1",
-				Ciphertext: ctB64,
-			})
-			resp, err := rs.client.Client.Post(peerURL+"/partial_refresh", "application/json", bytes.NewReader(reqBody))
-			if err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
-			}
-			defer resp.Body.Close()
-			var respData types.RefreshShareResponse
-			if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
-			}
+		active, err := SelectActiveParticipants(onlinePeers, myID, required, failed)
+		if err != nil {
+			return nil, err
+		}
+		report.Participants = active
+		logs.Printf("本次协同刷新活跃参与方: %v\n", active)
 
-			// 解析份额
-			shareBytes, err := utils.DecodeFromBase64(respData.Share)
-			if err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
-			}
-			var share multiparty.RefreshShare
-			if err := utils.DecodeShare(shareBytes, &share); err != nil {
-				results <- peerResp{PeerID: peerID, Err: err}
-				return
-			}
-			results <- peerResp{PeerID: peerID, Share: share}
-		}(peerID, peerURL)
-	}
-
-	// 收集所有份额
-	shares := []multiparty.RefreshShare{myShare}
-	successCount := 1 // 包括自己的份额
-	for i := 0; i < len(onlinePeers)-1; i++ {
-		res := <-results
-		if res.Err != nil {
-			fmt.Printf("[警告] 获取参与方 %d 刷新份额失败: %v\n", res.PeerID, res.Err)
-			continue
+		// 自己先算一份刷新份额
+		myShare, err := rs.GenerateRefreshShare(ct, taskID, active)
+		if err != nil {
+			return nil, fmt.Errorf("本地刷新份额生成失败: %v", err)
 		}
-		shares = append(shares, res.Share)
-		successCount++
-	}
 
-	fmt.Printf("成功收集 %d 个刷新份额 (包括本地份额)\n", successCount)
+		// 向活跃集合内的其他参与方并发请求刷新份额
+		type peerResp struct {
+			PeerID int
+			Share  multiparty.RefreshShare
+			Err    error
+		}
+		results := make(chan peerResp, len(active)-1)
 
-	// 聚合份额并刷新
-	refreshedCT, err := rs.FinalizeCollaborativeRefresh(ct, shares, "refresh_task1")
-	if err != nil {
-		return fmt.Errorf("聚合刷新失败: %v", err)
-	}
+		logs.Printf("向 %d 个在线参与方请求刷新份额...\n", len(active)-1)
+		for _, peerID := range active {
+			if peerID == myID {
+				continue // 跳过自己
+			}
+			go func(peerID int, peerURL string) {
+				data, err := requestShare(ctx, rs.client, peerURL+"/partial_refresh", types.RefreshRequest{
+					TaskID:       taskID,
+					Level:        ct.Level(),
+					Participants: active,
+				}, ctData)
+				if err != nil {
+					results <- peerResp{PeerID: peerID, Err: err}
+					return
+				}
+
+				// 解析并校验份额
+				share, err := envelope.OpenRefreshShare(rs.keyManager.GetParams(), rs.keyManager.KeyFingerprint(), ct.Level(), data)
+				if err != nil {
+					results <- peerResp{PeerID: peerID, Err: fmt.Errorf("份额校验失败: %v", err)}
+					return
+				}
+				results <- peerResp{PeerID: peerID, Share: share}
+			}(peerID, onlinePeers[peerID])
+		}
 
-	// 显示刷新效果（不输出解密结果）
-	fmt.Printf("刷新效果: Level从 %d 提升到 %d, Scale从 2^%.2f 提升到 2^%.2f\n",
-		ct.Level(), refreshedCT.Level(), ct.Scale.Log2(), refreshedCT.Scale.Log2())
+		// 收集所有份额
+		shares := []multiparty.RefreshShare{myShare}
+		retry := false
+		for i := 0; i < len(active)-1; i++ {
+			res := <-results
+			if res.Err != nil {
+				logs.Printf("[警告] 获取参与方 %d 刷新份额失败: %v\n", res.PeerID, res.Err)
+				report.PeerErrors = append(report.PeerErrors, types.PeerError{PeerID: res.PeerID, Error: res.Err.Error()})
+				failed[res.PeerID] = true
+				retry = true
+				continue
+			}
+			shares = append(shares, res.Share)
+		}
 
-	return nil
+		if !retry {
+			logs.Printf("成功收集 %d 个刷新份额 (包括本地份额)\n", len(shares))
+			return shares, nil
+		}
+		logs.Printf("活跃集合中有参与方失败，排除 %v 后重新选择活跃集合\n", keysOf(failed))
+	}
 }
 
 // FinalizeCollaborativeRefresh 聚合份额并输出刷新后的密文
@@ -229,22 +344,20 @@ func (rs *RefreshService) FinalizeCollaborativeRefresh(ct *rlwe.Ciphertext, shar
 	}
 
 	// 创建刷新协议实例
-	refreshNoise := ring.DiscreteGaussian{
-		Sigma: 6.36,
-		Bound: 128,
+	_, refreshNoise, err := rs.refreshMask(ct)
+	if err != nil {
+		return nil, err
 	}
-	refreshProto, err := mpckks.NewRefreshProtocol(rs.params, 128, refreshNoise)
+	refreshProto, err := mpckks.NewRefreshProtocol(rs.params, refreshPrecision, refreshNoise)
 	if err != nil {
 		return nil, err
 	}
 
-	// 从统一CRS种子生成PRNG
-	crs, err := sampling.NewKeyedPRNG(rs.commonCRSSeed)
+	// 与各参与方生成份额时使用同一任务的CRP
+	refreshCRP, err := rs.sampleCRP(refreshProto, taskID, ct.Level())
 	if err != nil {
-		return nil, fmt.Errorf("生成CRS失败: %v", err)
+		return nil, err
 	}
-	// 使用统一CRS生成CRP
-	refreshCRP := refreshProto.SampleCRP(rs.params.MaxLevel(), crs)
 
 	// 聚合份额
 	level := ct.Level()
@@ -0,0 +1,163 @@
+package crypto
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ==================== 已使用的刷新任务ID ====================
+//
+// 刷新CRP由会话种子、任务ID和密文层级派生，同一任务ID用于不同密文会复用CRP。
+// 任务ID带有发起时间（refresh-<Unix秒>-<uuid>），超过有效期的任务ID一律拒绝，
+// 因此参与方只需记录有效期内已使用的任务ID和密文哈希，过期的记录定期删除。
+// 设置记录文件后每个新任务ID追加写入文件，参与方重启后恢复，有效期内的任务ID仍不能用于其他密文。
+
+const (
+	// RefreshTaskTTL 刷新任务ID的有效期，与协调器默认的任务有效期相同
+	RefreshTaskTTL = 30 * time.Minute
+	// refreshTaskClockSkew 允许发起方时钟超前的时间
+	refreshTaskClockSkew = time.Minute
+	// refreshTaskPruneInterval 删除过期记录的间隔
+	refreshTaskPruneInterval = time.Minute
+)
+
+// usedRefreshTask 记录文件中的一行
+type usedRefreshTask struct {
+	TaskID string `json:"task_id"`
+	Hash   string `json:"hash"`
+}
+
+// NewRefreshTaskID 生成带发起时间的刷新任务ID
+func NewRefreshTaskID() string {
+	return fmt.Sprintf("refresh-%d-%s", time.Now().Unix(), uuid.New().String())
+}
+
+// refreshTaskTime 解析刷新任务ID中的发起时间
+func refreshTaskTime(taskID string) (time.Time, error) {
+	parts := strings.SplitN(taskID, "-", 3)
+	if len(parts) != 3 || parts[0] != "refresh" {
+		return time.Time{}, fmt.Errorf("刷新任务ID格式错误: %s", taskID)
+	}
+	sec, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("刷新任务ID格式错误: %s", taskID)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// refreshTaskExpired 任务ID是否已过期，格式错误的任务ID按过期处理
+func refreshTaskExpired(taskID string, now time.Time) bool {
+	issued, err := refreshTaskTime(taskID)
+	return err != nil || now.Sub(issued) > RefreshTaskTTL
+}
+
+// SetTaskLog 设置已使用刷新任务ID的记录文件，恢复其中未过期的记录
+func (rs *RefreshService) SetTaskLog(path string) error {
+	rs.tasksMu.Lock()
+	defer rs.tasksMu.Unlock()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取刷新任务记录失败: %v", err)
+	}
+	now := time.Now()
+	restored := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var task usedRefreshTask
+		// 跳过空行和崩溃时写了一半的行
+		if json.Unmarshal(line, &task) != nil || refreshTaskExpired(task.TaskID, now) {
+			continue
+		}
+		rs.usedTasks[task.TaskID] = task.Hash
+		restored++
+	}
+	rs.taskLogPath = path
+	rs.lastPrune = now
+	if err := rs.rewriteTaskLogLocked(); err != nil {
+		return err
+	}
+	if restored > 0 {
+		logs.Printf("已恢复 %d 个有效期内已使用的刷新任务ID\n", restored)
+	}
+	return nil
+}
+
+// recordTaskLocked 登记新的任务ID并追加到记录文件，调用方需持有 tasksMu
+// 写入后不等待落盘：进程崩溃不会丢失记录，只有掉电时可能丢失最后几条
+func (rs *RefreshService) recordTaskLocked(taskID, hash string) error {
+	if rs.taskLogPath != "" {
+		line, err := json.Marshal(usedRefreshTask{TaskID: taskID, Hash: hash})
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(rs.taskLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("记录刷新任务失败: %v", err)
+		}
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("记录刷新任务失败: %v", err)
+		}
+	}
+	rs.usedTasks[taskID] = hash
+	return nil
+}
+
+// pruneTasksLocked 定期删除过期的记录并重写记录文件，调用方需持有 tasksMu
+func (rs *RefreshService) pruneTasksLocked(now time.Time) {
+	if now.Sub(rs.lastPrune) < refreshTaskPruneInterval {
+		return
+	}
+	rs.lastPrune = now
+	pruned := 0
+	for taskID := range rs.usedTasks {
+		if refreshTaskExpired(taskID, now) {
+			delete(rs.usedTasks, taskID)
+			pruned++
+		}
+	}
+	if pruned == 0 {
+		return
+	}
+	if err := rs.rewriteTaskLogLocked(); err != nil {
+		logs.Printf("[警告] %v\n", err)
+	}
+}
+
+// rewriteTaskLogLocked 用当前记录重写记录文件，调用方需持有 tasksMu
+func (rs *RefreshService) rewriteTaskLogLocked() error {
+	if rs.taskLogPath == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	for taskID, hash := range rs.usedTasks {
+		line, err := json.Marshal(usedRefreshTask{TaskID: taskID, Hash: hash})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(rs.taskLogPath), 0700); err != nil {
+		return fmt.Errorf("创建刷新任务记录目录失败: %v", err)
+	}
+	tmp := rs.taskLogPath + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("写入刷新任务记录失败: %v", err)
+	}
+	if err := os.Rename(tmp, rs.taskLogPath); err != nil {
+		return fmt.Errorf("写入刷新任务记录失败: %v", err)
+	}
+	return nil
+}
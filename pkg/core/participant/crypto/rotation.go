@@ -0,0 +1,343 @@
+package crypto
+
+import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/smudging"
+	"context"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// ==================== 集体密钥轮换 ====================
+//
+// 轮换期间参与方同时持有两个纪元的密钥材料：当前纪元的私钥份额继续用于切换保存的密文，
+// 新纪元的私钥份额、门限份额和集体密钥在协调器提交前单独保存。
+// 密文切换需要全部N个参与方，每方用原始私钥份额生成 GenShare(sk_i, sk'_i, ct)，
+// 份额之和把密文从 Σsk_i 切换到 Σsk'_i，与门限配置无关（/keys/rotation/switch/batch）。
+// 提交后清零旧私钥份额和门限份额，中止时清零并丢弃新纪元的材料。
+// 加入新成员的轮换中，新成员没有旧私钥份额，以零作为 sk_i 参与切换，
+// 份额之和仍把密文从旧集体私钥切换到包含新成员的新集体私钥；提交时更新成员和N。
+
+// rotationState 进行中的密钥轮换
+type rotationState struct {
+	epoch   int
+	attempt int
+
+	// 新纪元的成员和成员纪元，joining 表示本方在这次轮换中加入集体密钥
+	members         []int
+	membershipEpoch int
+	joining         bool
+
+	// 当前纪元集体公钥的指纹，切换请求中的密文和份额绑定该指纹
+	oldKey envelope.Fingerprint
+
+	sk                      *rlwe.SecretKey
+	thresholdShare          *multiparty.ShamirSecretShare
+	receivedThresholdShares map[int]multiparty.ShamirSecretShare
+
+	// 协调器聚合出的新纪元集体密钥，下载后才能切换密文
+	pk         *rlwe.PublicKey
+	rlk        *rlwe.RelinearizationKey
+	galoisKeys []*rlwe.GaloisKey
+}
+
+// matches 是否为指定纪元和尝试次数的轮换
+func (rs *rotationState) matches(epoch, attempt int) bool {
+	return rs != nil && rs.epoch == epoch && rs.attempt == attempt
+}
+
+// BeginRotation 开始轮换到新纪元，sk 为本方新生成的私钥份额，members 为新纪元的成员，
+// oldKey 为协调器通知的当前纪元集体公钥指纹
+// 还没有私钥份额的参与方作为新成员加入，从协调器的当前纪元开始；之前未完成的轮换被丢弃
+func (km *KeyManager) BeginRotation(epoch, attempt int, sk *rlwe.SecretKey, members []int, membershipEpoch int, oldKey envelope.Fingerprint) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	joining := km.Sk == nil
+	if joining {
+		km.Epoch = epoch - 1
+	}
+	if epoch != km.Epoch+1 {
+		return fmt.Errorf("当前为第 %d 纪元，不能轮换到第 %d 纪元", km.Epoch, epoch)
+	}
+	if own := km.pkFingerprint.Fingerprint(km.PubKey); !joining && own != oldKey {
+		return fmt.Errorf("协调器的集体公钥 %s 与本方 %s 不一致", oldKey, own)
+	}
+	km.discardRotationLocked()
+	km.rotation = &rotationState{
+		epoch:                   epoch,
+		attempt:                 attempt,
+		members:                 members,
+		membershipEpoch:         membershipEpoch,
+		joining:                 joining,
+		oldKey:                  oldKey,
+		sk:                      sk,
+		receivedThresholdShares: make(map[int]multiparty.ShamirSecretShare),
+	}
+	return nil
+}
+
+// RotationMembers 进行中轮换的新纪元成员
+func (km *KeyManager) RotationMembers(epoch, attempt int) []int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return nil
+	}
+	return km.rotation.members
+}
+
+// RotationKeyFingerprint 进行中轮换被切换密文所在的集体公钥指纹
+func (km *KeyManager) RotationKeyFingerprint(epoch, attempt int) (envelope.Fingerprint, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return envelope.Fingerprint{}, fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	return km.rotation.oldKey, nil
+}
+
+// RotationInProgress 返回进行中轮换的目标纪元和尝试次数
+func (km *KeyManager) RotationInProgress() (epoch, attempt int, ok bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if km.rotation == nil {
+		return 0, 0, false
+	}
+	return km.rotation.epoch, km.rotation.attempt, true
+}
+
+// GenerateNextThresholdShares 为全部参与方生成新纪元私钥的Shamir份额
+func (km *KeyManager) GenerateNextThresholdShares(epoch, attempt int, participantIDs []int) (map[int]multiparty.ShamirSecretShare, error) {
+	km.mu.RLock()
+	rs, threshold, params := km.rotation, km.Threshold, km.Params
+	km.mu.RUnlock()
+	if !rs.matches(epoch, attempt) {
+		return nil, fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	return genShamirShares(params, threshold, rs.sk, participantIDs)
+}
+
+// AddNextThresholdShare 保存参与方 fromID 发给 toID 的新纪元Shamir份额，只接受新纪元成员发来的份额
+// 本方尚未开始该次轮换时返回错误，发送方稍后重试
+func (km *KeyManager) AddNextThresholdShare(epoch, attempt, fromID, toID int, share multiparty.ShamirSecretShare) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	rs := km.rotation
+	if !rs.matches(epoch, attempt) {
+		return fmt.Errorf("%w: 第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", ErrThresholdNotStarted, epoch, attempt)
+	}
+	if rs.thresholdShare != nil {
+		return ErrThresholdClosed
+	}
+	return addShamirShare(rs.receivedThresholdShares, rs.members, km.SelfID, fromID, toID, share)
+}
+
+// NextThresholdShareCount 已收到的新纪元Shamir份额数量（包括自己的）
+func (km *KeyManager) NextThresholdShareCount(epoch, attempt int) int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return 0
+	}
+	return len(km.rotation.receivedThresholdShares)
+}
+
+// FinalizeNextThresholdShare 聚合新纪元全部成员的Shamir份额
+func (km *KeyManager) FinalizeNextThresholdShare(epoch, attempt int) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	rs := km.rotation
+	if !rs.matches(epoch, attempt) {
+		return fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	agg, err := aggregateShamirShares(km.Params, rs.receivedThresholdShares, len(rs.members))
+	if err != nil {
+		return err
+	}
+	rs.thresholdShare = agg
+	rs.receivedThresholdShares = nil
+	return nil
+}
+
+// SetNextKeys 保存协调器聚合出的新纪元集体密钥
+func (km *KeyManager) SetNextKeys(epoch, attempt int, pk *rlwe.PublicKey, rlk *rlwe.RelinearizationKey, galoisKeys []*rlwe.GaloisKey) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	km.rotation.pk, km.rotation.rlk, km.rotation.galoisKeys = pk, rlk, galoisKeys
+	return nil
+}
+
+// NextPublicKey 新纪元的集体公钥，尚未下载时为nil
+func (km *KeyManager) NextPublicKey(epoch, attempt int) *rlwe.PublicKey {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return nil
+	}
+	return km.rotation.pk
+}
+
+// RotationSecretKeys 返回切换密文使用的当前纪元和新纪元私钥份额，加入的新成员当前纪元的份额为零
+func (km *KeyManager) RotationSecretKeys(epoch, attempt int) (*rlwe.SecretKey, *rlwe.SecretKey, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if !km.rotation.matches(epoch, attempt) {
+		return nil, nil, fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	if km.rotation.joining {
+		return rlwe.NewSecretKey(km.Params), km.rotation.sk, nil
+	}
+	if km.Sk == nil {
+		return nil, nil, fmt.Errorf("私钥未准备就绪")
+	}
+	return km.Sk, km.rotation.sk, nil
+}
+
+// CommitRotation 提交新纪元：清零旧私钥份额和门限份额，改用新纪元的密钥材料和成员
+func (km *KeyManager) CommitRotation(epoch, attempt int) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	rs := km.rotation
+	if !rs.matches(epoch, attempt) {
+		return fmt.Errorf("第 %d 纪元第 %d 次尝试不是进行中的密钥轮换", epoch, attempt)
+	}
+	if rs.pk == nil || rs.rlk == nil {
+		return fmt.Errorf("尚未获取第 %d 纪元的集体密钥", epoch)
+	}
+	if km.Threshold > 0 && km.Threshold < km.ExpectedN && rs.thresholdShare == nil {
+		return fmt.Errorf("第 %d 纪元的门限份额未准备就绪", epoch)
+	}
+	// 全员模式（t=N）下t随成员数量更新
+	if n := len(rs.members); n > 0 {
+		if km.Threshold <= 0 || km.Threshold >= km.ExpectedN {
+			km.Threshold = n
+		}
+		km.ExpectedN = n
+		km.Members = rs.members
+		km.MembershipEpoch = rs.membershipEpoch
+	}
+
+	if km.Sk != nil {
+		km.Sk.Value.Q.Zero()
+		km.Sk.Value.P.Zero()
+	}
+	if km.thresholdShare != nil {
+		km.thresholdShare.Q.Zero()
+		km.thresholdShare.P.Zero()
+	}
+	km.Sk = rs.sk
+	km.thresholdShare = rs.thresholdShare
+	km.PubKey = rs.pk
+	km.RelineKey = rs.rlk
+	km.GaloisKeys = rs.galoisKeys
+	km.TotalGaloisKeys = len(rs.galoisKeys)
+	km.Epoch = epoch
+	km.rotation = nil
+	return nil
+}
+
+// AbortRotation 丢弃进行中的轮换
+func (km *KeyManager) AbortRotation() {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.discardRotationLocked()
+}
+
+// discardRotationLocked 清零并丢弃新纪元的私钥材料，调用方需持有写锁
+func (km *KeyManager) discardRotationLocked() {
+	rs := km.rotation
+	if rs == nil {
+		return
+	}
+	if rs.sk != nil {
+		rs.sk.Value.Q.Zero()
+		rs.sk.Value.P.Zero()
+	}
+	if rs.thresholdShare != nil {
+		rs.thresholdShare.Q.Zero()
+		rs.thresholdShare.P.Zero()
+	}
+	km.rotation = nil
+}
+
+// GenerateRotationShare 生成把密文从当前纪元切换到新纪元的本地份额
+func (km *KeyManager) GenerateRotationShare(ct *rlwe.Ciphertext, epoch, attempt int) (multiparty.KeySwitchShare, error) {
+	skOld, skNew, err := km.RotationSecretKeys(epoch, attempt)
+	if err != nil {
+		return multiparty.KeySwitchShare{}, err
+	}
+	params := km.GetParams()
+	proto, err := multiparty.NewKeySwitchProtocol(params, smudging.ForRotation(params))
+	if err != nil {
+		return multiparty.KeySwitchShare{}, err
+	}
+	share := proto.AllocateShare(ct.Level())
+	proto.GenShare(skOld, skNew, ct, &share)
+	return share, nil
+}
+
+// CollaborativeRotateBatch 与新纪元的全部成员协同把多个密文切换到新纪元的集体私钥
+// 返回与输入一一对应的切换后密文和错误
+func (ds *DecryptionService) CollaborativeRotateBatch(ctx context.Context, cts []*rlwe.Ciphertext, epoch, attempt int, onlinePeers map[int]string, myID int) ([]*rlwe.Ciphertext, []error, types.RoundReport) {
+	km := ds.keyManager
+	members := km.RotationMembers(epoch, attempt)
+	items := make([]types.BatchItem, len(cts))
+	for i, ct := range cts {
+		items[i] = types.BatchItem{Level: ct.Level()}
+	}
+	params := km.GetParams()
+	key, err := km.RotationKeyFingerprint(epoch, attempt)
+	if err != nil {
+		errs := make([]error, len(cts))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]*rlwe.Ciphertext, len(cts)), errs, types.RoundReport{}
+	}
+	round := batchRound[multiparty.KeySwitchShare]{
+		name:  "密钥轮换",
+		path:  "/keys/rotation/switch/batch",
+		cts:   cts,
+		items: items,
+		local: func(i int, active []int) (multiparty.KeySwitchShare, error) {
+			return km.GenerateRotationShare(cts[i], epoch, attempt)
+		},
+		decode: func(i int, data []byte) (multiparty.KeySwitchShare, error) {
+			return envelope.OpenKeySwitchShare(params, key, cts[i].Level(), data)
+		},
+		key:      key,
+		required: len(members),
+		members:  members,
+		header:   types.BatchHeader{Epoch: epoch, Attempt: attempt},
+	}
+	shares, errs, report := collectBatchShares(ctx, ds.client, km, round, onlinePeers, myID)
+
+	rotated := make([]*rlwe.Ciphertext, len(cts))
+	parallelFor(len(cts), func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		proto, err := multiparty.NewKeySwitchProtocol(params, smudging.ForRotation(params))
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		agg := proto.AllocateShare(cts[i].Level())
+		for _, share := range shares[i] {
+			if err := proto.AggregateShares(share, agg, &agg); err != nil {
+				errs[i] = fmt.Errorf("聚合密钥轮换份额失败: %v", err)
+				return
+			}
+		}
+		rotated[i] = rlwe.NewCiphertext(params, 1, cts[i].Level())
+		*rotated[i].MetaData = *cts[i].MetaData
+		proto.KeySwitch(cts[i], agg, rotated[i])
+	})
+	return rotated, errs, report
+}
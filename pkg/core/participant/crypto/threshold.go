@@ -0,0 +1,260 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// ==================== 门限（t-out-of-N）密钥材料 ====================
+//
+// 密钥生成阶段仍需全部N个参与方在线。每个参与方将自己的私钥sk_i
+// 用Shamir秘密共享拆分为N份，点对点发送给其他参与方；收到全部份额后
+// 聚合得到本方的门限份额。之后任意t个在线参与方即可通过Combiner
+// 得到t-out-of-t的加法份额，用于协同解密和协同刷新。
+
+// 门限份额交换中拒绝份额的原因，P2P处理器据此选择状态码
+var (
+	ErrThresholdNotStarted = errors.New("本方尚未开始交换门限份额")   // 发送方稍后重试
+	ErrThresholdSender     = errors.New("发送方不是本次份额交换的成员") // 候选成员或未知参与方
+	ErrThresholdRecipient  = errors.New("份额不是发给本方的")
+	ErrThresholdConflict   = errors.New("已收到该发送方的不同份额") // 每个发送方只能发送一次
+	ErrThresholdClosed     = errors.New("门限份额已聚合，不再接受份额")
+)
+
+// SetThresholdConfig 设置门限配置
+func (km *KeyManager) SetThresholdConfig(selfID, threshold, expectedN int) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if threshold <= 0 || threshold > expectedN {
+		threshold = expectedN
+	}
+	km.SelfID = selfID
+	km.Threshold = threshold
+	km.ExpectedN = expectedN
+}
+
+// IsThresholdMode 是否启用了t<N的门限模式
+func (km *KeyManager) IsThresholdMode() bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.Threshold > 0 && km.Threshold < km.ExpectedN
+}
+
+// RequiredParticipants 协同解密/刷新所需的参与方数量
+// 门限模式下为t，否则为全部N个参与方
+func (km *KeyManager) RequiredParticipants() int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if km.Threshold > 0 && km.Threshold < km.ExpectedN {
+		return km.Threshold
+	}
+	return km.ExpectedN
+}
+
+// GenerateThresholdShares 为所有参与方生成本方私钥的Shamir份额
+// 参数：participantIDs 全部N个参与方ID（包括自己），ID即ShamirPublicPoint
+// 返回：参与方ID -> 发给该参与方的份额
+func (km *KeyManager) GenerateThresholdShares(participantIDs []int) (map[int]multiparty.ShamirSecretShare, error) {
+	km.mu.RLock()
+	sk, threshold, params := km.Sk, km.Threshold, km.Params
+	km.mu.RUnlock()
+
+	if sk == nil {
+		return nil, fmt.Errorf("私钥未生成，无法生成门限份额")
+	}
+	return genShamirShares(params, threshold, sk, participantIDs)
+}
+
+// genShamirShares 用Shamir秘密共享把sk拆分给全部参与方
+func genShamirShares(params ckks.Parameters, threshold int, sk *rlwe.SecretKey, participantIDs []int) (map[int]multiparty.ShamirSecretShare, error) {
+	thresholdizer := multiparty.NewThresholdizer(params)
+	poly, err := thresholdizer.GenShamirPolynomial(threshold, sk)
+	if err != nil {
+		return nil, fmt.Errorf("生成Shamir多项式失败: %v", err)
+	}
+
+	shares := make(map[int]multiparty.ShamirSecretShare, len(participantIDs))
+	for _, id := range participantIDs {
+		if id <= 0 {
+			return nil, fmt.Errorf("无效的参与方ID: %d", id)
+		}
+		share := thresholdizer.AllocateThresholdSecretShare()
+		thresholdizer.GenShamirSecretShare(multiparty.ShamirPublicPoint(id), poly, &share)
+		shares[id] = share
+	}
+	return shares, nil
+}
+
+// BeginThresholdShares 开始交换Shamir份额，participantIDs 为交换份额的全部N个参与方（包括自己）
+// 开始之前到达的份额被拒绝，发送方稍后重试；只接受这些参与方发来的份额
+func (km *KeyManager) BeginThresholdShares(participantIDs []int) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if km.thresholdShare != nil {
+		return ErrThresholdClosed
+	}
+	if len(participantIDs) != km.ExpectedN {
+		return fmt.Errorf("交换门限份额的参与方数量 %d 与N=%d 不一致", len(participantIDs), km.ExpectedN)
+	}
+	km.thresholdSenders = append([]int(nil), participantIDs...)
+	km.receivedThresholdShares = make(map[int]multiparty.ShamirSecretShare, len(participantIDs))
+	return nil
+}
+
+// AddThresholdShare 保存参与方 fromID 发给 toID 的Shamir份额
+// 每个发送方只接受一个份额（相同份额的重传视为成功），聚合之后不再接受
+func (km *KeyManager) AddThresholdShare(fromID, toID int, share multiparty.ShamirSecretShare) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if km.thresholdShare != nil {
+		return ErrThresholdClosed
+	}
+	if km.thresholdSenders == nil {
+		return ErrThresholdNotStarted
+	}
+	return addShamirShare(km.receivedThresholdShares, km.thresholdSenders, km.SelfID, fromID, toID, share)
+}
+
+// addShamirShare 校验发送方和接收方后保存份额，调用方需持有写锁
+func addShamirShare(received map[int]multiparty.ShamirSecretShare, senders []int, selfID, fromID, toID int, share multiparty.ShamirSecretShare) error {
+	if !containsInt(senders, fromID) {
+		return fmt.Errorf("%w: 参与方 %d", ErrThresholdSender, fromID)
+	}
+	if toID != selfID {
+		return fmt.Errorf("%w: 接收方为 %d", ErrThresholdRecipient, toID)
+	}
+	if existing, ok := received[fromID]; ok {
+		// 响应丢失后的重传
+		if existing.Equal(&share.Poly) {
+			return nil
+		}
+		return fmt.Errorf("%w: 参与方 %d", ErrThresholdConflict, fromID)
+	}
+	received[fromID] = share
+	return nil
+}
+
+// containsInt 判断切片中是否包含v
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ReceivedThresholdShareCount 已收到的Shamir份额数量（包括自己的）
+func (km *KeyManager) ReceivedThresholdShareCount() int {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return len(km.receivedThresholdShares)
+}
+
+// FinalizeThresholdShare 聚合收到的全部N个份额，得到本方的门限份额
+func (km *KeyManager) FinalizeThresholdShare() error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	agg, err := aggregateShamirShares(km.Params, km.receivedThresholdShares, km.ExpectedN)
+	if err != nil {
+		return err
+	}
+	km.thresholdShare = agg
+	// 聚合后不再需要保留单独的份额
+	km.receivedThresholdShares = nil
+	return nil
+}
+
+// aggregateShamirShares 聚合收到的全部N个Shamir份额
+func aggregateShamirShares(params ckks.Parameters, received map[int]multiparty.ShamirSecretShare, expectedN int) (*multiparty.ShamirSecretShare, error) {
+	if len(received) != expectedN {
+		return nil, fmt.Errorf("门限份额数量不足: %d/%d", len(received), expectedN)
+	}
+	thresholdizer := multiparty.NewThresholdizer(params)
+	agg := thresholdizer.AllocateThresholdSecretShare()
+	for id, share := range received {
+		if err := thresholdizer.AggregateShares(agg, share, &agg); err != nil {
+			return nil, fmt.Errorf("聚合参与方 %d 的门限份额失败: %v", id, err)
+		}
+	}
+	return &agg, nil
+}
+
+// HasThresholdShare 门限份额是否已准备就绪
+func (km *KeyManager) HasThresholdShare() bool {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.thresholdShare != nil
+}
+
+// SecretKeyForActiveSet 获取本方在给定活跃参与方集合下使用的私钥份额
+// 非门限模式直接返回本地私钥；门限模式下通过Combiner计算t-out-of-t加法份额，
+// 活跃集合必须恰好包含t个参与方且包含自己，所有参与方必须使用相同的集合
+func (km *KeyManager) SecretKeyForActiveSet(active []int) (*rlwe.SecretKey, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	if km.Sk == nil {
+		return nil, fmt.Errorf("私钥未准备就绪")
+	}
+	if !(km.Threshold > 0 && km.Threshold < km.ExpectedN) {
+		return km.Sk, nil
+	}
+	if km.thresholdShare == nil {
+		return nil, fmt.Errorf("门限份额未准备就绪")
+	}
+	if len(active) != km.Threshold {
+		return nil, fmt.Errorf("活跃参与方数量 %d 与门限 %d 不一致", len(active), km.Threshold)
+	}
+
+	own := multiparty.ShamirPublicPoint(km.SelfID)
+	points := make([]multiparty.ShamirPublicPoint, 0, len(active))
+	found := false
+	for _, id := range active {
+		if id == km.SelfID {
+			found = true
+		}
+		points = append(points, multiparty.ShamirPublicPoint(id))
+	}
+	if !found {
+		return nil, fmt.Errorf("参与方 %d 不在活跃集合 %v 中", km.SelfID, active)
+	}
+
+	combiner := multiparty.NewCombiner(*km.Params.GetRLWEParameters(), own, points, km.Threshold)
+	sk := rlwe.NewSecretKey(km.Params)
+	if err := combiner.GenAdditiveShare(points, own, *km.thresholdShare, sk); err != nil {
+		return nil, fmt.Errorf("生成加法份额失败: %v", err)
+	}
+	return sk, nil
+}
+
+// SelectActiveParticipants 从在线参与方中选出本次协同操作的活跃集合
+// 集合总是包含自己，其余按ID升序补足到required个，返回结果按ID升序排列
+func SelectActiveParticipants(onlinePeers map[int]string, myID int, required int, exclude map[int]bool) ([]int, error) {
+	candidates := make([]int, 0, len(onlinePeers))
+	for id := range onlinePeers {
+		if id == myID || exclude[id] {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	sort.Ints(candidates)
+
+	if required <= 0 {
+		// 未知门限时使用全部在线参与方
+		required = len(candidates) + 1
+	}
+	if len(candidates)+1 < required {
+		return nil, fmt.Errorf("在线参与方不足: 需要 %d 个，当前可用 %d 个", required, len(candidates)+1)
+	}
+
+	active := append([]int{myID}, candidates[:required-1]...)
+	sort.Ints(active)
+	return active, nil
+}
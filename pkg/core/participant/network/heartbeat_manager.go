@@ -1,19 +1,23 @@
 package network
 
 import (
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/types"
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// EventSource 订阅协调器会话事件流，见 CoordinatorClient.Events
+type EventSource func(ctx context.Context) (<-chan types.CoordinatorEvent, error)
+
 // HeartbeatManager 心跳和在线状态管理
 type HeartbeatManager struct {
 	coordinatorURL     string
-	heartbeatTicker    *time.Ticker
-	heartbeatStopCh    chan struct{}
+	peersMu            sync.RWMutex
 	onlinePeers        map[int]string
 	lastPeerUpdate     time.Time
 	peerUpdateInterval time.Duration
@@ -21,14 +25,17 @@ type HeartbeatManager struct {
 	client             *types.HTTPClient
 	participantID      int
 	interval           time.Duration
-	stopCh             chan struct{}
+
+	// 停止信号，心跳和在线状态监控协程共用
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 // NewHeartbeatManager 创建新的心跳管理器
 func NewHeartbeatManager(coordinatorURL string, client *types.HTTPClient, participantID int) *HeartbeatManager {
 	return &HeartbeatManager{
 		coordinatorURL:     coordinatorURL,
-		heartbeatStopCh:    make(chan struct{}),
 		onlinePeers:        make(map[int]string),
 		peerUpdateInterval: 10 * time.Second,
 		silentMode:         false,
@@ -41,15 +48,17 @@ func NewHeartbeatManager(coordinatorURL string, client *types.HTTPClient, partic
 
 // Start 启动心跳管理器
 func (hm *HeartbeatManager) Start() {
-	fmt.Printf("心跳管理器启动，参与方ID: %d\n", hm.participantID)
-	fmt.Printf("心跳间隔: %v\n", hm.interval)
-	fmt.Printf("协调器URL: %s\n", hm.coordinatorURL)
+	logs.Printf("心跳管理器启动，参与方ID: %d\n", hm.participantID)
+	logs.Printf("心跳间隔: %v\n", hm.interval)
+	logs.Printf("协调器URL: %s\n", hm.coordinatorURL)
 
+	hm.wg.Add(1)
 	go hm.run()
 }
 
 // run 运行心跳循环
 func (hm *HeartbeatManager) run() {
+	defer hm.wg.Done()
 	ticker := time.NewTicker(hm.interval)
 	defer ticker.Stop()
 
@@ -57,10 +66,10 @@ func (hm *HeartbeatManager) run() {
 		select {
 		case <-ticker.C:
 			if err := hm.sendHeartbeat(); err != nil {
-				fmt.Printf("心跳发送失败: %v\n", err)
+				logs.Printf("心跳发送失败: %v\n", err)
 			}
 		case <-hm.stopCh:
-			fmt.Printf("心跳管理器停止\n")
+			logs.Printf("心跳管理器停止\n")
 			return
 		}
 	}
@@ -77,7 +86,7 @@ func (hm *HeartbeatManager) sendHeartbeat() error {
 		return err
 	}
 
-	resp, err := http.Post(hm.coordinatorURL+"/heartbeat", "application/json", bytes.NewReader(jsonData))
+	resp, err := hm.client.PostSigned(hm.coordinatorURL+"/heartbeat", jsonData)
 	if err != nil {
 		return err
 	}
@@ -90,31 +99,51 @@ func (hm *HeartbeatManager) sendHeartbeat() error {
 	return nil
 }
 
-// StartOnlineStatusMonitor 启动在线状态监控
-func (hm *HeartbeatManager) StartOnlineStatusMonitor() {
+// StartOnlineStatusMonitor 启动在线状态监控：订阅协调器事件流，按每个事件附带的在线列表更新
+// 事件流断开时重新订阅，订阅失败期间退回每 peerUpdateInterval 拉取一次在线列表
+func (hm *HeartbeatManager) StartOnlineStatusMonitor(events EventSource) {
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		ticker := time.NewTicker(hm.peerUpdateInterval)
-		defer ticker.Stop()
+		<-hm.stopCh
+		cancel()
+	}()
 
+	hm.wg.Add(1)
+	go func() {
+		defer hm.wg.Done()
 		for {
-			select {
-			case <-ticker.C:
+			retry := time.Second
+			if ch, err := events(ctx); err != nil {
+				if !hm.silentMode {
+					logs.Printf("订阅会话事件失败，改为拉取在线列表: %v\n", err)
+				}
 				hm.updateOnlinePeers()
-			case <-hm.heartbeatStopCh:
+				retry = hm.peerUpdateInterval
+			} else {
+				for ev := range ch {
+					if ev.Online != nil {
+						hm.setOnlinePeers(ev.Online)
+					}
+				}
+			}
+
+			select {
+			case <-time.After(retry):
+			case <-hm.stopCh:
 				return
 			}
 		}
 	}()
 
-	fmt.Printf("启动在线状态监控\n")
+	logs.Printf("启动在线状态监控\n")
 }
 
-// updateOnlinePeers 更新在线参与方列表
+// updateOnlinePeers 从协调器拉取在线参与方列表
 func (hm *HeartbeatManager) updateOnlinePeers() {
 	resp, err := hm.client.Client.Get(hm.coordinatorURL + "/participants/online")
 	if err != nil {
 		if !hm.silentMode {
-			fmt.Printf("获取在线列表失败: %v\n", err)
+			logs.Printf("获取在线列表失败: %v\n", err)
 		}
 		return
 	}
@@ -123,24 +152,40 @@ func (hm *HeartbeatManager) updateOnlinePeers() {
 	var onlinePeers []types.PeerInfo
 	if err := json.NewDecoder(resp.Body).Decode(&onlinePeers); err != nil {
 		if !hm.silentMode {
-			fmt.Printf("解析在线列表失败: %v\n", err)
+			logs.Printf("解析在线列表失败: %v\n", err)
 		}
 		return
 	}
+	hm.setOnlinePeers(onlinePeers)
+}
 
-	hm.onlinePeers = make(map[int]string)
-	for _, peer := range onlinePeers {
-		hm.onlinePeers[peer.ID] = peer.URL
+// setOnlinePeers 替换在线参与方列表，列表有变化时输出
+func (hm *HeartbeatManager) setOnlinePeers(peers []types.PeerInfo) {
+	onlinePeers := make(map[int]string, len(peers))
+	for _, peer := range peers {
+		onlinePeers[peer.ID] = peer.URL
 	}
+
+	hm.peersMu.Lock()
+	changed := len(onlinePeers) != len(hm.onlinePeers)
+	for id, url := range onlinePeers {
+		if hm.onlinePeers[id] != url {
+			changed = true
+		}
+	}
+	hm.onlinePeers = onlinePeers
 	hm.lastPeerUpdate = time.Now()
+	hm.peersMu.Unlock()
 
-	if !hm.silentMode {
-		fmt.Printf("更新在线列表: %d 个参与方在线\n", len(hm.onlinePeers))
+	if changed && !hm.silentMode {
+		logs.Printf("更新在线列表: %d 个参与方在线\n", len(onlinePeers))
 	}
 }
 
 // GetOnlinePeers 获取在线参与方列表
 func (hm *HeartbeatManager) GetOnlinePeers() map[int]string {
+	hm.peersMu.RLock()
+	defer hm.peersMu.RUnlock()
 	result := make(map[int]string)
 	for id, url := range hm.onlinePeers {
 		result[id] = url
@@ -169,11 +214,12 @@ func (hm *HeartbeatManager) SetSilentMode(silent bool) {
 	hm.silentMode = silent
 }
 
-// StopHeartbeat 停止心跳机制
+// StopHeartbeat 停止心跳和在线状态监控，等待协程退出，可重复调用
 func (hm *HeartbeatManager) StopHeartbeat() {
-	if hm.heartbeatTicker != nil {
-		close(hm.heartbeatStopCh)
-	}
+	hm.stopOnce.Do(func() {
+		close(hm.stopCh)
+	})
+	hm.wg.Wait()
 }
 
 // ShowOnlineStatus 显示在线状态信息
@@ -183,19 +229,19 @@ func (hm *HeartbeatManager) ShowOnlineStatus() error {
 		return err
 	}
 
-	fmt.Println("\n=== 在线状态信息 ===")
-	fmt.Printf("在线参与方数量: %v\n", status["online_count"])
-	fmt.Printf("总参与方数量: %v\n", status["total_count"])
-	fmt.Printf("最小阈值: %v\n", status["min_participants"])
-	fmt.Printf("可以协作: %v\n", status["can_proceed"])
-	fmt.Printf("心跳超时: %v 秒\n", status["online_timeout"])
-	fmt.Printf("心跳间隔: %v 秒\n", status["heartbeat_interval"])
+	logs.Println("\n=== 在线状态信息 ===")
+	logs.Printf("在线参与方数量: %v\n", status["online_count"])
+	logs.Printf("总参与方数量: %v\n", status["total_count"])
+	logs.Printf("最小阈值: %v\n", status["min_participants"])
+	logs.Printf("可以协作: %v\n", status["can_proceed"])
+	logs.Printf("心跳超时: %v 秒\n", status["online_timeout"])
+	logs.Printf("心跳间隔: %v 秒\n", status["heartbeat_interval"])
 
 	// 显示在线参与方列表
 	onlinePeers := hm.GetOnlinePeers()
-	fmt.Printf("\n在线参与方列表 (%d 个):\n", len(onlinePeers))
+	logs.Printf("\n在线参与方列表 (%d 个):\n", len(onlinePeers))
 	for id, url := range onlinePeers {
-		fmt.Printf("   参与方 %d: %s\n", id, url)
+		logs.Printf("   参与方 %d: %s\n", id, url)
 	}
 
 	return nil
@@ -233,7 +279,7 @@ func (hm *HeartbeatManager) CheckOnlineStatusBeforeOperation() error {
 	}
 	canCollaborate := canCollaborateVal.(bool)
 
-	fmt.Printf(" 检查在线状态: %d/%d 个参与方在线，最小阈值: %d\n", onlineCount, totalCount, minParticipants)
+	logs.Printf(" 检查在线状态: %d/%d 个参与方在线，最小阈值: %d\n", onlineCount, totalCount, minParticipants)
 
 	if !canCollaborate {
 		return fmt.Errorf(" 在线参与方数量不足，无法进行协作操作 (需要至少 %d 个参与方在线，当前 %d 个)", minParticipants, onlineCount)
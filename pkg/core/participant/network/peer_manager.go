@@ -1,8 +1,8 @@
 package network
 
 import (
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/types"
-	"MPHEDev/pkg/core/participant/utils"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -29,7 +29,7 @@ func (pm *PeerManager) AddPeer(peerID int, peerURL string) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 	pm.Peers[peerID] = peerURL
-	fmt.Printf("添加对等节点: %d (%s)\n", peerID, peerURL)
+	logs.Printf("添加对等节点: %d (%s)\n", peerID, peerURL)
 }
 
 // GetPeerURL 获取对等节点URL
@@ -79,7 +79,7 @@ func (pm *PeerManager) DiscoverPeers(coordinatorURL string, client *types.HTTPCl
 		}
 	}
 
-	fmt.Printf("发现 %d 个其他参与方\n", len(pm.Peers))
+	logs.Printf("发现 %d 个其他参与方\n", len(pm.Peers))
 	return nil
 }
 
@@ -198,27 +198,16 @@ func isPrivateIP(ip net.IP) bool {
 	return false
 }
 
-// ReportURL 向协调器上报自己的URL
-func (pm *PeerManager) ReportURL(coordinatorURL string, client *types.HTTPClient, selfID int, port int) error {
-	// 使用正确的IP获取函数，优先查找Radmin VPN接口
-	localIP, err := utils.GetLocalIP()
-	if err != nil {
-		return fmt.Errorf("获取本机IP失败: %v", err)
-	}
-
-	myURL := fmt.Sprintf("http://%s:%d", localIP, port)
-
-	reqBody, _ := json.Marshal(types.PeerInfo{
-		ID:  selfID,
-		URL: myURL,
-	})
+// ReportURL 向协调器上报自己的URL，启用中继时同时上报中继公钥
+func (pm *PeerManager) ReportURL(coordinatorURL string, client *types.HTTPClient, self types.PeerInfo) error {
+	reqBody, _ := json.Marshal(self)
 
-	resp, err := client.Client.Post(coordinatorURL+"/participants/url", "application/json", bytes.NewReader(reqBody))
+	resp, err := client.PostSigned(coordinatorURL+"/participants/url", reqBody)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("上报URL: %s\n", myURL)
+	logs.Printf("上报URL: %s\n", self.URL)
 	return nil
 }
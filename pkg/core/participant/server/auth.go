@@ -0,0 +1,96 @@
+package server
+
+import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/wire"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 允许调用P2P接口的签名方
+const (
+	signerCoordinator = iota // 仅协调器
+	signerPeer               // 仅参与方（包括发给自己的消息）
+	signerAny                // 协调器或其他参与方
+)
+
+// protectedPaths 需要签名的P2P接口
+// /api/participant/* 是本机前端使用的接口，不在此列
+var protectedPaths = map[string]int{
+	"/partial_decrypt":            signerAny, // 协调器验证密钥或参与方协同解密
+	"/partial_refresh":            signerPeer,
+	"/partial_decrypt/batch":      signerPeer,
+	"/partial_refresh/batch":      signerPeer,
+	"/keys/rotation/switch/batch": signerPeer,
+	"/message":                    signerPeer,
+	"/threshold/share":            signerPeer,
+	"/keys/receive":               signerCoordinator,
+	"/keys/galois/round":          signerCoordinator,
+	"/keys/rotation":              signerCoordinator,
+	"/pcks_share":                 signerCoordinator,
+}
+
+// authMiddleware 验证P2P请求签名，拒绝伪造或重放的请求
+// 请求体（帧格式消息为控制帧）中声明的发送方（from字段）必须与签名方一致
+func authMiddleware(verifier *identity.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, ok := protectedPaths[c.Request.URL.Path]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// 验证签名前须读出整个请求体，限制长度防止未认证的请求耗尽内存
+		// 合法消息（压缩前后）都不超过 wire.MaxBodySize
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, wire.MaxBodySize)
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("请求体超过上限 %d", wire.MaxBodySize)})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		signer, err := verifier.Verify(c.Request, body)
+		if err != nil {
+			logs.Printf("[认证] 拒绝请求 %s: %v\n", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 签名覆盖压缩后的字节，验证通过后再解压
+		if body, err = wire.DecodeBody(c.Request, body); err != nil {
+			if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+				c.Header("Accept-Encoding", wire.Supported())
+			}
+			c.AbortWithStatusJSON(wire.StatusCode(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		isCoordinator := signer == identity.CoordinatorID
+		if (allowed == signerCoordinator && !isCoordinator) || (allowed == signerPeer && isCoordinator) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("签名方 %d 无权调用 %s", signer, c.Request.URL.Path)})
+			return
+		}
+
+		var claim struct {
+			From *int `json:"from"`
+		}
+		if err := json.Unmarshal(wire.ControlFrame(c.Request.Header.Get("Content-Type"), body), &claim); err == nil && claim.From != nil && *claim.From != signer {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("签名方 %d 不能代表参与方 %d 发送消息", signer, *claim.From)})
+			return
+		}
+		c.Next()
+	}
+}
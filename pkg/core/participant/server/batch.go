@@ -0,0 +1,288 @@
+package server
+
+import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/wire"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// ==================== 批量份额请求 ====================
+//
+// 一次请求携带多个密文，参与方用工作池并行生成份额，按完成顺序以帧格式流式返回，
+// 单个密文失败只影响该密文。帧格式见 types.BatchHeader，密文和份额均为绑定集体公钥的信封。
+
+// maxBatchItems 单个批量请求的密文数量上限
+const maxBatchItems = 4096
+
+// batchRequest 解析后的批量份额请求
+type batchRequest struct {
+	header types.BatchHeader
+	items  []types.BatchItem
+	cts    []*rlwe.Ciphertext
+	key    envelope.Fingerprint // 密文所在集体公钥的指纹，份额信封绑定同一指纹
+}
+
+// batchResult 单个密文的份额或失败原因
+type batchResult struct {
+	share   []byte
+	err     error
+	refused bool
+}
+
+// handlePartialDecryptBatch 批量部分解密处理器，每个密文都须对应已批准的解密任务
+func (h *Handlers) handlePartialDecryptBatch(w http.ResponseWriter, r *http.Request) {
+	if h.keyManager.GetSecretKey() == nil {
+		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := batchBody(w, r)
+	if !ok {
+		return
+	}
+	defer body.Close()
+	req, err := h.readBatchRequest(body, h.keyManager.KeyFingerprint())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := h.keyManager.GetParams()
+
+	logs.Printf("收到 %d 个密文的批量解密份额请求\n", len(req.cts))
+	h.serveBatch(w, r, len(req.cts), func(i int) batchResult {
+		ct := req.cts[i]
+		// 只为已批准的解密任务提供份额
+		if _, err := h.checkTask(req.items[i].TaskID, types.TaskKindDecrypt, ct); err != nil {
+			logs.Printf("[授权] 拒绝解密份额请求: %v\n", err)
+			return batchResult{err: err, refused: true}
+		}
+		share, err := h.decryptionService.GeneratePartialDecryptShare(ct, req.items[i].TaskID, req.header.Participants)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("生成解密份额失败: %v", err)}
+		}
+		data, err := envelope.SealKeySwitchShare(params, req.key, share)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("份额序列化失败: %v", err)}
+		}
+		return batchResult{share: data}
+	})
+}
+
+// handlePartialRefreshBatch 批量部分刷新处理器
+func (h *Handlers) handlePartialRefreshBatch(w http.ResponseWriter, r *http.Request) {
+	if h.keyManager.GetSecretKey() == nil {
+		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := batchBody(w, r)
+	if !ok {
+		return
+	}
+	defer body.Close()
+	req, err := h.readBatchRequest(body, h.keyManager.KeyFingerprint())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := h.keyManager.GetParams()
+
+	logs.Printf("收到 %d 个密文的批量刷新份额请求\n", len(req.cts))
+	h.serveBatch(w, r, len(req.cts), func(i int) batchResult {
+		ct := req.cts[i]
+		if ct.Level() != req.items[i].Level {
+			return batchResult{err: fmt.Errorf("密文层级 %d 与请求声明的层级 %d 不一致", ct.Level(), req.items[i].Level)}
+		}
+		share, err := h.refreshService.GenerateRefreshShare(ct, req.items[i].TaskID, req.header.Participants)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("生成刷新份额失败: %v", err)}
+		}
+		data, err := envelope.SealRefreshShare(params, req.key, share)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("份额序列化失败: %v", err)}
+		}
+		return batchResult{share: data}
+	})
+}
+
+// handleRotationSwitchBatch 批量密钥轮换切换处理器，为进行中的轮换生成把密文切换到新纪元的份额
+// 切换后的密文仍在新的集体密钥下加密，不需要解密任务授权
+func (h *Handlers) handleRotationSwitchBatch(w http.ResponseWriter, r *http.Request) {
+	body, ok := batchBody(w, r)
+	if !ok {
+		return
+	}
+	defer body.Close()
+	header, err := readBatchHeader(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	epoch, attempt := header.Epoch, header.Attempt
+	if _, _, err := h.keyManager.RotationSecretKeys(epoch, attempt); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	// 被切换的密文在当前纪元的集体公钥下，加入的新成员按协调器通知的指纹校验
+	key, err := h.keyManager.RotationKeyFingerprint(epoch, attempt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	req, err := h.readBatchItems(body, header, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := h.keyManager.GetParams()
+
+	logs.Printf("收到 %d 个密文的第 %d 纪元密钥轮换份额请求\n", len(req.cts), epoch)
+	h.serveBatch(w, r, len(req.cts), func(i int) batchResult {
+		share, err := h.keyManager.GenerateRotationShare(req.cts[i], epoch, attempt)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("生成密钥轮换份额失败: %v", err)}
+		}
+		data, err := envelope.SealKeySwitchShare(params, req.key, share)
+		if err != nil {
+			return batchResult{err: fmt.Errorf("份额序列化失败: %v", err)}
+		}
+		return batchResult{share: data}
+	})
+}
+
+// batchBody 返回解压后的批量请求体，请求不是帧格式或编码不支持时写出415响应
+func batchBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, bool) {
+	body, err := wire.RequestBody(r)
+	if err != nil {
+		wire.WriteUnsupported(w, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// readBatchRequest 读取批量请求的全部帧，密文信封须绑定会话参数和指纹为 key 的集体公钥
+func (h *Handlers) readBatchRequest(body io.Reader, key envelope.Fingerprint) (*batchRequest, error) {
+	header, err := readBatchHeader(body)
+	if err != nil {
+		return nil, err
+	}
+	return h.readBatchItems(body, header, key)
+}
+
+// readBatchHeader 读取并检查批量请求的首帧
+func readBatchHeader(body io.Reader) (types.BatchHeader, error) {
+	var header types.BatchHeader
+	frame, err := wire.ReadFrame(body)
+	if err != nil {
+		return header, fmt.Errorf("读取请求头失败: %v", err)
+	}
+	if err := json.Unmarshal(frame, &header); err != nil {
+		return header, fmt.Errorf("请求头解析失败: %v", err)
+	}
+	if header.Count <= 0 || header.Count > maxBatchItems {
+		return header, fmt.Errorf("密文数量 %d 超出范围 1..%d", header.Count, maxBatchItems)
+	}
+	return header, nil
+}
+
+// readBatchItems 读取首帧之后的密文描述和密文信封，逐个校验
+func (h *Handlers) readBatchItems(body io.Reader, header types.BatchHeader, key envelope.Fingerprint) (*batchRequest, error) {
+	params := h.keyManager.GetParams()
+	req := &batchRequest{
+		header: header,
+		items:  make([]types.BatchItem, header.Count),
+		cts:    make([]*rlwe.Ciphertext, header.Count),
+		key:    key,
+	}
+	for i := range req.cts {
+		frame, err := wire.ReadFrame(body)
+		if err != nil {
+			return nil, fmt.Errorf("读取第 %d 个密文描述失败: %v", i, err)
+		}
+		if err := json.Unmarshal(frame, &req.items[i]); err != nil {
+			return nil, fmt.Errorf("第 %d 个密文描述解析失败: %v", i, err)
+		}
+		if frame, err = wire.ReadFrame(body); err != nil {
+			return nil, fmt.Errorf("读取第 %d 个密文失败: %v", i, err)
+		}
+		ct, err := envelope.OpenCiphertext(params, key, frame)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个密文校验失败: %v", i, err)
+		}
+		if ct.Degree() != 1 {
+			return nil, fmt.Errorf("第 %d 个密文次数为 %d，需要先重线性化", i, ct.Degree())
+		}
+		req.cts[i] = ct
+	}
+	return req, nil
+}
+
+// serveBatch 用工作池并行处理n个密文，每完成一个就写出对应的响应帧
+// 请求方断开连接后不再处理剩余密文
+func (h *Handlers) serveBatch(w http.ResponseWriter, r *http.Request, n int, process func(i int) batchResult) {
+	ctx := r.Context()
+	rw, err := wire.NewResponseWriter(w, r, http.StatusOK)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jobs := make(chan int)
+	var mu sync.Mutex // 保护响应写出，帧不能交错
+	var writeErr error
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := process(i)
+				header := types.BatchShareHeader{Index: i, Refused: res.refused}
+				if res.err != nil {
+					header.Error = res.err.Error()
+					res.share = nil
+				}
+				headerBytes, _ := json.Marshal(header)
+
+				mu.Lock()
+				if writeErr == nil {
+					if writeErr = rw.WriteFrame(headerBytes); writeErr == nil {
+						writeErr = rw.WriteFrame(res.share)
+					}
+					if writeErr == nil {
+						writeErr = rw.Flush()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := rw.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		logs.Printf("[警告] 写出批量份额失败: %v\n", writeErr)
+	}
+}
@@ -1,15 +1,18 @@
 package server
 
 import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/crypto"
 	"MPHEDev/pkg/core/participant/types"
-	"MPHEDev/pkg/core/participant/utils"
+	"MPHEDev/pkg/core/wire"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
-	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/gorilla/websocket"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
 )
 
 // Handlers HTTP处理器集合
@@ -17,27 +20,34 @@ type Handlers struct {
 	keyManager        *crypto.KeyManager
 	decryptionService *crypto.DecryptionService
 	refreshService    *crypto.RefreshService
+	tasks             TaskSource   // 核对解密任务是否已批准
+	policy            PolicySource // 本方同意的授权策略
 }
 
 // NewHandlers 创建新的处理器集合
-func NewHandlers(keyManager *crypto.KeyManager, decryptionService *crypto.DecryptionService, refreshService *crypto.RefreshService) *Handlers {
+func NewHandlers(keyManager *crypto.KeyManager, decryptionService *crypto.DecryptionService, refreshService *crypto.RefreshService, tasks TaskSource, policy PolicySource) *Handlers {
 	return &Handlers{
 		keyManager:        keyManager,
 		decryptionService: decryptionService,
 		refreshService:    refreshService,
+		tasks:             tasks,
+		policy:            policy,
 	}
 }
 
 // GetHandlers 获取所有处理器
 func (h *Handlers) GetHandlers() map[string]http.HandlerFunc {
 	return map[string]http.HandlerFunc{
-		"/health":          h.handleHealth,
-		"/bootstrap":       h.handleBootstrap,
-		"/partial_decrypt": h.handlePartialDecrypt,
-		"/partial_refresh": h.handlePartialRefresh,
-		"/keys/receive":    h.handleReceiveKeys,
-		"/api/participant/collaborative-decrypt": h.handleCollaborativeDecrypt,
-		"/api/participant/collaborative-refresh": h.handleCollaborativeRefresh,
+		"/health":                     h.handleHealth,
+		"/bootstrap":                  h.handleBootstrap,
+		"/partial_decrypt":            h.handlePartialDecrypt,
+		"/partial_refresh":            h.handlePartialRefresh,
+		"/partial_decrypt/batch":      h.handlePartialDecryptBatch,
+		"/partial_refresh/batch":      h.handlePartialRefreshBatch,
+		"/keys/rotation/switch/batch": h.handleRotationSwitchBatch,
+		"/pcks_share":                 h.handlePCKSShare,
+		"/keys/receive":               h.handleReceiveKeys,
+		"/threshold/share":            h.handleThresholdShare,
 		"/api/participant/ws": func(w http.ResponseWriter, r *http.Request) {
 			h.handleParticipantWS(w, r)
 		},
@@ -63,80 +73,150 @@ func (h *Handlers) handleBootstrap(w http.ResponseWriter, r *http.Request) {
 
 // handlePartialDecrypt 部分解密处理器
 func (h *Handlers) handlePartialDecrypt(w http.ResponseWriter, r *http.Request) {
-	if !h.keyManager.IsReady() {
+	if h.keyManager.GetSecretKey() == nil {
 		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
 		return
 	}
 
-	var req struct {
-		TaskID     string `json:"task_id"`
-		Ciphertext string `json:"ciphertext"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "请求解析失败", http.StatusBadRequest)
+	var req types.PartialDecryptRequest
+	objects, ok := readMessage(w, r, &req, 1)
+	if !ok {
 		return
 	}
 
-	// 解码密文
-	ctBytes, err := utils.DecodeFromBase64(req.Ciphertext)
+	// 解码并校验密文信封
+	params, key := h.keyManager.GetParams(), h.keyManager.KeyFingerprint()
+	ct, err := envelope.OpenCiphertext(params, key, objects[0])
 	if err != nil {
-		http.Error(w, "密文解码失败", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("密文校验失败: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	var ct rlwe.Ciphertext
-	if err := utils.DecodeShare(ctBytes, &ct); err != nil {
-		http.Error(w, "密文反序列化失败", http.StatusBadRequest)
+	// 只为已批准的解密任务提供份额
+	if _, err := h.checkTask(req.TaskID, types.TaskKindDecrypt, ct); err != nil {
+		logs.Printf("[授权] 拒绝解密份额请求: %v\n", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
 	// 生成解密份额
-	share, err := h.decryptionService.GeneratePartialDecryptShare(&ct, req.TaskID)
+	share, err := h.decryptionService.GeneratePartialDecryptShare(ct, req.TaskID, req.Participants)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("生成解密份额失败: %v", err), http.StatusInternalServerError)
 		return
 	}
+	shareData, err := envelope.SealKeySwitchShare(params, key, share)
+	if err != nil {
+		http.Error(w, "份额序列化失败", http.StatusInternalServerError)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"share": share,
-	})
+	writeShare(w, r, shareData)
 }
 
-// handleReceiveKeys 处理接收密钥请求
-func (h *Handlers) handleReceiveKeys(w http.ResponseWriter, r *http.Request) {
+// readMessage 读取帧格式请求并检查对象数量，失败时写出错误响应
+func readMessage(w http.ResponseWriter, r *http.Request, control interface{}, count int) ([][]byte, bool) {
+	objects, err := wire.ReadRequest(r, control)
+	if err != nil {
+		if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+			wire.WriteUnsupported(w, err)
+		} else {
+			http.Error(w, fmt.Sprintf("请求解析失败: %v", err), http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	if len(objects) != count {
+		http.Error(w, fmt.Sprintf("请求包含 %d 个对象，应为 %d 个", len(objects), count), http.StatusBadRequest)
+		return nil, false
+	}
+	return objects, true
+}
+
+// writeShare 以帧格式返回份额信封
+func writeShare(w http.ResponseWriter, r *http.Request, shareData []byte) {
+	if err := wire.WriteResponse(w, r, types.ShareResponse{}, shareData); err != nil {
+		http.Error(w, "份额序列化失败", http.StatusInternalServerError)
+	}
+}
+
+// handleThresholdShare 接收其他参与方发来的Shamir门限份额
+func (h *Handlers) handleThresholdShare(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var keysData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&keysData); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var msg types.ThresholdShareMessage
+	objects, ok := readMessage(w, r, &msg, 1)
+	if !ok {
 		return
 	}
 
-	// 解析并设置密钥
-	if pubKeyStr, ok := keysData["pub_key"].(string); ok {
-		pubKeyBytes, err := utils.DecodeFromBase64(pubKeyStr)
-		if err == nil {
-			var pubKey rlwe.PublicKey
-			if err := utils.DecodeShare(pubKeyBytes, &pubKey); err == nil {
-				h.keyManager.SetPublicKey(&pubKey)
-			}
-		}
+	var share multiparty.ShamirSecretShare
+	if err := share.UnmarshalBinary(objects[0]); err != nil {
+		http.Error(w, "Failed to decode share", http.StatusBadRequest)
+		return
+	}
+
+	// 只接受本次交换的成员发给本方的份额，每个发送方一次；本方尚未开始交换时发送方稍后重试
+	var err error
+	if msg.Epoch > 0 {
+		// 密钥轮换中新纪元私钥的份额
+		err = h.keyManager.AddNextThresholdShare(msg.Epoch, msg.Attempt, msg.From, msg.To, share)
+	} else {
+		err = h.keyManager.AddThresholdShare(msg.From, msg.To, share)
+	}
+	if err != nil {
+		logs.Printf("[门限] 拒绝参与方 %d 的份额: %v\n", msg.From, err)
+		http.Error(w, err.Error(), thresholdShareStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "threshold_share_received"})
+}
+
+// thresholdShareStatus 拒绝门限份额时的状态码，只有尚未开始交换时（503）发送方重试
+func thresholdShareStatus(err error) int {
+	switch {
+	case errors.Is(err, crypto.ErrThresholdSender):
+		return http.StatusForbidden
+	case errors.Is(err, crypto.ErrThresholdRecipient):
+		return http.StatusBadRequest
+	case errors.Is(err, crypto.ErrThresholdConflict), errors.Is(err, crypto.ErrThresholdClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusServiceUnavailable
+	}
+}
+
+// handleReceiveKeys 处理接收密钥请求
+func (h *Handlers) handleReceiveKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	if relineKeyStr, ok := keysData["reline_key"].(string); ok {
-		relineKeyBytes, err := utils.DecodeFromBase64(relineKeyStr)
-		if err == nil {
-			var relineKey rlwe.RelinearizationKey
-			if err := utils.DecodeShare(relineKeyBytes, &relineKey); err == nil {
-				h.keyManager.SetRelinearizationKey(&relineKey)
-			}
+	var header types.KeysHeader
+	objects, err := wire.ReadRequest(r, &header)
+	if err != nil {
+		if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+			wire.WriteUnsupported(w, err)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
+		return
 	}
+	keys, err := types.DecodeKeys(header, objects)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 设置密钥
+	h.keyManager.SetPublicKey(keys.PubKey)
+	h.keyManager.SetRelinearizationKey(keys.RelineKey)
+	h.keyManager.SetGaloisKeys(keys.GaloisKeys)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "keys_received"})
@@ -150,73 +230,98 @@ func (h *Handlers) handlePartialRefresh(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req types.RefreshRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	objects, ok := readMessage(w, r, &req, 1)
+	if !ok {
 		return
 	}
 
-	// 解析密文
-	ctBytes, err := utils.DecodeFromBase64(req.Ciphertext)
+	// 解析并校验密文信封
+	params, key := h.keyManager.GetParams(), h.keyManager.KeyFingerprint()
+	ct, err := envelope.OpenCiphertext(params, key, objects[0])
 	if err != nil {
-		http.Error(w, "Invalid ciphertext", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("密文校验失败: %v", err), http.StatusBadRequest)
 		return
 	}
-
-	var ct rlwe.Ciphertext
-	if err := utils.DecodeShare(ctBytes, &ct); err != nil {
-		http.Error(w, "Failed to decode ciphertext", http.StatusBadRequest)
+	if ct.Level() != req.Level {
+		http.Error(w, fmt.Sprintf("密文层级 %d 与请求声明的层级 %d 不一致", ct.Level(), req.Level), http.StatusBadRequest)
 		return
 	}
 
 	// 生成刷新份额
-	share, err := h.refreshService.GenerateRefreshShare(&ct, req.TaskID)
+	share, err := h.refreshService.GenerateRefreshShare(ct, req.TaskID, req.Participants)
 	if err != nil {
-		http.Error(w, "Failed to generate refresh share", http.StatusInternalServerError)
+		http.Error(w, "Failed to generate refresh share: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// 序列化份额
-	shareBytes, err := utils.EncodeShare(share)
+	shareData, err := envelope.SealRefreshShare(params, key, share)
 	if err != nil {
 		http.Error(w, "Failed to encode share", http.StatusInternalServerError)
 		return
 	}
 
-	shareB64 := utils.EncodeToBase64(shareBytes)
-
 	// 返回份额
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(types.RefreshShareResponse{
-		Share: shareB64,
-	})
+	writeShare(w, r, shareData)
 }
 
-func (h *Handlers) handleCollaborativeDecrypt(w http.ResponseWriter, r *http.Request) {
-	if !h.keyManager.IsReady() {
+// handlePCKSShare 公钥切换份额处理器，把密文切换到结果接收方公钥下
+func (h *Handlers) handlePCKSShare(w http.ResponseWriter, r *http.Request) {
+	if h.keyManager.GetSecretKey() == nil {
 		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
 		return
 	}
-	// 这里假设参与方ID为1，实际应从会话或配置获取
-	// 这里只做本地触发，实际可根据需要扩展
-	if err := h.decryptionService.RequestCollaborativeDecrypt(nil, 1); err != nil {
-		http.Error(w, "协同解密失败: "+err.Error(), http.StatusInternalServerError)
+
+	// 对象依次为密文信封和接收方公钥信封
+	var req types.PCKSShareRequest
+	objects, ok := readMessage(w, r, &req, 2)
+	if !ok {
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "协同解密请求已发起"})
-}
 
-func (h *Handlers) handleCollaborativeRefresh(w http.ResponseWriter, r *http.Request) {
-	if !h.keyManager.IsReady() {
-		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
+	params, key := h.keyManager.GetParams(), h.keyManager.KeyFingerprint()
+	ct, err := envelope.OpenCiphertext(params, key, objects[0])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("密文校验失败: %v", err), http.StatusBadRequest)
 		return
 	}
-	if err := h.refreshService.RequestCollaborativeRefresh(nil, 1); err != nil {
-		http.Error(w, "协同刷新失败: "+err.Error(), http.StatusInternalServerError)
+
+	// 只为已批准的公钥切换任务提供份额，且接收方须与任务一致
+	task, err := h.checkTask(req.TaskID, types.TaskKindReencrypt, ct)
+	if err == nil && task.ConsumerID != req.ConsumerID {
+		err = fmt.Errorf("任务 %s 的接收方为 %s", task.ID, task.ConsumerID)
+	}
+	if err != nil {
+		logs.Printf("[授权] 拒绝公钥切换份额请求: %v\n", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "协同刷新请求已发起"})
+
+	pk, err := envelope.OpenPublicKey(params, objects[1])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("接收方公钥校验失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	// 协调器转发的公钥须是任务批准的那把，否则结果会交给持有其他私钥的一方
+	if fingerprint := envelope.KeyFingerprint(pk).Hex(); fingerprint != task.ConsumerKey {
+		logs.Printf("[授权] 拒绝公钥切换份额请求: 接收方公钥 %s 与任务 %s 批准的公钥不一致\n", fingerprint, task.ID)
+		http.Error(w, fmt.Sprintf("接收方公钥与任务 %s 批准的公钥不一致", task.ID), http.StatusForbidden)
+		return
+	}
+
+	share, err := h.decryptionService.GeneratePCKSShare(ct, pk, req.Participants)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("生成公钥切换份额失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	shareData, err := envelope.SealPublicKeySwitchShare(params, key, share)
+	if err != nil {
+		http.Error(w, "份额序列化失败", http.StatusInternalServerError)
+		return
+	}
+	logs.Printf("已为接收方 %s 生成公钥切换份额 (任务 %s)\n", req.ConsumerID, req.TaskID)
+
+	writeShare(w, r, shareData)
 }
 
 var upgrader = websocket.Upgrader{
@@ -1,7 +1,12 @@
 package server
 
 import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/utils"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/wire"
+	"context"
 	"fmt"
 	"net/http"
 
@@ -10,7 +15,7 @@ import (
 
 // MessageHandler 消息处理接口
 type MessageHandler interface {
-	HandleMessage(fromID int, message string)
+	HandleMessage(fromID int, message string, objects [][]byte)
 	GetOnlineParticipants() map[int]string
 	GetID() int
 	GetDataSplit() string
@@ -23,19 +28,22 @@ type HTTPServer struct {
 	LocalIP        string
 	Handlers       map[string]http.HandlerFunc
 	MessageHandler MessageHandler // 使用接口
+	TLS            *pki.Config    // mTLS配置，nil 时使用明文HTTP
 }
 
-// NewHTTPServer 创建新的HTTP服务器
-func NewHTTPServer(port int, handlers map[string]http.HandlerFunc, messageHandler MessageHandler) *HTTPServer {
+// NewHTTPServer 创建新的HTTP服务器，verifier 用于验证P2P请求签名
+// tlsConfig 不为 nil 时只接受会话CA签发证书的mTLS连接
+func NewHTTPServer(port int, handlers map[string]http.HandlerFunc, messageHandler MessageHandler, verifier *identity.Verifier, tlsConfig *pki.Config) *HTTPServer {
 	// 获取本机IP
 	localIP, err := utils.GetLocalIP()
 	if err != nil {
-		fmt.Printf("警告: 获取本机IP失败: %v\n", err)
+		logs.Printf("警告: 获取本机IP失败: %v\n", err)
 		localIP = "未知"
 	}
 
 	// 创建Gin路由器
 	router := gin.Default()
+	router.Use(authMiddleware(verifier))
 
 	// 添加状态页面
 	router.GET("/status", func(c *gin.Context) {
@@ -57,13 +65,18 @@ func NewHTTPServer(port int, handlers map[string]http.HandlerFunc, messageHandle
 			Message string `json:"message"`
 		}
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效请求"})
+		// 控制帧为消息内容，其后的对象帧为随消息发送的密文信封
+		objects, err := wire.ReadRequest(c.Request, &req)
+		if err != nil {
+			if wire.StatusCode(err) == http.StatusUnsupportedMediaType {
+				c.Header("Accept-Encoding", wire.Supported())
+			}
+			c.JSON(wire.StatusCode(err), gin.H{"error": "无效请求"})
 			return
 		}
 
 		// 处理消息
-		messageHandler.HandleMessage(req.From, req.Message)
+		messageHandler.HandleMessage(req.From, req.Message, objects)
 		c.JSON(http.StatusOK, gin.H{"status": "received"})
 	})
 
@@ -76,9 +89,13 @@ func NewHTTPServer(port int, handlers map[string]http.HandlerFunc, messageHandle
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: router,
 	}
+	if tlsConfig != nil {
+		server.TLSConfig = tlsConfig.ServerTLS()
+	}
 
 	return &HTTPServer{
 		Server:         server,
+		TLS:            tlsConfig,
 		Port:           port,
 		LocalIP:        localIP,
 		Handlers:       handlers,
@@ -88,26 +105,31 @@ func NewHTTPServer(port int, handlers map[string]http.HandlerFunc, messageHandle
 
 // Start 启动HTTP服务器
 func (hs *HTTPServer) Start() error {
-	fmt.Printf("参与方HTTP服务器启动中...\n")
-	fmt.Printf("本机IP: %s\n", hs.LocalIP)
-	fmt.Printf("监听地址: 0.0.0.0:%d\n", hs.Port)
-	fmt.Printf("状态页面: http://%s:%d/status\n", hs.LocalIP, hs.Port)
-	fmt.Printf("等待连接...\n\n")
+	logs.Printf("参与方HTTP服务器启动中...\n")
+	logs.Printf("本机IP: %s\n", hs.LocalIP)
+	logs.Printf("监听地址: 0.0.0.0:%d\n", hs.Port)
+	logs.Printf("状态页面: %s://%s:%d/status\n", hs.TLS.Scheme(), hs.LocalIP, hs.Port)
+	logs.Printf("等待连接...\n\n")
 
 	// 在后台启动HTTP服务器，不阻塞主线程
 	go func() {
-		if err := hs.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("HTTP服务器错误: %v\n", err)
+		var err error
+		if hs.TLS != nil {
+			err = hs.Server.ListenAndServeTLS("", "")
+		} else {
+			err = hs.Server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logs.Printf("HTTP服务器错误: %v\n", err)
 		}
 	}()
 
 	return nil
 }
 
-// Stop 停止HTTP服务器
-func (hs *HTTPServer) Stop() error {
-	// 这里可以实现优雅关闭逻辑
-	return nil
+// Stop 停止接受新连接，并等待处理中的协同解密、刷新等请求完成或 ctx 超时
+func (hs *HTTPServer) Stop(ctx context.Context) error {
+	return hs.Server.Shutdown(ctx)
 }
 
 // GetLocalIP 获取本机IP地址
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"fmt"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// TaskSource 查询协调器上的解密任务，由协调器客户端实现
+type TaskSource interface {
+	GetTask(taskID string) (*types.TaskInfo, error)
+}
+
+// PolicySource 本方同意的授权策略，由参与方实现
+type PolicySource interface {
+	AgreedPolicy() (types.TaskPolicy, bool)
+}
+
+// checkTask 核对解密任务：已批准、类型一致、未过期且与收到的密文哈希一致，并满足本方同意的授权策略
+// 解密份额和公钥切换份额能揭示密文内容，未通过核对的请求一律拒绝
+func (h *Handlers) checkTask(taskID, kind string, ct *rlwe.Ciphertext) (*types.TaskInfo, error) {
+	if taskID == "" {
+		return nil, fmt.Errorf("缺少任务ID")
+	}
+	task, err := h.tasks.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != "approved" {
+		return nil, fmt.Errorf("任务 %s 未批准（%s）", taskID, task.Status)
+	}
+	if task.Kind != kind {
+		return nil, fmt.Errorf("任务 %s 类型为 %s，不能用于 %s", taskID, task.Kind, kind)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, task.ExpiresAt)
+	if err != nil || time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("任务 %s 已过期", taskID)
+	}
+	if err := h.checkAgreedPolicy(task, expiresAt); err != nil {
+		return nil, err
+	}
+	hash, err := utils.CiphertextHash(ct)
+	if err != nil {
+		return nil, fmt.Errorf("计算密文哈希失败: %v", err)
+	}
+	if hash != task.CiphertextHash {
+		return nil, fmt.Errorf("密文与任务 %s 声明的哈希不一致", taskID)
+	}
+	return task, nil
+}
+
+// checkAgreedPolicy 拒绝按本方未同意的更宽松策略批准的任务：表决批准的任务批准数不足，或有效期更长
+// 已登记计算输出的任务自动批准，不检查批准数
+func (h *Handlers) checkAgreedPolicy(task *types.TaskInfo, expiresAt time.Time) error {
+	policy, ok := h.policy.AgreedPolicy()
+	if !ok {
+		return fmt.Errorf("本方尚未确定授权策略")
+	}
+	if task.Computation == "" && len(task.Approvals) < policy.RequiredApprovals {
+		return fmt.Errorf("任务 %s 只有 %d 个参与方批准，本方同意的策略需要 %d 个", task.ID, len(task.Approvals), policy.RequiredApprovals)
+	}
+	createdAt, err := time.Parse(time.RFC3339, task.CreatedAt)
+	if err != nil || expiresAt.Sub(createdAt) > time.Duration(policy.TaskTTLSeconds)*time.Second {
+		return fmt.Errorf("任务 %s 的有效期超过本方同意的 %d 秒", task.ID, policy.TaskTTLSeconds)
+	}
+	return nil
+}
@@ -1,23 +1,27 @@
 package services
 
 import (
-	"bytes"
+	"MPHEDev/pkg/core/logs"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"MPHEDev/pkg/core/envelope"
 	"MPHEDev/pkg/core/participant/utils"
 )
 
-// SendMessageToParticipant 向指定参与方发送消息
-func (p *Participant) SendMessageToParticipant(participantID int, message string) error {
+// SendMessageToParticipant 向指定参与方发送消息，objects 为随消息发送的密文信封
+func (p *Participant) SendMessageToParticipant(participantID int, message string, objects ...[]byte) error {
 	var peerURL string
 	var exists bool
 
 	// 如果是向自己发送消息，使用自己的URL
 	if participantID == p.ID {
-		peerURL = fmt.Sprintf("http://%s:%d", p.HTTPServer.GetLocalIP(), p.Port)
-		exists = true
+		selfURL, err := p.SelfURL()
+		if err != nil {
+			return err
+		}
+		peerURL, exists = selfURL, true
 	} else {
 		// 获取目标参与方的URL
 		peerURL, exists = p.PeerManager.GetPeerURL(participantID)
@@ -27,19 +31,14 @@ func (p *Participant) SendMessageToParticipant(participantID int, message string
 		return fmt.Errorf("参与方 %d 不在线或不存在", participantID)
 	}
 
-	// 构造请求体
-	reqBody := map[string]interface{}{
+	// 构造请求体，密文信封作为对象帧跟在控制帧之后
+	control := map[string]interface{}{
 		"from":    p.ID,
 		"message": message,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return err
-	}
-
 	// 发送HTTP请求
-	resp, err := p.Client.Client.Post(peerURL+"/message", "application/json", bytes.NewReader(jsonData))
+	resp, err := p.Client.PostMessage(peerURL+"/message", control, objects...)
 	if err != nil {
 		return err
 	}
@@ -49,7 +48,7 @@ func (p *Participant) SendMessageToParticipant(participantID int, message string
 		return fmt.Errorf("发送消息失败: %d", resp.StatusCode)
 	}
 
-	fmt.Printf("消息已发送到参与方 %d\n", participantID)
+	logs.Printf("消息已发送到参与方 %d\n", participantID)
 	return nil
 }
 
@@ -65,26 +64,27 @@ func (p *Participant) SendMessageToAll(message string) error {
 	// 向其他参与方发送
 	for id := range peers {
 		if err := p.SendMessageToParticipant(id, message); err != nil {
-			fmt.Printf("向参与方 %d 发送消息失败: %v\n", id, err)
+			logs.Printf("向参与方 %d 发送消息失败: %v\n", id, err)
 		}
 	}
 
 	// 向自己发送
 	if err := p.SendMessageToParticipant(p.ID, message); err != nil {
-		fmt.Printf("向自己发送消息失败: %v\n", err)
+		logs.Printf("向自己发送消息失败: %v\n", err)
 	}
 
 	return nil
 }
 
-// HandleMessage 处理来自其他参与方的消息
-func (p *Participant) HandleMessage(fromID int, message string) {
+// HandleMessage 处理来自其他参与方的消息，objects 为随消息发送的密文信封
+func (p *Participant) HandleMessage(fromID int, message string, objects [][]byte) {
 	var dataMsg DataMessage
 	if err := json.Unmarshal([]byte(message), &dataMsg); err != nil {
-		fmt.Printf("解析消息失败: %v\n", err)
+		logs.Printf("解析消息失败: %v\n", err)
 		return
 	}
-	fmt.Printf("收到消息：类型=%s，来自=%d\n", dataMsg.Type, fromID)
+	dataMsg.BatchData = objects
+	logs.Printf("收到消息：类型=%s，来自=%d\n", dataMsg.Type, fromID)
 	switch dataMsg.Type {
 	case "feature":
 		p.handleFeatureData(fromID, dataMsg)
@@ -101,13 +101,13 @@ func (p *Participant) HandleMessage(fromID int, message string) {
 	case "output_done":
 		p.handleOutputDoneMessage(fromID, dataMsg)
 	default:
-		fmt.Printf("未知消息类型: %s\n", dataMsg.Type)
+		logs.Printf("未知消息类型: %s\n", dataMsg.Type)
 	}
 }
 
 // handleFeatureData 处理特征数据
 func (p *Participant) handleFeatureData(fromID int, msg DataMessage) {
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的特征数据\n", p.ID, fromID)
+	logs.Printf("参与方 %d 收到来自参与方 %d 的特征数据\n", p.ID, fromID)
 
 	// 标记已接收该参与方的特征数据
 	p.ReceivedFeatures[fromID] = true
@@ -118,7 +118,7 @@ func (p *Participant) handleFeatureData(fromID int, msg DataMessage) {
 
 // handleLabelData 处理标签数据
 func (p *Participant) handleLabelData(fromID int, msg DataMessage) {
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的标签数据\n", p.ID, fromID)
+	logs.Printf("参与方 %d 收到来自参与方 %d 的标签数据\n", p.ID, fromID)
 
 	// 标记已接收该参与方的标签数据
 	p.ReceivedLabels[fromID] = true
@@ -132,16 +132,27 @@ func (p *Participant) handleFeatureBatchData(fromID int, msg DataMessage) {
 	// 解析批次信息
 	batchInfoBytes, err := utils.DecodeFromBase64(msg.Data)
 	if err != nil {
-		fmt.Printf("解析特征批次信息失败: %v\n", err)
+		logs.Printf("解析特征批次信息失败: %v\n", err)
 		return
 	}
 
 	var currentBatch, totalBatches int
 	fmt.Sscanf(string(batchInfoBytes), "%d,%d", &currentBatch, &totalBatches)
 
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的特征数据批次 %d/%d (包含 %d 个密文)\n",
+	logs.Printf("参与方 %d 收到来自参与方 %d 的特征数据批次 %d/%d (包含 %d 个密文)\n",
 		p.ID, fromID, currentBatch, totalBatches, len(msg.BatchData))
 
+	// 批次序号和密文信封都来自对方，校验不通过时丢弃整个批次
+	if currentBatch < 1 || currentBatch > totalBatches {
+		logs.Printf("[警告] 丢弃来自参与方 %d 的特征数据批次: 批次序号 %d/%d 无效\n", fromID, currentBatch, totalBatches)
+		return
+	}
+	batchData, err := p.checkCiphertextBatch(msg.BatchData)
+	if err != nil {
+		logs.Printf("[警告] 丢弃来自参与方 %d 的特征数据批次 %d: %v\n", fromID, currentBatch, err)
+		return
+	}
+
 	// 初始化批次状态
 	if p.FeatureBatchStatus[fromID] == nil {
 		p.FeatureBatchStatus[fromID] = &BatchStatus{
@@ -155,10 +166,13 @@ func (p *Participant) handleFeatureBatchData(fromID int, msg DataMessage) {
 	p.FeatureBatchStatus[fromID].ReceivedBatches[currentBatch] = true
 
 	// 存储接收到的密文数据
+	p.ciphertextMu.Lock()
 	if p.ReceivedFeatureCiphertexts[fromID] == nil {
 		p.ReceivedFeatureCiphertexts[fromID] = make([][]string, totalBatches)
 	}
-	p.ReceivedFeatureCiphertexts[fromID][currentBatch-1] = msg.BatchData // 批次索引从0开始
+	p.ReceivedFeatureCiphertexts[fromID][currentBatch-1] = batchData // 批次索引从0开始
+	p.ciphertextEpochs[ciphertextBatchKey{kind: "feature", from: fromID, batch: currentBatch - 1}] = p.KeyManager.Epoch
+	p.ciphertextMu.Unlock()
 
 	// 检查是否所有批次都已接收
 	allBatchesReceived := true
@@ -170,7 +184,7 @@ func (p *Participant) handleFeatureBatchData(fromID int, msg DataMessage) {
 	}
 
 	if allBatchesReceived {
-		fmt.Printf("参与方 %d 已接收来自参与方 %d 的所有特征数据批次\n", p.ID, fromID)
+		logs.Printf("参与方 %d 已接收来自参与方 %d 的所有特征数据批次\n", p.ID, fromID)
 		p.FeatureBatchStatus[fromID].AllReceived = true
 		p.ReceivedFeatures[fromID] = true
 
@@ -179,21 +193,46 @@ func (p *Participant) handleFeatureBatchData(fromID int, msg DataMessage) {
 	}
 }
 
+// checkCiphertextBatch 校验接收到的一批密文信封，密文须在当前集体公钥下
+// 校验通过后返回本地存储使用的base64编码
+func (p *Participant) checkCiphertextBatch(batch [][]byte) ([]string, error) {
+	params, key := p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint()
+	encoded := make([]string, len(batch))
+	for i, ctData := range batch {
+		if _, err := envelope.OpenCiphertext(params, key, ctData); err != nil {
+			return nil, fmt.Errorf("第 %d 个密文校验失败: %v", i+1, err)
+		}
+		encoded[i] = utils.EncodeToBase64(ctData)
+	}
+	return encoded, nil
+}
+
 // handleLabelBatchData 处理标签数据批次
 func (p *Participant) handleLabelBatchData(fromID int, msg DataMessage) {
 	// 解析批次信息
 	batchInfoBytes, err := utils.DecodeFromBase64(msg.Data)
 	if err != nil {
-		fmt.Printf("解析标签批次信息失败: %v\n", err)
+		logs.Printf("解析标签批次信息失败: %v\n", err)
 		return
 	}
 
 	var currentBatch, totalBatches int
 	fmt.Sscanf(string(batchInfoBytes), "%d,%d", &currentBatch, &totalBatches)
 
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的标签数据批次 %d/%d (包含 %d 个密文)\n",
+	logs.Printf("参与方 %d 收到来自参与方 %d 的标签数据批次 %d/%d (包含 %d 个密文)\n",
 		p.ID, fromID, currentBatch, totalBatches, len(msg.BatchData))
 
+	// 批次序号和密文信封都来自对方，校验不通过时丢弃整个批次
+	if currentBatch < 1 || currentBatch > totalBatches {
+		logs.Printf("[警告] 丢弃来自参与方 %d 的标签数据批次: 批次序号 %d/%d 无效\n", fromID, currentBatch, totalBatches)
+		return
+	}
+	batchData, err := p.checkCiphertextBatch(msg.BatchData)
+	if err != nil {
+		logs.Printf("[警告] 丢弃来自参与方 %d 的标签数据批次 %d: %v\n", fromID, currentBatch, err)
+		return
+	}
+
 	// 初始化批次状态
 	if p.LabelBatchStatus[fromID] == nil {
 		p.LabelBatchStatus[fromID] = &BatchStatus{
@@ -207,10 +246,13 @@ func (p *Participant) handleLabelBatchData(fromID int, msg DataMessage) {
 	p.LabelBatchStatus[fromID].ReceivedBatches[currentBatch] = true
 
 	// 存储接收到的密文数据
+	p.ciphertextMu.Lock()
 	if p.ReceivedLabelCiphertexts[fromID] == nil {
 		p.ReceivedLabelCiphertexts[fromID] = make([][]string, totalBatches)
 	}
-	p.ReceivedLabelCiphertexts[fromID][currentBatch-1] = msg.BatchData // 批次索引从0开始
+	p.ReceivedLabelCiphertexts[fromID][currentBatch-1] = batchData // 批次索引从0开始
+	p.ciphertextEpochs[ciphertextBatchKey{kind: "label", from: fromID, batch: currentBatch - 1}] = p.KeyManager.Epoch
+	p.ciphertextMu.Unlock()
 
 	// 检查是否所有批次都已接收
 	allBatchesReceived := true
@@ -222,7 +264,7 @@ func (p *Participant) handleLabelBatchData(fromID int, msg DataMessage) {
 	}
 
 	if allBatchesReceived {
-		fmt.Printf("参与方 %d 已接收来自参与方 %d 的所有标签数据批次\n", p.ID, fromID)
+		logs.Printf("参与方 %d 已接收来自参与方 %d 的所有标签数据批次\n", p.ID, fromID)
 		p.LabelBatchStatus[fromID].AllReceived = true
 		p.ReceivedLabels[fromID] = true
 
@@ -233,7 +275,7 @@ func (p *Participant) handleLabelBatchData(fromID int, msg DataMessage) {
 
 // handleDoneMessage 处理完成消息
 func (p *Participant) handleDoneMessage(fromID int, msg DataMessage) {
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的完成消息\n", p.ID, fromID)
+	logs.Printf("参与方 %d 收到来自参与方 %d 的完成消息\n", p.ID, fromID)
 
 	// 标记数据分发完成
 	p.DataDistributionDone = true
@@ -249,14 +291,14 @@ func (p *Participant) handleDoneMessage(fromID int, msg DataMessage) {
 
 // handleInputDoneMessage 处理输入层完成消息
 func (p *Participant) handleInputDoneMessage(fromID int, msg DataMessage) {
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的输入层完成消息\n", p.ID, fromID)
+	logs.Printf("参与方 %d 收到来自参与方 %d 的输入层完成消息\n", p.ID, fromID)
 	p.InputLayerDone = true
 	p.checkDataDistributionStatus()
 }
 
 // handleOutputDoneMessage 处理输出层完成消息
 func (p *Participant) handleOutputDoneMessage(fromID int, msg DataMessage) {
-	fmt.Printf("参与方 %d 收到来自参与方 %d 的输出层完成消息\n", p.ID, fromID)
+	logs.Printf("参与方 %d 收到来自参与方 %d 的输出层完成消息\n", p.ID, fromID)
 	p.OutputLayerDone = true
 	p.checkDataDistributionStatus()
 }
@@ -282,7 +324,7 @@ func (p *Participant) checkDataDistributionStatus() {
 
 	// 如果所有数据都已接收，发送相应的Done消息
 	if allFeaturesReceived && allLabelsReceived && !p.DataDistributionDone {
-		fmt.Printf("参与方 %d 已接收所有数据，发送Done消息\n", p.ID)
+		logs.Printf("参与方 %d 已接收所有数据，发送Done消息\n", p.ID)
 		p.DataDistributionDone = true
 
 		// 根据参与方角色发送相应的Done消息
@@ -293,10 +335,10 @@ func (p *Participant) checkDataDistributionStatus() {
 		}
 		inputDoneJSON, err := json.Marshal(inputDoneMessage)
 		if err != nil {
-			fmt.Printf("序列化输入层Done消息失败: %v\n", err)
+			logs.Printf("序列化输入层Done消息失败: %v\n", err)
 		} else {
 			if err := p.SendMessageToAll(string(inputDoneJSON)); err != nil {
-				fmt.Printf("发送输入层Done消息失败: %v\n", err)
+				logs.Printf("发送输入层Done消息失败: %v\n", err)
 			}
 		}
 
@@ -307,10 +349,10 @@ func (p *Participant) checkDataDistributionStatus() {
 		}
 		outputDoneJSON, err := json.Marshal(outputDoneMessage)
 		if err != nil {
-			fmt.Printf("序列化输出层Done消息失败: %v\n", err)
+			logs.Printf("序列化输出层Done消息失败: %v\n", err)
 		} else {
 			if err := p.SendMessageToAll(string(outputDoneJSON)); err != nil {
-				fmt.Printf("发送输出层Done消息失败: %v\n", err)
+				logs.Printf("发送输出层Done消息失败: %v\n", err)
 			}
 		}
 
@@ -329,11 +371,11 @@ func (p *Participant) testP2PCommunication() error {
 	// 获取在线参与方列表
 	onlineParticipants := p.GetOnlineParticipants()
 	if len(onlineParticipants) == 0 {
-		fmt.Printf("没有其他在线参与方，跳过P2P通信测试\n")
+		logs.Printf("没有其他在线参与方，跳过P2P通信测试\n")
 		return nil
 	}
 
-	fmt.Printf("开始P2P通信测试，在线参与方: %d 个\n", len(onlineParticipants))
+	logs.Printf("开始P2P通信测试，在线参与方: %d 个\n", len(onlineParticipants))
 
 	// 向所有参与方发送测试消息
 	testMessage := fmt.Sprintf("来自参与方 %d 的P2P通信测试消息", p.ID)
@@ -341,6 +383,6 @@ func (p *Participant) testP2PCommunication() error {
 		return fmt.Errorf("P2P通信测试失败: %v", err)
 	}
 
-	fmt.Printf("P2P通信测试成功\n")
+	logs.Printf("P2P通信测试成功\n")
 	return nil
 }
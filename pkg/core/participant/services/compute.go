@@ -0,0 +1,313 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/participant/crypto"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// ==================== 调用方密文的协同解密与刷新 ====================
+//
+// 应用代码提交自己的密文，由在线参与方协同解密或刷新。一批密文合并为一轮批量请求，
+// 每个参与方只收到一次请求；一个密文失败不影响其他密文：
+//   - 解密：使用调用方给出的已批准任务ID，或为每个密文提议任务并等待批准，再收集解密份额
+//   - 刷新：每个密文使用新的刷新任务ID，各参与方据此派生本次刷新的CRP
+// 超时作用于整批（解密包括等待批准的时间），结果中带有活跃参与方和失败参与方的原因。
+
+// DefaultOperationTimeout 一批密文协同解密/刷新的默认超时
+const DefaultOperationTimeout = 5 * time.Minute
+
+// maxParallelApprovals 同时等待批准的解密任务数量上限
+const maxParallelApprovals = 8
+
+// maxAPICiphertexts 本机接口单次请求的密文数量上限
+const maxAPICiphertexts = 4096
+
+// DecryptOptions 协同解密选项
+type DecryptOptions struct {
+	Purpose string        // 提议任务时声明的用途
+	TaskIDs []string      // 已批准的任务ID，与密文一一对应；为空时为每个密文提议任务
+	Timeout time.Duration // 整批的超时（包括等待批准），0 表示 DefaultOperationTimeout
+}
+
+// DecryptResult 单个密文的协同解密结果
+type DecryptResult struct {
+	TaskID string
+	Values []complex128 // 密文全部槽的解码结果
+	Report types.RoundReport
+	Err    error
+}
+
+// RefreshOptions 协同刷新选项
+type RefreshOptions struct {
+	Timeout time.Duration // 整批的超时，0 表示 DefaultOperationTimeout
+}
+
+// RefreshResult 单个密文的协同刷新结果
+type RefreshResult struct {
+	TaskID     string
+	Ciphertext *rlwe.Ciphertext
+	Report     types.RoundReport
+	Err        error
+}
+
+// DecryptCiphertexts 协同解密一批密文，返回与输入一一对应的结果
+// 先为每个密文取得已批准的任务，再把已批准的密文合并为一轮批量请求。
+// 只有参数错误时返回 error，单个密文的失败记录在对应结果的 Err 中
+func (p *Participant) DecryptCiphertexts(cts []*rlwe.Ciphertext, opts DecryptOptions) ([]DecryptResult, error) {
+	if err := p.checkComputeReady(cts); err != nil {
+		return nil, err
+	}
+	if len(opts.TaskIDs) > 0 && len(opts.TaskIDs) != len(cts) {
+		return nil, fmt.Errorf("任务ID数量 %d 与密文数量 %d 不一致", len(opts.TaskIDs), len(cts))
+	}
+	if len(opts.TaskIDs) == 0 && opts.Purpose == "" {
+		return nil, fmt.Errorf("需要声明解密用途或提供已批准的任务ID")
+	}
+	ctx, cancel := p.operationContext(opts.Timeout)
+	defer cancel()
+
+	results := make([]DecryptResult, len(cts))
+	if len(opts.TaskIDs) > 0 {
+		for i := range results {
+			results[i].TaskID = opts.TaskIDs[i]
+		}
+	} else {
+		p.forEachLimited(len(cts), func(i int) {
+			res := &results[i]
+			if res.TaskID, res.Err = p.AuthorizeTaskContext(ctx, types.TaskKindDecrypt, opts.Purpose, "", cts[i]); res.Err != nil {
+				res.Err = fmt.Errorf("解密任务未获批准: %v", res.Err)
+			}
+		})
+	}
+
+	// 已批准的密文在一轮批量请求中解密
+	var indices []int
+	var batch []*rlwe.Ciphertext
+	var taskIDs []string
+	for i, res := range results {
+		if res.Err == nil {
+			indices = append(indices, i)
+			batch = append(batch, cts[i])
+			taskIDs = append(taskIDs, res.TaskID)
+		}
+	}
+	if len(batch) == 0 {
+		return results, nil
+	}
+	pts, errs, report := p.DecryptionService.CollaborativeDecryptBatch(ctx, batch, taskIDs, p.HeartbeatManager.GetOnlinePeers(), p.ID)
+
+	encoder := ckks.NewEncoder(p.KeyManager.GetParams())
+	for k, i := range indices {
+		res := &results[i]
+		res.Report = report
+		if errs[k] != nil {
+			res.Err = errs[k]
+			continue
+		}
+		values := make([]complex128, cts[i].Slots())
+		if err := encoder.Decode(pts[k], values); err != nil {
+			res.Err = fmt.Errorf("解码失败: %v", err)
+			continue
+		}
+		res.Values = values
+	}
+	return results, nil
+}
+
+// RefreshCiphertexts 协同刷新一批密文，全部密文在一轮批量请求中完成，返回与输入一一对应的结果
+// 只有参数错误时返回 error，单个密文的失败记录在对应结果的 Err 中
+func (p *Participant) RefreshCiphertexts(cts []*rlwe.Ciphertext, opts RefreshOptions) ([]RefreshResult, error) {
+	if err := p.checkComputeReady(cts); err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.operationContext(opts.Timeout)
+	defer cancel()
+
+	// 每个密文使用新的刷新任务ID
+	taskIDs := make([]string, len(cts))
+	for i := range taskIDs {
+		taskIDs[i] = crypto.NewRefreshTaskID()
+	}
+	refreshed, errs, report := p.RefreshService.CollaborativeRefreshBatch(ctx, cts, taskIDs, p.HeartbeatManager.GetOnlinePeers(), p.ID)
+
+	results := make([]RefreshResult, len(cts))
+	for i := range results {
+		results[i] = RefreshResult{TaskID: taskIDs[i], Ciphertext: refreshed[i], Report: report, Err: errs[i]}
+	}
+	return results, nil
+}
+
+// checkComputeReady 检查密钥已就绪且密文与会话参数匹配
+func (p *Participant) checkComputeReady(cts []*rlwe.Ciphertext) error {
+	if p.KeyManager == nil || !p.KeyManager.IsReady() {
+		return fmt.Errorf("密钥未准备就绪")
+	}
+	if len(cts) == 0 {
+		return fmt.Errorf("没有待处理的密文")
+	}
+	params := p.KeyManager.GetParams()
+	for i, ct := range cts {
+		if ct == nil || ct.Degree() != 1 {
+			return fmt.Errorf("第 %d 个密文为空或不是一次密文", i)
+		}
+		if ct.Level() > params.MaxLevel() || ct.Value[0].N() != params.N() {
+			return fmt.Errorf("第 %d 个密文与会话参数不匹配", i)
+		}
+	}
+	return nil
+}
+
+// operationContext 一次批量操作的上下文，超时为0时取 DefaultOperationTimeout，参与方关闭时取消
+func (p *Participant) operationContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultOperationTimeout
+	}
+	return context.WithTimeout(p.ctx, timeout)
+}
+
+// forEachLimited 并发执行 fn(0..n-1)，最多 maxParallelApprovals 个同时进行，等待全部完成
+func (p *Participant) forEachLimited(n int, fn func(i int)) {
+	sem := make(chan struct{}, maxParallelApprovals)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		p.goBackground(func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(i)
+		})
+	}
+	wg.Wait()
+}
+
+// ==================== 本机接口 ====================
+
+// HandleDecryptAPI 本机接口：协同解密调用方提交的密文
+// POST /api/participant/decrypt，请求为 types.DecryptAPIRequest，返回每个密文的 types.DecryptAPIResult
+func (p *Participant) HandleDecryptAPI(w http.ResponseWriter, r *http.Request) {
+	var req types.DecryptAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return
+	}
+	cts, err := p.decodeAPICiphertexts(req.Ciphertexts)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := p.DecryptCiphertexts(cts, DecryptOptions{
+		Purpose: req.Purpose,
+		TaskIDs: req.TaskIDs,
+		Timeout: time.Duration(req.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := make([]types.DecryptAPIResult, len(results))
+	for i, res := range results {
+		out[i] = types.DecryptAPIResult{TaskID: res.TaskID, RoundReport: res.Report}
+		if res.Err != nil {
+			out[i].Error = res.Err.Error()
+			continue
+		}
+		values := res.Values
+		if req.Slots > 0 && req.Slots < len(values) {
+			values = values[:req.Slots]
+		}
+		out[i].Values = make([]float64, len(values))
+		for j, v := range values {
+			out[i].Values[j] = real(v)
+		}
+		if req.Complex {
+			out[i].Imag = make([]float64, len(values))
+			for j, v := range values {
+				out[i].Imag[j] = imag(v)
+			}
+		}
+	}
+	writeAPIJSON(w, map[string]interface{}{"results": out})
+}
+
+// HandleRefreshAPI 本机接口：协同刷新调用方提交的密文
+// POST /api/participant/refresh，请求为 types.RefreshAPIRequest，返回每个密文的 types.RefreshAPIResult
+func (p *Participant) HandleRefreshAPI(w http.ResponseWriter, r *http.Request) {
+	var req types.RefreshAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return
+	}
+	cts, err := p.decodeAPICiphertexts(req.Ciphertexts)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := p.RefreshCiphertexts(cts, RefreshOptions{
+		Timeout: time.Duration(req.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := make([]types.RefreshAPIResult, len(results))
+	for i, res := range results {
+		out[i] = types.RefreshAPIResult{TaskID: res.TaskID, RoundReport: res.Report}
+		if res.Err != nil {
+			out[i].Error = res.Err.Error()
+			continue
+		}
+		ctB64, err := utils.EncodeCiphertext(p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint(), res.Ciphertext)
+		if err != nil {
+			out[i].Error = fmt.Sprintf("密文序列化失败: %v", err)
+			continue
+		}
+		out[i].Ciphertext = ctB64
+		out[i].Level = res.Ciphertext.Level()
+	}
+	writeAPIJSON(w, map[string]interface{}{"results": out})
+}
+
+// decodeAPICiphertexts 解析Base64编码的密文信封列表，密文须在当前集体公钥下
+func (p *Participant) decodeAPICiphertexts(encoded []string) ([]*rlwe.Ciphertext, error) {
+	if len(encoded) > maxAPICiphertexts {
+		return nil, fmt.Errorf("单次最多提交 %d 个密文", maxAPICiphertexts)
+	}
+	params, key := p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint()
+	cts := make([]*rlwe.Ciphertext, len(encoded))
+	for i, s := range encoded {
+		ct, err := utils.DecodeCiphertext(params, key, s)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个密文校验失败: %v", i, err)
+		}
+		cts[i] = ct
+	}
+	return cts, nil
+}
+
+// writeAPIJSON 写出JSON响应
+func writeAPIJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError 写出JSON格式的错误响应
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
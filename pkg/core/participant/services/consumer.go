@@ -0,0 +1,48 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// DeliverToConsumer 用集体公钥加密数据，公钥切换任务获批后请求协调器交付给结果接收方
+// 接收方用自己的私钥解密，参与方和协调器都看不到结果明文
+func (p *Participant) DeliverToConsumer(consumerID string, values []float64) (string, error) {
+	params := p.KeyManager.GetParams()
+	pk := p.KeyManager.GetPublicKey()
+	if pk == nil {
+		return "", fmt.Errorf("集体公钥尚未就绪")
+	}
+
+	encoder := ckks.NewEncoder(params)
+	pt := ckks.NewPlaintext(params, params.MaxLevel())
+	if err := encoder.Encode(values, pt); err != nil {
+		return "", fmt.Errorf("编码失败: %v", err)
+	}
+	ct, err := rlwe.NewEncryptor(params, pk).EncryptNew(pt)
+	if err != nil {
+		return "", fmt.Errorf("加密失败: %v", err)
+	}
+	ctData, err := envelope.SealCiphertext(params, p.KeyManager.KeyFingerprint(), ct)
+	if err != nil {
+		return "", fmt.Errorf("密文序列化失败: %v", err)
+	}
+
+	// 参与方只为已批准的公钥切换任务提供份额
+	taskID, err := p.AuthorizeTask(types.TaskKindReencrypt, "交付结果给接收方", consumerID, ct)
+	if err != nil {
+		return "", fmt.Errorf("公钥切换任务未获批准: %v", err)
+	}
+
+	result, err := p.CoordinatorClient.Reencrypt(taskID, consumerID, ctData)
+	if err != nil {
+		return "", err
+	}
+	logs.Printf("已交付给接收方 %s，结果ID: %s\n", result.ConsumerID, result.ResultID)
+	return result.ResultID, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// crsNegotiationTimeout CRS种子协商的最长等待时间
+const crsNegotiationTimeout = 10 * time.Minute
+
+// ContributeCRS 通过commit-reveal向会话CRS种子贡献本方随机种子
+// 需要在注册之后、获取参数之前调用，协调器未开启协商时直接返回
+func (p *Participant) ContributeCRS() error {
+	if !p.CRSContribution {
+		return nil
+	}
+	deadline := time.Now().Add(crsNegotiationTimeout)
+
+	seed, err := crs.NewSeed()
+	if err != nil {
+		return err
+	}
+	p.crsSeed = seed
+
+	// 1. 提交承诺
+	commitment := crs.Commitment(p.SessionID, p.ID, seed)
+	if _, err := p.CoordinatorClient.CommitCRS(p.SessionID, commitment); err != nil {
+		return fmt.Errorf("提交CRS承诺失败: %v", err)
+	}
+	logs.Println("[CRS] 已提交种子承诺，等待其他参与方...")
+
+	// 2. 等待全部承诺到齐后公开种子
+	if err := p.waitCRSPhase(deadline, "reveal", "done"); err != nil {
+		return err
+	}
+	if _, err := p.CoordinatorClient.RevealCRS(p.SessionID, utils.EncodeToBase64(seed)); err != nil {
+		return fmt.Errorf("公开CRS种子失败: %v", err)
+	}
+	logs.Println("[CRS] 已公开种子，等待协商完成...")
+
+	// 3. 等待最终种子确定
+	if err := p.waitCRSPhase(deadline, "done"); err != nil {
+		return err
+	}
+	logs.Println("[CRS] 会话CRS种子协商完成")
+	return nil
+}
+
+// waitCRSPhase 轮询协调器直到协商进入指定阶段之一
+func (p *Participant) waitCRSPhase(deadline time.Time, phases ...string) error {
+	for {
+		status, err := p.CoordinatorClient.GetCRSStatus()
+		if err == nil {
+			if status.SessionID != p.SessionID {
+				return fmt.Errorf("协调器会话已变更: %s -> %s", p.SessionID, status.SessionID)
+			}
+			for _, phase := range phases {
+				if status.Phase == phase {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待CRS协商进入 %v 阶段超时", phases)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// VerifySessionParams 校验参数属于注册时的会话，并独立重算CRS种子
+// 任何一项不符都拒绝该参数
+func (p *Participant) VerifySessionParams(params *types.ParamsResponse) error {
+	if params.SessionID == "" || params.SessionID != p.SessionID {
+		return fmt.Errorf("参数会话ID %q 与注册会话 %q 不一致", params.SessionID, p.SessionID)
+	}
+
+	coordinatorSeed, err := utils.DecodeFromBase64(params.CRSCoordinatorSeed)
+	if err != nil {
+		return fmt.Errorf("解码协调器种子失败: %v", err)
+	}
+	if crs.Commitment(p.SessionID, crs.CoordinatorID, coordinatorSeed) != p.CRSCommitment {
+		return fmt.Errorf("协调器种子与注册时的承诺不符")
+	}
+
+	contributions := make(map[int][]byte, len(params.CRSContributions))
+	for id, seedB64 := range params.CRSContributions {
+		seed, err := utils.DecodeFromBase64(seedB64)
+		if err != nil {
+			return fmt.Errorf("解码参与方 %d 的种子失败: %v", id, err)
+		}
+		contributions[id] = seed
+	}
+	if p.CRSContribution {
+		// 候选成员在种子协商之后才注册，不贡献种子
+		if !p.Candidate && !bytes.Equal(contributions[p.ID], p.crsSeed) {
+			return fmt.Errorf("最终种子未包含本方贡献的种子")
+		}
+		if len(contributions) != params.CRSContributors {
+			return fmt.Errorf("种子贡献数量 %d 与初始参与方数量 %d 不一致", len(contributions), params.CRSContributors)
+		}
+	} else if len(contributions) != 0 {
+		return fmt.Errorf("本会话未开启种子协商，但参数中包含参与方种子")
+	}
+
+	expected := crs.DeriveSessionSeed(p.SessionID, coordinatorSeed, contributions)
+	actual, err := utils.DecodeFromBase64(params.CommonCRSSeed)
+	if err != nil {
+		return fmt.Errorf("解码CRS种子失败: %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		return fmt.Errorf("CRS种子与会话材料不符")
+	}
+
+	// 协调器下发的淹没噪声配置不能低于最低统计安全要求
+	if err := params.Smudging.Validate(); err != nil {
+		return fmt.Errorf("噪声淹没配置不满足要求: %v", err)
+	}
+	logs.Printf("[CRS] 会话 %s 的参数校验通过\n", p.SessionID)
+	return nil
+}
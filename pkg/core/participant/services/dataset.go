@@ -1,11 +1,14 @@
 package services
 
 import (
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/utils"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
@@ -14,7 +17,7 @@ import (
 
 // LoadDataset 载入本地数据集
 func (p *Participant) LoadDataset() error {
-	dataDir := fmt.Sprintf("../../data/%s", p.DataSplit)
+	dataDir := filepath.Join(p.dataDir(), p.DataSplit)
 	splitID := fmt.Sprintf("train_split_%03d", p.ID-1)
 	imagesPath := fmt.Sprintf("%s/%s_images.csv", dataDir, splitID)
 	labelsPath := fmt.Sprintf("%s/%s_labels.csv", dataDir, splitID)
@@ -185,27 +188,27 @@ func (p *Participant) EncryptAndDistributeDataset() error {
 		}
 	}
 
-	fmt.Printf("参与方角色：输入层=%d, 输出层=%d, 当前参与方=%d\n", inputLayerID, outputLayerID, p.ID)
+	logs.Printf("参与方角色：输入层=%d, 输出层=%d, 当前参与方=%d\n", inputLayerID, outputLayerID, p.ID)
 
 	// 所有参与方都加密数据集，只是发送目标不同
-	fmt.Printf("参与方 %d：开始加密并分发数据集\n", p.ID)
+	logs.Printf("参与方 %d：开始加密并分发数据集\n", p.ID)
 
 	// 根据参与方角色确定发送目标
 	if p.ID == inputLayerID && p.ID == outputLayerID {
 		// 只有一个参与方时：既是输入层又是输出层，需要发送数据给自己
-		fmt.Printf("参与方 %d：既是输入层又是输出层，发送数据给自己\n", p.ID)
+		logs.Printf("参与方 %d：既是输入层又是输出层，发送数据给自己\n", p.ID)
 		return p.encryptAndSendData(encoder, encryptor, inputLayerID, outputLayerID)
 	} else if p.ID == inputLayerID {
 		// 输入层参与方：加密标签数据发送给输出层
-		fmt.Printf("参与方 %d：作为输入层，加密标签数据发送给输出层 %d\n", p.ID, outputLayerID)
+		logs.Printf("参与方 %d：作为输入层，加密标签数据发送给输出层 %d\n", p.ID, outputLayerID)
 		return p.encryptAndSendLabelsToOutput(encoder, encryptor, outputLayerID)
 	} else if p.ID == outputLayerID {
 		// 输出层参与方：加密特征数据发送给输入层
-		fmt.Printf("参与方 %d：作为输出层，加密特征数据发送给输入层 %d\n", p.ID, inputLayerID)
+		logs.Printf("参与方 %d：作为输出层，加密特征数据发送给输入层 %d\n", p.ID, inputLayerID)
 		return p.encryptAndSendFeaturesToInput(encoder, encryptor, inputLayerID)
 	} else {
 		// 中间层参与方：加密特征数据发送给输入层，加密标签数据发送给输出层
-		fmt.Printf("参与方 %d：作为中间层，加密特征数据发送给输入层 %d，加密标签数据发送给输出层 %d\n", p.ID, inputLayerID, outputLayerID)
+		logs.Printf("参与方 %d：作为中间层，加密特征数据发送给输入层 %d，加密标签数据发送给输出层 %d\n", p.ID, inputLayerID, outputLayerID)
 		return p.encryptAndSendDataToBothLayers(encoder, encryptor, inputLayerID, outputLayerID)
 	}
 }
@@ -246,7 +249,7 @@ func (p *Participant) encryptAndSendFeatures(encoder *ckks.Encoder, encryptor *r
 	totalBatches := (batchCount + batchSize - 1) / batchSize
 
 	// 当前批次的密文列表
-	var currentBatchCiphertexts []string
+	var currentBatchCiphertexts [][]byte
 
 	// 按批次处理所有特征
 	for batchIndex := 0; batchIndex < batchCount; batchIndex++ {
@@ -291,26 +294,25 @@ func (p *Participant) encryptAndSendFeatures(encoder *ckks.Encoder, encryptor *r
 			return fmt.Errorf("加密特征数据批次 %d 失败: %v", batchIndex, err)
 		}
 
-		// 序列化密文
-		ctBytes, err := utils.EncodeShare(ct)
+		// 封装为绑定集体公钥的密文信封
+		ctData, err := envelope.SealCiphertext(p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint(), ct)
 		if err != nil {
 			return fmt.Errorf("序列化特征密文批次 %d 失败: %v", batchIndex, err)
 		}
 
 		// 添加到当前发送批次
-		currentBatchCiphertexts = append(currentBatchCiphertexts, utils.EncodeToBase64(ctBytes))
+		currentBatchCiphertexts = append(currentBatchCiphertexts, ctData)
 
 		// 检查是否需要发送当前批次
 		if len(currentBatchCiphertexts) >= batchSize || batchIndex == batchCount-1 {
 			sendBatchIndex := (batchIndex / batchSize) + 1
-			fmt.Printf("发送特征数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
+			logs.Printf("发送特征数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
 
 			// 构造消息
 			message := DataMessage{
-				Type:      "feature_batch",
-				From:      p.ID,
-				Data:      utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
-				BatchData: currentBatchCiphertexts,                                                          // 当前批次的密文数据
+				Type: "feature_batch",
+				From: p.ID,
+				Data: utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
 			}
 
 			// 发送消息
@@ -319,43 +321,43 @@ func (p *Participant) encryptAndSendFeatures(encoder *ckks.Encoder, encryptor *r
 				return fmt.Errorf("序列化特征消息批次 %d 失败: %v", sendBatchIndex, err)
 			}
 
-			if err := p.SendMessageToParticipant(targetID, string(messageJSON)); err != nil {
+			if err := p.SendMessageToParticipant(targetID, string(messageJSON), currentBatchCiphertexts...); err != nil {
 				return fmt.Errorf("发送特征数据批次 %d 到参与方 %d 失败: %v", sendBatchIndex, targetID, err)
 			}
 
-			fmt.Printf("特征数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
+			logs.Printf("特征数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
 
 			// 清空当前批次
 			currentBatchCiphertexts = nil
 		}
 	}
 
-	fmt.Printf("所有特征数据发送完成 (总样本数: %d, 总特征数: %d)\n", totalSamples, totalFeaturesToProcess)
+	logs.Printf("所有特征数据发送完成 (总样本数: %d, 总特征数: %d)\n", totalSamples, totalFeaturesToProcess)
 	return nil
 }
 
 // encryptAndSendLabels 加密并发送标签数据
 func (p *Participant) encryptAndSendLabels(encoder *ckks.Encoder, encryptor *rlwe.Encryptor, targetID int, slots int) error {
-	fmt.Printf("向参与方 %d 发送标签数据...\n", targetID)
+	logs.Printf("向参与方 %d 发送标签数据...\n", targetID)
 
 	totalSamples := len(p.Labels)
 
-	fmt.Printf("开始加密 %d 个样本的标签数据\n", totalSamples)
+	logs.Printf("开始加密 %d 个样本的标签数据\n", totalSamples)
 
 	// 计算需要多少个批次来处理所有标签
 	// 每个槽存储一个标签值
 	batchCount := (totalSamples + slots - 1) / slots // 向上取整
 
-	fmt.Printf("需要 %d 个批次来处理所有标签数据 (每批次 %d 个槽)\n", batchCount, slots)
+	logs.Printf("需要 %d 个批次来处理所有标签数据 (每批次 %d 个槽)\n", batchCount, slots)
 
 	// 流式发送：每20个批次发送一次
 	batchSize := 20
 	totalBatches := (batchCount + batchSize - 1) / batchSize
 
-	fmt.Printf("将分 %d 次发送，每次发送 %d 个批次\n", totalBatches, batchSize)
+	logs.Printf("将分 %d 次发送，每次发送 %d 个批次\n", totalBatches, batchSize)
 
 	// 当前批次的密文列表
-	var currentBatchCiphertexts []string
+	var currentBatchCiphertexts [][]byte
 
 	// 按批次处理所有标签
 	for batchIndex := 0; batchIndex < batchCount; batchIndex++ {
@@ -393,32 +395,31 @@ func (p *Participant) encryptAndSendLabels(encoder *ckks.Encoder, encryptor *rlw
 			return fmt.Errorf("加密标签数据批次 %d 失败: %v", batchIndex, err)
 		}
 
-		// 序列化密文
-		ctBytes, err := utils.EncodeShare(ct)
+		// 封装为绑定集体公钥的密文信封
+		ctData, err := envelope.SealCiphertext(p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint(), ct)
 		if err != nil {
 			return fmt.Errorf("序列化标签密文批次 %d 失败: %v", batchIndex, err)
 		}
 
 		// 添加到当前发送批次
-		currentBatchCiphertexts = append(currentBatchCiphertexts, utils.EncodeToBase64(ctBytes))
+		currentBatchCiphertexts = append(currentBatchCiphertexts, ctData)
 
 		// 每10个批次输出一次进度，减少日志输出
 		if (batchIndex+1)%10 == 0 || batchIndex == batchCount-1 {
-			fmt.Printf("标签数据加密进度: %d/%d 批次完成 (%.1f%%)\n",
+			logs.Printf("标签数据加密进度: %d/%d 批次完成 (%.1f%%)\n",
 				batchIndex+1, batchCount, float64(batchIndex+1)/float64(batchCount)*100)
 		}
 
 		// 检查是否需要发送当前批次
 		if len(currentBatchCiphertexts) >= batchSize || batchIndex == batchCount-1 {
 			sendBatchIndex := (batchIndex / batchSize) + 1
-			fmt.Printf("发送标签数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
+			logs.Printf("发送标签数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
 
 			// 构造消息
 			message := DataMessage{
-				Type:      "label_batch",
-				From:      p.ID,
-				Data:      utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
-				BatchData: currentBatchCiphertexts,                                                          // 当前批次的密文数据
+				Type: "label_batch",
+				From: p.ID,
+				Data: utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
 			}
 
 			// 发送消息
@@ -427,18 +428,18 @@ func (p *Participant) encryptAndSendLabels(encoder *ckks.Encoder, encryptor *rlw
 				return fmt.Errorf("序列化标签消息批次 %d 失败: %v", sendBatchIndex, err)
 			}
 
-			if err := p.SendMessageToParticipant(targetID, string(messageJSON)); err != nil {
+			if err := p.SendMessageToParticipant(targetID, string(messageJSON), currentBatchCiphertexts...); err != nil {
 				return fmt.Errorf("发送标签数据批次 %d 到参与方 %d 失败: %v", sendBatchIndex, targetID, err)
 			}
 
-			fmt.Printf("标签数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
+			logs.Printf("标签数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
 
 			// 清空当前批次
 			currentBatchCiphertexts = nil
 		}
 	}
 
-	fmt.Printf("所有标签数据发送完成 (总样本数: %d)\n", totalSamples)
+	logs.Printf("所有标签数据发送完成 (总样本数: %d)\n", totalSamples)
 	return nil
 }
 
@@ -461,7 +462,7 @@ func (p *Participant) encryptAndSendFeaturesToInput(encoder *ckks.Encoder, encry
 	totalBatches := (batchCount + batchSize - 1) / batchSize
 
 	// 当前批次的密文列表
-	var currentBatchCiphertexts []string
+	var currentBatchCiphertexts [][]byte
 
 	// 按批次处理所有特征
 	for batchIndex := 0; batchIndex < batchCount; batchIndex++ {
@@ -506,26 +507,25 @@ func (p *Participant) encryptAndSendFeaturesToInput(encoder *ckks.Encoder, encry
 			return fmt.Errorf("加密特征数据批次 %d 失败: %v", batchIndex, err)
 		}
 
-		// 序列化密文
-		ctBytes, err := utils.EncodeShare(ct)
+		// 封装为绑定集体公钥的密文信封
+		ctData, err := envelope.SealCiphertext(p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint(), ct)
 		if err != nil {
 			return fmt.Errorf("序列化特征密文批次 %d 失败: %v", batchIndex, err)
 		}
 
 		// 添加到当前发送批次
-		currentBatchCiphertexts = append(currentBatchCiphertexts, utils.EncodeToBase64(ctBytes))
+		currentBatchCiphertexts = append(currentBatchCiphertexts, ctData)
 
 		// 检查是否需要发送当前批次
 		if len(currentBatchCiphertexts) >= batchSize || batchIndex == batchCount-1 {
 			sendBatchIndex := (batchIndex / batchSize) + 1
-			fmt.Printf("发送特征数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
+			logs.Printf("发送特征数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
 
 			// 构造消息
 			message := DataMessage{
-				Type:      "feature_batch",
-				From:      p.ID,
-				Data:      utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
-				BatchData: currentBatchCiphertexts,                                                          // 当前批次的密文数据
+				Type: "feature_batch",
+				From: p.ID,
+				Data: utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
 			}
 
 			// 发送消息
@@ -534,18 +534,18 @@ func (p *Participant) encryptAndSendFeaturesToInput(encoder *ckks.Encoder, encry
 				return fmt.Errorf("序列化特征消息批次 %d 失败: %v", sendBatchIndex, err)
 			}
 
-			if err := p.SendMessageToParticipant(inputLayerID, string(messageJSON)); err != nil {
+			if err := p.SendMessageToParticipant(inputLayerID, string(messageJSON), currentBatchCiphertexts...); err != nil {
 				return fmt.Errorf("发送特征数据批次 %d 到参与方 %d 失败: %v", sendBatchIndex, inputLayerID, err)
 			}
 
-			fmt.Printf("特征数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
+			logs.Printf("特征数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
 
 			// 清空当前批次
 			currentBatchCiphertexts = nil
 		}
 	}
 
-	fmt.Printf("所有特征数据发送完成 (总样本数: %d, 总特征数: %d)\n", totalSamples, totalFeaturesToProcess)
+	logs.Printf("所有特征数据发送完成 (总样本数: %d, 总特征数: %d)\n", totalSamples, totalFeaturesToProcess)
 	return nil
 }
 
@@ -555,26 +555,26 @@ func (p *Participant) encryptAndSendLabelsToOutput(encoder *ckks.Encoder, encryp
 	params := p.KeyManager.GetParams()
 	slots := params.N() / 2 // CKKS的槽数是N/2
 
-	fmt.Printf("向参与方 %d 发送标签数据...\n", outputLayerID)
+	logs.Printf("向参与方 %d 发送标签数据...\n", outputLayerID)
 
 	totalSamples := len(p.Labels)
 
-	fmt.Printf("开始加密 %d 个样本的标签数据\n", totalSamples)
+	logs.Printf("开始加密 %d 个样本的标签数据\n", totalSamples)
 
 	// 计算需要多少个批次来处理所有标签
 	// 每个槽存储一个标签值
 	batchCount := (totalSamples + slots - 1) / slots // 向上取整
 
-	fmt.Printf("需要 %d 个批次来处理所有标签数据 (每批次 %d 个槽)\n", batchCount, slots)
+	logs.Printf("需要 %d 个批次来处理所有标签数据 (每批次 %d 个槽)\n", batchCount, slots)
 
 	// 流式发送：每20个批次发送一次
 	batchSize := 20
 	totalBatches := (batchCount + batchSize - 1) / batchSize
 
-	fmt.Printf("将分 %d 次发送，每次发送 %d 个批次\n", totalBatches, batchSize)
+	logs.Printf("将分 %d 次发送，每次发送 %d 个批次\n", totalBatches, batchSize)
 
 	// 当前批次的密文列表
-	var currentBatchCiphertexts []string
+	var currentBatchCiphertexts [][]byte
 
 	// 按批次处理所有标签
 	for batchIndex := 0; batchIndex < batchCount; batchIndex++ {
@@ -612,32 +612,31 @@ func (p *Participant) encryptAndSendLabelsToOutput(encoder *ckks.Encoder, encryp
 			return fmt.Errorf("加密标签数据批次 %d 失败: %v", batchIndex, err)
 		}
 
-		// 序列化密文
-		ctBytes, err := utils.EncodeShare(ct)
+		// 封装为绑定集体公钥的密文信封
+		ctData, err := envelope.SealCiphertext(p.KeyManager.GetParams(), p.KeyManager.KeyFingerprint(), ct)
 		if err != nil {
 			return fmt.Errorf("序列化标签密文批次 %d 失败: %v", batchIndex, err)
 		}
 
 		// 添加到当前发送批次
-		currentBatchCiphertexts = append(currentBatchCiphertexts, utils.EncodeToBase64(ctBytes))
+		currentBatchCiphertexts = append(currentBatchCiphertexts, ctData)
 
 		// 每10个批次输出一次进度，减少日志输出
 		if (batchIndex+1)%10 == 0 || batchIndex == batchCount-1 {
-			fmt.Printf("标签数据加密进度: %d/%d 批次完成 (%.1f%%)\n",
+			logs.Printf("标签数据加密进度: %d/%d 批次完成 (%.1f%%)\n",
 				batchIndex+1, batchCount, float64(batchIndex+1)/float64(batchCount)*100)
 		}
 
 		// 检查是否需要发送当前批次
 		if len(currentBatchCiphertexts) >= batchSize || batchIndex == batchCount-1 {
 			sendBatchIndex := (batchIndex / batchSize) + 1
-			fmt.Printf("发送标签数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
+			logs.Printf("发送标签数据批次 %d/%d (包含 %d 个密文)...\n", sendBatchIndex, totalBatches, len(currentBatchCiphertexts))
 
 			// 构造消息
 			message := DataMessage{
-				Type:      "label_batch",
-				From:      p.ID,
-				Data:      utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
-				BatchData: currentBatchCiphertexts,                                                          // 当前批次的密文数据
+				Type: "label_batch",
+				From: p.ID,
+				Data: utils.EncodeToBase64([]byte(fmt.Sprintf("%d,%d", sendBatchIndex, totalBatches))), // 发送批次信息
 			}
 
 			// 发送消息
@@ -646,18 +645,18 @@ func (p *Participant) encryptAndSendLabelsToOutput(encoder *ckks.Encoder, encryp
 				return fmt.Errorf("序列化标签消息批次 %d 失败: %v", sendBatchIndex, err)
 			}
 
-			if err := p.SendMessageToParticipant(outputLayerID, string(messageJSON)); err != nil {
+			if err := p.SendMessageToParticipant(outputLayerID, string(messageJSON), currentBatchCiphertexts...); err != nil {
 				return fmt.Errorf("发送标签数据批次 %d 到参与方 %d 失败: %v", sendBatchIndex, outputLayerID, err)
 			}
 
-			fmt.Printf("标签数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
+			logs.Printf("标签数据批次 %d/%d 发送完成\n", sendBatchIndex, totalBatches)
 
 			// 清空当前批次
 			currentBatchCiphertexts = nil
 		}
 	}
 
-	fmt.Printf("所有标签数据发送完成 (总样本数: %d)\n", totalSamples)
+	logs.Printf("所有标签数据发送完成 (总样本数: %d)\n", totalSamples)
 	return nil
 }
 
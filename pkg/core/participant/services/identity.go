@@ -0,0 +1,55 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/logs"
+	"crypto/ed25519"
+	"fmt"
+	"path/filepath"
+)
+
+// loadIdentity 载入参与方身份，首次启动时生成并保存
+// 同一分片重启后使用同一身份，协调器据此拒绝冒用分片的注册
+func (p *Participant) loadIdentity(shardID string) error {
+	path := p.IdentityPath
+	if path == "" {
+		path = filepath.Join("identity", "participant_"+shardID+".json")
+	}
+	id, err := identity.LoadOrCreate(path)
+	if err != nil {
+		return fmt.Errorf("载入身份失败: %v", err)
+	}
+	p.Identity = id
+	p.IdentityPath = path
+	logs.Printf("身份公钥: %s (%s)\n", id.PublicKeyBase64(), path)
+	return nil
+}
+
+// lookupPeerKey 查找签名方的身份公钥
+// 本地未登记时从协调器的参与方列表刷新，门限份额等请求可能早于参与方发现到达
+func (p *Participant) lookupPeerKey(id int) (ed25519.PublicKey, bool) {
+	if pub, ok := p.PeerKeys.Get(id); ok {
+		return pub, true
+	}
+	if id == identity.CoordinatorID || p.CoordinatorClient == nil {
+		return nil, false
+	}
+
+	peers, err := p.CoordinatorClient.GetParticipantsList()
+	if err != nil {
+		logs.Printf("[认证] 获取参与方公钥失败: %v\n", err)
+		return nil, false
+	}
+	for _, peer := range peers {
+		if peer.PublicKey == "" {
+			continue
+		}
+		pub, err := identity.ParsePublicKey(peer.PublicKey)
+		if err != nil {
+			logs.Printf("[认证] 参与方 %d 的公钥无效: %v\n", peer.ID, err)
+			continue
+		}
+		p.PeerKeys.Set(peer.ID, pub)
+	}
+	return p.PeerKeys.Get(id)
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"MPHEDev/pkg/core/participant/utils"
 	"fmt"
 
 	"github.com/tuneinsight/lattigo/v6/core/rlwe"
@@ -51,20 +50,14 @@ func (kg *KeyGenerator) GenerateKeys() (*rlwe.SecretKey, multiparty.PublicKeyGen
 	return sk, share, nil
 }
 
-func (kg *KeyGenerator) EncodeSecretKey(sk *rlwe.SecretKey) (string, error) {
-	skBytes, err := utils.EncodeShare(sk)
-	if err != nil {
-		return "", err
-	}
-	return utils.EncodeToBase64(skBytes), nil
+// EncodeSecretKey 私钥的二进制编码，仅 insecure_debug 模式下上传
+func (kg *KeyGenerator) EncodeSecretKey(sk *rlwe.SecretKey) ([]byte, error) {
+	return sk.MarshalBinary()
 }
 
-func (kg *KeyGenerator) EncodePublicKeyShare(share multiparty.PublicKeyGenShare) (string, error) {
-	shareBytes, err := utils.EncodeShare(share)
-	if err != nil {
-		return "", err
-	}
-	return utils.EncodeToBase64(shareBytes), nil
+// EncodePublicKeyShare 公钥份额的二进制编码
+func (kg *KeyGenerator) EncodePublicKeyShare(share multiparty.PublicKeyGenShare) ([]byte, error) {
+	return share.MarshalBinary()
 }
 
 func (kg *KeyGenerator) GenerateGaloisKeyShares() (map[uint64]multiparty.GaloisKeyGenShare, error) {
@@ -83,12 +76,9 @@ func (kg *KeyGenerator) GenerateGaloisKeyShares() (map[uint64]multiparty.GaloisK
 	return shares, nil
 }
 
-func (kg *KeyGenerator) EncodeGaloisKeyShare(share multiparty.GaloisKeyGenShare) (string, error) {
-	shareBytes, err := utils.EncodeShare(share)
-	if err != nil {
-		return "", err
-	}
-	return utils.EncodeToBase64(shareBytes), nil
+// EncodeGaloisKeyShare 伽罗瓦密钥份额的二进制编码
+func (kg *KeyGenerator) EncodeGaloisKeyShare(share multiparty.GaloisKeyGenShare) ([]byte, error) {
+	return share.MarshalBinary()
 }
 
 func (kg *KeyGenerator) GenerateRelinearizationKeyRound1() error {
@@ -119,19 +109,15 @@ func (kg *KeyGenerator) GenerateRelinearizationKeyRound2(aggregatedShare1 multip
 	return nil
 }
 
-func (kg *KeyGenerator) EncodeRelinearizationKeyShare(round int) (string, error) {
+// EncodeRelinearizationKeyShare 指定轮次重线性化密钥份额的二进制编码
+func (kg *KeyGenerator) EncodeRelinearizationKeyShare(round int) ([]byte, error) {
 	var share multiparty.RelinearizationKeyGenShare
 	if round == 1 {
 		share = kg.rlkShare1
 	} else if round == 2 {
 		share = kg.rlkShare2
 	} else {
-		return "", fmt.Errorf("无效的轮次: %d", round)
-	}
-
-	shareBytes, err := utils.EncodeShare(share)
-	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("无效的轮次: %d", round)
 	}
-	return utils.EncodeToBase64(shareBytes), nil
+	return share.MarshalBinary()
 }
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/envelope"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/utils/sampling"
+)
+
+// keyRotationTimeout 等待密钥轮换各阶段的最长时间，与协调器的轮换超时一致
+const keyRotationTimeout = 30 * time.Minute
+
+// rotationChunkSize 每轮协同切换的密文数量
+const rotationChunkSize = 256
+
+// 向协调器报告的轮换进度
+const (
+	keyRotationStageSwitched  = "switched"
+	keyRotationStageCommitted = "committed"
+	keyRotationStageFailed    = "failed"
+)
+
+// handleKeyRotation 接收协调器的密钥轮换通知，在后台生成新纪元的密钥并切换保存的密文
+func (p *Participant) handleKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var notice types.KeyRotationNotice
+	if err := json.NewDecoder(r.Body).Decode(&notice); err != nil {
+		http.Error(w, "请求解析失败", http.StatusBadRequest)
+		return
+	}
+	if notice.SessionID != p.SessionID {
+		http.Error(w, fmt.Sprintf("会话ID不一致: %s", notice.SessionID), http.StatusConflict)
+		return
+	}
+	if !containsID(notice.Members, p.ID) {
+		http.Error(w, fmt.Sprintf("参与方 %d 不是第 %d 纪元的成员", p.ID, notice.Epoch), http.StatusConflict)
+		return
+	}
+	// 候选成员还没有密钥，只接受把自己加入集体密钥的轮换
+	joining := containsID(notice.Joining, p.ID)
+	if p.sessionSeed == nil || (!joining && !p.KeyManager.IsReady()) {
+		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
+		return
+	}
+	if current := p.KeyManager.Epoch; !joining && notice.Epoch != current+1 {
+		http.Error(w, fmt.Sprintf("本方处于第 %d 纪元，不能轮换到第 %d 纪元", current, notice.Epoch), http.StatusConflict)
+		return
+	}
+
+	logs.Printf("[密钥轮换] 收到轮换到第 %d 纪元的通知（第 %d 次尝试）\n", notice.Epoch, notice.Attempt)
+	if len(notice.Joining) > 0 {
+		logs.Printf("[密钥轮换] 参与方 %v 加入，新纪元成员 %v（成员纪元 %d）\n", notice.Joining, notice.Members, notice.MembershipEpoch)
+	}
+	p.goBackground(func() {
+		p.runKeyRotation(notice)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "accepted",
+		"epoch":   notice.Epoch,
+		"attempt": notice.Attempt,
+	})
+}
+
+// runKeyRotation 完成一次密钥轮换
+// 报告完成切换之前失败时丢弃新纪元的材料并报告失败；之后由协调器决定提交或中止
+func (p *Participant) runKeyRotation(notice types.KeyRotationNotice) {
+	p.keyRotationMu.Lock()
+	defer p.keyRotationMu.Unlock()
+
+	epoch, attempt := notice.Epoch, notice.Attempt
+	if err := p.switchToNextEpoch(notice); err != nil {
+		logs.Printf("[密钥轮换] 第 %d 纪元失败: %v\n", epoch, err)
+		p.KeyManager.AbortRotation()
+		if _, err := p.CoordinatorClient.ReportKeyRotation(epoch, attempt, keyRotationStageFailed, err.Error()); err != nil {
+			logs.Printf("[密钥轮换] 报告失败时出错: %v\n", err)
+		}
+		return
+	}
+	p.awaitKeyRotationCommit(epoch, attempt)
+}
+
+// switchToNextEpoch 生成新纪元的密钥、切换保存的密文并报告完成切换
+func (p *Participant) switchToNextEpoch(notice types.KeyRotationNotice) error {
+	epoch, attempt := notice.Epoch, notice.Attempt
+	params := p.KeyManager.GetParams()
+
+	// 1. 新纪元的CRP由会话种子按纪元和尝试次数派生，与协调器的计算方式一致
+	seed := crs.EpochSeed(p.sessionSeed, epoch, attempt)
+	prng, err := sampling.NewKeyedPRNG(seed)
+	if err != nil {
+		return fmt.Errorf("创建第 %d 纪元的PRNG失败: %v", epoch, err)
+	}
+	crp := multiparty.NewPublicKeyGenProtocol(params).SampleCRP(prng)
+	rlkCRP := multiparty.NewRelinearizationKeyGenProtocol(params).SampleCRP(prng)
+	galoisCRPs := make(map[uint64]multiparty.GaloisKeyGenCRP, len(notice.GalEls))
+	for _, galEl := range notice.GalEls {
+		if galoisCRPs[galEl], err = sampleGaloisCRP(params, seed, galEl); err != nil {
+			return err
+		}
+	}
+
+	kg := NewKeyGenerator(params, &crp, notice.GalEls, galoisCRPs, &rlkCRP)
+	sk, pkShare, err := kg.GenerateKeys()
+	if err != nil {
+		return fmt.Errorf("生成新私钥失败: %v", err)
+	}
+	oldKey, err := envelope.ParseFingerprint(notice.KeyFingerprint)
+	if err != nil {
+		return fmt.Errorf("集体公钥指纹无效: %v", err)
+	}
+	if err := p.KeyManager.BeginRotation(epoch, attempt, sk, notice.Members, notice.MembershipEpoch, oldKey); err != nil {
+		return err
+	}
+
+	// 2. 上传新纪元的密钥份额
+	if notice.InsecureDebug {
+		skData, err := kg.EncodeSecretKey(sk)
+		if err != nil {
+			return fmt.Errorf("编码私钥失败: %v", err)
+		}
+		if err := p.CoordinatorClient.UploadKeyRotationShare(epoch, attempt, "secret", 0, 0, skData); err != nil {
+			return err
+		}
+	}
+	pkData, err := kg.EncodePublicKeyShare(pkShare)
+	if err != nil {
+		return fmt.Errorf("编码公钥份额失败: %v", err)
+	}
+	if err := p.CoordinatorClient.UploadKeyRotationShare(epoch, attempt, "public", 0, 0, pkData); err != nil {
+		return err
+	}
+	galoisShares, err := kg.GenerateGaloisKeyShares()
+	if err != nil {
+		return fmt.Errorf("生成伽罗瓦密钥份额失败: %v", err)
+	}
+	for galEl, share := range galoisShares {
+		data, err := kg.EncodeGaloisKeyShare(share)
+		if err != nil {
+			return fmt.Errorf("编码伽罗瓦密钥份额失败 (galEl: %d): %v", galEl, err)
+		}
+		if err := p.CoordinatorClient.UploadKeyRotationShare(epoch, attempt, "galois", galEl, 0, data); err != nil {
+			return err
+		}
+	}
+	if err := kg.GenerateRelinearizationKeyRound1(); err != nil {
+		return err
+	}
+	round1, err := kg.EncodeRelinearizationKeyShare(1)
+	if err != nil {
+		return fmt.Errorf("编码重线性化密钥第一轮份额失败: %v", err)
+	}
+	if err := p.CoordinatorClient.UploadKeyRotationShare(epoch, attempt, "relin", 0, 1, round1); err != nil {
+		return err
+	}
+	if err := p.waitKeyRotation(epoch, attempt, "重线性化密钥第一轮聚合", func(s *types.KeyRotationStatus) bool {
+		return s.RlkRound1Ready
+	}); err != nil {
+		return err
+	}
+	aggregated, err := p.CoordinatorClient.GetKeyRotationRelinRound1(epoch, attempt)
+	if err != nil {
+		return err
+	}
+	if err := kg.GenerateRelinearizationKeyRound2(aggregated); err != nil {
+		return err
+	}
+	round2, err := kg.EncodeRelinearizationKeyShare(2)
+	if err != nil {
+		return fmt.Errorf("编码重线性化密钥第二轮份额失败: %v", err)
+	}
+	if err := p.CoordinatorClient.UploadKeyRotationShare(epoch, attempt, "relin", 0, 2, round2); err != nil {
+		return err
+	}
+	logs.Printf("[密钥轮换] 第 %d 纪元的密钥份额已全部上传\n", epoch)
+
+	// 3. 门限模式下与新纪元的全部成员交换新私钥的Shamir份额
+	if err := p.exchangeNextThresholdShares(epoch, attempt, notice.Members); err != nil {
+		return err
+	}
+
+	// 4. 等待新纪元的集体密钥全部聚合后下载
+	if err := p.waitKeyRotation(epoch, attempt, "新纪元集体密钥聚合", func(s *types.KeyRotationStatus) bool {
+		return s.Phase == "switch"
+	}); err != nil {
+		return err
+	}
+	keys, err := p.CoordinatorClient.GetKeyRotationKeys(epoch, attempt)
+	if err != nil {
+		return err
+	}
+	if err := p.KeyManager.SetNextKeys(epoch, attempt, keys.PubKey, keys.RelineKey, keys.GaloisKeys); err != nil {
+		return err
+	}
+
+	// 5. 把保存的密文切换到新纪元的集体私钥
+	if err := p.rotateStoredCiphertexts(epoch, attempt, notice.Members); err != nil {
+		return err
+	}
+
+	// 6. 报告完成切换后协调器随时可能提交，新私钥份额必须先落盘
+	if err := p.SaveKeystore(); err != nil {
+		return fmt.Errorf("保存新纪元的密钥材料失败: %v", err)
+	}
+	if _, err := p.CoordinatorClient.ReportKeyRotation(epoch, attempt, keyRotationStageSwitched, ""); err != nil {
+		return err
+	}
+	logs.Printf("[密钥轮换] 已完成第 %d 纪元的密文切换，等待全部参与方完成\n", epoch)
+	return nil
+}
+
+// waitKeyRotation 轮询协调器的轮换状态直到 ready 返回 true
+// 轮换被中止、被重新发起或超时时返回错误
+func (p *Participant) waitKeyRotation(epoch, attempt int, what string, ready func(*types.KeyRotationStatus) bool) error {
+	deadline := time.Now().Add(keyRotationTimeout)
+	for {
+		status, err := p.CoordinatorClient.GetKeyRotationStatus()
+		if err == nil {
+			if status.TargetEpoch != epoch || status.Attempt != attempt {
+				return fmt.Errorf("协调器已重新发起轮换（第 %d 纪元第 %d 次尝试）", status.TargetEpoch, status.Attempt)
+			}
+			if status.Phase == "aborted" {
+				return fmt.Errorf("协调器已中止轮换: %s", status.Error)
+			}
+			if ready(status) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待%s超时", what)
+		}
+		if !p.sleepOrDone(2 * time.Second) {
+			return fmt.Errorf("参与方正在关闭")
+		}
+	}
+}
+
+// exchangeNextThresholdShares 与新纪元的其他成员交换新私钥的Shamir份额，非门限模式下直接返回
+func (p *Participant) exchangeNextThresholdShares(epoch, attempt int, members []int) error {
+	if !p.KeyManager.IsThresholdMode() {
+		return nil
+	}
+	expectedN := len(members)
+	deadline := time.Now().Add(thresholdSetupTimeout)
+
+	online, err := p.CoordinatorClient.GetParticipantsList()
+	if err != nil {
+		return fmt.Errorf("获取参与方列表失败: %v", err)
+	}
+	var peers []types.PeerInfo
+	for _, peer := range online {
+		if containsID(members, peer.ID) {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) < expectedN {
+		return fmt.Errorf("密钥轮换需要全部成员在线: %d/%d", len(peers), expectedN)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	ids := make([]int, 0, len(peers))
+	for _, peer := range peers {
+		ids = append(ids, peer.ID)
+	}
+
+	shares, err := p.KeyManager.GenerateNextThresholdShares(epoch, attempt, ids)
+	if err != nil {
+		return err
+	}
+	if err := p.KeyManager.AddNextThresholdShare(epoch, attempt, p.ID, p.ID, shares[p.ID]); err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		if peer.ID == p.ID {
+			continue
+		}
+		msg := types.ThresholdShareMessage{
+			From:    p.ID,
+			To:      peer.ID,
+			Epoch:   epoch,
+			Attempt: attempt,
+		}
+		if err := p.sendThresholdShare(peer.URL, msg, shares[peer.ID], deadline); err != nil {
+			return fmt.Errorf("向参与方 %d 发送第 %d 纪元的门限份额失败: %v", peer.ID, epoch, err)
+		}
+	}
+
+	for p.KeyManager.NextThresholdShareCount(epoch, attempt) < expectedN {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待第 %d 纪元的门限份额超时: %d/%d", epoch, p.KeyManager.NextThresholdShareCount(epoch, attempt), expectedN)
+		}
+		if !p.sleepOrDone(1 * time.Second) {
+			return fmt.Errorf("参与方正在关闭")
+		}
+	}
+	if err := p.KeyManager.FinalizeNextThresholdShare(epoch, attempt); err != nil {
+		return err
+	}
+	logs.Printf("[密钥轮换] 第 %d 纪元的门限份额准备就绪\n", epoch)
+	return nil
+}
+
+// storedCiphertext 接收到的密文在存储中的位置
+type storedCiphertext struct {
+	store map[int][][]string
+	kind  string
+	from  int
+	batch int
+	index int
+	value string
+}
+
+// rotateStoredCiphertexts 与新纪元的全部成员协同把接收到的特征和标签密文切换到新纪元
+// 全部切换成功后才替换，失败时保留原密文
+func (p *Participant) rotateStoredCiphertexts(epoch, attempt int, members []int) error {
+	p.ciphertextMu.Lock()
+	var stored []storedCiphertext
+	for kind, store := range p.ciphertextStores() {
+		for from, batches := range store {
+			for b, batch := range batches {
+				for i, value := range batch {
+					stored = append(stored, storedCiphertext{store: store, kind: kind, from: from, batch: b, index: i, value: value})
+				}
+			}
+		}
+	}
+	p.ciphertextMu.Unlock()
+	if len(stored) == 0 {
+		logs.Println("[密钥轮换] 本方没有保存的密文")
+		return nil
+	}
+
+	// 保存的密文在当前纪元的集体公钥下，切换后改为绑定新纪元的集体公钥
+	params := p.KeyManager.GetParams()
+	oldKey, err := p.KeyManager.RotationKeyFingerprint(epoch, attempt)
+	if err != nil {
+		return err
+	}
+	newKey := envelope.KeyFingerprint(p.KeyManager.NextPublicKey(epoch, attempt))
+	cts := make([]*rlwe.Ciphertext, len(stored))
+	for i, sc := range stored {
+		ct, err := utils.DecodeCiphertext(params, oldKey, sc.value)
+		if err != nil {
+			return fmt.Errorf("解码保存的密文失败: %v", err)
+		}
+		cts[i] = ct
+	}
+
+	if err := p.UpdateOnlineParticipants(); err != nil {
+		return fmt.Errorf("更新在线参与方失败: %v", err)
+	}
+	// 加入的新成员也要参与切换，不能按当前成员过滤
+	onlinePeers := make(map[int]string)
+	for id, url := range p.GetOnlineParticipants() {
+		if containsID(members, id) {
+			onlinePeers[id] = url
+		}
+	}
+	rotated := make([]string, len(stored))
+	for start := 0; start < len(cts); start += rotationChunkSize {
+		end := start + rotationChunkSize
+		if end > len(cts) {
+			end = len(cts)
+		}
+		ctx, cancel := context.WithTimeout(p.ctx, keyRotationTimeout)
+		out, errs, _ := p.DecryptionService.CollaborativeRotateBatch(ctx, cts[start:end], epoch, attempt, onlinePeers, p.ID)
+		cancel()
+		for k, ct := range out {
+			if errs[k] != nil {
+				return fmt.Errorf("切换第 %d 个密文失败: %v", start+k, errs[k])
+			}
+			if rotated[start+k], err = utils.EncodeCiphertext(params, newKey, ct); err != nil {
+				return fmt.Errorf("序列化切换后的密文失败: %v", err)
+			}
+		}
+		logs.Printf("[密钥轮换] 已切换 %d/%d 个密文\n", end, len(cts))
+	}
+
+	// 切换期间位置上的密文被替换时保留新值
+	p.ciphertextMu.Lock()
+	defer p.ciphertextMu.Unlock()
+	for i, sc := range stored {
+		if batch := sc.store[sc.from][sc.batch]; sc.index < len(batch) && batch[sc.index] == sc.value {
+			batch[sc.index] = rotated[i]
+			p.ciphertextEpochs[ciphertextBatchKey{kind: sc.kind, from: sc.from, batch: sc.batch}] = epoch
+		}
+	}
+	return nil
+}
+
+// awaitKeyRotationCommit 等待协调器提交新纪元，提交后清除旧私钥份额
+// 协调器中止轮换时丢弃新纪元的材料；超时时保留，重启后按协调器状态处理
+func (p *Participant) awaitKeyRotationCommit(epoch, attempt int) {
+	deadline := time.Now().Add(keyRotationTimeout)
+	for {
+		status, err := p.CoordinatorClient.GetKeyRotationStatus()
+		if err == nil {
+			if status.Epoch >= epoch {
+				p.commitKeyRotation(epoch, attempt)
+				return
+			}
+			if status.TargetEpoch != epoch || status.Attempt != attempt || status.Phase == "aborted" {
+				logs.Printf("[密钥轮换] 协调器未提交第 %d 纪元，丢弃新密钥: %s\n", epoch, status.Error)
+				p.KeyManager.AbortRotation()
+				if err := p.SaveKeystore(); err != nil {
+					logs.Printf("[密钥轮换] 保存密钥库失败: %v\n", err)
+				}
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			logs.Printf("[警告] 等待协调器提交第 %d 纪元超时，保留新旧两份密钥\n", epoch)
+			return
+		}
+		if !p.sleepOrDone(2 * time.Second) {
+			return
+		}
+	}
+}
+
+// commitKeyRotation 改用新纪元的密钥，保存密钥库并报告已提交
+func (p *Participant) commitKeyRotation(epoch, attempt int) {
+	if err := p.KeyManager.CommitRotation(epoch, attempt); err != nil {
+		logs.Printf("[密钥轮换] 提交第 %d 纪元失败: %v\n", epoch, err)
+		return
+	}
+	p.keySeed = crs.EpochSeed(p.sessionSeed, epoch, attempt)
+	if err := p.SaveKeystore(); err != nil {
+		logs.Printf("[警告] 保存密钥库失败，重启后将无法重新加入本会话: %v\n", err)
+	}
+	if _, err := p.CoordinatorClient.ReportKeyRotation(epoch, attempt, keyRotationStageCommitted, ""); err != nil {
+		logs.Printf("[密钥轮换] 报告已提交失败: %v\n", err)
+	}
+	logs.Printf("[密钥轮换] 已进入第 %d 纪元，旧私钥份额已清除\n", epoch)
+}
+
+// resumeKeyRotation 从密钥库恢复了已切换但未提交的轮换时，在后台等待协调器提交或中止
+func (p *Participant) resumeKeyRotation() {
+	epoch, attempt, ok := p.KeyManager.RotationInProgress()
+	if !ok {
+		return
+	}
+	logs.Printf("[密钥轮换] 密钥库中有未提交的第 %d 纪元密钥，等待协调器的结果\n", epoch)
+	p.goBackground(func() {
+		p.keyRotationMu.Lock()
+		defer p.keyRotationMu.Unlock()
+		p.awaitKeyRotationCommit(epoch, attempt)
+	})
+}
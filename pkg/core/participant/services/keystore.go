@@ -0,0 +1,109 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KeystorePassphraseEnv 密钥库口令的环境变量，未设置时启动时提示输入
+const KeystorePassphraseEnv = "MPHE_KEYSTORE_PASSPHRASE"
+
+// keystorePath 密钥库路径，默认 keystore/participant_<分片ID>.json
+func (p *Participant) keystorePath() string {
+	if p.KeystorePath != "" {
+		return p.KeystorePath
+	}
+	return filepath.Join("keystore", "participant_"+p.ShardID+".json")
+}
+
+// KeystoreFile 密钥库文件路径
+func (p *Participant) KeystoreFile() string {
+	return p.keystorePath()
+}
+
+// LoadKeystore 注册后读取密钥库，密钥库属于当前会话时返回 true，参与方可跳过密钥生成重新加入会话
+// 密钥库不存在、未设置口令或属于其他会话时返回 false，按新参与方生成密钥
+func (p *Participant) LoadKeystore() (bool, error) {
+	if len(p.KeystorePassphrase) == 0 {
+		return false, nil
+	}
+	path := p.keystorePath()
+	ks, err := crypto.LoadKeystore(path, p.KeystorePassphrase)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取密钥库 %s 失败: %v", path, err)
+	}
+
+	if ks.SessionID != p.SessionID {
+		logs.Printf("密钥库属于会话 %s，当前会话为 %s，将重新生成密钥\n", ks.SessionID, p.SessionID)
+		return false, nil
+	}
+	if ks.ShardID != p.ShardID || ks.ParticipantID != p.ID {
+		return false, fmt.Errorf("密钥库属于分片 %s（参与方 %d），与当前注册的分片 %s（参与方 %d）不一致",
+			ks.ShardID, ks.ParticipantID, p.ShardID, p.ID)
+	}
+
+	p.keystore = ks
+	p.crsSeed = ks.CRSSeed
+	logs.Printf("已从密钥库 %s 读取会话 %s 的密钥，重新加入会话\n", path, ks.SessionID)
+	return true, nil
+}
+
+// ApplyKeystore 用已读取的密钥库恢复密钥材料，需在设置CKKS参数之后调用
+func (p *Participant) ApplyKeystore() error {
+	if p.keystore == nil {
+		return fmt.Errorf("未读取密钥库")
+	}
+	if err := p.KeyManager.ImportKeystore(p.keystore); err != nil {
+		return err
+	}
+	p.sessionSeed = p.keystore.SessionSeed
+	p.keySeed = p.keystore.KeySeed
+	if p.keySeed == nil {
+		p.keySeed = p.sessionSeed
+	}
+	p.resumeKeyRotation()
+	return nil
+}
+
+// RestoreRefreshTasks 设置已使用刷新任务ID的记录文件（与密钥库放在一起）并恢复有效期内的记录
+// 与密钥库一样只在设置口令时保存：没有密钥库时重启后不会恢复私钥份额，不存在复用CRP的风险
+func (p *Participant) RestoreRefreshTasks() error {
+	if len(p.KeystorePassphrase) == 0 {
+		return nil
+	}
+	return p.RefreshService.SetTaskLog(p.keystorePath() + ".refresh_tasks")
+}
+
+// SaveKeystore 将私钥份额、门限份额、集体密钥和会话信息加密保存，未设置口令时跳过
+func (p *Participant) SaveKeystore() error {
+	if len(p.KeystorePassphrase) == 0 {
+		return nil
+	}
+	ks, err := p.KeyManager.ExportKeystore()
+	if err != nil {
+		return err
+	}
+	ks.SessionID = p.SessionID
+	ks.ShardID = p.ShardID
+	ks.CRSSeed = p.crsSeed
+	ks.SessionSeed = p.sessionSeed
+	ks.KeySeed = p.keySeed
+	if policy, ok := p.AgreedPolicy(); ok {
+		ks.AgreedApprovals = policy.RequiredApprovals
+		ks.AgreedTaskTTLSeconds = policy.TaskTTLSeconds
+	}
+
+	path := p.keystorePath()
+	if err := crypto.SaveKeystore(path, p.KeystorePassphrase, ks); err != nil {
+		return err
+	}
+	p.KeystorePath = path
+	logs.Printf("密钥已加密保存到 %s\n", path)
+	return nil
+}
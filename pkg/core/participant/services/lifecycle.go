@@ -0,0 +1,79 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"context"
+	"fmt"
+	"time"
+)
+
+// goBackground 启动受生命周期管理的后台任务，Shutdown 会等待其退出
+func (p *Participant) goBackground(fn func()) {
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+		fn()
+	}()
+}
+
+// sleepOrDone 等待指定时间，参与方关闭时提前返回 false
+func (p *Participant) sleepOrDone(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+// Shutdown 优雅关闭参与方，可重复调用
+// 先停止心跳并向协调器注销（KeepRegistration 时不注销），使其他参与方不再选中本方；再等待处理中的
+// 协同解密、刷新请求和后台任务完成，最后关闭P2P服务器
+func (p *Participant) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	p.shutdownOnce.Do(func() {
+		logs.Println("参与方正在关闭...")
+
+		// 1. 停止心跳和在线状态监控
+		if p.HeartbeatManager != nil {
+			p.HeartbeatManager.StopHeartbeat()
+		}
+
+		// 2. 向协调器注销，保留登记时跳过
+		if p.CoordinatorClient != nil && p.ID > 0 && !p.KeepRegistration {
+			if err := p.Unregister(); err != nil {
+				logs.Printf("[警告] 注销失败: %v\n", err)
+				shutdownErr = fmt.Errorf("注销失败: %v", err)
+			} else {
+				logs.Println("已向协调器注销")
+			}
+		}
+
+		// 3. 停止接受新请求，等待处理中的请求完成
+		if p.HTTPServer != nil {
+			if err := p.HTTPServer.Stop(ctx); err != nil {
+				logs.Printf("[警告] 关闭P2P服务器失败: %v\n", err)
+				if shutdownErr == nil {
+					shutdownErr = err
+				}
+			}
+		}
+
+		// 4. 通知后台任务退出并等待
+		p.cancel()
+		done := make(chan struct{})
+		go func() {
+			p.background.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			logs.Println("[警告] 等待后台任务退出超时")
+		}
+		logs.Println("参与方已关闭")
+	})
+	return shutdownErr
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ==================== 成员与密文纪元 ====================
+//
+// 初始密钥生成完成后注册的参与方是候选成员：它跳过种子协商和初始密钥生成，
+// 等待控制面发起一次把它加入集体密钥的密钥轮换（见 key_rotation.go），
+// 轮换提交后它持有新纪元的私钥份额，成为下一个成员纪元的成员。
+// 现有成员从轮换通知得知新的成员列表，启动和重新加入会话时从协调器的 /members 同步。
+// 接收到的每批密文记录所在的密钥纪元，轮换切换后更新。
+
+// membershipPollInterval 候选成员查询是否已加入集体密钥的间隔
+const membershipPollInterval = 2 * time.Second
+
+// ciphertextBatchKey 接收到的一批密文：类型（feature/label）、发送方和批次序号
+type ciphertextBatchKey struct {
+	kind  string
+	from  int
+	batch int
+}
+
+// ciphertextStores 按类型返回接收到的密文存储，调用方需持有 ciphertextMu
+func (p *Participant) ciphertextStores() map[string]map[int][][]string {
+	return map[string]map[int][][]string{
+		"feature": p.ReceivedFeatureCiphertexts,
+		"label":   p.ReceivedLabelCiphertexts,
+	}
+}
+
+// SyncMembership 从协调器同步当前成员和成员纪元
+func (p *Participant) SyncMembership() error {
+	members, err := p.CoordinatorClient.GetMembers()
+	if err != nil {
+		return err
+	}
+	if len(members.Members) == 0 {
+		return nil
+	}
+	p.KeyManager.SetMembership(members.Members, members.Epoch)
+	logs.Printf("成员纪元 %d: 成员 %v，候选成员 %v\n", members.Epoch, members.Members, members.Candidates)
+	return nil
+}
+
+// WaitForMembership 候选成员等待控制面把本方加入集体密钥，轮换提交后返回
+func (p *Participant) WaitForMembership() error {
+	logs.Printf("参与方 %d 是候选成员，等待加入集体密钥（POST /api/coordinator/members）...\n", p.ID)
+	for !p.KeyManager.IsReady() {
+		if !p.sleepOrDone(membershipPollInterval) {
+			return fmt.Errorf("参与方正在关闭")
+		}
+	}
+	members, epoch := p.KeyManager.GetMembership()
+	logs.Printf("参与方 %d 已加入集体密钥，成员纪元 %d，成员 %v\n", p.ID, epoch, members)
+	return nil
+}
+
+// CiphertextStatus 本方的密钥纪元、成员和保存的每批密文所在的密钥纪元
+func (p *Participant) CiphertextStatus() types.CiphertextStatus {
+	members, membershipEpoch := p.KeyManager.GetMembership()
+	status := types.CiphertextStatus{
+		KeyEpoch:        p.KeyManager.Epoch,
+		MembershipEpoch: membershipEpoch,
+		Members:         members,
+		Ciphertexts:     []types.StoredCiphertextInfo{},
+	}
+
+	p.ciphertextMu.Lock()
+	defer p.ciphertextMu.Unlock()
+	for kind, store := range p.ciphertextStores() {
+		for from, batches := range store {
+			for b, batch := range batches {
+				if batch == nil {
+					continue
+				}
+				status.Ciphertexts = append(status.Ciphertexts, types.StoredCiphertextInfo{
+					From:  from,
+					Kind:  kind,
+					Batch: b + 1,
+					Count: len(batch),
+					Epoch: p.ciphertextEpochs[ciphertextBatchKey{kind: kind, from: from, batch: b}],
+				})
+			}
+		}
+	}
+	sort.Slice(status.Ciphertexts, func(i, j int) bool {
+		a, b := status.Ciphertexts[i], status.Ciphertexts[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.Batch < b.Batch
+	})
+	return status
+}
+
+// JoinAsCandidate 候选成员用会话种子准备密钥轮换需要的CRP，然后等待加入集体密钥
+func (p *Participant) JoinAsCandidate(params *types.ParamsResponse) error {
+	seed, err := utils.DecodeFromBase64(params.CommonCRSSeed)
+	if err != nil {
+		return fmt.Errorf("解码统一CRS种子失败: %v", err)
+	}
+	p.sessionSeed = seed
+	p.keySeed = seed
+	return p.WaitForMembership()
+}
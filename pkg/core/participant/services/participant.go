@@ -1,18 +1,27 @@
 package services
 
 import (
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/logs"
 	"MPHEDev/pkg/core/participant/coordinator"
 	"MPHEDev/pkg/core/participant/crypto"
 	"MPHEDev/pkg/core/participant/network"
 	"MPHEDev/pkg/core/participant/server"
 	"MPHEDev/pkg/core/participant/types"
 	"MPHEDev/pkg/core/participant/utils"
+	"MPHEDev/pkg/core/pki"
+	"MPHEDev/pkg/core/relay"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
 	"github.com/tuneinsight/lattigo/v6/multiparty"
 	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 	"github.com/tuneinsight/lattigo/v6/utils/sampling"
@@ -20,9 +29,21 @@ import (
 
 // Participant 重构后的参与方主结构体
 type Participant struct {
-	ID     int
-	Port   int
-	Client *types.HTTPClient
+	ID      int
+	Port    int    // P2P服务端口，为0时使用默认端口8081
+	Host    string // 向其他参与方公布的地址，为空时使用本机IP
+	DataDir string // 数据集目录（含 horizontal/vertical 分片子目录），为空时使用 ../../data
+	Client  *types.HTTPClient
+
+	// mTLS配置，nil 时使用明文HTTP
+	TLS *pki.Config
+
+	// 中继模式：无法直连时经协调器转发P2P请求，见 relay.go
+	Relay     relay.Mode
+	relayKey  *relay.Key
+	relayOnce sync.Once
+	relayMu   sync.Mutex
+	relayKeys map[int][]byte // 其他参与方已核对签名的中继公钥
 
 	// 网络相关
 	PeerManager      *network.PeerManager
@@ -32,6 +53,16 @@ type Participant struct {
 	// 协调器客户端
 	CoordinatorClient *coordinator.CoordinatorClient
 
+	// 身份（Ed25519），用于签名上传的份额和P2P请求
+	Identity     *identity.Identity
+	IdentityPath string            // 身份文件路径，为空时按分片ID使用默认路径
+	PeerKeys     *identity.KeyRing // 协调器和其他参与方的身份公钥
+
+	// 加密密钥库：保存私钥份额和集体密钥，重启后重新加入同一会话
+	KeystorePath       string // 密钥库路径，为空时按分片ID使用默认路径
+	KeystorePassphrase []byte // 密钥库口令，为空时不保存密钥库
+	keystore           *crypto.Keystore
+
 	// 加密相关
 	KeyManager        *crypto.KeyManager
 	DecryptionService *crypto.DecryptionService
@@ -41,6 +72,33 @@ type Participant struct {
 	Ready   bool
 	ReadyCh chan struct{}
 
+	// 会话信息（注册时由协调器下发）
+	ShardID         string // 本地数据分片ID，为空时注册时从数据集目录检测
+	Candidate       bool   // 初始密钥生成后才注册、等待加入集体密钥的候选成员
+	SessionID       string
+	CRSCommitment   string // 协调器CRS种子的承诺
+	CRSContribution bool   // 是否需要贡献CRS种子
+	crsSeed         []byte // 本方贡献的CRS种子
+	sessionSeed     []byte // 会话最终CRS种子，派生各纪元的种子
+	keySeed         []byte // 当前密钥纪元的种子，追加旋转密钥时派生伽罗瓦CRP
+
+	// 本方同意的解密授权策略，只为满足该策略的任务提供份额，见 tasks.go
+	agreedPolicy   *types.TaskPolicy
+	agreedPolicyMu sync.RWMutex
+
+	// 追加旋转密钥轮次
+	galoisRoundMu sync.Mutex
+	// 集体密钥轮换，同一时间只进行一次
+	keyRotationMu sync.Mutex
+
+	// 生命周期：ctx 在关闭时取消，background 跟踪后台任务
+	ctx          context.Context
+	cancel       context.CancelFunc
+	background   sync.WaitGroup
+	shutdownOnce sync.Once
+	// KeepRegistration 关闭时不向协调器注销，之后以同一分片和密钥库重新加入会话
+	KeepRegistration bool
+
 	// 数据集相关
 	Images    [][]float64 // 载入的图像数据
 	Labels    []int       // 载入的标签数据
@@ -59,9 +117,11 @@ type Participant struct {
 	FeatureBatchStatus map[int]*BatchStatus // 每个参与方的特征批次状态
 	LabelBatchStatus   map[int]*BatchStatus // 每个参与方的标签批次状态
 
-	// 接收到的密文数据存储
-	ReceivedFeatureCiphertexts map[int][][]string // 每个参与方的特征密文批次
-	ReceivedLabelCiphertexts   map[int][][]string // 每个参与方的标签密文批次
+	// 接收到的密文数据存储，密钥轮换时切换到新纪元
+	ReceivedFeatureCiphertexts map[int][][]string         // 每个参与方的特征密文批次
+	ReceivedLabelCiphertexts   map[int][][]string         // 每个参与方的标签密文批次
+	ciphertextEpochs           map[ciphertextBatchKey]int // 每批密文所在的密钥纪元
+	ciphertextMu               sync.Mutex                 // 保护接收到的密文
 }
 
 // BatchStatus 批次状态
@@ -86,11 +146,17 @@ func NewParticipant() *Participant {
 	// 创建刷新服务
 	refreshService := crypto.NewRefreshService(keyManager, client)
 
-	return &Participant{
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Participant{
+		ctx:                        ctx,
+		cancel:                     cancel,
 		Client:                     client,
 		KeyManager:                 keyManager,
 		DecryptionService:          decryptionService,
 		RefreshService:             refreshService,
+		PeerKeys:                   identity.NewKeyRing(),
+		Relay:                      relay.ModeAuto,
+		relayKeys:                  make(map[int][]byte),
 		ReadyCh:                    make(chan struct{}),
 		ReceivedFeatures:           make(map[int]bool),
 		ReceivedLabels:             make(map[int]bool),
@@ -101,28 +167,44 @@ func NewParticipant() *Participant {
 		LabelBatchStatus:           make(map[int]*BatchStatus),
 		ReceivedFeatureCiphertexts: make(map[int][][]string),
 		ReceivedLabelCiphertexts:   make(map[int][][]string),
+		ciphertextEpochs:           make(map[ciphertextBatchKey]int),
+	}
+	decryptionService.SetTaskAuthorizer(func(kind, purpose string, ct *rlwe.Ciphertext) (string, error) {
+		return p.AuthorizeTask(kind, purpose, "", ct)
+	})
+	return p
+}
+
+// defaultDataDir 默认的数据集目录
+const defaultDataDir = "../../data"
+
+// dataDir 数据集目录
+func (p *Participant) dataDir() string {
+	if p.DataDir == "" {
+		return defaultDataDir
 	}
+	return p.DataDir
 }
 
-func getLocalShardID(dataSplit string) string {
+func getLocalShardID(root, dataSplit string) string {
 	var dataDir string
 	if dataSplit == "vertical" {
-		dataDir = "../../data/vertical"
+		dataDir = filepath.Join(root, "vertical")
 	} else {
-		dataDir = "../../data/horizontal"
+		dataDir = filepath.Join(root, "horizontal")
 	}
 	files, err := ioutil.ReadDir(dataDir)
 	if err != nil {
-		fmt.Printf("读取目录失败: %s, err=%v\n", dataDir, err)
+		logs.Printf("读取目录失败: %s, err=%v\n", dataDir, err)
 		return ""
 	}
-	fmt.Printf("扫描目录 %s，文件列表：\n", dataDir)
+	logs.Printf("扫描目录 %s，文件列表：\n", dataDir)
 	for _, f := range files {
-		fmt.Println("  ", f.Name())
+		logs.Println("  ", f.Name())
 		if strings.HasPrefix(f.Name(), "train_split_") && strings.HasSuffix(f.Name(), "_images.csv") {
 			parts := strings.Split(f.Name(), "_")
 			if len(parts) >= 3 {
-				fmt.Printf("检测到分片文件: %s，分片ID: %s\n", f.Name(), parts[2])
+				logs.Printf("检测到分片文件: %s，分片ID: %s\n", f.Name(), parts[2])
 				return parts[2] // 000、001等
 			}
 		}
@@ -131,18 +213,13 @@ func getLocalShardID(dataSplit string) string {
 }
 
 // autoDetectDataSplit 自动检测数据分片类型
-func autoDetectDataSplit() string {
-	if files, err := ioutil.ReadDir("../../data/vertical"); err == nil && len(files) > 0 {
-		for _, f := range files {
-			if strings.HasPrefix(f.Name(), "train_split_") && strings.HasSuffix(f.Name(), "_images.csv") {
-				return "vertical"
-			}
-		}
-	}
-	if files, err := ioutil.ReadDir("../../data/horizontal"); err == nil && len(files) > 0 {
-		for _, f := range files {
-			if strings.HasPrefix(f.Name(), "train_split_") && strings.HasSuffix(f.Name(), "_images.csv") {
-				return "horizontal"
+func autoDetectDataSplit(root string) string {
+	for _, dataSplit := range []string{"vertical", "horizontal"} {
+		if files, err := ioutil.ReadDir(filepath.Join(root, dataSplit)); err == nil && len(files) > 0 {
+			for _, f := range files {
+				if strings.HasPrefix(f.Name(), "train_split_") && strings.HasSuffix(f.Name(), "_images.csv") {
+					return dataSplit
+				}
 			}
 		}
 	}
@@ -151,27 +228,48 @@ func autoDetectDataSplit() string {
 
 // Register 注册到协调器并启动P2P服务器
 func (p *Participant) Register(coordinatorURL string) error {
-	// 1. 自动检测数据集划分方式
-	dataSplit := autoDetectDataSplit()
-	if dataSplit == "" {
-		return fmt.Errorf("未找到本地分片文件，无法注册")
-	}
-	p.DataSplit = dataSplit
-	shardID := getLocalShardID(dataSplit)
-	if shardID == "" {
-		return fmt.Errorf("未找到本地分片文件，无法注册")
+	// 1. 未指定分片时自动检测数据集划分方式和分片ID
+	if p.ShardID == "" {
+		dataSplit := autoDetectDataSplit(p.dataDir())
+		if dataSplit == "" {
+			return fmt.Errorf("未找到本地分片文件，无法注册")
+		}
+		p.DataSplit = dataSplit
+		p.ShardID = getLocalShardID(p.dataDir(), dataSplit)
+		if p.ShardID == "" {
+			return fmt.Errorf("未找到本地分片文件，无法注册")
+		}
 	}
+	shardID := p.ShardID
 	// 2. 创建协调器客户端
 	p.CoordinatorClient = coordinator.NewCoordinatorClient(coordinatorURL, p.Client)
-	// 3. 注册获取ID
-	regResp, err := p.CoordinatorClient.Register(shardID)
+	// 3. 载入（首次启动时生成）身份，注册获取ID
+	if err := p.loadIdentity(shardID); err != nil {
+		return err
+	}
+	regResp, err := p.CoordinatorClient.Register(shardID, p.Identity)
 	if err != nil {
 		return fmt.Errorf("注册失败: %v", err)
 	}
+	coordinatorKey, err := identity.ParsePublicKey(regResp.CoordinatorPublicKey)
+	if err != nil {
+		return fmt.Errorf("解析协调器身份公钥失败: %v", err)
+	}
+	p.PeerKeys.Set(identity.CoordinatorID, coordinatorKey)
 	p.ID = regResp.ParticipantID
+	p.Client.SetSigner(p.Identity, p.ID)
+	if err := p.enableRelay(); err != nil {
+		return err
+	}
+	p.SessionID = regResp.SessionID
+	p.CRSCommitment = regResp.CRSCommitment
+	p.CRSContribution = regResp.CRSContribution
+	p.Candidate = regResp.KeyGenerated && !regResp.Member
 
 	// 4. 设置端口
-	p.Port = 8081 // 使用固定端口8081，因为不同机器上运行
+	if p.Port == 0 {
+		p.Port = 8081 // 默认使用固定端口8081，因为不同机器上运行
+	}
 
 	// 5. 创建P2P网络管理器
 	p.PeerManager = network.NewPeerManager()
@@ -187,10 +285,15 @@ func (p *Participant) Register(coordinatorURL string) error {
 	// 8. 等待服务器启动
 	time.Sleep(1 * time.Second)
 
-	// 9. 向协调器上报自己的URL
-	if err := p.PeerManager.ReportURL(coordinatorURL, p.Client, p.ID, p.Port); err != nil {
+	// 9. 向协调器上报自己的URL和中继公钥，并保持中继连接
+	selfInfo, err := p.selfPeerInfo()
+	if err != nil {
+		return err
+	}
+	if err := p.PeerManager.ReportURL(coordinatorURL, p.Client, selfInfo); err != nil {
 		return fmt.Errorf("上报URL失败: %v", err)
 	}
+	p.startRelay()
 
 	// 10. 获取其他参与方的URL
 	if err := p.PeerManager.DiscoverPeers(coordinatorURL, p.Client, p.ID); err != nil {
@@ -200,8 +303,8 @@ func (p *Participant) Register(coordinatorURL string) error {
 	// 11. 启动心跳机制
 	p.HeartbeatManager.Start()
 
-	// 12. 启动在线状态监控
-	p.HeartbeatManager.StartOnlineStatusMonitor()
+	// 12. 启动在线状态监控，在线列表由协调器推送
+	p.HeartbeatManager.StartOnlineStatusMonitor(p.CoordinatorClient.Events)
 
 	// 13. 发送初始心跳，确保自己能被识别为在线
 	if err := p.HeartbeatManager.SendInitialHeartbeat(); err != nil {
@@ -242,25 +345,49 @@ func (p *Participant) UpdateOnlineParticipants() error {
 
 	// 统计在线参与方数量（onlineParticipants已经包含所有在线参与方）
 	totalOnline := len(onlineParticipants)
-	fmt.Printf("当前在线参与方: %d 个 (包括自己)\n", totalOnline)
-	fmt.Printf("  参与方 %d: %s (自己)\n", p.ID, p.HTTPServer.GetLocalIP())
+	logs.Printf("当前在线参与方: %d 个 (包括自己)\n", totalOnline)
+	logs.Printf("  参与方 %d: %s (自己)\n", p.ID, p.HTTPServer.GetLocalIP())
 	for id, url := range onlineParticipants {
 		if id != p.ID { // 只显示其他参与方
-			fmt.Printf("  参与方 %d: %s\n", id, url)
+			logs.Printf("  参与方 %d: %s\n", id, url)
 		}
 	}
 
 	return nil
 }
 
+// SetTLS 启用mTLS：P2P服务只接受会话CA签发的证书，访问协调器和其他参与方时出示本方证书
+func (p *Participant) SetTLS(cfg *pki.Config) {
+	p.TLS = cfg
+	if cfg != nil {
+		p.Client.Client.Transport = cfg.Transport()
+	}
+}
+
+// SelfURL 返回本方P2P服务的URL
+func (p *Participant) SelfURL() (string, error) {
+	host := p.Host
+	if host == "" {
+		// 使用正确的IP获取函数，优先查找Radmin VPN接口
+		localIP, err := utils.GetLocalIP()
+		if err != nil {
+			return "", fmt.Errorf("获取本机IP失败: %v", err)
+		}
+		host = localIP
+	}
+	return fmt.Sprintf("%s://%s:%d", p.TLS.Scheme(), host, p.Port), nil
+}
+
 // startHTTPServer 启动HTTP服务器
 func (p *Participant) startHTTPServer() error {
 	// 创建HTTP处理器
-	handlers := server.NewHandlers(p.KeyManager, p.DecryptionService, p.RefreshService)
+	handlers := server.NewHandlers(p.KeyManager, p.DecryptionService, p.RefreshService, p.CoordinatorClient, p)
 	handlerMap := handlers.GetHandlers()
+	handlerMap["/keys/galois/round"] = p.handleGaloisRound
+	handlerMap["/keys/rotation"] = p.handleKeyRotation
 
 	// 创建HTTP服务器
-	p.HTTPServer = server.NewHTTPServer(p.Port, handlerMap, p)
+	p.HTTPServer = server.NewHTTPServer(p.Port, handlerMap, p, identity.NewVerifier(p.lookupPeerKey), p.TLS)
 
 	// 启动服务器
 	return p.HTTPServer.Start()
@@ -310,17 +437,19 @@ func (p *Participant) RunMainLoop() {
 	// 进入菜单模式，启用静默模式
 	p.SetSilentMode(true)
 	for {
-		fmt.Println("\n请选择操作：")
-		fmt.Println("1. 发起协同解密请求")
-		fmt.Println("2. 发起协同刷新请求")
-		fmt.Println("3. 查看在线状态")
-		fmt.Println("4. 退出")
-		fmt.Print("输入选项: ")
+		logs.Println("\n请选择操作：")
+		logs.Println("1. 发起协同解密请求")
+		logs.Println("2. 发起协同刷新请求")
+		logs.Println("3. 查看在线状态")
+		logs.Println("4. 交付测试数据给结果接收方")
+		logs.Println("5. 审批解密任务")
+		logs.Println("6. 退出")
+		logs.Print("输入选项: ")
 
 		var choice int
 		_, err := fmt.Scan(&choice)
 		if err != nil {
-			fmt.Println("输入无效，请重新输入。")
+			logs.Println("输入无效，请重新输入。")
 			continue
 		}
 
@@ -328,40 +457,61 @@ func (p *Participant) RunMainLoop() {
 		case 1:
 			// 先检查在线状态
 			if err := p.CheckOnlineStatusBeforeOperation(); err != nil {
-				fmt.Println("[错误] 在线状态检查失败:", err)
+				logs.Println("[错误] 在线状态检查失败:", err)
 				continue
 			}
 			// 发起协同解密请求
 			if err := p.RequestCollaborativeDecrypt(); err != nil {
-				fmt.Printf("[错误] 协同解密失败: %v\n", err)
+				logs.Printf("[错误] 协同解密失败: %v\n", err)
 			}
 			continue
 		case 2:
 			// 先检查在线状态
 			if err := p.CheckOnlineStatusBeforeOperation(); err != nil {
-				fmt.Println("[错误] 在线状态检查失败:", err)
+				logs.Println("[错误] 在线状态检查失败:", err)
 				continue
 			}
 			// 发起协同刷新请求
 			if err := p.RequestCollaborativeRefresh(); err != nil {
-				fmt.Printf("[错误] 协同刷新失败: %v\n", err)
+				logs.Printf("[错误] 协同刷新失败: %v\n", err)
 			}
 			continue
 		case 3:
 			// 临时禁用静默模式以显示状态
 			p.SetSilentMode(false)
 			if err := p.ShowOnlineStatus(); err != nil {
-				fmt.Println("[错误] 获取在线状态失败:", err)
+				logs.Println("[错误] 获取在线状态失败:", err)
 			}
 			// 重新启用静默模式
 			p.SetSilentMode(true)
 			continue
 		case 4:
-			fmt.Println("退出程序。")
-			p.StopHeartbeat()
+			var consumerID string
+			logs.Print("输入接收方ID: ")
+			if _, err := fmt.Scan(&consumerID); err != nil {
+				logs.Println("输入无效，请重新输入。")
+				continue
+			}
+			if err := p.CheckOnlineStatusBeforeOperation(); err != nil {
+				logs.Println("[错误] 在线状态检查失败:", err)
+				continue
+			}
+			values := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+			logs.Printf("交付明文: %v\n", values)
+			if _, err := p.DeliverToConsumer(consumerID, values); err != nil {
+				logs.Printf("[错误] 交付失败: %v\n", err)
+			}
+			continue
+		case 5:
+			if err := p.ReviewPendingTasks(); err != nil {
+				logs.Printf("[错误] 审批解密任务失败: %v\n", err)
+			}
+			continue
+		case 6:
+			logs.Println("退出程序。")
 			return
 		default:
-			fmt.Println("无效选项，请重新输入。")
+			logs.Println("无效选项，请重新输入。")
 		}
 	}
 }
@@ -401,25 +551,38 @@ func (p *Participant) GenerateAllCRPs(paramsResp *types.ParamsResponse) error {
 	}
 
 	// 使用统一种子创建PRNG
-	crs, err := sampling.NewKeyedPRNG(commonCRSSeedBytes)
+	prng, err := sampling.NewKeyedPRNG(commonCRSSeedBytes)
 	if err != nil {
 		return fmt.Errorf("使用统一种子创建PRNG失败: %v", err)
 	}
 
 	// 生成公钥CRP
 	pubKeyProto := multiparty.NewPublicKeyGenProtocol(params)
-	pubKeyCRP := pubKeyProto.SampleCRP(crs)
+	pubKeyCRP := pubKeyProto.SampleCRP(prng)
 	pubKeyCRPRaw, err := utils.EncodeShare(pubKeyCRP)
 	if err != nil {
 		return fmt.Errorf("编码公钥CRP失败: %v", err)
 	}
 	paramsResp.Crp = utils.EncodeToBase64(pubKeyCRPRaw)
 
-	// 使用协调器传输的伽罗瓦元素（避免重复生成）
-	galoisProto := multiparty.NewGaloisKeyGenProtocol(params)
+	// 生成重线性化密钥CRP
+	rlkProto := multiparty.NewRelinearizationKeyGenProtocol(params)
+	rlkCRP := rlkProto.SampleCRP(prng)
+	rlkCRPRaw, err := utils.EncodeShare(rlkCRP)
+	if err != nil {
+		return fmt.Errorf("编码重线性化CRP失败: %v", err)
+	}
+	paramsResp.RlkCRP = utils.EncodeToBase64(rlkCRPRaw)
+
+	// 使用协调器传输的伽罗瓦元素，每个元素的CRP由会话种子独立派生
+	p.sessionSeed = commonCRSSeedBytes
+	p.keySeed = commonCRSSeedBytes
 	galoisCRPs := make(map[uint64]string)
 	for _, galEl := range paramsResp.GalEls {
-		galoisCRP := galoisProto.SampleCRP(crs)
+		galoisCRP, err := sampleGaloisCRP(params, commonCRSSeedBytes, galEl)
+		if err != nil {
+			return err
+		}
 		crpRaw, err := utils.EncodeShare(galoisCRP)
 		if err != nil {
 			return fmt.Errorf("编码伽罗瓦CRP失败: %v", err)
@@ -428,26 +591,20 @@ func (p *Participant) GenerateAllCRPs(paramsResp *types.ParamsResponse) error {
 	}
 	paramsResp.GaloisCRPs = galoisCRPs
 
-	// 生成重线性化密钥CRP
-	rlkProto := multiparty.NewRelinearizationKeyGenProtocol(params)
-	rlkCRP := rlkProto.SampleCRP(crs)
-	rlkCRPRaw, err := utils.EncodeShare(rlkCRP)
-	if err != nil {
-		return fmt.Errorf("编码重线性化CRP失败: %v", err)
-	}
-	paramsResp.RlkCRP = utils.EncodeToBase64(rlkCRPRaw)
-
-	// 生成刷新CRS
-	refreshCRSSeed := []byte("refresh_crs_seed_32_bytes_long")
+	// 生成刷新CRS，由会话种子派生
+	refreshCRSSeed := crs.DeriveLabeled(commonCRSSeedBytes, "refresh")
 	paramsResp.RefreshCRS = utils.EncodeToBase64(refreshCRSSeed)
 
-	fmt.Printf("参与方 %d 生成了所有CRP：公钥CRP、%d个伽罗瓦CRP、重线性化CRP、刷新CRS\n", p.ID, len(galoisCRPs))
+	logs.Printf("参与方 %d 生成了所有CRP：公钥CRP、%d个伽罗瓦CRP、重线性化CRP、刷新CRS\n", p.ID, len(galoisCRPs))
 	return nil
 }
 
 // Unregister 注销参与方
 func (p *Participant) Unregister() error {
-	shardID := getLocalShardID(p.DataSplit)
+	shardID := p.ShardID
+	if shardID == "" {
+		shardID = getLocalShardID(p.dataDir(), p.DataSplit)
+	}
 	if shardID == "" {
 		return fmt.Errorf("未找到本地分片文件，无法注销")
 	}
@@ -458,6 +615,6 @@ func (p *Participant) Unregister() error {
 type DataMessage struct {
 	Type      string   `json:"type"` // "feature", "label", "done", "input_done", "output_done"
 	From      int      `json:"from"`
-	Data      string   `json:"data,omitempty"`       // base64编码的密文
-	BatchData []string `json:"batch_data,omitempty"` // base64编码的密文批次
+	Data      string   `json:"data,omitempty"` // base64编码的密文
+	BatchData [][]byte `json:"-"`              // 密文信封批次，作为消息的对象帧传输
 }
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/relay"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ==================== 中继 ====================
+//
+// 参与方与协调器保持一条中继连接，其他参与方和协调器连接不上本方P2P服务时经协调器转发请求；
+// 本方访问其他参与方时同样先直连，连接不上再经中继（-relay auto）。位于NAT之后、确定无法被直接
+// 访问的参与方使用 -relay always，上报 relay://participant-{ID} 作为URL，其他参与方直接经中继访问。
+
+// relayRetryInterval 中继连接断开或建立失败后重新连接的间隔
+const relayRetryInterval = 5 * time.Second
+
+// enableRelay 派生中继密钥并包装访问其他参与方的传输层，重试注册时只包装一次
+func (p *Participant) enableRelay() error {
+	if p.Relay != relay.ModeOff && p.relayKey == nil {
+		key, err := relay.DeriveKey(p.Identity.Seed())
+		if err != nil {
+			return err
+		}
+		p.relayKey = key
+	}
+	if _, ok := p.Client.Client.Transport.(*relay.Transport); ok {
+		return nil
+	}
+	p.Client.Client.Transport = &relay.Transport{
+		Direct:  relay.DirectTransport(p.Client.Client.Transport),
+		Mode:    p.Relay,
+		Lookup:  p.peerByHost,
+		PeerKey: p.relayPeerKey,
+		Forward: func(ctx context.Context, to int, sealed []byte) ([]byte, error) {
+			return p.CoordinatorClient.RelayForward(ctx, to, sealed)
+		},
+	}
+	return nil
+}
+
+// selfPeerInfo 上报给协调器的URL和中继公钥
+func (p *Participant) selfPeerInfo() (types.PeerInfo, error) {
+	info := types.PeerInfo{ID: p.ID}
+	if p.Relay == relay.ModeAlways {
+		info.URL = relay.Address(p.ID)
+	} else {
+		myURL, err := p.SelfURL()
+		if err != nil {
+			return info, err
+		}
+		info.URL = myURL
+	}
+	if p.relayKey != nil {
+		info.RelayKey = p.relayKey.PublicKeyBase64()
+		info.RelayKeySignature = p.relayKey.Sign(p.Identity, p.ID)
+	}
+	return info, nil
+}
+
+// startRelay 在后台保持中继连接，处理经协调器转发来的请求，参与方关闭时退出
+func (p *Participant) startRelay() {
+	if p.relayKey == nil {
+		return
+	}
+	p.relayOnce.Do(func() {
+		var tlsConfig *tls.Config
+		if p.TLS != nil {
+			tlsConfig = p.TLS.ClientTLS()
+		}
+		p.goBackground(func() {
+			connected := true // 只在状态变化时输出日志
+			for p.ctx.Err() == nil {
+				ws, err := p.CoordinatorClient.RelayDial(p.ctx, tlsConfig)
+				if err != nil {
+					if connected {
+						logs.Printf("[中继] 连接协调器中继失败: %v，%v 后重试\n", err, relayRetryInterval)
+						connected = false
+					}
+				} else {
+					connected = true
+					logs.Println("[中继] 已连接协调器中继")
+					err = relay.Serve(p.ctx, ws, p.relayKey, p.HTTPServer.Server.Handler)
+					if p.ctx.Err() == nil {
+						logs.Printf("[中继] 中继连接断开: %v\n", err)
+					}
+				}
+				if !p.sleepOrDone(relayRetryInterval) {
+					return
+				}
+			}
+		})
+	})
+}
+
+// relayPeerKey 其他参与方已核对签名的中继公钥，本地没有时从协调器刷新
+func (p *Participant) relayPeerKey(id int) ([]byte, error) {
+	if key, ok := p.cachedRelayKey(id); ok {
+		return key, nil
+	}
+	p.refreshRelayKeys()
+	if key, ok := p.cachedRelayKey(id); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("参与方 %d 未启用中继", id)
+}
+
+// peerByHost 在已发现和在线的参与方中查找上报该地址的参与方，多个参与方上报相同地址时不中继
+func (p *Participant) peerByHost(host string) (int, bool) {
+	urls := make(map[int]string)
+	if p.PeerManager != nil {
+		for id, u := range p.PeerManager.GetPeers() {
+			urls[id] = u
+		}
+	}
+	if p.HeartbeatManager != nil {
+		for id, u := range p.HeartbeatManager.GetOnlinePeers() {
+			urls[id] = u
+		}
+	}
+	found, matches := 0, 0
+	for id, u := range urls {
+		if parsed, err := url.Parse(u); err == nil && parsed.Host == host {
+			found = id
+			matches++
+		}
+	}
+	return found, matches == 1
+}
+
+func (p *Participant) cachedRelayKey(id int) ([]byte, bool) {
+	p.relayMu.Lock()
+	defer p.relayMu.Unlock()
+	key, ok := p.relayKeys[id]
+	return key, ok
+}
+
+// refreshRelayKeys 从协调器的参与方列表获取中继公钥，用身份公钥核对签名后缓存
+func (p *Participant) refreshRelayKeys() {
+	if p.CoordinatorClient == nil {
+		return
+	}
+	peers, err := p.CoordinatorClient.GetParticipantsList()
+	if err != nil {
+		logs.Printf("[中继] 获取参与方中继公钥失败: %v\n", err)
+		return
+	}
+	for _, peer := range peers {
+		if peer.RelayKey == "" {
+			continue
+		}
+		pub, ok := p.lookupPeerKey(peer.ID)
+		if !ok {
+			continue
+		}
+		key, err := relay.VerifyKey(pub, peer.ID, peer.RelayKey, peer.RelayKeySignature)
+		if err != nil {
+			logs.Printf("[中继] %v\n", err)
+			continue
+		}
+		p.relayMu.Lock()
+		p.relayKeys[peer.ID] = key
+		p.relayMu.Unlock()
+	}
+}
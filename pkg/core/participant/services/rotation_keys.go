@@ -0,0 +1,133 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/crs"
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+	"github.com/tuneinsight/lattigo/v6/utils/sampling"
+)
+
+// galoisRoundTimeout 等待追加轮次的伽罗瓦密钥全部聚合的最长时间
+const galoisRoundTimeout = 10 * time.Minute
+
+// sampleGaloisCRP 由密钥纪元的种子派生单个伽罗瓦元素的CRP，与协调器的计算方式一致
+func sampleGaloisCRP(params ckks.Parameters, seed []byte, galEl uint64) (multiparty.GaloisKeyGenCRP, error) {
+	prng, err := sampling.NewKeyedPRNG(crs.GaloisSeed(seed, galEl))
+	if err != nil {
+		return multiparty.GaloisKeyGenCRP{}, fmt.Errorf("创建伽罗瓦CRP的PRNG失败: %v", err)
+	}
+	return multiparty.NewGaloisKeyGenProtocol(params).SampleCRP(prng), nil
+}
+
+// handleGaloisRound 接收协调器追加旋转密钥的通知，在后台生成并上传份额
+func (p *Participant) handleGaloisRound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var notice types.GaloisRoundNotice
+	if err := json.NewDecoder(r.Body).Decode(&notice); err != nil {
+		http.Error(w, "请求解析失败", http.StatusBadRequest)
+		return
+	}
+	if notice.SessionID != p.SessionID {
+		http.Error(w, fmt.Sprintf("会话ID不一致: %s", notice.SessionID), http.StatusConflict)
+		return
+	}
+	if p.KeyManager.GetSecretKey() == nil || p.keySeed == nil {
+		http.Error(w, "密钥未准备就绪", http.StatusServiceUnavailable)
+		return
+	}
+
+	logs.Printf("[旋转密钥] 收到第 %d 轮通知，需要生成 %d 个伽罗瓦密钥份额\n", notice.Round, len(notice.GalEls))
+	p.goBackground(func() {
+		p.runGaloisRound(notice)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "accepted",
+		"round":  notice.Round,
+	})
+}
+
+// runGaloisRound 生成并上传份额，等待聚合完成后更新本地伽罗瓦密钥
+func (p *Participant) runGaloisRound(notice types.GaloisRoundNotice) {
+	p.galoisRoundMu.Lock()
+	defer p.galoisRoundMu.Unlock()
+
+	if err := p.UploadGaloisKeyShares(notice.GalEls); err != nil {
+		logs.Printf("[旋转密钥] 第 %d 轮份额上传失败: %v\n", notice.Round, err)
+		return
+	}
+	logs.Printf("[旋转密钥] 第 %d 轮份额上传完成，等待聚合...\n", notice.Round)
+
+	if err := p.SyncGaloisKeys(); err != nil {
+		logs.Printf("[旋转密钥] 第 %d 轮密钥同步失败: %v\n", notice.Round, err)
+		return
+	}
+	logs.Printf("[旋转密钥] 第 %d 轮完成，本地共 %d 个伽罗瓦密钥\n", notice.Round, len(p.KeyManager.GetGaloisKeys()))
+	if err := p.SaveKeystore(); err != nil {
+		logs.Printf("[旋转密钥] 保存密钥库失败: %v\n", err)
+	}
+}
+
+// UploadGaloisKeyShares 为指定伽罗瓦元素生成密钥份额并上传到协调器
+func (p *Participant) UploadGaloisKeyShares(galEls []uint64) error {
+	params := p.KeyManager.GetParams()
+	sk := p.KeyManager.GetSecretKey()
+	if sk == nil {
+		return fmt.Errorf("私钥未生成")
+	}
+
+	proto := multiparty.NewGaloisKeyGenProtocol(params)
+	for _, galEl := range galEls {
+		crp, err := sampleGaloisCRP(params, p.keySeed, galEl)
+		if err != nil {
+			return err
+		}
+		share := proto.AllocateShare()
+		if err := proto.GenShare(sk, galEl, crp, &share); err != nil {
+			return fmt.Errorf("生成伽罗瓦密钥份额失败 (galEl: %d): %v", galEl, err)
+		}
+		shareData, err := share.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("编码伽罗瓦密钥份额失败 (galEl: %d): %v", galEl, err)
+		}
+		if err := p.CoordinatorClient.UploadGaloisKeyShare(galEl, shareData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncGaloisKeys 等待协调器聚合出全部伽罗瓦密钥，然后下载并替换本地伽罗瓦密钥
+func (p *Participant) SyncGaloisKeys() error {
+	ctx, cancel := context.WithTimeout(p.ctx, galoisRoundTimeout)
+	defer cancel()
+	if _, err := p.CoordinatorClient.WaitForStatus(ctx, func(status *types.StatusResponse) bool {
+		return status.GaloisKeysReady == status.TotalGaloisKeys
+	}); err != nil {
+		if p.ctx.Err() != nil {
+			return fmt.Errorf("参与方正在关闭")
+		}
+		return fmt.Errorf("等待伽罗瓦密钥聚合超时")
+	}
+
+	keys, err := p.CoordinatorClient.GetAggregatedKeys()
+	if err != nil {
+		return fmt.Errorf("获取聚合密钥失败: %v", err)
+	}
+	p.KeyManager.SetGaloisKeys(keys.GaloisKeys)
+	return nil
+}
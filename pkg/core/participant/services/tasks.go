@@ -0,0 +1,218 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"MPHEDev/pkg/core/participant/utils"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+)
+
+// 等待解密任务批准的配置
+const (
+	taskApprovalTimeout  = 5 * time.Minute
+	taskApprovalInterval = 2 * time.Second
+)
+
+// AuthorizeTask 向协调器提议解密任务并等待按授权策略批准，返回任务ID
+// consumerID 仅公钥切换任务需要
+func (p *Participant) AuthorizeTask(kind, purpose, consumerID string, ct *rlwe.Ciphertext) (string, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, taskApprovalTimeout)
+	defer cancel()
+	return p.AuthorizeTaskContext(ctx, kind, purpose, consumerID, ct)
+}
+
+// AuthorizeTaskContext 与 AuthorizeTask 相同，等待批准直到 ctx 取消或超时
+func (p *Participant) AuthorizeTaskContext(ctx context.Context, kind, purpose, consumerID string, ct *rlwe.Ciphertext) (string, error) {
+	hash, err := utils.CiphertextHash(ct)
+	if err != nil {
+		return "", fmt.Errorf("计算密文哈希失败: %v", err)
+	}
+	task, err := p.CoordinatorClient.ProposeTask(kind, purpose, hash, consumerID)
+	if err != nil {
+		return "", err
+	}
+	logs.Printf("已提议解密任务 %s（%s），等待其他参与方批准...\n", task.ID, purpose)
+
+	for {
+		switch task.Status {
+		case "approved":
+			logs.Printf("解密任务 %s 已批准（批准方 %v）\n", task.ID, task.Approvals)
+			return task.ID, nil
+		case "rejected":
+			return "", fmt.Errorf("任务 %s 被拒绝（拒绝方 %v）", task.ID, task.Rejections)
+		}
+
+		timer := time.NewTimer(taskApprovalInterval)
+		select {
+		case <-timer.C:
+		case <-p.ctx.Done():
+			timer.Stop()
+			return "", fmt.Errorf("参与方正在关闭")
+		case <-ctx.Done():
+			timer.Stop()
+			return "", fmt.Errorf("任务 %s 未在期限内获批准: %v", task.ID, ctx.Err())
+		}
+		if task, err = p.CoordinatorClient.GetTask(task.ID); err != nil {
+			return "", err
+		}
+	}
+}
+
+// ==================== 本方同意的授权策略 ====================
+//
+// 协调器上的授权策略只有经参与方表决批准才能修改，但批准数未必包括本方。参与方记录自己同意的策略：
+// 加入会话时采用协调器的当前策略并保存到密钥库，之后只有本方批准的策略变更才更新记录。
+// 提供份额前按记录的策略核对任务（见 server.checkTask），拒绝按本方未同意的更宽松策略批准的任务。
+
+// SyncTaskPolicy 确定本方同意的授权策略：密钥库中已有记录时沿用，否则采用协调器的当前策略
+func (p *Participant) SyncTaskPolicy() error {
+	if ks := p.keystore; ks != nil && ks.AgreedApprovals > 0 {
+		p.setAgreedPolicy(types.TaskPolicy{RequiredApprovals: ks.AgreedApprovals, TaskTTLSeconds: ks.AgreedTaskTTLSeconds})
+		return nil
+	}
+	policy, err := p.CoordinatorClient.GetPolicy()
+	if err != nil {
+		return err
+	}
+	p.setAgreedPolicy(*policy)
+	return nil
+}
+
+// AgreedPolicy 本方同意的授权策略，尚未确定时返回 false
+func (p *Participant) AgreedPolicy() (types.TaskPolicy, bool) {
+	p.agreedPolicyMu.RLock()
+	defer p.agreedPolicyMu.RUnlock()
+	if p.agreedPolicy == nil {
+		return types.TaskPolicy{}, false
+	}
+	return *p.agreedPolicy, true
+}
+
+// setAgreedPolicy 记录本方同意的授权策略
+func (p *Participant) setAgreedPolicy(policy types.TaskPolicy) {
+	p.agreedPolicyMu.Lock()
+	p.agreedPolicy = &policy
+	p.agreedPolicyMu.Unlock()
+	logs.Printf("本方同意的解密授权策略: 需要 %d 个参与方批准，任务有效期 %d 秒\n", policy.RequiredApprovals, policy.TaskTTLSeconds)
+}
+
+// ReviewPendingTasks 列出待批准的解密任务和变更，逐个询问是否批准
+func (p *Participant) ReviewPendingTasks() error {
+	pending, policy, err := p.CoordinatorClient.ListTasks("pending")
+	if err != nil {
+		return err
+	}
+
+	reviewed := 0
+	for _, task := range pending {
+		if task.ProposerID == p.ID || containsID(task.Approvals, p.ID) || containsID(task.Rejections, p.ID) {
+			continue
+		}
+		reviewed++
+		printTask(task, policy)
+
+		var answer string
+		logs.Print("批准该任务? (y=批准 / n=拒绝 / 其他=跳过): ")
+		if _, err := fmt.Scan(&answer); err != nil {
+			return err
+		}
+		if answer != "y" && answer != "n" {
+			continue
+		}
+		updated, err := p.CoordinatorClient.VoteTask(task.ID, answer == "y")
+		if err != nil {
+			logs.Printf("[错误] 表决失败: %v\n", err)
+			continue
+		}
+		logs.Printf("任务 %s 当前状态: %s\n", updated.ID, updated.Status)
+		// 批准策略变更即同意新策略
+		if answer == "y" && task.Kind == "policy" && task.Policy != nil {
+			p.setAgreedPolicy(*task.Policy)
+			if err := p.SaveKeystore(); err != nil {
+				logs.Printf("[警告] 保存密钥库失败，重启后将沿用之前同意的授权策略: %v\n", err)
+			}
+		}
+	}
+	if reviewed == 0 {
+		logs.Println("没有需要审批的解密任务")
+	}
+	return nil
+}
+
+// StartAutoApprove 在后台定期批准其他参与方提议的解密任务，用于脚本和测试环境中无人值守的参与方
+// purposes 不为空时只批准用途在其中的任务，其余任务留给人工审批；控制面提议的变更总是留给人工审批
+func (p *Participant) StartAutoApprove(purposes []string) {
+	p.goBackground(func() {
+		for p.sleepOrDone(taskApprovalInterval) {
+			pending, _, err := p.CoordinatorClient.ListTasks("pending")
+			if err != nil {
+				continue
+			}
+			for _, task := range pending {
+				if task.IsChange() || task.ProposerID == p.ID || containsID(task.Approvals, p.ID) || containsID(task.Rejections, p.ID) {
+					continue
+				}
+				if len(purposes) > 0 && !containsString(purposes, task.Purpose) {
+					continue
+				}
+				if _, err := p.CoordinatorClient.VoteTask(task.ID, true); err != nil {
+					logs.Printf("[警告] 自动批准任务 %s 失败: %v\n", task.ID, err)
+					continue
+				}
+				logs.Printf("已自动批准任务 %s（%s，提议方 %d）\n", task.ID, task.Purpose, task.ProposerID)
+			}
+		}
+	})
+}
+
+// printTask 打印待审批任务
+func printTask(task types.TaskInfo, policy *types.TaskPolicy) {
+	logs.Printf("\n任务 %s\n", task.ID)
+	logs.Printf("  类型: %s  用途: %s\n", task.Kind, task.Purpose)
+	if task.ConsumerID != "" {
+		logs.Printf("  接收方: %s  公钥指纹: %s\n", task.ConsumerID, task.ConsumerKey)
+	}
+	switch {
+	case task.Policy != nil:
+		logs.Printf("  提议方: 控制面  授权策略: 从需要 %d 个批准、有效期 %d 秒改为需要 %d 个批准、有效期 %d 秒\n",
+			policy.RequiredApprovals, policy.TaskTTLSeconds, task.Policy.RequiredApprovals, task.Policy.TaskTTLSeconds)
+	case task.Kind == "outputs":
+		logs.Printf("  提议方: 控制面  计算: %s  输出密文哈希:\n", task.Computation)
+		for _, h := range task.CiphertextHashes {
+			logs.Printf("    %s\n", h)
+		}
+	case task.Kind == "members":
+		logs.Printf("  提议方: 控制面  加入集体密钥的候选成员: %v\n", task.ParticipantIDs)
+	case task.Kind == "galois":
+		logs.Printf("  提议方: 控制面  追加的旋转密钥: %s\n", task.Galois)
+	case task.IsChange():
+		logs.Printf("  提议方: 控制面\n")
+	default:
+		logs.Printf("  提议方: 参与方 %d  密文哈希: %s\n", task.ProposerID, task.CiphertextHash)
+	}
+	logs.Printf("  已批准: %v（需要 %d 个）  有效期至: %s\n", task.Approvals, policy.RequiredApprovals, task.ExpiresAt)
+}
+
+// containsString 判断切片中是否包含s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsID 判断切片中是否包含id
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
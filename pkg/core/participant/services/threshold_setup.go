@@ -0,0 +1,115 @@
+package services
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/participant/types"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v6/multiparty"
+)
+
+// thresholdSetupTimeout 门限份额交换的最长等待时间
+const thresholdSetupTimeout = 10 * time.Minute
+
+// SetupThresholdKey 在密钥生成阶段与其他参与方交换Shamir份额
+// 需要在本地私钥生成之后调用，非门限模式下直接返回
+func (p *Participant) SetupThresholdKey() error {
+	if !p.KeyManager.IsThresholdMode() {
+		return nil
+	}
+	expectedN := p.KeyManager.ExpectedN
+	deadline := time.Now().Add(thresholdSetupTimeout)
+
+	// 1. 等待全部N个参与方上报URL
+	logs.Printf("[门限] 等待 %d 个参与方全部上线以交换Shamir份额...\n", expectedN)
+	var peers []types.PeerInfo
+	for {
+		list, err := p.CoordinatorClient.GetParticipantsList()
+		if err == nil && len(list) >= expectedN {
+			peers = list
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待参与方上线超时: %d/%d", len(list), expectedN)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+
+	ids := make([]int, 0, len(peers))
+	for _, peer := range peers {
+		ids = append(ids, peer.ID)
+	}
+
+	// 2. 生成发给每个参与方的份额
+	shares, err := p.KeyManager.GenerateThresholdShares(ids)
+	if err != nil {
+		return err
+	}
+
+	// 3. 开始接受这N个参与方的份额，自己的份额直接保存，其他份额点对点发送
+	if err := p.KeyManager.BeginThresholdShares(ids); err != nil {
+		return err
+	}
+	if err := p.KeyManager.AddThresholdShare(p.ID, p.ID, shares[p.ID]); err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		if peer.ID == p.ID {
+			continue
+		}
+		msg := types.ThresholdShareMessage{
+			From: p.ID,
+			To:   peer.ID,
+		}
+		if err := p.sendThresholdShare(peer.URL, msg, shares[peer.ID], deadline); err != nil {
+			return fmt.Errorf("向参与方 %d 发送门限份额失败: %v", peer.ID, err)
+		}
+		logs.Printf("[门限] 已向参与方 %d 发送Shamir份额\n", peer.ID)
+	}
+
+	// 4. 等待收齐其他参与方的份额
+	for p.KeyManager.ReceivedThresholdShareCount() < expectedN {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("等待门限份额超时: %d/%d", p.KeyManager.ReceivedThresholdShareCount(), expectedN)
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	// 5. 聚合得到本方门限份额
+	if err := p.KeyManager.FinalizeThresholdShare(); err != nil {
+		return err
+	}
+	logs.Printf("[门限] 门限份额准备就绪 (t=%d, N=%d)\n", p.KeyManager.Threshold, expectedN)
+	return nil
+}
+
+// sendThresholdShare 以帧格式发送门限份额，对端尚未启动时重试
+func (p *Participant) sendThresholdShare(peerURL string, msg types.ThresholdShareMessage, share multiparty.ShamirSecretShare, deadline time.Time) error {
+	data, err := share.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("序列化门限份额失败: %v", err)
+	}
+	for {
+		resp, err := p.Client.PostMessage(peerURL+"/threshold/share", msg, data)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("状态码 %d", resp.StatusCode)
+			// 对端拒绝份额（不是本次交换的成员、不是发给对端的、份额冲突或已聚合）时重试无意义
+			switch resp.StatusCode {
+			case http.StatusBadRequest, http.StatusForbidden, http.StatusConflict:
+				return err
+			}
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
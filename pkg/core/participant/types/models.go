@@ -1,6 +1,13 @@
 package types
 
 import (
+	"MPHEDev/pkg/core/identity"
+	"MPHEDev/pkg/core/smudging"
+	"MPHEDev/pkg/core/wire"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -11,18 +18,39 @@ import (
 
 // PeerInfo 参与方信息
 type PeerInfo struct {
-	ID  int    `json:"id"`
-	URL string `json:"url"`
+	ID        int    `json:"id"`
+	URL       string `json:"url"`
+	PublicKey string `json:"public_key,omitempty"` // base64编码的Ed25519身份公钥
+
+	// 中继公钥（X25519，base64）及身份私钥对其的签名，未启用中继时为空
+	RelayKey          string `json:"relay_key,omitempty"`
+	RelayKeySignature string `json:"relay_key_signature,omitempty"`
 }
 
 // RegisterRequest 注册请求
 type RegisterRequest struct {
-	ShardID string `json:"shard_id"`
+	ShardID   string `json:"shard_id"`
+	PublicKey string `json:"public_key"` // base64编码的Ed25519身份公钥
 }
 
 // RegisterResponse 注册响应
 type RegisterResponse struct {
-	ParticipantID int `json:"participant_id"`
+	ParticipantID        int `json:"participant_id"`
+	Threshold            int `json:"threshold"`             // 协同解密所需的最少参与方数量t
+	ExpectedParticipants int `json:"expected_participants"` // 参与密钥生成的参与方总数N
+
+	// 会话信息
+	SessionID       string `json:"session_id"`       // 会话ID
+	CRSCommitment   string `json:"crs_commitment"`   // 协调器CRS种子的承诺
+	CRSContribution bool   `json:"crs_contribution"` // 是否需要参与方贡献CRS种子
+
+	// 成员状态：初始密钥已生成且本方不是成员时，本方是等待加入集体密钥的候选成员
+	KeyGenerated    bool `json:"key_generated"`
+	Member          bool `json:"member"`
+	MembershipEpoch int  `json:"membership_epoch"`
+
+	// CoordinatorPublicKey 协调器会话签名公钥，用于验证协调器发来的请求
+	CoordinatorPublicKey string `json:"coordinator_public_key"`
 }
 
 // ParamsResponse 参数响应
@@ -32,6 +60,22 @@ type ParamsResponse struct {
 	GalEls        []uint64               `json:"gal_els"`
 	CommonCRSSeed string                 `json:"common_crs_seed"` // 统一的CRS种子
 	DataSplitType string                 `json:"data_split_type"` // 数据集划分方式
+	ParamProfile  string                 `json:"param_profile"`   // 参数配置档名称
+	SecurityBits  int                    `json:"security_bits"`   // 按HE标准估计的安全级别
+	Smudging      smudging.Config        `json:"smudging"`        // 解密和刷新的噪声淹没配置
+
+	// 门限配置
+	Threshold            int `json:"threshold"`
+	ExpectedParticipants int `json:"expected_participants"`
+
+	// InsecureDebug 协调器是否运行在调试模式，仅此时才上传私钥
+	InsecureDebug bool `json:"insecure_debug"`
+
+	// 会话ID及派生CRS种子的公开材料
+	SessionID          string         `json:"session_id"`
+	CRSCoordinatorSeed string         `json:"crs_coordinator_seed"` // base64
+	CRSContributions   map[int]string `json:"crs_contributions"`    // 参与方ID -> base64种子
+	CRSContributors    int            `json:"crs_contributors"`     // 需要贡献种子的参与方数量（初始成员数）
 
 	// 参与方生成的CRP（不通过JSON传输）
 	Crp        string            `json:"-"` // 公钥CRP
@@ -53,13 +97,91 @@ type StatusResponse struct {
 	RlkRound1Ready      bool `json:"rlk_round1_ready"`
 	RlkRound2Ready      bool `json:"rlk_round2_ready"`
 	RlkReady            bool `json:"rlk_ready"`
+	InsecureDebug       bool `json:"insecure_debug"`
+	KeysVerified        bool `json:"keys_verified"`
+	GaloisRound         int  `json:"galois_round"`
+
+	// 会话阶段，阶段设置了超时时 PhaseDeadline 为超时时间（RFC3339），进入 failed 时 PhaseError 为原因
+	Phase         string `json:"phase"`
+	PhaseSince    string `json:"phase_since"`
+	PhaseDeadline string `json:"phase_deadline"`
+	PhaseError    string `json:"phase_error"`
+}
+
+// 会话阶段，与协调器一致
+const (
+	PhaseRegistration = "registration" // 等待N个参与方注册和CRS种子协商
+	PhasePublicKey    = "pk"           // 上传公钥份额（调试模式下还有私钥）
+	PhaseRelinRound1  = "rlk_round1"   // 上传重线性化密钥第一轮份额
+	PhaseRelinRound2  = "rlk_round2"   // 上传重线性化密钥第二轮份额
+	PhaseGalois       = "galois"       // 上传伽罗瓦密钥份额
+	PhaseVerification = "verification" // 密钥已全部聚合，协同解密验证密钥
+	PhaseReady        = "ready"        // 密钥验证通过
+	PhaseComputing    = "computing"    // 已有参与方提议解密任务
+	PhaseClosed       = "closed"       // 会话已关闭
+	PhaseFailed       = "failed"       // 阶段超时或密钥验证失败
+)
+
+// SessionPhases 会话阶段的推进顺序，failed 不在其中
+var SessionPhases = []string{
+	PhaseRegistration, PhasePublicKey, PhaseRelinRound1, PhaseRelinRound2, PhaseGalois,
+	PhaseVerification, PhaseReady, PhaseComputing, PhaseClosed,
 }
 
-// KeysResponse 聚合密钥响应
+// CoordinatorEvent 协调器推送的会话事件（GET /events），附带发布时的会话阶段、密钥生成进度和在线参与方
+type CoordinatorEvent struct {
+	ID            uint64          `json:"id"`
+	Type          string          `json:"type"` // snapshot/participant_joined/share_received/key_aggregated/rlk_round1_ready/phase_changed 等
+	Time          time.Time       `json:"time"`
+	Phase         string          `json:"phase"` // 会话阶段，见 SessionPhases
+	ParticipantID int             `json:"participant_id,omitempty"`
+	Key           string          `json:"key,omitempty"` // public/secret/galois/relin
+	GalEl         uint64          `json:"gal_el,omitempty"`
+	Round         int             `json:"round,omitempty"`
+	Status        *StatusResponse `json:"status"`
+	Online        []PeerInfo      `json:"online"`
+}
+
+// KeysHeader 集体密钥响应的控制帧，其后依次为公钥、重线性化密钥和 GaloisElements 对应的伽罗瓦密钥
+type KeysHeader struct {
+	GaloisElements []uint64 `json:"galois_elements"`
+}
+
+// KeysResponse 解码后的集体密钥
 type KeysResponse struct {
-	PubKey     string            `json:"pub_key"`
-	RelineKey  string            `json:"reline_key"`
-	GaloisKeys map[uint64]string `json:"galois_keys"`
+	PubKey     *rlwe.PublicKey
+	RelineKey  *rlwe.RelinearizationKey
+	GaloisKeys []*rlwe.GaloisKey
+}
+
+// DecodeKeys 按控制帧解码集体密钥的对象帧
+func DecodeKeys(header KeysHeader, objects [][]byte) (*KeysResponse, error) {
+	if len(objects) != 2+len(header.GaloisElements) {
+		return nil, fmt.Errorf("密钥消息包含 %d 个对象，应为 %d 个", len(objects), 2+len(header.GaloisElements))
+	}
+
+	keys := &KeysResponse{
+		PubKey:     new(rlwe.PublicKey),
+		RelineKey:  new(rlwe.RelinearizationKey),
+		GaloisKeys: make([]*rlwe.GaloisKey, len(header.GaloisElements)),
+	}
+	if err := keys.PubKey.UnmarshalBinary(objects[0]); err != nil {
+		return nil, fmt.Errorf("反序列化公钥失败: %v", err)
+	}
+	if err := keys.RelineKey.UnmarshalBinary(objects[1]); err != nil {
+		return nil, fmt.Errorf("反序列化重线性化密钥失败: %v", err)
+	}
+	for i, galEl := range header.GaloisElements {
+		gk := new(rlwe.GaloisKey)
+		if err := gk.UnmarshalBinary(objects[2+i]); err != nil {
+			return nil, fmt.Errorf("反序列化伽罗瓦密钥失败 (galEl: %d): %v", galEl, err)
+		}
+		if gk.GaloisElement != galEl {
+			return nil, fmt.Errorf("伽罗瓦密钥的元素 %d 与声明的 %d 不一致", gk.GaloisElement, galEl)
+		}
+		keys.GaloisKeys[i] = gk
+	}
+	return keys, nil
 }
 
 // Participant 参与方主结构体
@@ -88,6 +210,73 @@ type Participant struct {
 // HTTPClient HTTP客户端
 type HTTPClient struct {
 	Client *http.Client
+
+	// 请求签名身份，注册后设置签名方ID
+	Identity *identity.Identity
+	SignerID int
+
+	// Encoding 帧格式消息的请求体压缩编码，也是响应的首选编码
+	Encoding wire.Encoding
+}
+
+// SetSigner 设置请求签名身份和签名方ID
+func (c *HTTPClient) SetSigner(id *identity.Identity, signerID int) {
+	c.Identity = id
+	c.SignerID = signerID
+}
+
+// PostSigned 发送带身份签名的JSON POST请求，未设置签名身份时发送普通请求
+func (c *HTTPClient) PostSigned(url string, body []byte) (*http.Response, error) {
+	return c.PostSignedContext(context.Background(), url, body)
+}
+
+// PostSignedContext 发送带身份签名的JSON POST请求，ctx 取消或超时时中止请求
+func (c *HTTPClient) PostSignedContext(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	if c.Identity == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return c.Client.Do(req)
+	}
+	return c.Identity.PostContext(ctx, c.Client, url, c.SignerID, body)
+}
+
+// PostMessage 发送带身份签名的帧格式消息，签名覆盖压缩后的请求体
+func (c *HTTPClient) PostMessage(url string, control interface{}, objects ...[]byte) (*http.Response, error) {
+	return c.PostMessageContext(context.Background(), url, control, objects...)
+}
+
+// PostMessageContext 发送带身份签名的帧格式消息，ctx 取消或超时时中止请求
+func (c *HTTPClient) PostMessageContext(ctx context.Context, url string, control interface{}, objects ...[]byte) (*http.Response, error) {
+	body, err := c.EncodeMessage(control, objects...)
+	if err != nil {
+		return nil, err
+	}
+	return c.PostEncodedContext(ctx, url, body)
+}
+
+// EncodeMessage 按客户端的压缩编码编码帧格式消息，结果交给 PostEncodedContext 发送
+func (c *HTTPClient) EncodeMessage(control interface{}, objects ...[]byte) ([]byte, error) {
+	return wire.Encode(c.Encoding, control, objects...)
+}
+
+// PostEncodedContext 发送 EncodeMessage 编码好的消息，同一消息发给多个参与方时只编码一次
+func (c *HTTPClient) PostEncodedContext(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	req, err := wire.NewEncodedRequest(ctx, url, c.Encoding, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Identity == nil {
+		return c.Client.Do(req)
+	}
+	return c.Identity.Do(c.Client, req, c.SignerID, body)
+}
+
+// GetMessage 发送接受帧格式响应的GET请求
+func (c *HTTPClient) GetMessage(url string) (*http.Response, error) {
+	return wire.Get(c.Client, url, c.Encoding)
 }
 
 // PeerManager P2P网络管理
@@ -142,13 +331,235 @@ type RefreshTask struct {
 	Ciphertext string `json:"ciphertext"` // base64编码的密文
 }
 
-// RefreshShareResponse 刷新份额响应
-type RefreshShareResponse struct {
-	Share string `json:"share"` // base64编码的刷新份额
-}
+// 单个份额请求（/partial_decrypt、/partial_refresh、/pcks_share）使用帧格式消息：
+// 请求为控制帧和密文信封（公钥切换还有接收方公钥信封），响应为 ShareResponse 和份额信封
 
-// RefreshRequest 刷新请求
+// RefreshRequest 刷新请求的控制帧，刷新CRP由会话种子、任务ID和密文层级派生
 type RefreshRequest struct {
-	TaskID     string `json:"task_id"`
-	Ciphertext string `json:"ciphertext"`
+	TaskID       string `json:"task_id"`
+	Level        int    `json:"level"`                  // 密文层级，参与方据此核对派生CRP使用的层级
+	Participants []int  `json:"participants,omitempty"` // 本次协同操作的活跃参与方集合（门限模式）
+}
+
+// PartialDecryptRequest 部分解密请求的控制帧
+type PartialDecryptRequest struct {
+	TaskID       string `json:"task_id"`
+	Participants []int  `json:"participants,omitempty"` // 本次协同操作的活跃参与方集合（门限模式）
+}
+
+// ShareResponse 单个份额响应的控制帧，其后一帧为份额信封
+type ShareResponse struct{}
+
+// 批量份额请求（/partial_decrypt/batch、/partial_refresh/batch）使用帧格式的二进制消息：
+// 请求首帧为 BatchHeader，之后每个密文两帧（BatchItem 和密文信封）；
+// 响应每个份额两帧（BatchShareHeader 和份额信封，失败时为空帧），按完成顺序返回
+
+// BatchHeader 批量份额请求的首帧
+type BatchHeader struct {
+	Count        int   `json:"count"`                  // 密文数量
+	Participants []int `json:"participants,omitempty"` // 本次协同操作的活跃参与方集合（门限模式）
+	Epoch        int   `json:"epoch,omitempty"`        // 密钥轮换的目标纪元，仅用于轮换密文切换
+	Attempt      int   `json:"attempt,omitempty"`      // 密钥轮换的尝试次数
+}
+
+// BatchItem 批量请求中单个密文的描述
+type BatchItem struct {
+	TaskID string `json:"task_id"`
+	Level  int    `json:"level"` // 密文层级，刷新时核对派生CRP使用的层级
+}
+
+// BatchShareHeader 批量响应中单个份额的描述
+type BatchShareHeader struct {
+	Index   int    `json:"index"`             // 对应请求中密文的序号
+	Error   string `json:"error,omitempty"`   // 该密文失败的原因
+	Refused bool   `json:"refused,omitempty"` // 任务未获授权，换组重试没有意义
+}
+
+// PCKSShareRequest 公钥切换份额请求的控制帧（协调器发起），其后为密文信封和已登记的接收方公钥信封
+type PCKSShareRequest struct {
+	TaskID       string `json:"task_id"`
+	ConsumerID   string `json:"consumer_id"`
+	Participants []int  `json:"participants,omitempty"`
+}
+
+// 解密任务类型
+const (
+	TaskKindDecrypt   = "decrypt"
+	TaskKindReencrypt = "reencrypt"
+)
+
+// TaskInfo 协调器上的解密任务，参与方只为已批准的任务提供份额
+type TaskInfo struct {
+	ID             string `json:"task_id"`
+	Kind           string `json:"kind"`
+	Purpose        string `json:"purpose"`
+	CiphertextHash string `json:"ciphertext_hash"`
+	ConsumerID     string `json:"consumer_id,omitempty"`
+	ConsumerKey    string `json:"consumer_key,omitempty"` // 接收方公钥指纹（十六进制）
+	ProposerID     int    `json:"proposer_id"`
+	Status         string `json:"status"` // pending/approved/rejected
+	Approvals      []int  `json:"approvals"`
+	Rejections     []int  `json:"rejections"`
+	Computation    string `json:"computation,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ExpiresAt      string `json:"expires_at"`
+
+	// 控制面提议的变更（kind 为 policy/outputs）的内容
+	Policy           *TaskPolicy     `json:"policy,omitempty"`
+	CiphertextHashes []string        `json:"ciphertext_hashes,omitempty"`
+	ParticipantIDs   []int           `json:"participant_ids,omitempty"`
+	Galois           json.RawMessage `json:"galois,omitempty"` // 追加的旋转密钥配置
+}
+
+// IsChange 是否为控制面提议的变更（修改授权策略、登记计算输出、加入成员、轮换密钥、追加旋转密钥），而不是解密任务
+func (t *TaskInfo) IsChange() bool {
+	return t.Kind != "decrypt" && t.Kind != "reencrypt"
+}
+
+// TaskPolicy 解密授权策略
+type TaskPolicy struct {
+	RequiredApprovals int `json:"required_approvals"`
+	TaskTTLSeconds    int `json:"task_ttl_seconds"`
+}
+
+// ReencryptResponse 协调器返回的公钥切换结果，控制帧之后一帧为接收方公钥下的密文信封
+type ReencryptResponse struct {
+	ResultID   string `json:"result_id"`
+	ConsumerID string `json:"consumer_id"`
+	CreatedAt  string `json:"created_at"`
+	Ciphertext []byte `json:"-"` // 接收方公钥下的密文信封
+}
+
+// PeerError 协同解密/刷新中某个参与方的失败原因
+type PeerError struct {
+	PeerID int    `json:"peer_id"`
+	Error  string `json:"error"`
+}
+
+// RoundReport 一次协同解密/刷新的参与情况
+type RoundReport struct {
+	Participants []int       `json:"participants"`          // 最终提供份额的活跃集合
+	PeerErrors   []PeerError `json:"peer_errors,omitempty"` // 被排除的参与方及原因
+}
+
+// DecryptAPIRequest 本机接口：对调用方提交的密文进行协同解密
+type DecryptAPIRequest struct {
+	Ciphertexts    []string `json:"ciphertexts"`               // Base64编码的密文信封
+	TaskIDs        []string `json:"task_ids,omitempty"`        // 已批准的任务，与密文一一对应；为空时为每个密文提议任务
+	Purpose        string   `json:"purpose,omitempty"`         // 提议任务时声明的用途
+	Slots          int      `json:"slots,omitempty"`           // 返回前多少个槽，0表示全部
+	Complex        bool     `json:"complex,omitempty"`         // 是否同时返回虚部
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // 整批的超时（包括等待任务批准），0表示默认
+}
+
+// DecryptAPIResult 单个密文的协同解密结果
+type DecryptAPIResult struct {
+	TaskID string    `json:"task_id,omitempty"`
+	Values []float64 `json:"values,omitempty"` // 实部
+	Imag   []float64 `json:"imag,omitempty"`   // 虚部，仅 complex=true 时返回
+	RoundReport
+	Error string `json:"error,omitempty"`
+}
+
+// RefreshAPIRequest 本机接口：对调用方提交的密文进行协同刷新
+type RefreshAPIRequest struct {
+	Ciphertexts    []string `json:"ciphertexts"`               // Base64编码的密文信封
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // 整批的超时，0表示默认
+}
+
+// RefreshAPIResult 单个密文的协同刷新结果
+type RefreshAPIResult struct {
+	TaskID     string `json:"task_id,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"` // Base64编码的刷新后密文信封
+	Level      int    `json:"level"`
+	RoundReport
+	Error string `json:"error,omitempty"`
+}
+
+// CRSStatusResponse CRS种子协商进度
+type CRSStatusResponse struct {
+	SessionID    string `json:"session_id"`
+	Required     bool   `json:"required"`
+	Phase        string `json:"phase"` // commit/reveal/done
+	Commitments  int    `json:"commitments"`
+	Reveals      int    `json:"reveals"`
+	Contributors int    `json:"contributors"`
+}
+
+// ThresholdShareMessage Shamir门限份额消息的控制帧（参与方之间点对点传输），其后一帧为 ShamirSecretShare 的二进制编码
+type ThresholdShareMessage struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// 密钥轮换时为新纪元私钥的份额，初始密钥生成时为0
+	Epoch   int `json:"epoch,omitempty"`
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// GaloisRoundNotice 协调器通知参与方为追加的伽罗瓦元素生成密钥份额
+type GaloisRoundNotice struct {
+	SessionID string   `json:"session_id"`
+	Round     int      `json:"round"`
+	GalEls    []uint64 `json:"gal_els"`
+}
+
+// KeyRotationNotice 协调器通知参与方开始集体密钥轮换
+type KeyRotationNotice struct {
+	SessionID     string   `json:"session_id"`
+	Epoch         int      `json:"epoch"`   // 目标纪元
+	Attempt       int      `json:"attempt"` // 同一纪元的第几次尝试，与纪元一起决定新纪元的CRP
+	GalEls        []uint64 `json:"gal_els"`
+	InsecureDebug bool     `json:"insecure_debug,omitempty"`
+
+	// KeyFingerprint 当前纪元集体公钥的指纹（十六进制），切换请求中的密文信封绑定该指纹
+	KeyFingerprint string `json:"key_fingerprint"`
+
+	// 新纪元的成员（包括加入的参与方）及提交后的成员纪元
+	Members         []int `json:"members"`
+	Joining         []int `json:"joining,omitempty"`
+	MembershipEpoch int   `json:"membership_epoch"`
+}
+
+// KeyRotationStatus 协调器的密钥轮换状态
+type KeyRotationStatus struct {
+	Epoch           int    `json:"epoch"` // 协调器当前的密钥纪元
+	TargetEpoch     int    `json:"target_epoch"`
+	Attempt         int    `json:"attempt"`
+	Phase           string `json:"phase"` // idle/keygen/switch/commit/done/aborted
+	PublicKeyReady  bool   `json:"public_key_ready"`
+	RlkRound1Ready  bool   `json:"rlk_round1_ready"`
+	RlkReady        bool   `json:"rlk_ready"`
+	GaloisKeysReady int    `json:"galois_keys_ready"`
+	TotalGaloisKeys int    `json:"total_galois_keys"`
+	Switched        []int  `json:"switched"`
+	Committed       []int  `json:"committed"`
+	Error           string `json:"error,omitempty"`
+
+	MembershipEpoch int   `json:"membership_epoch"` // 协调器当前的成员纪元
+	Members         []int `json:"members,omitempty"`
+	Joining         []int `json:"joining,omitempty"`
+}
+
+// MembershipResponse 协调器的成员状态（GET /members）
+type MembershipResponse struct {
+	Epoch      int   `json:"epoch"`     // 成员纪元
+	KeyEpoch   int   `json:"key_epoch"` // 密钥纪元
+	Members    []int `json:"members"`
+	Candidates []int `json:"candidates"`
+}
+
+// StoredCiphertextInfo 本方保存的一批密文及其所属的密钥纪元
+type StoredCiphertextInfo struct {
+	From  int    `json:"from"`  // 发送方
+	Kind  string `json:"kind"`  // feature/label
+	Batch int    `json:"batch"` // 批次序号
+	Count int    `json:"count"` // 密文数量
+	Epoch int    `json:"epoch"` // 密文所在的密钥纪元
+}
+
+// CiphertextStatus 参与方的密钥纪元、成员和保存的密文
+type CiphertextStatus struct {
+	KeyEpoch        int                    `json:"key_epoch"`
+	MembershipEpoch int                    `json:"membership_epoch"`
+	Members         []int                  `json:"members"`
+	Ciphertexts     []StoredCiphertextInfo `json:"ciphertexts"`
 }
@@ -1,11 +1,19 @@
 package utils
 
 import (
+	"MPHEDev/pkg/core/envelope"
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/hex"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
 )
 
+// EncodeShare 用gob序列化结构体，仅用于本地持久化（密钥库、CRP）
+// 与协调器和其他参与方交换的对象使用 Lattigo 二进制编码，见 wire 包
 func EncodeShare(share interface{}) ([]byte, error) {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
@@ -15,6 +23,7 @@ func EncodeShare(share interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DecodeShare 反序列化 EncodeShare 的输出
 func DecodeShare(data []byte, share interface{}) error {
 	buf := bytes.NewBuffer(data)
 	dec := gob.NewDecoder(buf)
@@ -28,3 +37,37 @@ func EncodeToBase64(data []byte) string {
 func DecodeFromBase64(s string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(s)
 }
+
+// CiphertextHash 计算密文二进制编码的SHA-256（十六进制），用于把解密任务绑定到具体密文
+func CiphertextHash(ct *rlwe.Ciphertext) (string, error) {
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ==================== 信封编码 ====================
+//
+// 本地保存的密文（接收到的数据集、计算结果）为信封（见 envelope 包）的Base64形式，
+// 解码时校验参数哈希、集体公钥指纹、对象类型和层级，不符时返回错误。
+// 网络传输直接使用信封的二进制，见 wire 包。
+
+// EncodeCiphertext 把集体公钥（指纹为 key）下的密文封装为信封并编码为Base64
+func EncodeCiphertext(params ckks.Parameters, key envelope.Fingerprint, ct *rlwe.Ciphertext) (string, error) {
+	data, err := envelope.SealCiphertext(params, key, ct)
+	if err != nil {
+		return "", err
+	}
+	return EncodeToBase64(data), nil
+}
+
+// DecodeCiphertext 解码Base64密文信封并校验
+func DecodeCiphertext(params ckks.Parameters, key envelope.Fingerprint, s string) (*rlwe.Ciphertext, error) {
+	data, err := DecodeFromBase64(s)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.OpenCiphertext(params, key, data)
+}
@@ -0,0 +1,191 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ==================== 会话迷你CA ====================
+//
+// 每个会话由协调器所在机器生成一个自签名CA，为协调器和每个参与方签发短期证书。
+// 证书同时用于服务端和客户端认证，协调器和参与方之间、参与方之间均使用mTLS。
+
+const (
+	// CAFileName CA证书文件名
+	CAFileName = "ca.crt"
+	// CAKeyFileName CA私钥文件名
+	CAKeyFileName = "ca.key"
+
+	// DefaultCAValidity CA证书默认有效期
+	DefaultCAValidity = 7 * 24 * time.Hour
+	// DefaultCertValidity 会话证书默认有效期
+	DefaultCertValidity = 24 * time.Hour
+)
+
+// CA 会话证书颁发机构
+type CA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewCA 生成新的自签名CA
+func NewCA(commonName string, validity time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成CA私钥失败: %v", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"MPHE"}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("生成CA证书失败: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("解析CA证书失败: %v", err)
+	}
+	return &CA{Cert: cert, key: key}, nil
+}
+
+// LoadCA 从目录载入CA证书和私钥
+func LoadCA(dir string) (*CA, error) {
+	cert, err := readCertificate(filepath.Join(dir, CAFileName))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, CAKeyFileName))
+	if err != nil {
+		return nil, fmt.Errorf("读取CA私钥失败: %v", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("CA私钥不是PEM格式")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析CA私钥失败: %v", err)
+	}
+	return &CA{Cert: cert, key: key}, nil
+}
+
+// Save 保存CA证书和私钥，私钥文件权限为0600
+func (ca *CA) Save(dir string) error {
+	keyDER, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		return fmt.Errorf("序列化CA私钥失败: %v", err)
+	}
+	return writePair(dir, CAFileName, CAKeyFileName, ca.Cert.Raw, keyDER)
+}
+
+// Issue 签发会话证书并保存为 <name>.crt 和 <name>.key
+// hosts 为证书的IP地址或域名（SAN），服务端证书必须包含对方访问时使用的地址
+func (ca *CA) Issue(dir, name string, hosts []string, validity time.Duration) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("证书 %s 至少需要一个IP地址或域名", name)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成私钥失败: %v", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"MPHE"}},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return fmt.Errorf("签发证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("序列化私钥失败: %v", err)
+	}
+	return writePair(dir, name+".crt", name+".key", der, keyDER)
+}
+
+// randomSerial 生成128位随机证书序列号
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("生成证书序列号失败: %v", err)
+	}
+	return serial, nil
+}
+
+// readCertificate 读取PEM格式证书
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取证书失败: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("证书 %s 不是PEM格式", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败: %v", err)
+	}
+	return cert, nil
+}
+
+// writePair 以PEM格式写入证书和私钥
+func writePair(dir, certName, keyName string, certDER, keyDER []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := os.WriteFile(filepath.Join(dir, certName), certPEM, 0644); err != nil {
+		return fmt.Errorf("写入证书失败: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, keyName), keyPEM, 0600); err != nil {
+		return fmt.Errorf("写入私钥失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package pki
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Config 双向TLS配置，nil 表示使用明文HTTP
+type Config struct {
+	pool *x509.CertPool
+	cert tls.Certificate
+}
+
+// Load 载入CA证书和本方证书，三个文件都为空时返回 nil（明文HTTP）
+func Load(caFile, certFile, keyFile string) (*Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if caFile == "" || certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("启用mTLS需要同时指定CA证书、证书和私钥")
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取CA证书失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("CA证书 %s 无效", caFile)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("载入证书失败: %v", err)
+	}
+
+	// 提前校验证书由该CA签发，避免启动后才在握手时失败
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败: %v", err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("证书 %s 未通过CA校验: %v", certFile, err)
+	}
+	if time.Until(leaf.NotAfter) < time.Hour {
+		logs.Printf("[警告] 证书 %s 将于 %s 过期\n", certFile, leaf.NotAfter.Format(time.RFC3339))
+	}
+	return &Config{pool: pool, cert: cert}, nil
+}
+
+// ServerTLS 服务端TLS配置，要求客户端出示同一CA签发的证书
+func (c *Config) ServerTLS() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{c.cert},
+		ClientCAs:    c.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// ClientTLS 客户端TLS配置，只信任会话CA并出示本方证书
+func (c *Config) ClientTLS() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{c.cert},
+		RootCAs:      c.pool,
+	}
+}
+
+// Transport 使用客户端TLS配置的HTTP传输
+func (c *Config) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.ClientTLS()
+	return transport
+}
+
+// Scheme 返回URL协议，未启用mTLS时为 http
+func (c *Config) Scheme() string {
+	if c == nil {
+		return "http"
+	}
+	return "https"
+}
@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"MPHEDev/pkg/core/wire"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pingInterval 协调器在中继连接上发送ping的间隔
+	pingInterval = 30 * time.Second
+	// pongWait 超过该时间没有收到ping/pong或消息时认为连接已断开
+	pongWait = 90 * time.Second
+	// controlWait 发送ping/pong的超时
+	controlWait = 10 * time.Second
+)
+
+// frame 中继连接上一条消息的控制帧，其后的对象帧为请求或响应信封
+type frame struct {
+	ID    uint64 `json:"id"`
+	From  int    `json:"from,omitempty"`  // 请求的发送方，由协调器按请求签名填写
+	Reply bool   `json:"reply,omitempty"` // 是否为响应
+	Error string `json:"error,omitempty"` // 接收方无法处理请求时的错误
+}
+
+// conn 中继连接，写出需要串行
+type conn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// write 写出一条消息：控制帧和信封
+func (c *conn) write(f frame, payload []byte) error {
+	var objects [][]byte
+	if payload != nil {
+		objects = append(objects, payload)
+	}
+	msg, err := wire.EncodeMessage(f, objects...)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// read 读取一条消息，返回控制帧和信封
+func (c *conn) read() (frame, []byte, error) {
+	var f frame
+	for {
+		kind, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return f, nil, err
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		objects, err := wire.ReadMessage(bytes.NewReader(msg), &f)
+		if err != nil {
+			return f, nil, fmt.Errorf("中继消息格式错误: %v", err)
+		}
+		var payload []byte
+		if len(objects) > 0 {
+			payload = objects[0]
+		}
+		return f, payload, nil
+	}
+}
+
+// extendDeadline 收到ping/pong后延长读超时
+func (c *conn) extendDeadline() error {
+	return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+}
+
+// Serve 在参与方一侧处理协调器沿中继连接转发来的请求，直到连接断开或 ctx 取消
+// 请求信封用本方中继密钥打开后交给 handler（本方P2P服务的处理器），响应加密后沿连接发回
+func Serve(ctx context.Context, ws *websocket.Conn, key *Key, handler http.Handler) error {
+	c := &conn{ws: ws}
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+	defer ws.Close()
+
+	c.extendDeadline()
+	ws.SetPingHandler(func(data string) error {
+		c.extendDeadline()
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(controlWait))
+	})
+
+	var handling sync.WaitGroup
+	defer handling.Wait()
+	for {
+		f, payload, err := c.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if f.Reply {
+			continue
+		}
+		handling.Add(1)
+		go func() {
+			defer handling.Done()
+			reply := frame{ID: f.ID, Reply: true}
+			out, err := handle(key, handler, payload)
+			if err != nil {
+				logs.Printf("[中继] 处理参与方 %d 转发的请求失败: %v\n", f.From, err)
+				reply.Error = err.Error()
+			}
+			if err := c.write(reply, out); err != nil {
+				logs.Printf("[中继] 发回响应失败: %v\n", err)
+			}
+		}()
+	}
+}
+
+// handle 打开请求信封，交给处理器并加密响应
+func handle(key *Key, handler http.Handler, sealed []byte) ([]byte, error) {
+	data, responseKey, err := key.OpenRequest(sealed)
+	if err != nil {
+		return nil, err
+	}
+	data, err = ServeRequest(handler, data)
+	if err != nil {
+		return nil, err
+	}
+	return SealResponse(responseKey, data)
+}
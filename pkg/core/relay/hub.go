@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Hub 协调器一侧的中继：登记参与方的中继连接，把请求信封转发给目标参与方并等待响应
+// 协调器只转发信封，无法解密请求和响应
+type Hub struct {
+	mu     sync.Mutex
+	conns  map[int]*hubConn
+	closed bool
+	nextID atomic.Uint64
+}
+
+// hubConn 一个参与方的中继连接和等待响应的请求
+type hubConn struct {
+	conn
+	mu      sync.Mutex
+	pending map[uint64]chan hubResult
+	done    chan struct{}
+}
+
+type hubResult struct {
+	payload []byte
+	err     error
+}
+
+// NewHub 创建中继
+func NewHub() *Hub {
+	return &Hub{conns: make(map[int]*hubConn)}
+}
+
+// Serve 登记参与方的中继连接并读取响应，直到连接断开或中继关闭
+// 同一参与方重新连接时关闭旧连接，旧连接上等待中的请求失败
+func (h *Hub) Serve(participantID int, ws *websocket.Conn) {
+	c := &hubConn{
+		conn:    conn{ws: ws},
+		pending: make(map[uint64]chan hubResult),
+		done:    make(chan struct{}),
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		ws.Close()
+		return
+	}
+	if old, ok := h.conns[participantID]; ok {
+		old.ws.Close()
+	}
+	h.conns[participantID] = c
+	h.mu.Unlock()
+	logs.Printf("[中继] 参与方 %d 已连接\n", participantID)
+
+	defer func() {
+		h.mu.Lock()
+		if h.conns[participantID] == c {
+			delete(h.conns, participantID)
+		}
+		h.mu.Unlock()
+		ws.Close()
+		close(c.done)
+		logs.Printf("[中继] 参与方 %d 已断开\n", participantID)
+	}()
+
+	c.extendDeadline()
+	ws.SetPongHandler(func(string) error { return c.extendDeadline() })
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlWait)); err != nil {
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	for {
+		f, payload, err := c.read()
+		if err != nil {
+			return
+		}
+		if !f.Reply {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[f.ID]
+		delete(c.pending, f.ID)
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if f.Error != "" {
+			ch <- hubResult{err: fmt.Errorf("%s", f.Error)}
+		} else {
+			ch <- hubResult{payload: payload}
+		}
+	}
+}
+
+// Connected 参与方是否持有中继连接
+func (h *Hub) Connected(participantID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.conns[participantID]
+	return ok
+}
+
+// Forward 把 from 发出的请求信封转发给参与方 to，返回响应信封
+func (h *Hub) Forward(ctx context.Context, from, to int, sealed []byte) ([]byte, error) {
+	h.mu.Lock()
+	c, ok := h.conns[to]
+	h.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("参与方 %d 未连接中继", to)
+	}
+
+	id := h.nextID.Add(1)
+	ch := make(chan hubResult, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(frame{ID: id, From: from}, sealed); err != nil {
+		return nil, fmt.Errorf("转发请求失败: %v", err)
+	}
+	select {
+	case res := <-ch:
+		return res.payload, res.err
+	case <-c.done:
+		return nil, fmt.Errorf("参与方 %d 的中继连接已断开", to)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close 关闭全部中继连接，之后的连接立即关闭
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, c := range h.conns {
+		c.ws.Close()
+	}
+}
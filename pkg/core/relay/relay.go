@@ -0,0 +1,216 @@
+// 协调器中继
+// 参与方位于NAT或防火墙之后、其他参与方无法直接访问其上报的URL时，P2P请求经协调器中继：
+// 每个参与方与协调器之间保持一条由参与方发起的WebSocket长连接，协调器把发给该参与方的请求
+// 沿连接转发，再把响应带回。中继的请求端到端加密，协调器只能看到收发双方的ID和密文长度。
+//
+// 请求和响应信封格式：
+//
+//	请求：版本 (1) ‖ 临时X25519公钥 (32) ‖ 随机数 (12) ‖ AES-256-GCM(请求密钥, 序列化的HTTP请求)
+//	响应：随机数 (12) ‖ AES-256-GCM(响应密钥, 序列化的HTTP响应)
+//
+// 请求密钥和响应密钥由临时私钥与接收方中继公钥的X25519共享密钥经HKDF-SHA256派生，每个请求
+// 使用新的临时密钥，只有发送方和接收方能打开请求和伪造响应。中继密钥由参与方身份种子派生，
+// 随URL上报并由身份私钥签名，发送方用接收方的身份公钥核对签名后才使用。
+// 隧道内的请求保留原有的身份签名，接收方照常验证签名并拒绝重放，协调器无法伪造或重放请求。
+package relay
+
+import (
+	"MPHEDev/pkg/core/identity"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// Version 当前请求信封版本
+const Version = 1
+
+// 密钥派生和签名的域分隔标签
+const (
+	domainKey       = "MPHE-RELAY-KEY-v1"
+	domainSignature = "MPHE-RELAY-SIG-v1"
+	infoRequest     = "MPHE-RELAY-v1 request"
+	infoResponse    = "MPHE-RELAY-v1 response"
+)
+
+const (
+	keySize   = 32
+	nonceSize = 12
+)
+
+// Key 参与方的中继密钥（X25519），用于打开发给本方的请求
+type Key struct {
+	priv *ecdh.PrivateKey
+}
+
+// DeriveKey 由身份种子派生中继密钥，同一身份重启后中继公钥不变
+func DeriveKey(seed []byte) (*Key, error) {
+	raw, err := hkdf.Key(sha256.New, seed, nil, domainKey, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("派生中继密钥失败: %v", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("派生中继密钥失败: %v", err)
+	}
+	return &Key{priv: priv}, nil
+}
+
+// PublicKey 中继公钥
+func (k *Key) PublicKey() []byte {
+	return k.priv.PublicKey().Bytes()
+}
+
+// PublicKeyBase64 base64编码的中继公钥，随URL上报
+func (k *Key) PublicKeyBase64() string {
+	return base64.StdEncoding.EncodeToString(k.PublicKey())
+}
+
+// signedMessage 中继公钥签名的内容：域标签、参与方ID和公钥
+func signedMessage(participantID int, key []byte) []byte {
+	msg := []byte(domainSignature + "\n" + strconv.Itoa(participantID) + "\n")
+	return append(msg, key...)
+}
+
+// Sign 以参与方身份签名中继公钥，返回base64编码的签名
+func (k *Key) Sign(id *identity.Identity, participantID int) string {
+	return base64.StdEncoding.EncodeToString(id.Sign(signedMessage(participantID, k.PublicKey())))
+}
+
+// VerifyKey 用参与方身份公钥核对中继公钥的签名，返回解码后的中继公钥
+func VerifyKey(pub ed25519.PublicKey, participantID int, keyB64, sigB64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return nil, fmt.Errorf("中继公钥编码无效: %v", err)
+	}
+	if _, err := ecdh.X25519().NewPublicKey(key); err != nil {
+		return nil, fmt.Errorf("中继公钥无效: %v", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil || !ed25519.Verify(pub, signedMessage(participantID, key), sig) {
+		return nil, fmt.Errorf("参与方 %d 的中继公钥签名无效", participantID)
+	}
+	return key, nil
+}
+
+// deriveKeys 由共享密钥派生请求密钥和响应密钥，盐为临时公钥和接收方公钥
+func deriveKeys(shared, ephemeral, recipient []byte) (requestKey, responseKey []byte, err error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	if requestKey, err = hkdf.Key(sha256.New, shared, salt, infoRequest, keySize); err != nil {
+		return nil, nil, err
+	}
+	if responseKey, err = hkdf.Key(sha256.New, shared, salt, infoResponse, keySize); err != nil {
+		return nil, nil, err
+	}
+	return requestKey, responseKey, nil
+}
+
+// seal 以 AES-256-GCM 加密，返回 随机数 ‖ 密文，additional 为附加认证数据
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// open 解密 seal 的输出
+func open(key, sealed, additional []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceSize+aead.Overhead() {
+		return nil, fmt.Errorf("中继信封过短")
+	}
+	plaintext, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additional)
+	if err != nil {
+		return nil, fmt.Errorf("中继信封解密失败")
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealRequest 用接收方的中继公钥加密请求，返回请求信封和打开响应所需的响应密钥
+func SealRequest(recipient, plaintext []byte) (sealed, responseKey []byte, err error) {
+	recipientKey, err := ecdh.X25519().NewPublicKey(recipient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("中继公钥无效: %v", err)
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成临时密钥失败: %v", err)
+	}
+	shared, err := ephemeral.ECDH(recipientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	requestKey, responseKey, err := deriveKeys(shared, ephemeralPub, recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := append([]byte{Version}, ephemeralPub...)
+	body, err := seal(requestKey, plaintext, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(header, body...), responseKey, nil
+}
+
+// OpenRequest 用本方中继密钥打开请求信封，返回请求和加密响应所需的响应密钥
+func (k *Key) OpenRequest(sealed []byte) (plaintext, responseKey []byte, err error) {
+	headerSize := 1 + keySize
+	if len(sealed) < headerSize {
+		return nil, nil, fmt.Errorf("中继信封过短")
+	}
+	if sealed[0] != Version {
+		return nil, nil, fmt.Errorf("不支持的中继信封版本 %d", sealed[0])
+	}
+	ephemeralPub := sealed[1:headerSize]
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralPub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("临时公钥无效: %v", err)
+	}
+	shared, err := k.priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	requestKey, responseKey, err := deriveKeys(shared, ephemeralPub, k.PublicKey())
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err = open(requestKey, sealed[headerSize:], sealed[:headerSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, responseKey, nil
+}
+
+// SealResponse 用请求派生的响应密钥加密响应
+func SealResponse(responseKey, plaintext []byte) ([]byte, error) {
+	return seal(responseKey, plaintext, nil)
+}
+
+// OpenResponse 打开响应信封
+func OpenResponse(responseKey, sealed []byte) ([]byte, error) {
+	return open(responseKey, sealed, nil)
+}
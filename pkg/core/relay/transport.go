@@ -0,0 +1,175 @@
+package relay
+
+import (
+	"MPHEDev/pkg/core/logs"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Mode 中继模式
+type Mode string
+
+const (
+	ModeAuto   Mode = "auto"   // 先直连，连接不上时改经协调器中继
+	ModeAlways Mode = "always" // 始终经协调器中继，上报的URL为中继地址
+	ModeOff    Mode = "off"    // 只直连，不连接协调器中继
+)
+
+// Scheme 中继地址的URL协议，以 relay://participant-{ID} 上报的参与方只能经中继访问
+const Scheme = "relay"
+
+// ParseMode 解析中继模式，空字符串为 auto
+func ParseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case "", ModeAuto:
+		return ModeAuto, nil
+	case ModeAlways, ModeOff:
+		return Mode(name), nil
+	default:
+		return "", fmt.Errorf("未知的中继模式: %s（可选 auto、always、off）", name)
+	}
+}
+
+// Address 参与方的中继地址，始终经中继时作为URL上报
+func Address(participantID int) string {
+	return fmt.Sprintf("%s://participant-%d", Scheme, participantID)
+}
+
+const (
+	// directDialTimeout 直连参与方的建连超时，超时后改经中继，不等待系统默认的30秒
+	directDialTimeout = 5 * time.Second
+	// directRetryInterval 直连失败后经中继访问该参与方的时长，之后再尝试直连
+	directRetryInterval = 5 * time.Minute
+)
+
+// Transport 访问参与方P2P接口的传输层：目标是已知参与方时按模式直连或经协调器中继，
+// 其他请求（访问协调器等）直接交给 Direct
+type Transport struct {
+	Direct http.RoundTripper
+	Mode   Mode
+	// Lookup 按请求的主机（host:port）查找参与方ID，多个参与方上报相同地址时应返回 false
+	Lookup func(host string) (int, bool)
+	// PeerKey 获取参与方已核对签名的中继公钥，只在需要中继时调用
+	PeerKey func(id int) ([]byte, error)
+	// Forward 把请求信封经协调器转发给参与方，返回响应信封
+	Forward func(ctx context.Context, to int, sealed []byte) ([]byte, error)
+
+	mu      sync.Mutex
+	relayed map[int]time.Time // 直连失败的参与方 -> 恢复尝试直连的时间
+}
+
+// DirectTransport 复制基础传输层并缩短建连超时，base 为空时使用默认传输层
+func DirectTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	t.DialContext = (&net.Dialer{Timeout: directDialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	return t
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	viaRelay := req.URL.Scheme == Scheme
+	if t.Mode == ModeOff || t.Lookup == nil {
+		if viaRelay {
+			return nil, fmt.Errorf("%s 只能经协调器中继访问，但中继已关闭", req.URL.Host)
+		}
+		return t.Direct.RoundTrip(req)
+	}
+	peer, ok := t.Lookup(req.URL.Host)
+	if !ok {
+		if viaRelay {
+			return nil, fmt.Errorf("未知的中继地址 %s", req.URL.Host)
+		}
+		return t.Direct.RoundTrip(req)
+	}
+
+	if !viaRelay && t.Mode == ModeAuto && !t.isRelayed(peer) {
+		// 先直连，只有连接没有建立（请求未发出）时才改经中继，避免重复执行请求
+		retry := req
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return t.Direct.RoundTrip(req)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			retry = req.Clone(req.Context())
+			retry.Body = body
+		}
+		resp, err := t.Direct.RoundTrip(req)
+		if err == nil || !isDialError(err) {
+			return resp, err
+		}
+		logs.Printf("[中继] 无法直连参与方 %d (%v)，改经协调器中继\n", peer, err)
+		t.markRelayed(peer)
+		req = retry
+	}
+	return t.roundTripRelay(req, peer)
+}
+
+// roundTripRelay 加密请求并经协调器转发给参与方
+func (t *Transport) roundTripRelay(req *http.Request, peer int) (*http.Response, error) {
+	key, err := t.PeerKey(peer)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	data, err := EncodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	sealed, responseKey, err := SealRequest(key, data)
+	if err != nil {
+		return nil, err
+	}
+	out, err := t.Forward(req.Context(), peer, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("经协调器中继访问参与方 %d 失败: %v", peer, err)
+	}
+	data, err = OpenResponse(responseKey, out)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeResponse(data, req)
+}
+
+// isRelayed 参与方最近是否直连失败
+func (t *Transport) isRelayed(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.relayed[id]
+	if ok && time.Now().After(until) {
+		delete(t.relayed, id)
+		return false
+	}
+	return ok
+}
+
+func (t *Transport) markRelayed(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.relayed == nil {
+		t.relayed = make(map[int]time.Time)
+	}
+	t.relayed[id] = time.Now().Add(directRetryInterval)
+}
+
+// isDialError 连接是否在发出请求前就失败（拒绝连接、超时、不可达、域名解析失败）
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,88 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// relayRemoteAddr 中继请求在接收方的远端地址，中继请求不经过本方监听的连接
+const relayRemoteAddr = "relay"
+
+// EncodeRequest 序列化HTTP请求：请求行、头部（包括身份签名头）和请求体，会读完并关闭请求体
+func EncodeRequest(req *http.Request) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, fmt.Errorf("序列化中继请求失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ServeRequest 把序列化的请求交给本方的P2P处理器，返回序列化的响应
+// 处理器照常验证请求签名，与直接访问P2P服务没有区别
+func ServeRequest(handler http.Handler, data []byte) ([]byte, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, fmt.Errorf("解析中继请求失败: %v", err)
+	}
+	req.RemoteAddr = relayRemoteAddr
+
+	rec := &recorder{header: make(http.Header)}
+	handler.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	resp := &http.Response{
+		StatusCode:    rec.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          http.NoBody,
+		ContentLength: int64(rec.body.Len()),
+	}
+	if rec.body.Len() > 0 {
+		resp.Body = io.NopCloser(bytes.NewReader(rec.body.Bytes()))
+	}
+	var buf bytes.Buffer
+	if err := resp.Write(&buf); err != nil {
+		return nil, fmt.Errorf("序列化中继响应失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeResponse 解析序列化的响应，req 为对应的请求
+func DecodeResponse(data []byte, req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, fmt.Errorf("解析中继响应失败: %v", err)
+	}
+	return resp, nil
+}
+
+// recorder 记录处理器写出的响应，流式响应在处理器返回后整体发回
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// Flush 流式响应在处理器返回后才发回，刷新无需操作
+func (r *recorder) Flush() {}
@@ -0,0 +1,219 @@
+// 噪声淹没（smudging）参数
+// 协调器和参与方共用的淹没噪声计算和校验规则，双方必须使用完全相同的计算方式。
+//
+// 协同解密和公钥切换的份额为 s_i·c1 + e_i，聚合后的明文带有密文误差，而密文误差与私钥相关。
+// 每个参与方加入的淹没噪声 e_i 必须远大于密文误差，才能在统计意义上掩盖它：
+// 按 σ_smudge ≥ 2^λ · 6σ_ct 计算，统计距离不超过 2^-λ。
+// 密文误差 σ_ct 由参数估计：新鲜公钥加密误差，加上每次重缩放的舍入误差和配置档声明的计算误差。
+// 淹没噪声同时不能超过密文当前层级的模数，否则解密结果错误；两者不能兼顾时拒绝解密。
+//
+// 协同刷新用均匀掩码隐藏 m + e_ct，掩码位数为 λ_refresh + log2(scale)，
+// 密文所在层级的模数必须容纳全部参与方掩码之和。
+package smudging
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/tuneinsight/lattigo/v6/core/rlwe"
+	"github.com/tuneinsight/lattigo/v6/multiparty/mpckks"
+	"github.com/tuneinsight/lattigo/v6/ring"
+	"github.com/tuneinsight/lattigo/v6/schemes/ckks"
+)
+
+// 默认统计安全参数
+const (
+	DefaultStatisticalSecurity = 20
+	DefaultRefreshSecurity     = 128
+)
+
+// 参与方接受的最低统计安全参数，协调器下发更低的配置时拒绝
+const (
+	MinStatisticalSecurity = 16
+	MinRefreshSecurity     = 64
+)
+
+// tailBound 误差的截断界（标准差的倍数）
+const tailBound = 6
+
+// Config 噪声淹没配置，来自会话的参数配置档
+type Config struct {
+	// StatisticalSecurity 协同解密和公钥切换的统计安全参数λ
+	StatisticalSecurity int `json:"statistical_security"`
+	// LogSigma 固定的淹没噪声标准差（log2），0 表示按λ和密文误差估计计算；
+	// 固定值达不到λ时拒绝解密
+	LogSigma float64 `json:"log_sigma,omitempty"`
+	// CircuitNoiseBits 同态计算额外放大的密文误差（比特），深电路输出应按实际电路估计
+	CircuitNoiseBits float64 `json:"circuit_noise_bits,omitempty"`
+	// RefreshSecurity 协同刷新掩码的统计安全参数
+	RefreshSecurity int `json:"refresh_security"`
+}
+
+// DefaultConfig 默认噪声淹没配置
+func DefaultConfig() Config {
+	return Config{
+		StatisticalSecurity: DefaultStatisticalSecurity,
+		RefreshSecurity:     DefaultRefreshSecurity,
+	}
+}
+
+// Normalize 未设置的字段取默认值
+func (c Config) Normalize() Config {
+	if c.StatisticalSecurity == 0 {
+		c.StatisticalSecurity = DefaultStatisticalSecurity
+	}
+	if c.RefreshSecurity == 0 {
+		c.RefreshSecurity = DefaultRefreshSecurity
+	}
+	return c
+}
+
+// Validate 校验配置不低于最低统计安全要求
+func (c Config) Validate() error {
+	c = c.Normalize()
+	if c.StatisticalSecurity < MinStatisticalSecurity {
+		return fmt.Errorf("解密统计安全参数 %d 低于最低要求 %d", c.StatisticalSecurity, MinStatisticalSecurity)
+	}
+	if c.RefreshSecurity < MinRefreshSecurity {
+		return fmt.Errorf("刷新统计安全参数 %d 低于最低要求 %d", c.RefreshSecurity, MinRefreshSecurity)
+	}
+	if c.LogSigma < 0 || c.CircuitNoiseBits < 0 {
+		return fmt.Errorf("log_sigma 和 circuit_noise_bits 不能为负")
+	}
+	return nil
+}
+
+// Estimate 一次协同解密或公钥切换的淹没噪声
+type Estimate struct {
+	LogCiphertextNoise float64 // 密文误差标准差估计（log2）
+	LogSigma           float64 // 每个参与方的淹没噪声标准差（log2）
+	SecurityBits       float64 // 实际达到的统计安全 log2(σ_smudge / 6σ_ct)
+	PrecisionBits      float64 // 解密结果每个槽的剩余精度 log2(scale / (√(k·n)·σ_smudge))，k为参与方数量，n为环维度
+}
+
+// Distribution 淹没噪声分布
+func (e Estimate) Distribution() ring.DiscreteGaussian {
+	sigma := math.Exp2(e.LogSigma)
+	return ring.DiscreteGaussian{Sigma: sigma, Bound: tailBound * sigma}
+}
+
+// String 便于日志输出
+func (e Estimate) String() string {
+	return fmt.Sprintf("σ=2^%.1f（密文误差 2^%.1f，统计安全 %.1f-bit，剩余精度 %.1f-bit）",
+		e.LogSigma, e.LogCiphertextNoise, e.SecurityBits, e.PrecisionBits)
+}
+
+// ForKeySwitch 计算协同解密或公钥切换密文ct所需的淹没噪声
+// parties 为参与方总数N：集体私钥是N个私钥份额之和，活跃集合不超过N，按N估计偏保守
+// 淹没噪声达不到统计安全要求、会超出密文模数或完全覆盖明文时返回错误
+func ForKeySwitch(params ckks.Parameters, cfg Config, ct *rlwe.Ciphertext, parties int) (Estimate, error) {
+	cfg = cfg.Normalize()
+	if parties < 1 {
+		parties = 1
+	}
+	level := ct.Level()
+
+	est := Estimate{LogCiphertextNoise: logCiphertextNoise(params, level, parties) + cfg.CircuitNoiseBits}
+	logBound := est.LogCiphertextNoise + math.Log2(tailBound)
+	if cfg.LogSigma > 0 {
+		est.LogSigma = cfg.LogSigma
+		est.SecurityBits = est.LogSigma - logBound
+	} else {
+		est.LogSigma = logBound + float64(cfg.StatisticalSecurity)
+		est.SecurityBits = float64(cfg.StatisticalSecurity)
+	}
+	// 各参与方噪声之和的系数标准差为 √k·σ，解码到槽时再放大约 √n 倍
+	logTotal := est.LogSigma + 0.5*math.Log2(float64(parties))
+	est.PrecisionBits = math.Log2(ct.Scale.Float64()) - logTotal - 0.5*math.Log2(float64(params.N()))
+
+	if est.SecurityBits < float64(cfg.StatisticalSecurity) {
+		return est, fmt.Errorf("淹没噪声 2^%.1f 只达到 %.1f-bit 统计安全，低于要求的 %d-bit（密文误差估计 2^%.1f）",
+			est.LogSigma, est.SecurityBits, cfg.StatisticalSecurity, est.LogCiphertextNoise)
+	}
+	if logQ := logModulus(params, level); logTotal+math.Log2(tailBound) >= logQ-1 {
+		return est, fmt.Errorf("层级 %d 的模数 2^%.1f 不足以容纳 2^%.1f 的淹没噪声，请在更高层级解密", level, logQ, est.LogSigma)
+	}
+	if est.PrecisionBits <= 0 {
+		return est, fmt.Errorf("淹没噪声 2^%.1f 相对密文缩放因子 2^%.1f 过大，解密结果没有有效精度",
+			est.LogSigma, math.Log2(ct.Scale.Float64()))
+	}
+	return est, nil
+}
+
+// RefreshMask 计算协同刷新密文ct的掩码位数和份额误差分布
+// 层级模数容纳不下N个掩码之和时返回错误
+func RefreshMask(params ckks.Parameters, cfg Config, ct *rlwe.Ciphertext, parties int) (uint, ring.DiscreteGaussian, error) {
+	cfg = cfg.Normalize()
+	if parties < 1 {
+		parties = 1
+	}
+
+	// 掩码直接隐藏 m + e_ct，份额误差只需覆盖两次密钥切换的新鲜误差
+	noise := freshNoise(params)
+
+	minLevel, logBound, ok := mpckks.GetMinimumLevelForRefresh(cfg.RefreshSecurity, ct.Scale, parties, params.Q())
+	if !ok {
+		return 0, noise, fmt.Errorf("模数链不足以容纳 %d-bit 统计安全的刷新掩码", cfg.RefreshSecurity)
+	}
+	if ct.Level() < minLevel {
+		return 0, noise, fmt.Errorf("层级 %d 的模数不足以容纳 %d-bit 统计安全的刷新掩码（至少需要层级 %d）",
+			ct.Level(), cfg.RefreshSecurity, minLevel)
+	}
+	return logBound, noise, nil
+}
+
+// ForRotation 密钥轮换时把密文从旧集体私钥切换到新集体私钥的份额误差分布
+// 轮换份额为 (s_i - s'_i)·c1 + e_i，切换后的密文仍在新集体私钥下加密，不会直接解密，
+// 份额只需按RLWE假设隐藏 s_i - s'_i，误差取新鲜误差即可；使用解密的淹没噪声会使之后的解密失去精度。
+// 密文误差只在后续解密时由解密份额的淹没噪声掩盖
+func ForRotation(params ckks.Parameters) ring.DiscreteGaussian {
+	return freshNoise(params)
+}
+
+// freshNoise 两倍新鲜误差标准差的离散高斯分布
+func freshNoise(params ckks.Parameters) ring.DiscreteGaussian {
+	sigma := 2 * rlwe.DefaultNoise
+	if xe, ok := params.Xe().(ring.DiscreteGaussian); ok {
+		sigma = 2 * xe.Sigma
+	}
+	return ring.DiscreteGaussian{Sigma: sigma, Bound: tailBound * sigma}
+}
+
+// logCiphertextNoise 估计层级level的密文误差标准差（log2）
+// 新鲜公钥加密：e = u·e_pk + e0 + e1·s，集体公钥误差和集体私钥都是k个参与方份额之和，
+// 方差约 Var(e)·(1 + 2·n·k·Var(s))，n为环维度；每次重缩放再加入方差约 (1 + n·k·Var(s))/12 的舍入误差
+func logCiphertextNoise(params ckks.Parameters, level, parties int) float64 {
+	n := float64(params.N())
+	varS := variance(params.Xs(), n)
+	varE := variance(params.Xe(), n)
+	k := float64(parties)
+
+	fresh := varE * (1 + 2*n*k*varS)
+	rescale := (1 + n*k*varS) / 12
+	consumed := float64(params.MaxLevel() - level)
+	return 0.5 * math.Log2(fresh+consumed*rescale)
+}
+
+// variance 分布的单个系数方差
+func variance(dist ring.DistributionParameters, n float64) float64 {
+	switch d := dist.(type) {
+	case ring.Ternary:
+		if d.H > 0 {
+			return float64(d.H) / n
+		}
+		return d.P
+	case ring.DiscreteGaussian:
+		return d.Sigma * d.Sigma
+	default:
+		return 1
+	}
+}
+
+// logModulus 层级level的模数 log2(q_0·…·q_level)
+func logModulus(params ckks.Parameters, level int) float64 {
+	logQ := 0.0
+	for _, q := range params.Q()[:level+1] {
+		logQ += math.Log2(float64(q))
+	}
+	return logQ
+}
@@ -0,0 +1,199 @@
+package wire
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding 消息体的内容编码（压缩算法）
+type Encoding string
+
+// 支持的内容编码
+const (
+	Identity Encoding = "identity" // 不压缩
+	Gzip     Encoding = "gzip"
+	Zstd     Encoding = "zstd"
+)
+
+// preferred 响应协商时同等权重下的优先顺序
+var preferred = []Encoding{Zstd, Gzip, Identity}
+
+// MaxBodySize 解压后的消息体长度上限，防止压缩炸弹
+const MaxBodySize = 1 << 30
+
+// ErrUnsupportedEncoding 不支持的内容编码
+var ErrUnsupportedEncoding = errors.New("不支持的内容编码")
+
+// ParseEncoding 解析内容编码名称，空字符串和 none 表示不压缩
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "identity", "none":
+		return Identity, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedEncoding, name)
+}
+
+// Supported 支持的内容编码列表，415响应的 Accept-Encoding 头
+func Supported() string {
+	return "zstd, gzip, identity"
+}
+
+// AcceptEncoding 客户端请求头 Accept-Encoding 的取值，优先使用 enc
+// 显式设置该头后 net/http 不再自动解压响应，由 ResponseBody 按实际编码解压
+func AcceptEncoding(enc Encoding) string {
+	if enc == "" || enc == Identity {
+		return string(Identity)
+	}
+	values := []string{string(enc)}
+	for _, other := range preferred {
+		if other != enc && other != Identity {
+			values = append(values, string(other)+";q=0.5")
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// Negotiate 按 Accept-Encoding 选择响应编码：权重最高的已支持编码，同等权重按 preferred 顺序
+// 头部为空或没有可接受的压缩编码时不压缩
+func Negotiate(acceptEncoding string) Encoding {
+	best, bestQ := Identity, 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		enc, err := ParseEncoding(name)
+		if err != nil || name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && rank(enc) < rank(best)) {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// rank 编码在 preferred 中的位置
+func rank(enc Encoding) int {
+	for i, e := range preferred {
+		if e == enc {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+// nopWriteCloser 不压缩时的写出器
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewWriter 返回按 enc 压缩写入 w 的写出器，Close 写出压缩尾部但不关闭 w
+func NewWriter(w io.Writer, enc Encoding) (io.WriteCloser, error) {
+	switch enc {
+	case "", Identity:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, enc)
+}
+
+// NewReader 返回按 enc 解压 r 的读取器，解压后超过 MaxBodySize 时读取失败
+func NewReader(r io.Reader, enc Encoding) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	switch enc {
+	case "", Identity:
+		rc = io.NopCloser(r)
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip 解压失败: %v", err)
+		}
+		rc = zr
+	case Zstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MaxBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("zstd 解压失败: %v", err)
+		}
+		rc = zr.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, enc)
+	}
+	return &limitedReader{rc: rc, remaining: MaxBodySize}, nil
+}
+
+// limitedReader 限制解压后长度的读取器
+type limitedReader struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, fmt.Errorf("解压后的消息体超过上限 %d", MaxBodySize)
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.rc.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func (l *limitedReader) Close() error { return l.rc.Close() }
+
+// Compress 按 enc 压缩整个消息体
+func Compress(enc Encoding, data []byte) ([]byte, error) {
+	if enc == "" || enc == Identity {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, enc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress 按 enc 解压整个消息体
+func Decompress(enc Encoding, data []byte) ([]byte, error) {
+	if enc == "" || enc == Identity {
+		return data, nil
+	}
+	r, err := NewReader(bytes.NewReader(data), enc)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("解压消息体失败: %v", err)
+	}
+	return out, nil
+}
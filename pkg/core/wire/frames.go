@@ -0,0 +1,58 @@
+// 二进制传输格式
+// 协调器和参与方共用的密钥份额、评估密钥和密文的传输格式，JSON只用于控制信息。
+//
+// 消息由若干帧组成，每帧为4字节大端长度加内容：
+//
+//	控制帧（JSON）‖ 对象帧 ‖ 对象帧 ‖ ...
+//
+// 对象帧是 Lattigo 的二进制编码（MarshalBinary/WriteTo），密文和份额是绑定集体公钥的信封
+// （见 envelope 包），对象的含义和顺序由各接口的控制帧说明。
+// 消息体可以整体压缩（gzip/zstd），请求用 Content-Encoding 声明，响应按 Accept-Encoding 协商。
+// 请求签名覆盖实际传输（压缩后）的字节，接收方先验证签名再解压。
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ContentType 帧格式消息的Content-Type
+const ContentType = "application/x-mphe-frames"
+
+// MaxFrameSize 单帧长度上限，防止恶意长度导致分配过大内存
+const MaxFrameSize = 256 << 20
+
+// WriteFrame 写出一帧
+func WriteFrame(w io.Writer, data []byte) error {
+	if len(data) > MaxFrameSize {
+		return fmt.Errorf("帧长度 %d 超过上限 %d", len(data), MaxFrameSize)
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadFrame 读取一帧，数据正好在帧边界结束时返回 io.EOF
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("帧长度不完整")
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > MaxFrameSize {
+		return nil, fmt.Errorf("帧长度 %d 超过上限 %d", size, MaxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("帧内容不完整: %v", err)
+	}
+	return data, nil
+}
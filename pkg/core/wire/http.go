@@ -0,0 +1,221 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsupportedMediaType 请求不是帧格式消息
+var ErrUnsupportedMediaType = errors.New("请求须为帧格式消息 (" + ContentType + ")")
+
+// StatusCode 读取请求失败时应返回的HTTP状态码：格式或编码不支持为415，其他为400
+func StatusCode(err error) int {
+	if errors.Is(err, ErrUnsupportedMediaType) || errors.Is(err, ErrUnsupportedEncoding) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// ==================== 客户端 ====================
+
+// NewRequest 构造帧格式消息的POST请求，消息体按 enc 压缩
+// 返回的消息体与请求实际发送的字节一致，供请求签名使用
+func NewRequest(ctx context.Context, url string, enc Encoding, control interface{}, objects ...[]byte) (*http.Request, []byte, error) {
+	body, err := Encode(enc, control, objects...)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := NewEncodedRequest(ctx, url, enc, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, body, nil
+}
+
+// Encode 把控制信息和对象编码为帧格式消息并按 enc 压缩
+func Encode(enc Encoding, control interface{}, objects ...[]byte) ([]byte, error) {
+	message, err := EncodeMessage(control, objects...)
+	if err != nil {
+		return nil, err
+	}
+	return Compress(enc, message)
+}
+
+// NewEncodedRequest 用已按 enc 压缩的消息体构造POST请求，同一消息发给多个接收方时只需编码一次
+func NewEncodedRequest(ctx context.Context, url string, enc Encoding, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if enc != "" && enc != Identity {
+		req.Header.Set("Content-Encoding", string(enc))
+	}
+	SetAccept(req, enc)
+	return req, nil
+}
+
+// SetAccept 声明请求方可接受帧格式响应和 enc 优先的压缩编码
+func SetAccept(req *http.Request, enc Encoding) {
+	req.Header.Set("Accept", ContentType+", application/json")
+	req.Header.Set("Accept-Encoding", AcceptEncoding(enc))
+}
+
+// Get 发送接受帧格式响应的GET请求
+func Get(client *http.Client, url string, enc Encoding) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	SetAccept(req, enc)
+	return client.Do(req)
+}
+
+// Accepts 请求方是否接受帧格式响应，同时服务浏览器等JSON客户端的接口据此选择响应格式
+func Accepts(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if IsFramed(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseBody 返回解压后的帧格式响应体，响应不是帧格式时返回错误
+func ResponseBody(resp *http.Response) (io.ReadCloser, error) {
+	if !IsFramed(resp.Header.Get("Content-Type")) {
+		return nil, fmt.Errorf("响应不是帧格式消息: %s", resp.Header.Get("Content-Type"))
+	}
+	enc, err := ParseEncoding(resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(resp.Body, enc)
+}
+
+// ReadResponse 读取帧格式响应，控制帧解析到 control，返回其后的对象
+func ReadResponse(resp *http.Response, control interface{}) ([][]byte, error) {
+	body, err := ResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ReadMessage(body, control)
+}
+
+// ==================== 服务端 ====================
+
+// DecodeBody 按 Content-Encoding 解压已读出的请求体，用解压结果替换 r.Body 并移除该头
+// 认证中间件验证签名（覆盖压缩后的字节）之后调用，之后的处理器直接读取明文消息
+func DecodeBody(r *http.Request, body []byte) ([]byte, error) {
+	enc, err := ParseEncoding(r.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	if enc != Identity {
+		if body, err = Decompress(enc, body); err != nil {
+			return nil, err
+		}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = int64(len(body))
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RequestBody 返回解压后的帧格式请求体，请求不是帧格式或编码不支持时返回错误
+func RequestBody(r *http.Request) (io.ReadCloser, error) {
+	if !IsFramed(r.Header.Get("Content-Type")) {
+		return nil, ErrUnsupportedMediaType
+	}
+	enc, err := ParseEncoding(r.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(r.Body, enc)
+}
+
+// ReadRequest 读取帧格式请求，控制帧解析到 control，返回其后的对象
+func ReadRequest(r *http.Request, control interface{}) ([][]byte, error) {
+	body, err := RequestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ReadMessage(body, control)
+}
+
+// WriteUnsupported 写出415响应，并在 Accept-Encoding 头中列出支持的编码
+func WriteUnsupported(w http.ResponseWriter, err error) {
+	w.Header().Set("Accept-Encoding", Supported())
+	http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+}
+
+// ResponseWriter 帧格式响应的写出器，按请求的 Accept-Encoding 协商压缩编码
+type ResponseWriter struct {
+	w       http.ResponseWriter
+	enc     io.WriteCloser
+	flusher http.Flusher
+}
+
+// NewResponseWriter 写出响应头并返回帧写出器，写完后必须调用 Close
+func NewResponseWriter(w http.ResponseWriter, r *http.Request, status int) (*ResponseWriter, error) {
+	enc := Negotiate(r.Header.Get("Accept-Encoding"))
+	writer, err := NewWriter(w, enc)
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Add("Vary", "Accept-Encoding")
+	if enc != Identity {
+		w.Header().Set("Content-Encoding", string(enc))
+	}
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	return &ResponseWriter{w: w, enc: writer, flusher: flusher}, nil
+}
+
+// WriteFrame 写出一帧
+func (rw *ResponseWriter) WriteFrame(data []byte) error {
+	return WriteFrame(rw.enc, data)
+}
+
+// Flush 把已写出的帧发送给请求方，流式响应每写完一组帧调用一次
+func (rw *ResponseWriter) Flush() error {
+	if f, ok := rw.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if rw.flusher != nil {
+		rw.flusher.Flush()
+	}
+	return nil
+}
+
+// Close 结束压缩流
+func (rw *ResponseWriter) Close() error {
+	return rw.enc.Close()
+}
+
+// WriteResponse 以帧格式写出完整的200响应，消息编码失败时尚未写出任何内容，调用方可以改写错误响应
+func WriteResponse(w http.ResponseWriter, r *http.Request, control interface{}, objects ...[]byte) error {
+	message, err := EncodeMessage(control, objects...)
+	if err != nil {
+		return err
+	}
+	rw, err := NewResponseWriter(w, r, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if _, err := rw.enc.Write(message); err != nil {
+		rw.Close()
+		return err
+	}
+	return rw.Close()
+}
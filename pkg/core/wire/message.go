@@ -0,0 +1,94 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxObjects 单条消息的对象帧数量上限
+const MaxObjects = 1 << 16
+
+// EncodeMessage 把控制信息和对象编码为帧格式消息
+func EncodeMessage(control interface{}, objects ...[]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, control, objects...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMessage 写出帧格式消息：控制帧和各个对象帧
+func WriteMessage(w io.Writer, control interface{}, objects ...[]byte) error {
+	if len(objects) > MaxObjects {
+		return fmt.Errorf("对象数量 %d 超过上限 %d", len(objects), MaxObjects)
+	}
+	header, err := json.Marshal(control)
+	if err != nil {
+		return fmt.Errorf("控制信息序列化失败: %v", err)
+	}
+	if err := WriteFrame(w, header); err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := WriteFrame(w, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMessage 读取帧格式消息，控制帧解析到 control（为空时忽略），返回其后的全部对象
+func ReadMessage(r io.Reader, control interface{}) ([][]byte, error) {
+	header, err := ReadFrame(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("消息缺少控制帧")
+		}
+		return nil, err
+	}
+	if control != nil {
+		if err := json.Unmarshal(header, control); err != nil {
+			return nil, fmt.Errorf("控制信息解析失败: %v", err)
+		}
+	}
+	var objects [][]byte
+	for {
+		obj, err := ReadFrame(r)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) == MaxObjects {
+			return nil, fmt.Errorf("对象数量超过上限 %d", MaxObjects)
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// ControlFrame 返回请求体中的JSON控制信息：帧格式消息为控制帧，其他请求为整个请求体
+// 用于认证中间件核对请求声明的发送方，消息格式错误时返回空
+func ControlFrame(contentType string, body []byte) []byte {
+	if !IsFramed(contentType) {
+		return body
+	}
+	if len(body) < 4 {
+		return nil
+	}
+	size := binary.BigEndian.Uint32(body[:4])
+	if uint64(size) > uint64(len(body)-4) {
+		return nil
+	}
+	return body[4 : 4+size]
+}
+
+// IsFramed Content-Type 是否为帧格式
+func IsFramed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), ContentType)
+}